@@ -98,12 +98,12 @@ func showModelInfo(c *cli.Context) error {
 
 var modelGetCmd = &cli.Command{
 	Name:  "get",
-	Usage: "Download a model from a URL",
+	Usage: "Download a model from a URL or a Hugging Face reference",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:     "url",
 			Aliases:  []string{"u"},
-			Usage:    "URL of the model to download",
+			Usage:    "URL of the model to download, or a Hugging Face reference such as hf://org/repo:Q4_K_M",
 			Required: true,
 		},
 		&cli.StringFlag{
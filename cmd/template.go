@@ -0,0 +1,389 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+	"github.com/hybridgroup/yzma/pkg/message"
+	"github.com/hybridgroup/yzma/pkg/template"
+	"github.com/urfave/cli/v2"
+)
+
+var TemplateCmd = &cli.Command{
+	Name:  "template",
+	Usage: "Inspect, render and check chat templates",
+	Subcommands: []*cli.Command{
+		templateShowCmd,
+		templateRenderCmd,
+		templateCheckCmd,
+		templateDiffCmd,
+	},
+}
+
+// templateFlags select the template: a built-in template or a template file,
+// else the chat template of a model.
+var templateFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "model",
+		Aliases: []string{"m"},
+		Usage:   "path to the model file",
+	},
+	&cli.StringFlag{
+		Name:    "template",
+		Aliases: []string{"t"},
+		Usage:   "built-in template name or path to a jinja template file",
+	},
+	&cli.StringFlag{
+		Name:    "lib",
+		Aliases: []string{"l"},
+		Usage:   "path to llama.cpp compiled library files",
+		EnvVars: []string{"YZMA_LIB"},
+	},
+}
+
+var conversationFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "messages",
+		Aliases:  []string{"f"},
+		Usage:    "path to a JSON file with an array of OpenAI messages, or an object with messages and tools",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:  "tools",
+		Usage: "path to a JSON file with an array of OpenAI tool definitions",
+	},
+	&cli.BoolFlag{
+		Name:  "add-generation-prompt",
+		Usage: "end the prompt with the start of an assistant message",
+		Value: true,
+	},
+}
+
+var templateShowCmd = &cli.Command{
+	Name:  "show",
+	Usage: "Print the chat template of a model or a built-in template",
+	Flags: templateFlags,
+	Action: func(c *cli.Context) error {
+		return runTemplateShow(c)
+	},
+}
+
+var templateRenderCmd = &cli.Command{
+	Name:  "render",
+	Usage: "Render a conversation with a chat template and print the prompt",
+	Flags: append(append([]cli.Flag{}, templateFlags...), conversationFlags...),
+	Action: func(c *cli.Context) error {
+		return runTemplateRender(c)
+	},
+}
+
+var templateCheckCmd = &cli.Command{
+	Name:  "check",
+	Usage: "Check that a chat template renders standard conversations completely",
+	Flags: templateFlags,
+	Action: func(c *cli.Context) error {
+		return runTemplateCheck(c)
+	},
+}
+
+var templateDiffCmd = &cli.Command{
+	Name:  "diff",
+	Usage: "Compare the prompts rendered by llama.cpp and by the jinja engine",
+	Flags: append(append([]cli.Flag{}, templateFlags...), conversationFlags...),
+	Action: func(c *cli.Context) error {
+		return runTemplateDiff(c)
+	},
+}
+
+// chatTemplate is the template selected by the template flags.
+type chatTemplate struct {
+	// name is the built-in template name, empty for other templates.
+	name string
+
+	tmpl  *template.Template
+	model llama.Model
+}
+
+func (t *chatTemplate) close() {
+	if t.model != 0 {
+		llama.ModelFree(t.model)
+	}
+}
+
+// loadTemplate loads the template selected by the template flags. The model
+// is loaded when given, for its template or its vocabulary, and needs the
+// llama.cpp library.
+func loadTemplate(c *cli.Context) (*chatTemplate, error) {
+	var t chatTemplate
+	if c.String("model") != "" {
+		if err := llama.Load(c.String("lib")); err != nil {
+			return nil, fmt.Errorf("unable to load library: %w", err)
+		}
+		llama.LogSet(llama.LogSilent())
+		llama.Init()
+
+		params := llama.ModelDefaultParams()
+		params.VocabOnly = 1
+		model, err := llama.ModelLoadFromFile(c.String("model"), params)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load model from file %s: %w", c.String("model"), err)
+		}
+		t.model = model
+	}
+
+	var err error
+	switch name := c.String("template"); {
+	case name != "":
+		if source, ok := template.BuiltinTemplate(name); ok {
+			t.name = name
+			t.tmpl, err = template.Compile(source)
+			break
+		}
+		source, readErr := os.ReadFile(name)
+		if readErr != nil {
+			err = fmt.Errorf("%q is neither a built-in template nor a readable file: %w", name, readErr)
+			break
+		}
+		t.tmpl, err = template.Compile(string(source))
+	case t.model != 0:
+		t.tmpl, err = template.ForModel(t.model)
+	default:
+		err = errors.New("either --model or --template is required")
+	}
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	return &t, nil
+}
+
+func runTemplateShow(c *cli.Context) error {
+	t, err := loadTemplate(c)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	fmt.Println(t.tmpl.Source())
+	return nil
+}
+
+func runTemplateCheck(c *cli.Context) error {
+	t, err := loadTemplate(c)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	report := template.Check(t.tmpl.Source())
+	fmt.Print(report.String())
+	if !report.OK() {
+		return errors.New("template check failed")
+	}
+	return nil
+}
+
+func runTemplateRender(c *cli.Context) error {
+	t, err := loadTemplate(c)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	msgs, tools, err := loadConversation(c.String("messages"), c.String("tools"))
+	if err != nil {
+		return err
+	}
+
+	opts := template.DefaultOptions()
+	opts.Tools = tools
+	if t.model != 0 {
+		opts.SetSpecialTokens(llama.ModelGetVocab(t.model))
+	}
+	prompt, err := t.tmpl.RenderWithOptions(msgs, c.Bool("add-generation-prompt"), opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(prompt)
+	if t.model != 0 {
+		tokens := llama.Tokenize(llama.ModelGetVocab(t.model), prompt, false, true)
+		fmt.Printf("\n%d tokens\n", len(tokens))
+	}
+	return nil
+}
+
+func runTemplateDiff(c *cli.Context) error {
+	if c.String("model") == "" {
+		// llama.ChatApplyTemplate needs the library, which is loaded with
+		// the model.
+		if err := llama.Load(c.String("lib")); err != nil {
+			return fmt.Errorf("unable to load library: %w", err)
+		}
+	}
+	t, err := loadTemplate(c)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	msgs, tools, err := loadConversation(c.String("messages"), c.String("tools"))
+	if err != nil {
+		return err
+	}
+	add := c.Bool("add-generation-prompt")
+
+	opts := template.DefaultOptions()
+	opts.Tools = tools
+	jinjaPrompt, err := t.tmpl.RenderWithOptions(msgs, add, opts)
+	if err != nil {
+		return fmt.Errorf("jinja: %w", err)
+	}
+
+	// llama.cpp renders the templates it knows by name, and detects the
+	// others from their source.
+	name := t.name
+	if name == "" {
+		name = t.tmpl.Source()
+	}
+	llamaPrompt, err := chatApplyTemplate(name, msgs, add)
+	if err != nil {
+		return err
+	}
+
+	if llamaPrompt == jinjaPrompt {
+		fmt.Printf("identical prompts (%d bytes)\n", len(jinjaPrompt))
+		return nil
+	}
+	fmt.Println("--- llama.cpp")
+	fmt.Println("+++ jinja")
+	fmt.Print(diffLines(llamaPrompt, jinjaPrompt))
+	return errors.New("prompts differ")
+}
+
+// chatApplyTemplate renders msgs with the built-in template engine of
+// llama.cpp, which only sees the role and text of the messages.
+func chatApplyTemplate(tmpl string, msgs []message.Message, add bool) (string, error) {
+	chat := make([]llama.ChatMessage, len(msgs))
+	size := 0
+	for i, m := range msgs {
+		content, _ := m.GetContent()["content"].(string)
+		chat[i] = llama.NewChatMessage(m.GetRole(), content)
+		size += len(m.GetRole()) + len(content)
+	}
+
+	buf := make([]byte, 2*size+1024)
+	n := llama.ChatApplyTemplate(tmpl, chat, add, buf)
+	if int(n) > len(buf) {
+		buf = make([]byte, n)
+		n = llama.ChatApplyTemplate(tmpl, chat, add, buf)
+	}
+	if n < 0 {
+		return "", errors.New("llama.cpp does not support this template")
+	}
+	return string(buf[:n]), nil
+}
+
+// loadConversation reads the messages file, which holds an array of OpenAI
+// messages or a chat completion request with messages and tools, and the
+// optional tools file.
+func loadConversation(messagesFile, toolsFile string) ([]message.Message, []message.ToolDefinition, error) {
+	data, err := os.ReadFile(messagesFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var req struct {
+		Messages []message.OpenAIMessage  `json:"messages"`
+		Tools    []message.ToolDefinition `json:"tools"`
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &req.Messages)
+	} else {
+		err = json.Unmarshal(data, &req)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", messagesFile, err)
+	}
+
+	if toolsFile != "" {
+		data, err := os.ReadFile(toolsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal(data, &req.Tools); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", toolsFile, err)
+		}
+	}
+
+	msgs, err := message.FromOpenAI(req.Messages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", messagesFile, err)
+	}
+	return msgs, req.Tools, nil
+}
+
+// diffLines returns a line diff of a and b, with the lines of a prefixed
+// with "-", those of b with "+" and the common lines with " ".
+func diffLines(a, b string) string {
+	x := splitLines(a)
+	y := splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	line := func(prefix, s string) {
+		sb.WriteString(prefix)
+		sb.WriteString(strings.TrimSuffix(s, "\n"))
+		sb.WriteString("\n")
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			line(" ", x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("-", x[i])
+			i++
+		default:
+			line("+", y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		line("-", x[i])
+	}
+	for ; j < len(y); j++ {
+		line("+", y[j])
+	}
+	return sb.String()
+}
+
+// splitLines splits s after each newline, without an empty last line.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
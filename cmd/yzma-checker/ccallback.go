@@ -213,6 +213,8 @@ type Callback struct {
 var callbackTags = map[string]string{
 	// LogSilent is named for what it does, not for what it implements.
 	"llama.LogSilent": "ggml_log_callback",
+	// The scheduler's eval callback is known to llama.h only as cb_eval.
+	"llama.evalCallbackCif": "ggml_backend_sched_eval_callback",
 }
 
 // cPrefixes are the library prefixes a yzma identifier drops.
@@ -11,7 +11,7 @@ var (
 	modelFile    *string
 	prompt       *string
 	systemPrompt *string
-	template     *string
+	templateName *string
 	libPath      *string
 	verbose      *bool
 
@@ -37,7 +37,7 @@ func handleFlags() error {
 	modelFile = flag.String("model", "", "model file to use")
 	prompt = flag.String("p", "", "prompt")
 	systemPrompt = flag.String("sys", "", "system prompt")
-	template = flag.String("template", "", "template name")
+	templateName = flag.String("template", "", "built-in template name, e.g. chatml (default is the model chat template)")
 	libPath = flag.String("lib", "", "path to llama.cpp compiled library files")
 	verbose = flag.Bool("v", false, "verbose logging")
 
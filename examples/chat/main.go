@@ -2,11 +2,15 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"slices"
 
 	"github.com/hybridgroup/yzma/pkg/llama"
+	"github.com/hybridgroup/yzma/pkg/message"
+	"github.com/hybridgroup/yzma/pkg/template"
 )
 
 var (
@@ -14,8 +18,12 @@ var (
 	model   llama.Model
 	lctx    llama.Context
 	sampler llama.Sampler
+	tmpl    *template.Template
 
-	messages []llama.ChatMessage
+	// messages is the conversation, and history the part of it that the KV
+	// cache already holds.
+	messages []message.Message
+	history  []message.Message
 )
 
 func main() {
@@ -97,28 +105,25 @@ func main() {
 	samplers := []llama.SamplerType{llama.SamplerTypeTopK, llama.SamplerTypeTopP, llama.SamplerTypeMinP, llama.SamplerTypeTemperature}
 	sampler = llama.NewSampler(model, samplers, sp)
 
-	if *template == "" {
-		*template = llama.ModelChatTemplate(model, "")
-	}
-	if *template == "" {
-		*template = "chatml"
+	tmpl, err = loadTemplate()
+	if err != nil {
+		fmt.Println("unable to load chat template", err.Error())
+		os.Exit(1)
 	}
 
-	messages = make([]llama.ChatMessage, 0)
 	if *systemPrompt != "" {
-		messages = append(messages, llama.NewChatMessage("system", *systemPrompt))
+		messages = append(messages, message.Chat{Role: "system", Content: *systemPrompt})
 	}
 
 	// single message
 	if len(*prompt) > 0 {
-		messages = append(messages, llama.NewChatMessage("user", *prompt))
-		chat(chatTemplate(true), true)
+		messages = append(messages, message.Chat{Role: "user", Content: *prompt})
+		turn()
 
 		return
 	}
 
 	// chat session
-	first := true
 	for {
 		fmt.Print("USER> ")
 		reader := bufio.NewReader(os.Stdin)
@@ -128,13 +133,58 @@ func main() {
 			os.Exit(1)
 		}
 
-		messages = append(messages, llama.NewChatMessage("user", pmpt))
-		chat(chatTemplate(true), first)
-		first = false
+		messages = append(messages, message.Chat{Role: "user", Content: pmpt})
+		turn()
+	}
+}
+
+// loadTemplate returns the built-in template named by the -template flag,
+// else the chat template of the model or the built-in matching its name,
+// else the chatml template.
+func loadTemplate() (*template.Template, error) {
+	if *templateName != "" {
+		src, ok := template.BuiltinTemplate(*templateName)
+		if !ok {
+			return nil, fmt.Errorf("unknown template %q", *templateName)
+		}
+		return template.Compile(src)
+	}
+
+	t, err := template.ForModel(model)
+	if errors.Is(err, template.ErrNoChatTemplate) {
+		src, _ := template.BuiltinTemplate("chatml")
+		return template.Compile(src)
+	}
+	return t, err
+}
+
+// turn decodes the messages that the KV cache does not hold yet, and adds
+// the answer of the model to the conversation.
+func turn() {
+	text, err := tmpl.RenderDelta(history, messages)
+	first := len(history) == 0
+	switch {
+	case errors.Is(err, template.ErrHistoryRewritten):
+		// The template renders the history differently now, so decode
+		// the whole conversation again.
+		mem, err := llama.GetMemory(lctx)
+		if err != nil {
+			fmt.Println("unable to get memory", err.Error())
+			os.Exit(1)
+		}
+		llama.MemoryClear(mem, true)
+		first = true
+	case err != nil:
+		fmt.Println("unable to apply chat template", err.Error())
+		os.Exit(1)
 	}
+
+	response := chat(text, first)
+	messages = append(messages, message.Chat{Role: "assistant", Content: response})
+	history = slices.Clone(messages)
 }
 
-func chat(text string, first bool) {
+func chat(text string, first bool) string {
 	tokens := llama.Tokenize(vocab, text, first, true)
 
 	batch := llama.BatchGetOne(tokens)
@@ -173,11 +223,5 @@ func chat(text string, first bool) {
 	}
 
 	fmt.Println()
-}
-
-func chatTemplate(add bool) string {
-	buf := make([]byte, 1024)
-	len := llama.ChatApplyTemplate(*template, messages, add, buf)
-	result := string(buf[:len])
-	return result
+	return response
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+var (
+	modelFile    *string
+	libPath      *string
+	positiveFile *string
+	negativeFile *string
+	outputFile   *string
+	verbose      *bool
+
+	method      *string
+	cvecMethod  llama.ControlVectorMethod
+	iterations  *int
+	threadCount *int
+)
+
+func showUsage() {
+	fmt.Println(`
+Usage:
+cvector -model [model file path] -lib [llama.cpp .so file path] -positive [positive prompts file] -negative [negative prompts file] -o [output file] -method [pca|mean] -v`)
+}
+
+func handleFlags() error {
+	modelFile = flag.String("model", "", "model file to use")
+	libPath = flag.String("lib", "", "path to llama.cpp compiled library files")
+	positiveFile = flag.String("positive", "", "file with one positive prompt per line")
+	negativeFile = flag.String("negative", "", "file with one negative prompt per line")
+	outputFile = flag.String("o", "control_vector.gguf", "output control vector file")
+	verbose = flag.Bool("v", false, "verbose logging")
+
+	method = flag.String("method", "pca", "method used to compute the directions (pca, mean)")
+	iterations = flag.Int("pca-iter", 1000, "maximum number of power iterations for pca")
+	threadCount = flag.Int("t", 0, "number of threads to use (0 = default)")
+
+	flag.Parse()
+
+	if len(*modelFile) == 0 {
+		return errors.New("missing model flag")
+	}
+
+	if len(*positiveFile) == 0 || len(*negativeFile) == 0 {
+		return errors.New("missing positive or negative flag")
+	}
+
+	if len(*libPath) == 0 && os.Getenv("YZMA_LIB") != "" {
+		*libPath = os.Getenv("YZMA_LIB")
+	}
+
+	if len(*libPath) == 0 {
+		return errors.New("missing lib flag or YZMA_LIB env var")
+	}
+
+	switch *method {
+	case "pca":
+		cvecMethod = llama.ControlVectorMethodPCA
+	case "mean":
+		cvecMethod = llama.ControlVectorMethodMean
+	default:
+		return fmt.Errorf("unknown method %q", *method)
+	}
+
+	return nil
+}
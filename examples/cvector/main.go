@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if err := handleFlags(); err != nil {
+		showUsage()
+		return err
+	}
+
+	positive, err := readPrompts(*positiveFile)
+	if err != nil {
+		return err
+	}
+
+	negative, err := readPrompts(*negativeFile)
+	if err != nil {
+		return err
+	}
+
+	if len(positive) != len(negative) {
+		return fmt.Errorf("%d positive prompts but %d negative prompts", len(positive), len(negative))
+	}
+
+	pairs := make([]llama.ControlVectorPromptPair, len(positive))
+	for i := range positive {
+		pairs[i] = llama.ControlVectorPromptPair{Positive: positive[i], Negative: negative[i]}
+	}
+
+	if err := llama.Load(*libPath); err != nil {
+		return fmt.Errorf("unable to load library: %w", err)
+	}
+
+	if !*verbose {
+		llama.LogSet(llama.LogSilent())
+	}
+
+	llama.Init()
+	defer llama.Close()
+
+	model, err := llama.ModelLoadFromFile(*modelFile, llama.ModelDefaultParams())
+	if err != nil {
+		return fmt.Errorf("unable to load model from file %s: %v", *modelFile, err)
+	}
+	defer llama.ModelFree(model)
+
+	params := llama.ControlVectorGenerateDefaultParams()
+	params.Method = cvecMethod
+	params.PCAIterations = *iterations
+	params.NThreads = int32(*threadCount)
+
+	fmt.Printf("Generating control vector from %d prompt pairs using %s...\n", len(pairs), params.Method)
+
+	cv, err := llama.ControlVectorGenerate(model, pairs, params)
+	if err != nil {
+		return fmt.Errorf("unable to generate control vector: %w", err)
+	}
+
+	arch, _ := llama.ModelMetaValStr(model, "general.architecture")
+	if err := llama.ControlVectorSave(cv, *outputFile, arch); err != nil {
+		return fmt.Errorf("unable to save control vector: %w", err)
+	}
+
+	fmt.Printf("Wrote %d layers of %d dimensions to %s\n", cv.NLayers(), cv.NEmbd, *outputFile)
+
+	return nil
+}
+
+// readPrompts reads one prompt per line, expanding "\n" escapes so that a
+// prompt can span several lines, for example to include a chat template.
+func readPrompts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prompts []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prompts = append(prompts, strings.ReplaceAll(line, `\n`, "\n"))
+	}
+
+	return prompts, scanner.Err()
+}
@@ -68,50 +68,26 @@ func main() {
 	runToolConversation(ctx, model, vocab, sampler, chatTemplate, tools)
 }
 
-// formatToolsForPrompt formats the tool definitions as a JSON string for the system prompt
-func formatToolsForPrompt(tools []message.ToolDefinition) string {
-	toolsJSON, err := json.MarshalIndent(tools, "", "  ")
-	if err != nil {
-		return "[]"
-	}
-	return string(toolsJSON)
-}
-
 func runToolConversation(ctx llama.Context, model llama.Model, vocab llama.Vocab, sampler llama.Sampler, chatTemplate string, tools []message.ToolDefinition) {
 	fmt.Println("=== Tool Calling Example ===")
 	fmt.Println()
 	fmt.Printf("User: %s\n", *userQuestion)
 	fmt.Println()
 
-	// Format tools as JSON for the system prompt
-	toolsJSON := formatToolsForPrompt(tools)
-
-	// Build system prompt with tool definitions
-	systemPrompt := fmt.Sprintf(`You are a helpful assistant with access to the following tools:
-
-%s
-
-When you need to use a tool, respond with a tool call in the following format:
-<tool_call>
-{"name": "function_name", "arguments": {"arg1": "value1", "arg2": "value2"}}
-</tool_call>
-
-After receiving tool results, provide a final answer to the user.`, toolsJSON)
-
-	// Step 1: Create initial message with user question
+	// Step 1: Create initial message with user question. The chat template
+	// describes the tools to the model.
 	messages := []message.Message{
-		message.Chat{
-			Role:    "system",
-			Content: systemPrompt,
-		},
 		message.Chat{
 			Role:    "user",
 			Content: *userQuestion,
 		},
 	}
 
+	opts := template.DefaultOptions()
+	opts.Tools = tools
+
 	// Apply template and generate response
-	prompt, err := template.Apply(chatTemplate, messages, true)
+	prompt, err := template.ApplyWithOptions(chatTemplate, messages, true, opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to apply template: %v\n", err)
 		return
@@ -163,7 +139,7 @@ After receiving tool results, provide a final answer to the user.`, toolsJSON)
 
 		// Step 3: Generate final response with tool results
 		fmt.Println("=== Final Response ===")
-		prompt, err = template.Apply(chatTemplate, messages, true)
+		prompt, err = template.ApplyWithOptions(chatTemplate, messages, true, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to apply template: %v\n", err)
 			return
@@ -28,6 +28,7 @@ func buildCommands() []*cli.Command {
 		cmd.SystemCmd,
 		cmd.LlamaCmd,
 		cmd.ModelCmd,
+		cmd.TemplateCmd,
 		versionCmd,
 		infoCmd,
 	}
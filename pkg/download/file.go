@@ -0,0 +1,343 @@
+package download
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	getter "github.com/hashicorp/go-getter"
+)
+
+// PartialSuffix is appended to the name of a file while it is downloaded.
+const PartialSuffix = ".partial"
+
+// validatorSuffix is appended to the name of the partial file for the file
+// that holds the ETag or Last-Modified validator of the download, so that a
+// resumed download does not join two versions of a file.
+const validatorSuffix = ".etag"
+
+// ChecksumError is returned when a downloaded file does not have the
+// expected SHA-256 digest. The partial file is removed, so that the next
+// attempt downloads the file again from the start.
+type ChecksumError struct {
+	// File is the path the file was to be saved to.
+	File string
+
+	// Want and Got are the expected and actual digests, in hex.
+	Want string
+	Got  string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: want sha256 %s, got %s", e.File, e.Want, e.Got)
+}
+
+// FileOptions controls how DownloadFile downloads a file.
+type FileOptions struct {
+	// SHA256 is the expected SHA-256 digest of the file, in hex. If empty,
+	// the digest is read from the <url>.sha256 sidecar file when the server
+	// has one, else the file is not verified.
+	SHA256 string
+
+	// Header holds extra request headers, such as Authorization.
+	Header http.Header
+
+	// Progress tracks the progress of the download, if not nil.
+	Progress getter.ProgressTracker
+}
+
+// DownloadFile downloads url to the file dest. The data is written to
+// dest + PartialSuffix, which is renamed to dest once complete and verified,
+// so that dest never holds a partial file. If the partial file exists from an
+// interrupted download, the download resumes from its end with an HTTP Range
+// request, which is conditional on the ETag or Last-Modified validator of the
+// interrupted download; the download starts over if the file has changed
+// since. Without a validator the download only resumes if the digest is
+// known. A file that fails verification returns a *ChecksumError.
+func DownloadFile(ctx context.Context, url, dest string, opts FileOptions) error {
+	want := strings.ToLower(opts.SHA256)
+	if want == "" {
+		want = sidecarDigest(ctx, url, opts.Header)
+	}
+
+	// A complete file with the expected digest is not downloaded again.
+	if want != "" {
+		if got, err := fileDigest(dest); err == nil && got == want {
+			return nil
+		}
+	}
+
+	partial := dest + PartialSuffix
+	validatorFile := partial + validatorSuffix
+	h := sha256.New()
+	offset, err := hashFile(partial, h)
+	if err != nil {
+		return err
+	}
+
+	// Without a validator, a changed file cannot be told apart from the
+	// rest of the interrupted one unless the digest is known.
+	validator := readValidator(validatorFile)
+	if offset > 0 && validator == "" && want == "" {
+		offset = 0
+		h.Reset()
+	}
+
+	resp, err := rangeGet(ctx, url, offset, validator, opts.Header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file already holds the whole file, unless it is larger.
+		if size, ok := rangeSize(resp.Header.Get("Content-Range")); !ok || size != offset {
+			removePartial(partial)
+			return fmt.Errorf("downloading %s: partial file %s does not match, removed it", url, partial)
+		}
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("downloading %s: unexpected range %q", url, resp.Header.Get("Content-Range"))
+		}
+		if err := appendBody(partial, resp, offset, h, url, opts.Progress); err != nil {
+			return err
+		}
+	default:
+		// The server ignored the range, or the file has changed since the
+		// partial file was written: start over.
+		h.Reset()
+		if err := writeValidator(validatorFile, resp); err != nil {
+			return err
+		}
+		if err := appendBody(partial, resp, 0, h, url, opts.Progress); err != nil {
+			return err
+		}
+	}
+
+	if want != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			removePartial(partial)
+			return &ChecksumError{File: dest, Want: want, Got: got}
+		}
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		return err
+	}
+	os.Remove(validatorFile)
+	return nil
+}
+
+// readValidator returns the validator stored in name, or "" if there is none.
+func readValidator(name string) string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeValidator stores the validator of resp in name: its ETag if strong,
+// else its Last-Modified date. If resp has neither, name is removed.
+func writeValidator(name string, resp *http.Response) error {
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(name, []byte(validator+"\n"), 0644)
+}
+
+// removePartial removes the partial file and its validator.
+func removePartial(partial string) {
+	os.Remove(partial)
+	os.Remove(partial + validatorSuffix)
+}
+
+// rangeGet requests url from offset on, and checks the response status. The
+// range is conditional on validator, if not empty, so that a server sends
+// the whole file if it has changed.
+func rangeGet(ctx context.Context, url string, offset int64, validator string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not download file: %s not found", url)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		resp.Body.Close()
+		return nil, fmt.Errorf("received status code %d from %s", resp.StatusCode, url)
+	}
+	return resp, nil
+}
+
+// rangeSize returns the size of the file in a Content-Range header of the
+// form "bytes */<size>".
+func rangeSize(contentRange string) (int64, bool) {
+	s, ok := strings.CutPrefix(contentRange, "bytes */")
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	return size, err == nil
+}
+
+// appendBody writes the body of resp to the partial file from offset on,
+// and adds it to h. On error the partial file is kept, so that the download
+// can resume.
+func appendBody(partial string, resp *http.Response, offset int64, h hash.Hash, url string, progress getter.ProgressTracker) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	out, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	body := resp.Body
+	if progress != nil && resp.ContentLength >= 0 {
+		if tracked := progress.TrackProgress(url, offset, offset+resp.ContentLength, body); tracked != nil {
+			body = tracked
+			defer body.Close()
+		}
+	}
+
+	if _, err := io.Copy(io.MultiWriter(out, h), body); err != nil {
+		out.Close()
+		return fmt.Errorf("downloading %s: %w", url, err)
+	}
+	return out.Close()
+}
+
+// hashFile adds the contents of name to h and returns its size. A missing
+// file has size zero.
+func hashFile(name string, h hash.Hash) (int64, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(h, bufio.NewReader(f))
+}
+
+// fileDigest returns the SHA-256 digest of name, in hex.
+func fileDigest(name string) (string, error) {
+	h := sha256.New()
+	if _, err := os.Stat(name); err != nil {
+		return "", err
+	}
+	if _, err := hashFile(name, h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sidecarDigest returns the digest in the <url>.sha256 file, in the format
+// of sha256sum, or "" if the server has no such file. Servers answer
+// differently for missing files, some with an HTML page and a 200 status, so
+// any failure to get a digest from it means none.
+func sidecarDigest(ctx context.Context, url string, header http.Header) string {
+	sidecar := url + ".sha256"
+	if i := strings.Index(url, "?"); i >= 0 {
+		sidecar = url[:i] + ".sha256" + url[i:]
+	}
+	resp, err := rangeGet(ctx, sidecar, 0, "", header)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || !isSHA256(fields[0]) {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+func isSHA256(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == sha256.Size*2
+}
+
+// checksumParam splits the go-getter style checksum parameter off url, as in
+// https://example.com/model.gguf?checksum=sha256:<hex>, and returns the url
+// without it and the digest. ok is false if the url needs go-getter: for a
+// checksum other than sha256:<hex>, such as md5:, sha1:, sha512: or file:,
+// for the archive and filename parameters, or for an archive file name.
+func checksumParam(url string) (src, digest string, ok bool) {
+	base, query, _ := strings.Cut(url, "?")
+	for ext := range getter.Decompressors {
+		if strings.HasSuffix(base, "."+ext) {
+			return "", "", false
+		}
+	}
+	if query == "" {
+		return url, "", true
+	}
+
+	var rest []string
+	for _, kv := range strings.Split(query, "&") {
+		key, v, _ := strings.Cut(kv, "=")
+		switch key {
+		case "checksum":
+			d, ok := strings.CutPrefix(v, "sha256:")
+			if !ok || !isSHA256(d) {
+				return "", "", false
+			}
+			digest = strings.ToLower(d)
+		case "archive", "filename":
+			return "", "", false
+		default:
+			rest = append(rest, kv)
+		}
+	}
+	if len(rest) > 0 {
+		base += "?" + strings.Join(rest, "&")
+	}
+	return base, digest, true
+}
+
+// isHTTP reports whether url is a plain HTTP(S) URL, which DownloadFile can
+// download, rather than a go-getter source.
+func isHTTP(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
@@ -0,0 +1,378 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testModel = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileServer serves data, or testModel if nil, at /model.gguf, with Range
+// support and the etag if set, and records the Range header of each request.
+// If dropAt is set, the first response stops after dropAt bytes, as a
+// dropped connection.
+type fileServer struct {
+	data    []byte
+	etag    string
+	dropAt  int
+	sidecar string
+	ranges  []string
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/model.gguf":
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		data := s.data
+		if data == nil {
+			data = testModel
+		}
+		if s.etag != "" {
+			w.Header().Set("ETag", s.etag)
+		}
+		if s.dropAt > 0 {
+			drop := s.dropAt
+			s.dropAt = 0
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:drop])
+			w.(http.Flusher).Flush()
+			// Returning early with a short body makes the client fail with
+			// an unexpected EOF.
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "model.gguf", time.Time{}, bytes.NewReader(data))
+	case "/model.gguf.sha256":
+		if s.sidecar == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(s.sidecar))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	srv := &fileServer{}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	err := DownloadFile(context.Background(), server.URL+"/model.gguf", dest, FileOptions{SHA256: sha256Hex(testModel)})
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testModel) {
+		t.Error("downloaded file differs from the served file")
+	}
+	if _, err := os.Stat(dest + PartialSuffix); !os.IsNotExist(err) {
+		t.Error("partial file left behind")
+	}
+
+	// A verified file is not downloaded again.
+	if err := DownloadFile(context.Background(), server.URL+"/model.gguf", dest, FileOptions{SHA256: sha256Hex(testModel)}); err != nil {
+		t.Fatalf("second DownloadFile failed: %v", err)
+	}
+	if len(srv.ranges) != 1 {
+		t.Errorf("got %d downloads, want 1", len(srv.ranges))
+	}
+}
+
+func TestDownloadFile_Resume(t *testing.T) {
+	srv := &fileServer{dropAt: 10000}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	url := server.URL + "/model.gguf"
+	opts := FileOptions{SHA256: sha256Hex(testModel)}
+
+	if err := DownloadFile(context.Background(), url, dest, opts); err == nil {
+		t.Fatal("DownloadFile with a dropped connection succeeded, want an error")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatal("destination file exists after a failed download")
+	}
+	info, err := os.Stat(dest + PartialSuffix)
+	if err != nil {
+		t.Fatalf("partial file missing: %v", err)
+	}
+	if info.Size() != 10000 {
+		t.Fatalf("partial file has %d bytes, want 10000", info.Size())
+	}
+
+	if err := DownloadFile(context.Background(), url, dest, opts); err != nil {
+		t.Fatalf("resumed DownloadFile failed: %v", err)
+	}
+	if want := []string{"", "bytes=10000-"}; len(srv.ranges) != 2 || srv.ranges[1] != want[1] {
+		t.Errorf("ranges = %q, want %q", srv.ranges, want)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testModel) {
+		t.Error("resumed file differs from the served file")
+	}
+}
+
+func TestDownloadFile_CompletePartial(t *testing.T) {
+	srv := &fileServer{}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	// The connection dropped after the last byte, before the rename.
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(dest+PartialSuffix, testModel, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadFile(context.Background(), server.URL+"/model.gguf", dest, FileOptions{SHA256: sha256Hex(testModel)}); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if want := []string{"bytes=" + strconv.Itoa(len(testModel)) + "-"}; len(srv.ranges) != 1 || srv.ranges[0] != want[0] {
+		t.Errorf("ranges = %q, want %q", srv.ranges, want)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testModel) {
+		t.Error("file differs from the served file")
+	}
+}
+
+func TestDownloadFile_ResumeValidator(t *testing.T) {
+	srv := &fileServer{etag: `"v1"`, dropAt: 10000}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	url := server.URL + "/model.gguf"
+
+	if err := DownloadFile(context.Background(), url, dest, FileOptions{}); err == nil {
+		t.Fatal("DownloadFile with a dropped connection succeeded, want an error")
+	}
+	if err := DownloadFile(context.Background(), url, dest, FileOptions{}); err != nil {
+		t.Fatalf("resumed DownloadFile failed: %v", err)
+	}
+	if len(srv.ranges) != 2 || srv.ranges[1] != "bytes=10000-" {
+		t.Errorf("ranges = %q, want a resumed download", srv.ranges)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testModel) {
+		t.Error("resumed file differs from the served file")
+	}
+	if _, err := os.Stat(dest + PartialSuffix + validatorSuffix); !os.IsNotExist(err) {
+		t.Error("validator file left behind")
+	}
+}
+
+func TestDownloadFile_ChangedFile(t *testing.T) {
+	changed := bytes.Repeat([]byte("B"), 1000)
+
+	for _, tt := range []struct {
+		name string
+		etag string
+	}{
+		{"changed etag", `"v2"`},
+		{"no validator", ""},
+	} {
+		srv := &fileServer{data: bytes.Repeat([]byte("A"), 1000), dropAt: 400}
+		if tt.etag != "" {
+			srv.etag = `"v1"`
+		}
+		server := httptest.NewServer(srv)
+
+		dest := filepath.Join(t.TempDir(), "model.gguf")
+		url := server.URL + "/model.gguf"
+		if err := DownloadFile(context.Background(), url, dest, FileOptions{}); err == nil {
+			t.Fatalf("%s: DownloadFile with a dropped connection succeeded, want an error", tt.name)
+		}
+
+		// The file changes before the download is resumed.
+		srv.data, srv.etag = changed, tt.etag
+		if err := DownloadFile(context.Background(), url, dest, FileOptions{}); err != nil {
+			t.Fatalf("%s: DownloadFile failed: %v", tt.name, err)
+		}
+		data, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, changed) {
+			t.Errorf("%s: got a file of %d bytes starting with %q, want the changed file", tt.name, len(data), data[:min(len(data), 8)])
+		}
+		server.Close()
+	}
+}
+
+func TestDownloadFile_ChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(&fileServer{})
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	want := strings.Repeat("0", 64)
+	err := DownloadFile(context.Background(), server.URL+"/model.gguf", dest, FileOptions{SHA256: want})
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("DownloadFile error = %v, want a *ChecksumError", err)
+	}
+	if checksumErr.Want != want || checksumErr.Got != sha256Hex(testModel) {
+		t.Errorf("ChecksumError = %+v", checksumErr)
+	}
+	for _, name := range []string{dest, dest + PartialSuffix} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s exists after a checksum mismatch", name)
+		}
+	}
+}
+
+func TestDownloadFile_Sidecar(t *testing.T) {
+	srv := &fileServer{sidecar: strings.Repeat("a", 64) + "  model.gguf\n"}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	url := server.URL + "/model.gguf"
+
+	var checksumErr *ChecksumError
+	if err := DownloadFile(context.Background(), url, dest, FileOptions{}); !errors.As(err, &checksumErr) {
+		t.Fatalf("DownloadFile with a wrong sidecar digest error = %v, want a *ChecksumError", err)
+	}
+
+	srv.sidecar = strings.ToUpper(sha256Hex(testModel)) + "  model.gguf\n"
+	if err := DownloadFile(context.Background(), url, dest, FileOptions{}); err != nil {
+		t.Fatalf("DownloadFile with the sidecar digest failed: %v", err)
+	}
+}
+
+func TestDownloadFile_HTMLSidecar(t *testing.T) {
+	// Some servers answer a missing file with a page and a 200 status.
+	srv := &fileServer{sidecar: "<!DOCTYPE html><html><body>Not Found</body></html>"}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "model.gguf")
+	if err := DownloadFile(context.Background(), server.URL+"/model.gguf", dest, FileOptions{}); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testModel) {
+		t.Error("downloaded file differs from the served file")
+	}
+}
+
+func TestChecksumParam(t *testing.T) {
+	digest := sha256Hex(testModel)
+	tests := map[string][2]string{
+		"https://example.com/m.gguf":                               {"https://example.com/m.gguf", ""},
+		"https://example.com/m.gguf?checksum=sha256:" + digest:     {"https://example.com/m.gguf", digest},
+		"https://example.com/m.gguf?a=1&checksum=sha256:" + digest: {"https://example.com/m.gguf?a=1", digest},
+		"https://example.com/m.gguf?download=true":                 {"https://example.com/m.gguf?download=true", ""},
+	}
+	for url, want := range tests {
+		src, got, ok := checksumParam(url)
+		if !ok {
+			t.Errorf("checksumParam(%q) needs go-getter, want a direct download", url)
+			continue
+		}
+		if src != want[0] || got != want[1] {
+			t.Errorf("checksumParam(%q) = %q, %q, want %q, %q", url, src, got, want[0], want[1])
+		}
+	}
+
+	for _, url := range []string{
+		"https://example.com/m.gguf?checksum=md5:0cc175b9c0f1b6a831c399e269772661",
+		"https://example.com/m.gguf?checksum=sha512:abc",
+		"https://example.com/m.gguf?checksum=file:https://example.com/SHA256SUMS",
+		"https://example.com/m.gguf?checksum=sha256:xyz",
+		"https://example.com/m.gguf?filename=model.gguf",
+		"https://example.com/m.tar.gz?checksum=sha256:" + digest,
+		"https://example.com/m?archive=zip",
+	} {
+		if _, _, ok := checksumParam(url); ok {
+			t.Errorf("checksumParam(%q) is a direct download, want go-getter", url)
+		}
+	}
+}
+
+func TestGetModel_Checksum(t *testing.T) {
+	server := httptest.NewServer(&fileServer{})
+	defer server.Close()
+
+	dest := t.TempDir()
+	url := server.URL + "/model.gguf?checksum=sha256:" + sha256Hex(testModel)
+	if err := GetModelWithProgress(url, dest, nil); err != nil {
+		t.Fatalf("GetModelWithProgress failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "model.gguf")); err != nil {
+		t.Errorf("model not downloaded: %v", err)
+	}
+
+	var checksumErr *ChecksumError
+	url = server.URL + "/model.gguf?checksum=sha256:" + strings.Repeat("1", 64)
+	if err := GetModelWithProgress(url, t.TempDir(), nil); !errors.As(err, &checksumErr) {
+		t.Errorf("GetModelWithProgress error = %v, want a *ChecksumError", err)
+	}
+}
+
+func TestGetModel_GetterChecksum(t *testing.T) {
+	server := httptest.NewServer(&fileServer{})
+	defer server.Close()
+
+	sum := md5.Sum(testModel)
+	digest := hex.EncodeToString(sum[:])
+
+	dest := t.TempDir()
+	if err := GetModelWithProgress(server.URL+"/model.gguf?checksum=md5:"+digest, dest, nil); err != nil {
+		t.Fatalf("GetModelWithProgress with an md5 checksum failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "model.gguf"))
+	if err != nil {
+		t.Fatalf("model not downloaded: %v", err)
+	}
+	if !bytes.Equal(data, testModel) {
+		t.Error("downloaded file differs from the served file")
+	}
+
+	url := server.URL + "/model.gguf?checksum=md5:" + strings.Repeat("0", 32)
+	if err := GetModelWithProgress(url, t.TempDir(), nil); err == nil {
+		t.Error("GetModelWithProgress with a wrong md5 checksum succeeded, want an error")
+	}
+
+	dest = t.TempDir()
+	if err := GetModelWithProgress(server.URL+"/model.gguf?filename=renamed.gguf", dest, nil); err != nil {
+		t.Fatalf("GetModelWithProgress with a filename failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "renamed.gguf")); err != nil {
+		t.Errorf("model not downloaded to its filename: %v", err)
+	}
+}
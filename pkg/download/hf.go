@@ -0,0 +1,437 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	getter "github.com/hashicorp/go-getter"
+)
+
+var (
+	ErrInvalidHFRef = errors.New("invalid Hugging Face reference, want hf://org/repo[@revision][:quant]")
+	ErrNoGGUF       = errors.New("no matching GGUF file in repository")
+	ErrHFNotFound   = errors.New("not found on Hugging Face, check the repository and revision, and HF_TOKEN for gated models")
+)
+
+// HFScheme is the scheme of Hugging Face model references.
+const HFScheme = "hf://"
+
+// DefaultQuant is the quantization picked when a reference does not name
+// one, as in llama.cpp.
+const DefaultQuant = "Q4_K_M"
+
+// HFRef is a reference to a GGUF model in a Hugging Face repository, such as
+// hf://bartowski/Qwen_Qwen3-VL-2B-Instruct-GGUF:Q4_K_M.
+type HFRef struct {
+	// Repo is the repository, e.g. "bartowski/Qwen_Qwen3-VL-2B-Instruct-GGUF".
+	Repo string
+
+	// Revision is the branch, tag or commit to download from. It defaults
+	// to "main".
+	Revision string
+
+	// Quant is the quantization, e.g. "Q4_K_M". Empty means DefaultQuant,
+	// or the only GGUF file of the repository.
+	Quant string
+}
+
+// IsHFRef reports whether s is a Hugging Face model reference.
+func IsHFRef(s string) bool {
+	return strings.HasPrefix(s, HFScheme)
+}
+
+// ParseHFRef parses a reference of the form hf://org/repo[@revision][:quant].
+func ParseHFRef(ref string) (HFRef, error) {
+	if !IsHFRef(ref) {
+		return HFRef{}, fmt.Errorf("%w: %q", ErrInvalidHFRef, ref)
+	}
+	r := HFRef{Revision: "main"}
+	s := strings.TrimPrefix(ref, HFScheme)
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		s, r.Quant = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, "@"); i >= 0 {
+		s, r.Revision = s[:i], s[i+1:]
+	}
+	r.Repo = s
+
+	parts := strings.Split(r.Repo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || r.Revision == "" {
+		return HFRef{}, fmt.Errorf("%w: %q", ErrInvalidHFRef, ref)
+	}
+	return r, nil
+}
+
+// HFOptions controls how Hugging Face models are resolved and downloaded.
+type HFOptions struct {
+	// Endpoint is the Hugging Face hub URL. It defaults to the HF_ENDPOINT
+	// environment variable, else https://huggingface.co.
+	Endpoint string
+
+	// Token is the access token for private and gated repositories. It
+	// defaults to the HF_TOKEN environment variable.
+	Token string
+
+	// MMProj also downloads the multimodal projector (mmproj) file of the
+	// repository, if it has one.
+	MMProj bool
+}
+
+// DefaultHFOptions returns the options used by GetModel for hf:// references.
+func DefaultHFOptions() HFOptions {
+	return HFOptions{MMProj: true}
+}
+
+func (o HFOptions) endpoint() string {
+	switch {
+	case o.Endpoint != "":
+		return strings.TrimSuffix(o.Endpoint, "/")
+	case os.Getenv("HF_ENDPOINT") != "":
+		return strings.TrimSuffix(os.Getenv("HF_ENDPOINT"), "/")
+	default:
+		return "https://huggingface.co"
+	}
+}
+
+func (o HFOptions) token() string {
+	if o.Token != "" {
+		return o.Token
+	}
+	return os.Getenv("HF_TOKEN")
+}
+
+// HFFile is a file of a Hugging Face repository.
+type HFFile struct {
+	// Path is the path of the file in the repository.
+	Path string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// SHA256 is the SHA-256 digest of the file, in hex, for the files stored
+	// with git LFS, which the GGUF files are.
+	SHA256 string
+
+	// URL is the download URL of the file, pinned to the resolved commit.
+	URL string
+}
+
+// HFModel is a model resolved from an HFRef.
+type HFModel struct {
+	Ref HFRef
+
+	// Commit is the commit that the revision resolved to. The file URLs
+	// point to it, so that all the files come from the same commit.
+	Commit string
+
+	// Files are the GGUF files of the model: a single file, or all the
+	// shards of a split model in order.
+	Files []HFFile
+
+	// MMProj is the multimodal projector file, if requested and present.
+	MMProj *HFFile
+}
+
+// ResolveHFModel resolves ref to the files to download, using the Hugging
+// Face API. It does not download the files.
+func ResolveHFModel(ctx context.Context, ref HFRef, opts HFOptions) (*HFModel, error) {
+	commit, err := hfCommit(ctx, ref, opts)
+	if err != nil {
+		return nil, err
+	}
+	files, err := hfListFiles(ctx, ref.Repo, commit, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &HFModel{Ref: ref, Commit: commit}
+	m.Files, err = selectGGUF(files, ref.Quant)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ref.Repo, err)
+	}
+	if opts.MMProj {
+		m.MMProj = selectMMProj(files)
+	}
+
+	for i := range m.Files {
+		m.Files[i].URL = hfFileURL(opts, ref.Repo, commit, m.Files[i].Path)
+	}
+	if m.MMProj != nil {
+		m.MMProj.URL = hfFileURL(opts, ref.Repo, commit, m.MMProj.Path)
+	}
+	return m, nil
+}
+
+// GetHFModel resolves ref and downloads its files into the dest directory,
+// under their base names. The downloads resume after an interruption and are
+// verified against the digests of the files, see DownloadFile. It returns the
+// resolved model.
+func GetHFModel(ctx context.Context, ref HFRef, dest string, opts HFOptions, progress getter.ProgressTracker) (*HFModel, error) {
+	m, err := ResolveHFModel(ctx, ref, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+
+	files := m.Files
+	if m.MMProj != nil {
+		files = append(slices.Clone(files), *m.MMProj)
+	}
+	for _, f := range files {
+		if err := hfDownload(ctx, f, filepath.Join(dest, path.Base(f.Path)), opts, progress); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func hfFileURL(opts HFOptions, repo, commit, file string) string {
+	return fmt.Sprintf("%s/%s/resolve/%s/%s", opts.endpoint(), repo, commit, file)
+}
+
+// hfGet sends an authenticated GET request and checks the response status.
+func hfGet(ctx context.Context, rawURL string, opts HFOptions) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := opts.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrHFNotFound, rawURL)
+		}
+		return nil, fmt.Errorf("received status code %d from %s: %s", resp.StatusCode, rawURL, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// hfCommit returns the commit that the revision of ref points to.
+func hfCommit(ctx context.Context, ref HFRef, opts HFOptions) (string, error) {
+	u := fmt.Sprintf("%s/api/models/%s/revision/%s", opts.endpoint(), ref.Repo, url.PathEscape(ref.Revision))
+	resp, err := hfGet(ctx, u, opts)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("%s: %w", u, err)
+	}
+	if info.SHA == "" {
+		return "", fmt.Errorf("%s: no commit in response", u)
+	}
+	return info.SHA, nil
+}
+
+// hfTreeEntry is an entry of the tree API response.
+type hfTreeEntry struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	LFS  *hfLFS `json:"lfs,omitempty"`
+}
+
+// hfLFS describes a file stored with git LFS.
+type hfLFS struct {
+	Oid string `json:"oid"`
+}
+
+// linkNextRE matches the next page of a paginated API response.
+var linkNextRE = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// hfListFiles lists the files of repo at commit, following the pages of the
+// tree API.
+func hfListFiles(ctx context.Context, repo, commit string, opts HFOptions) ([]HFFile, error) {
+	var files []HFFile
+	next := fmt.Sprintf("%s/api/models/%s/tree/%s?recursive=true", opts.endpoint(), repo, commit)
+	for next != "" {
+		resp, err := hfGet(ctx, next, opts)
+		if err != nil {
+			return nil, err
+		}
+		var entries []hfTreeEntry
+		err = json.NewDecoder(resp.Body).Decode(&entries)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", next, err)
+		}
+
+		for _, e := range entries {
+			if e.Type != "file" {
+				continue
+			}
+			f := HFFile{Path: e.Path, Size: e.Size}
+			if e.LFS != nil {
+				// The oid of a file stored with git LFS is its SHA-256.
+				f.SHA256 = e.LFS.Oid
+			}
+			files = append(files, f)
+		}
+
+		next = ""
+		if m := linkNextRE.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			next = m[1]
+		}
+	}
+	return files, nil
+}
+
+// splitRE matches the suffix of the shards of a split GGUF model, e.g.
+// "-00001-of-00003.gguf".
+var splitRE = regexp.MustCompile(`-(\d{5})-of-(\d{5})\.gguf$`)
+
+func isGGUF(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".gguf")
+}
+
+func isMMProj(name string) bool {
+	return strings.Contains(strings.ToLower(path.Base(name)), "mmproj")
+}
+
+// hasQuant reports whether the path names the quantization, delimited by
+// separators, so that Q4_K does not match Q4_K_M.
+func hasQuant(name, quant string) bool {
+	name, quant = strings.ToUpper(name), strings.ToUpper(quant)
+	for i := 0; ; {
+		j := strings.Index(name[i:], quant)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(quant)
+		if (start == 0 || strings.ContainsRune("-._/", rune(name[start-1]))) &&
+			(end == len(name) || strings.ContainsRune("-._/", rune(name[end]))) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+// selectGGUF picks the model files for quant from the files of a
+// repository: the single GGUF file, or every shard of a split model.
+func selectGGUF(files []HFFile, quant string) ([]HFFile, error) {
+	var models []HFFile
+	for _, f := range files {
+		if isGGUF(f.Path) && !isMMProj(f.Path) {
+			models = append(models, f)
+		}
+	}
+	if len(models) == 0 {
+		return nil, ErrNoGGUF
+	}
+
+	want := quant
+	if want == "" {
+		want = DefaultQuant
+	}
+	var match *HFFile
+	for i, f := range models {
+		if hasQuant(f.Path, want) {
+			match = &models[i]
+			break
+		}
+	}
+	if match == nil {
+		// Without a quantization, a repository with a single model is
+		// unambiguous.
+		if quant != "" || !(len(models) == 1 || sameSplit(models)) {
+			return nil, fmt.Errorf("%w for quantization %s", ErrNoGGUF, want)
+		}
+		match = &models[0]
+	}
+
+	m := splitRE.FindStringSubmatchIndex(match.Path)
+	if m == nil {
+		return []HFFile{*match}, nil
+	}
+
+	// Collect the shards of the split model.
+	prefix, count := match.Path[:m[0]], match.Path[m[4]:m[5]]
+	var shards []HFFile
+	for _, f := range models {
+		if s := splitRE.FindStringSubmatch(f.Path); s != nil && strings.HasPrefix(f.Path, prefix) && len(f.Path)-len(s[0]) == len(prefix) && s[2] == count {
+			shards = append(shards, f)
+		}
+	}
+	slices.SortFunc(shards, func(a, b HFFile) int { return strings.Compare(a.Path, b.Path) })
+	for i, s := range shards {
+		if want := fmt.Sprintf("%s-%05d-of-%s.gguf", prefix, i+1, count); s.Path != want {
+			return nil, fmt.Errorf("split model %s: missing %s", prefix, want)
+		}
+	}
+	if fmt.Sprintf("%05d", len(shards)) != count {
+		return nil, fmt.Errorf("split model %s: found %d of %s shards", prefix, len(shards), count)
+	}
+	return shards, nil
+}
+
+// sameSplit reports whether the files are the shards of one split model.
+func sameSplit(files []HFFile) bool {
+	prefix := ""
+	for _, f := range files {
+		m := splitRE.FindStringIndex(f.Path)
+		if m == nil || (prefix != "" && f.Path[:m[0]] != prefix) {
+			return false
+		}
+		prefix = f.Path[:m[0]]
+	}
+	return true
+}
+
+// mmprojPreference orders the precisions of mmproj files, best first.
+var mmprojPreference = []string{"F16", "BF16", "Q8_0", "F32"}
+
+// selectMMProj picks the multimodal projector among the files of a
+// repository, preferring the F16 one. It returns nil if there is none.
+func selectMMProj(files []HFFile) *HFFile {
+	var mmprojs []HFFile
+	for _, f := range files {
+		if isGGUF(f.Path) && isMMProj(f.Path) {
+			mmprojs = append(mmprojs, f)
+		}
+	}
+	if len(mmprojs) == 0 {
+		return nil
+	}
+	for _, p := range mmprojPreference {
+		for _, f := range mmprojs {
+			if hasQuant(f.Path, p) {
+				return &f
+			}
+		}
+	}
+	return &mmprojs[0]
+}
+
+// hfDownload downloads f to the file dest.
+func hfDownload(ctx context.Context, f HFFile, dest string, opts HFOptions, progress getter.ProgressTracker) error {
+	header := http.Header{}
+	if token := opts.token(); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return DownloadFile(ctx, f.URL, dest, FileOptions{SHA256: f.SHA256, Header: header, Progress: progress})
+}
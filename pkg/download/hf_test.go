@@ -0,0 +1,351 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeHub serves the Hugging Face API for the repositories in repos, which
+// map a repository to its files and their contents, at commit "abc123".
+type fakeHub struct {
+	repos map[string]map[string]string
+
+	// token is the token that the hub requires, if any.
+	token string
+
+	// pageSize splits the tree listings in pages, if not zero.
+	pageSize int
+
+	// corrupt replaces the served contents of the files it names, but not
+	// their LFS digests.
+	corrupt map[string]string
+
+	requests []string
+}
+
+func (h *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.requests = append(h.requests, r.URL.Path)
+	if h.token != "" && r.Header.Get("Authorization") != "Bearer "+h.token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	for repo, files := range h.repos {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/models/"+repo+"/revision/"):
+			json.NewEncoder(w).Encode(map[string]string{"sha": "abc123"})
+			return
+		case r.URL.Path == "/api/models/"+repo+"/tree/abc123":
+			var entries []hfTreeEntry
+			for name, data := range files {
+				e := hfTreeEntry{Type: "file", Path: name, Size: int64(len(data))}
+				if strings.HasSuffix(name, ".gguf") {
+					e.LFS = &hfLFS{Oid: sha256Hex([]byte(data))}
+				}
+				entries = append(entries, e)
+			}
+			slices.SortFunc(entries, func(a, b hfTreeEntry) int { return strings.Compare(a.Path, b.Path) })
+			entries = append(entries, hfTreeEntry{Type: "directory", Path: "docs"})
+
+			if h.pageSize > 0 {
+				page := 0
+				if p := r.URL.Query().Get("page"); p != "" {
+					page = int(p[0] - '0')
+				}
+				start := page * h.pageSize
+				end := min(start+h.pageSize, len(entries))
+				if end < len(entries) {
+					w.Header().Set("Link", `<http://`+r.Host+r.URL.Path+`?recursive=true&page=`+string(rune('0'+page+1))+`>; rel="next"`)
+				}
+				entries = entries[start:end]
+			}
+			json.NewEncoder(w).Encode(entries)
+			return
+		case strings.HasPrefix(r.URL.Path, "/"+repo+"/resolve/abc123/"):
+			name := strings.TrimPrefix(r.URL.Path, "/"+repo+"/resolve/abc123/")
+			data, ok := files[name]
+			if !ok {
+				break
+			}
+			if c, ok := h.corrupt[name]; ok {
+				data = c
+			}
+			w.Write([]byte(data))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func TestParseHFRef(t *testing.T) {
+	tests := map[string]HFRef{
+		"hf://org/repo":               {Repo: "org/repo", Revision: "main"},
+		"hf://org/repo:Q4_K_M":        {Repo: "org/repo", Revision: "main", Quant: "Q4_K_M"},
+		"hf://org/repo@v1.0:q8_0":     {Repo: "org/repo", Revision: "v1.0", Quant: "q8_0"},
+		"hf://org/repo@0123456789abc": {Repo: "org/repo", Revision: "0123456789abc"},
+	}
+	for ref, want := range tests {
+		got, err := ParseHFRef(ref)
+		if err != nil {
+			t.Errorf("ParseHFRef(%q) failed: %v", ref, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseHFRef(%q) = %+v, want %+v", ref, got, want)
+		}
+	}
+
+	for _, ref := range []string{"https://huggingface.co/org/repo", "hf://repo", "hf://org/repo/file.gguf", "hf://org/repo@:Q4_K_M", "hf:///repo"} {
+		if _, err := ParseHFRef(ref); !errors.Is(err, ErrInvalidHFRef) {
+			t.Errorf("ParseHFRef(%q) error = %v, want ErrInvalidHFRef", ref, err)
+		}
+	}
+}
+
+func TestSelectGGUF(t *testing.T) {
+	files := func(names ...string) []HFFile {
+		var f []HFFile
+		for _, name := range names {
+			f = append(f, HFFile{Path: name})
+		}
+		return f
+	}
+	paths := func(files []HFFile) []string {
+		var p []string
+		for _, f := range files {
+			p = append(p, f.Path)
+		}
+		return p
+	}
+
+	repo := files(
+		"README.md",
+		"model-Q4_K.gguf",
+		"model-Q4_K_M.gguf",
+		"model-Q8_0.gguf",
+		"mmproj-model-f16.gguf",
+		"Q6_K/model-Q6_K-00002-of-00002.gguf",
+		"Q6_K/model-Q6_K-00001-of-00002.gguf",
+	)
+	tests := map[string][]string{
+		"":       {"model-Q4_K_M.gguf"},
+		"Q4_K":   {"model-Q4_K.gguf"},
+		"q8_0":   {"model-Q8_0.gguf"},
+		"Q6_K":   {"Q6_K/model-Q6_K-00001-of-00002.gguf", "Q6_K/model-Q6_K-00002-of-00002.gguf"},
+		"Q4_K_M": {"model-Q4_K_M.gguf"},
+	}
+	for quant, want := range tests {
+		got, err := selectGGUF(repo, quant)
+		if err != nil {
+			t.Errorf("selectGGUF(%q) failed: %v", quant, err)
+			continue
+		}
+		if !slices.Equal(paths(got), want) {
+			t.Errorf("selectGGUF(%q) = %v, want %v", quant, paths(got), want)
+		}
+	}
+
+	if _, err := selectGGUF(repo, "IQ2_XS"); !errors.Is(err, ErrNoGGUF) {
+		t.Errorf("selectGGUF(IQ2_XS) error = %v, want ErrNoGGUF", err)
+	}
+	if _, err := selectGGUF(files("README.md", "mmproj-f16.gguf"), ""); !errors.Is(err, ErrNoGGUF) {
+		t.Errorf("selectGGUF without models error = %v, want ErrNoGGUF", err)
+	}
+
+	// A repository with a single model needs no quantization.
+	got, err := selectGGUF(files("model-f16.gguf"), "")
+	if err != nil || !slices.Equal(paths(got), []string{"model-f16.gguf"}) {
+		t.Errorf("selectGGUF of a single model = %v, %v", paths(got), err)
+	}
+
+	if _, err := selectGGUF(files("m-Q4_K_M-00001-of-00003.gguf", "m-Q4_K_M-00003-of-00003.gguf"), ""); err == nil {
+		t.Error("selectGGUF with a missing shard succeeded, want an error")
+	}
+}
+
+func TestSelectMMProj(t *testing.T) {
+	got := selectMMProj([]HFFile{{Path: "mmproj-model-Q8_0.gguf"}, {Path: "mmproj-model-f16.gguf"}, {Path: "model-f16.gguf"}})
+	if got == nil || got.Path != "mmproj-model-f16.gguf" {
+		t.Errorf("selectMMProj() = %v, want mmproj-model-f16.gguf", got)
+	}
+	if got := selectMMProj([]HFFile{{Path: "model-f16.gguf"}}); got != nil {
+		t.Errorf("selectMMProj() without mmproj = %v, want nil", got)
+	}
+}
+
+func TestGetHFModel(t *testing.T) {
+	hub := &fakeHub{
+		repos: map[string]map[string]string{
+			"org/model-GGUF": {
+				"model-Q4_K_M.gguf":     "q4 weights",
+				"model-Q8_0.gguf":       "q8 weights",
+				"mmproj-model-f16.gguf": "projector",
+				"README.md":             "readme",
+			},
+		},
+		token:    "secret",
+		pageSize: 2,
+	}
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	t.Setenv("HF_ENDPOINT", server.URL)
+	t.Setenv("HF_TOKEN", "secret")
+
+	dest := t.TempDir()
+	ref, err := ParseHFRef("hf://org/model-GGUF:Q8_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := GetHFModel(context.Background(), ref, dest, DefaultHFOptions(), nil)
+	if err != nil {
+		t.Fatalf("GetHFModel failed: %v", err)
+	}
+
+	if m.Commit != "abc123" {
+		t.Errorf("Commit = %q, want abc123", m.Commit)
+	}
+	if want := server.URL + "/org/model-GGUF/resolve/abc123/model-Q8_0.gguf"; len(m.Files) != 1 || m.Files[0].URL != want {
+		t.Errorf("Files = %+v, want %s", m.Files, want)
+	}
+	if m.Files[0].SHA256 != sha256Hex([]byte("q8 weights")) {
+		t.Errorf("SHA256 = %q, want the LFS oid", m.Files[0].SHA256)
+	}
+	if m.MMProj == nil || m.MMProj.Path != "mmproj-model-f16.gguf" {
+		t.Errorf("MMProj = %+v, want mmproj-model-f16.gguf", m.MMProj)
+	}
+
+	for name, want := range map[string]string{"model-Q8_0.gguf": "q8 weights", "mmproj-model-f16.gguf": "projector"} {
+		data, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Errorf("reading %s: %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "model-Q4_K_M.gguf")); !os.IsNotExist(err) {
+		t.Error("downloaded a quantization that was not requested")
+	}
+}
+
+func TestGetHFModel_Split(t *testing.T) {
+	hub := &fakeHub{
+		repos: map[string]map[string]string{
+			"org/big-GGUF": {
+				"Q4_K_M/big-Q4_K_M-00001-of-00002.gguf": "part 1",
+				"Q4_K_M/big-Q4_K_M-00002-of-00002.gguf": "part 2",
+				"big-Q2_K.gguf":                         "q2",
+			},
+		},
+	}
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	dest := t.TempDir()
+	ref := HFRef{Repo: "org/big-GGUF", Revision: "main"}
+	opts := HFOptions{Endpoint: server.URL}
+	m, err := GetHFModel(context.Background(), ref, dest, opts, nil)
+	if err != nil {
+		t.Fatalf("GetHFModel failed: %v", err)
+	}
+	if len(m.Files) != 2 || m.MMProj != nil {
+		t.Fatalf("got files %+v and mmproj %+v, want 2 shards", m.Files, m.MMProj)
+	}
+	for i, name := range []string{"big-Q4_K_M-00001-of-00002.gguf", "big-Q4_K_M-00002-of-00002.gguf"} {
+		data, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatalf("reading shard %d: %v", i+1, err)
+		}
+		if want := "part " + string(rune('1'+i)); string(data) != want {
+			t.Errorf("shard %d = %q, want %q", i+1, data, want)
+		}
+	}
+}
+
+func TestGetHFModel_Errors(t *testing.T) {
+	hub := &fakeHub{
+		repos: map[string]map[string]string{
+			"org/model-GGUF": {"model-Q4_K_M.gguf": "q4"},
+		},
+		token: "secret",
+	}
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	ctx := context.Background()
+	opts := HFOptions{Endpoint: server.URL, Token: "secret"}
+
+	_, err := ResolveHFModel(ctx, HFRef{Repo: "org/missing", Revision: "main"}, opts)
+	if !errors.Is(err, ErrHFNotFound) {
+		t.Errorf("missing repository error = %v, want ErrHFNotFound", err)
+	}
+
+	_, err = ResolveHFModel(ctx, HFRef{Repo: "org/model-GGUF", Revision: "main", Quant: "Q8_0"}, opts)
+	if !errors.Is(err, ErrNoGGUF) {
+		t.Errorf("missing quantization error = %v, want ErrNoGGUF", err)
+	}
+
+	t.Setenv("HF_TOKEN", "")
+	opts.Token = ""
+	if _, err := ResolveHFModel(ctx, HFRef{Repo: "org/model-GGUF", Revision: "main"}, opts); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unauthenticated error = %v, want a 401 status", err)
+	}
+}
+
+func TestGetModel_HFRef(t *testing.T) {
+	hub := &fakeHub{
+		repos: map[string]map[string]string{
+			"org/model-GGUF": {"model-Q4_K_M.gguf": "q4"},
+		},
+	}
+	server := httptest.NewServer(hub)
+	defer server.Close()
+	t.Setenv("HF_ENDPOINT", server.URL)
+
+	dest := t.TempDir()
+	if err := GetModelWithProgress("hf://org/model-GGUF@v1", dest, DefaultProgressTracker()); err != nil {
+		t.Fatalf("GetModelWithProgress failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "model-Q4_K_M.gguf")); err != nil {
+		t.Errorf("model not downloaded: %v", err)
+	}
+	if !slices.Contains(hub.requests, "/api/models/org/model-GGUF/revision/v1") {
+		t.Errorf("revision v1 not resolved, requests: %v", hub.requests)
+	}
+}
+
+func TestGetHFModel_ChecksumMismatch(t *testing.T) {
+	hub := &fakeHub{
+		repos: map[string]map[string]string{
+			"org/model-GGUF": {"model-Q4_K_M.gguf": "q4 weights"},
+		},
+		corrupt: map[string]string{"model-Q4_K_M.gguf": "q4 weighs"},
+	}
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	dest := t.TempDir()
+	ref := HFRef{Repo: "org/model-GGUF", Revision: "main"}
+	_, err := GetHFModel(context.Background(), ref, dest, HFOptions{Endpoint: server.URL}, nil)
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("GetHFModel error = %v, want a *ChecksumError", err)
+	}
+	if checksumErr.Want != sha256Hex([]byte("q4 weights")) {
+		t.Errorf("ChecksumError.Want = %q, want the LFS oid", checksumErr.Want)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "model-Q4_K_M.gguf")); !os.IsNotExist(err) {
+		t.Error("corrupt model saved")
+	}
+}
@@ -2,7 +2,10 @@ package download
 
 import (
 	"context"
+	"fmt"
+	neturl "net/url"
 	"os"
+	"path"
 	"path/filepath"
 
 	getter "github.com/hashicorp/go-getter"
@@ -18,6 +21,18 @@ func DefaultModelsDir() string {
 }
 
 // GetModel downloads a model from the specified URL to the destination path.
+// The URL can also be a Hugging Face reference such as
+// hf://bartowski/Qwen_Qwen3-VL-2B-Instruct-GGUF:Q4_K_M, in which case dest is
+// a directory and the model files are downloaded into it, see GetHFModel.
+//
+// HTTP(S) URLs are downloaded into the dest directory with DownloadFile, so
+// that an interrupted download resumes where it stopped. The file is verified
+// against the digest of a go-getter style checksum parameter, as in
+// https://example.com/model.gguf?checksum=sha256:<hex>, else against the
+// <url>.sha256 sidecar file if the server has one. A file that fails
+// verification returns a *ChecksumError. URLs with other checksum types, with
+// the go-getter archive or filename parameters, or of archives are downloaded
+// by go-getter, as are other sources.
 func GetModel(url, dest string) error {
 	return getModel(context.Background(), url, dest, ProgressTracker)
 }
@@ -35,6 +50,30 @@ func GetModelWithContext(ctx context.Context, url, dest string, progress getter.
 }
 
 func getModel(ctx context.Context, url, dest string, progress getter.ProgressTracker) error {
+	if IsHFRef(url) {
+		ref, err := ParseHFRef(url)
+		if err != nil {
+			return err
+		}
+		_, err = GetHFModel(ctx, ref, dest, DefaultHFOptions(), progress)
+		return err
+	}
+
+	if src, digest, ok := checksumParam(url); ok && isHTTP(url) {
+		u, err := neturl.Parse(src)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		name := path.Base(u.Path)
+		if name == "/" || name == "." {
+			return fmt.Errorf("no file name in URL %s", src)
+		}
+		return DownloadFile(ctx, src, filepath.Join(dest, name), FileOptions{SHA256: digest, Progress: progress})
+	}
+
 	client := &getter.Client{
 		Ctx:  ctx,
 		Src:  url,
@@ -53,6 +53,7 @@ func (pr *progressReader) TrackProgress(src string, currentSize, totalSize int64
 	pr.src = src
 	pr.currentSize = currentSize
 	pr.totalSize = totalSize
+	pr.lastReported = currentSize
 	pr.startTime = time.Now()
 	pr.reader = stream
 
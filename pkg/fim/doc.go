@@ -0,0 +1,3 @@
+// Package fim builds fill-in-the-middle (FIM) prompts for code completion
+// models, and generates the missing middle with the infill sampler.
+package fim
@@ -0,0 +1,154 @@
+package fim
+
+import (
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+// RepoFile is a file of the repository that is passed to the model as extra
+// context for the completion.
+type RepoFile struct {
+	// Name is the path of the file, e.g. "pkg/fim/fim.go".
+	Name string
+
+	// Text is the content of the file.
+	Text string
+}
+
+// Options controls how Build assembles a prompt.
+type Options struct {
+	// Budget is the number of tokens for the prefix and the suffix. As in
+	// llama.cpp, three quarters of it go to the end of the prefix and the
+	// rest, less two tokens, to the start of the suffix. A zero or negative
+	// Budget leaves both out; DefaultOptions sets the llama.cpp default.
+	Budget int
+
+	// ExtraBudget is the number of tokens for the extra files. When the
+	// files do not fit, the start of the extra context is dropped, so the
+	// last files are kept. A zero or negative ExtraBudget leaves the extra
+	// context out.
+	ExtraBudget int
+
+	// Project is the repository name that follows the FIMRep token.
+	Project string
+
+	// FileName is the name of the file being completed, which follows the
+	// last FIMSep token.
+	FileName string
+
+	// SPM puts the suffix before the prefix (suffix-prefix-middle order), for
+	// models trained that way.
+	SPM bool
+}
+
+// DefaultOptions returns the llama.cpp server defaults.
+func DefaultOptions() Options {
+	return Options{
+		Budget:      2048,
+		ExtraBudget: 2048,
+		Project:     "myproject",
+		FileName:    "filename",
+	}
+}
+
+// chunkSeparator separates the extra files for models without a FIMSep
+// token, as in llama.cpp.
+const chunkSeparator = "\n\n--- snippet ---\n\n"
+
+// Supported reports whether the vocabulary has the FIMPre, FIMSuf and FIMMid
+// tokens that a FIM prompt needs.
+func Supported(vocab llama.Vocab) bool {
+	return llama.VocabFIMPre(vocab) != llama.TokenNull &&
+		llama.VocabFIMSuf(vocab) != llama.TokenNull &&
+		llama.VocabFIMMid(vocab) != llama.TokenNull
+}
+
+// Build returns the FIM prompt for completing the text between prefix and
+// suffix, with extraFiles as context. It follows the repo-level layout of
+// llama.cpp:
+//
+//	[FIM_REP]myproject
+//	[FIM_SEP]filename0
+//	extra file 0
+//	[FIM_SEP]filename1
+//	extra file 1
+//	[FIM_SEP]filename
+//	[FIM_PRE]prefix[FIM_SUF]suffix[FIM_MID]
+//
+// The FIMRep and FIMSep parts are left out when the vocabulary does not have
+// these tokens. Build returns nil if the vocabulary does not support FIM,
+// see Supported.
+func Build(vocab llama.Vocab, prefix, suffix string, extraFiles []RepoFile) []llama.Token {
+	return BuildWithOptions(vocab, prefix, suffix, extraFiles, DefaultOptions())
+}
+
+// BuildWithOptions is like Build with opts.
+func BuildWithOptions(vocab llama.Vocab, prefix, suffix string, extraFiles []RepoFile, opts Options) []llama.Token {
+	if !Supported(vocab) {
+		return nil
+	}
+
+	sp := specialTokens{
+		pre: llama.VocabFIMPre(vocab),
+		suf: llama.VocabFIMSuf(vocab),
+		mid: llama.VocabFIMMid(vocab),
+		rep: llama.VocabFIMRep(vocab),
+		sep: llama.VocabFIMSep(vocab),
+		bos: llama.TokenNull,
+	}
+	if llama.VocabGetAddBOS(vocab) {
+		sp.bos = llama.VocabBOS(vocab)
+	}
+	tokenize := func(text string) []llama.Token {
+		return llama.Tokenize(vocab, text, false, false)
+	}
+	return build(sp, tokenize, prefix, suffix, extraFiles, opts)
+}
+
+// specialTokens are the tokens of a FIM prompt. Optional tokens are
+// llama.TokenNull when the vocabulary does not have them.
+type specialTokens struct {
+	pre, suf, mid, rep, sep, bos llama.Token
+}
+
+func build(sp specialTokens, tokenize func(string) []llama.Token, prefix, suffix string, extraFiles []RepoFile, opts Options) []llama.Token {
+	var extra []llama.Token
+	if sp.rep != llama.TokenNull {
+		extra = append(extra, sp.rep)
+		extra = append(extra, tokenize(opts.Project+"\n")...)
+	}
+	for _, f := range extraFiles {
+		if sp.sep != llama.TokenNull {
+			extra = append(extra, sp.sep)
+			extra = append(extra, tokenize(f.Name+"\n")...)
+		} else {
+			extra = append(extra, tokenize(chunkSeparator)...)
+		}
+		extra = append(extra, tokenize(f.Text)...)
+	}
+	if sp.sep != llama.TokenNull {
+		extra = append(extra, sp.sep)
+		extra = append(extra, tokenize(opts.FileName+"\n")...)
+	}
+	extra = extra[len(extra)-min(len(extra), max(0, opts.ExtraBudget)):]
+
+	prefixTokens := tokenize(prefix)
+	prefixTokens = prefixTokens[len(prefixTokens)-min(len(prefixTokens), max(0, 3*(opts.Budget/4))):]
+	suffixTokens := tokenize(suffix)
+	suffixTokens = suffixTokens[:min(len(suffixTokens), max(0, opts.Budget/4-2))]
+
+	pre := append([]llama.Token{sp.pre}, prefixTokens...)
+	suf := append([]llama.Token{sp.suf}, suffixTokens...)
+	first, second := pre, suf
+	if opts.SPM {
+		first, second = suf, pre
+	}
+
+	prompt := make([]llama.Token, 0, len(extra)+len(first)+len(second)+2)
+	prompt = append(prompt, extra...)
+	if sp.bos != llama.TokenNull {
+		prompt = append(prompt, sp.bos)
+	}
+	prompt = append(prompt, first...)
+	prompt = append(prompt, second...)
+	return append(prompt, sp.mid)
+}
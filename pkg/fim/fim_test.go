@@ -0,0 +1,137 @@
+package fim
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+const (
+	tokPre llama.Token = iota + 1
+	tokSuf
+	tokMid
+	tokRep
+	tokSep
+	tokBOS
+)
+
+var testTokens = specialTokens{pre: tokPre, suf: tokSuf, mid: tokMid, rep: tokRep, sep: tokSep, bos: llama.TokenNull}
+
+// testTokenize returns one token per byte, above the special tokens.
+func testTokenize(text string) []llama.Token {
+	tokens := make([]llama.Token, len(text))
+	for i := range len(text) {
+		tokens[i] = llama.Token(text[i]) + 100
+	}
+	return tokens
+}
+
+// testDetokenize renders tokens as text, with the special tokens spelled out.
+func testDetokenize(tokens []llama.Token) string {
+	names := map[llama.Token]string{tokPre: "<PRE>", tokSuf: "<SUF>", tokMid: "<MID>", tokRep: "<REP>", tokSep: "<SEP>", tokBOS: "<BOS>"}
+	var s string
+	for _, tok := range tokens {
+		if name, ok := names[tok]; ok {
+			s += name
+		} else {
+			s += string(rune(tok - 100))
+		}
+	}
+	return s
+}
+
+func TestBuild_RepoLevel(t *testing.T) {
+	files := []RepoFile{
+		{Name: "a.go", Text: "package a\n"},
+		{Name: "b.go", Text: "package b\n"},
+	}
+	opts := DefaultOptions()
+	opts.FileName = "main.go"
+
+	got := testDetokenize(build(testTokens, testTokenize, "func main() {\n", "\n}\n", files, opts))
+	want := "<REP>myproject\n<SEP>a.go\npackage a\n<SEP>b.go\npackage b\n<SEP>main.go\n<PRE>func main() {\n<SUF>\n}\n<MID>"
+	if got != want {
+		t.Errorf("prompt mismatch:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestBuild_NoRepoTokens(t *testing.T) {
+	sp := testTokens
+	sp.rep, sp.sep = llama.TokenNull, llama.TokenNull
+	files := []RepoFile{{Name: "a.go", Text: "package a\n"}}
+
+	got := testDetokenize(build(sp, testTokenize, "x := ", "\n", files, DefaultOptions()))
+	want := chunkSeparator + "package a\n<PRE>x := <SUF>\n<MID>"
+	if got != want {
+		t.Errorf("prompt mismatch:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestBuild_Budget(t *testing.T) {
+	sp := testTokens
+	sp.rep, sp.sep = llama.TokenNull, llama.TokenNull
+	opts := DefaultOptions()
+	opts.Budget = 16 // 12 prefix tokens, 2 suffix tokens
+
+	got := testDetokenize(build(sp, testTokenize, "0123456789abcdefghij", "ABCDEFGH", nil, opts))
+	want := "<PRE>89abcdefghij<SUF>AB<MID>"
+	if got != want {
+		t.Errorf("prompt mismatch:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestBuild_NoBudget(t *testing.T) {
+	sp := testTokens
+	sp.rep, sp.sep = llama.TokenNull, llama.TokenNull
+
+	for _, budget := range []int{0, -4} {
+		opts := DefaultOptions()
+		opts.Budget = budget
+
+		got := build(sp, testTokenize, "prefix", "suffix", nil, opts)
+		if want := []llama.Token{tokPre, tokSuf, tokMid}; !slices.Equal(got, want) {
+			t.Errorf("budget %d: prompt = %v, want %v", budget, got, want)
+		}
+	}
+}
+
+func TestBuild_ExtraBudget(t *testing.T) {
+	files := []RepoFile{
+		{Name: "a", Text: "old\n"},
+		{Name: "b", Text: "new\n"},
+	}
+	opts := DefaultOptions()
+	opts.ExtraBudget = 10
+	opts.FileName = "c"
+
+	got := build(testTokens, testTokenize, "", "", files, opts)
+	if want := "<SEP>b\nnew\n<SEP>c\n<PRE><SUF><MID>"; testDetokenize(got) != want {
+		t.Errorf("prompt mismatch:\n got: %q\nwant: %q", testDetokenize(got), want)
+	}
+
+	opts.ExtraBudget = 0
+	got = build(testTokens, testTokenize, "", "", files, opts)
+	if want := []llama.Token{tokPre, tokSuf, tokMid}; !slices.Equal(got, want) {
+		t.Errorf("prompt = %v, want %v", got, want)
+	}
+}
+
+func TestBuild_SPM(t *testing.T) {
+	sp := testTokens
+	sp.rep, sp.sep, sp.bos = llama.TokenNull, llama.TokenNull, tokBOS
+	opts := DefaultOptions()
+	opts.SPM = true
+
+	got := testDetokenize(build(sp, testTokenize, "pre", "suf", nil, opts))
+	want := "<BOS><SUF>suf<PRE>pre<MID>"
+	if got != want {
+		t.Errorf("prompt mismatch:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestBuild_Unsupported(t *testing.T) {
+	if got := Build(0, "a", "b", nil); got != nil {
+		t.Errorf("Build with no vocabulary = %v, want nil", got)
+	}
+}
@@ -0,0 +1,84 @@
+package fim
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+var errEmptyPrompt = errors.New("empty prompt")
+
+// NewSampler returns the sampler chain that llama.cpp recommends for FIM:
+// top-k and top-p followed by the infill sampler, which favours ending the
+// middle over continuing it once the end is likely. Free it with
+// llama.SamplerFree.
+func NewSampler(vocab llama.Vocab) llama.Sampler {
+	sampler := llama.SamplerChainInit(llama.SamplerChainDefaultParams())
+	llama.SamplerChainAdd(sampler, llama.SamplerInitTopK(40))
+	llama.SamplerChainAdd(sampler, llama.SamplerInitTopP(0.95, 1))
+	llama.SamplerChainAdd(sampler, llama.SamplerInitInfill(vocab))
+	llama.SamplerChainAdd(sampler, llama.SamplerInitDist(llama.DefaultSeed))
+	return sampler
+}
+
+// Generate decodes prompt, as returned by Build, and samples the middle with
+// NewSampler. It stops at the EOT or FIMPad token, at any other end of
+// generation token, or after maxTokens tokens, and returns the middle. The
+// memory of ctx is cleared first.
+func Generate(ctx llama.Context, vocab llama.Vocab, prompt []llama.Token, maxTokens int) (string, error) {
+	if len(prompt) == 0 {
+		return "", errEmptyPrompt
+	}
+
+	mem, err := llama.GetMemory(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := llama.MemoryClear(mem, true); err != nil {
+		return "", err
+	}
+
+	sampler := NewSampler(vocab)
+	defer llama.SamplerFree(sampler)
+
+	nBatch := int(llama.NBatch(ctx))
+	for i := 0; i < len(prompt); i += nBatch {
+		chunk := prompt[i:min(i+nBatch, len(prompt))]
+		if err := decode(ctx, chunk); err != nil {
+			return "", err
+		}
+	}
+
+	eot := llama.VocabEOT(vocab)
+	pad := llama.VocabFIMPad(vocab)
+
+	var middle []byte
+	buf := make([]byte, 256)
+	for range maxTokens {
+		token := llama.SamplerSample(sampler, ctx, -1)
+		if token == eot || token == pad || llama.VocabIsEOG(vocab, token) {
+			break
+		}
+
+		if n := llama.TokenToPiece(vocab, token, buf, 0, false); n > 0 {
+			middle = append(middle, buf[:n]...)
+		}
+
+		if err := decode(ctx, []llama.Token{token}); err != nil {
+			return string(middle), err
+		}
+	}
+	return string(middle), nil
+}
+
+func decode(ctx llama.Context, tokens []llama.Token) error {
+	ret, err := llama.Decode(ctx, llama.BatchGetOne(tokens))
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return fmt.Errorf("decode failed: %d", ret)
+	}
+	return nil
+}
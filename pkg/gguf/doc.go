@@ -0,0 +1,30 @@
+// Package gguf reads and writes GGUF model files in pure Go, without loading
+// the llama.cpp libraries or the model weights.
+//
+// # Reading
+//
+// [Open] parses the header of a GGUF v2 or v3 file: the typed key/value
+// metadata, including arrays, and the name, shape, type and offset of every
+// tensor. Tensor data is only read when asked for with [File.TensorReader].
+// [Read] does the same for any [io.ReaderAt].
+//
+//	f, err := gguf.Open("model.gguf")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//
+//	arch := f.Architecture()
+//	nLayer, _ := f.GetUint64(arch + ".block_count")
+//
+// # Writing
+//
+// A [File] can be edited and written out again with [File.WriteTo] or
+// [File.WriteFile], which copies the tensor data of the original file. This is
+// enough for changes such as fixing a chat template:
+//
+//	f.SetString("tokenizer.chat_template", fixed)
+//	err := f.WriteFile("model-fixed.gguf")
+//
+// [New] starts an empty file, and [File.AddTensor] adds tensors held in memory.
+package gguf
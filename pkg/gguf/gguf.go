@@ -0,0 +1,320 @@
+package gguf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+const (
+	// Magic is the little-endian uint32 every GGUF file starts with, "GGUF".
+	Magic = 0x46554747
+
+	// Version is the GGUF version written by this package.
+	Version = 3
+
+	// DefaultAlignment is the alignment of tensor data when the file does not
+	// set general.alignment.
+	DefaultAlignment = 32
+
+	// KeyAlignment is the metadata key that overrides DefaultAlignment.
+	KeyAlignment = "general.alignment"
+
+	// KeyArchitecture is the metadata key naming the model architecture.
+	KeyArchitecture = "general.architecture"
+
+	// maxDims is GGML_MAX_DIMS.
+	maxDims = 4
+)
+
+var (
+	ErrNotGGUF            = errors.New("not a GGUF file")
+	ErrUnsupportedVersion = errors.New("unsupported GGUF version")
+	ErrTensorNotFound     = errors.New("tensor not found")
+)
+
+// File is the header of a GGUF file: its metadata and tensor descriptors.
+// The tensor data stays in the file it was read from until it is asked for.
+type File struct {
+	Version uint32       // GGUF version of the file read, Version for a new file
+	KV      []KV         // metadata, in file order
+	Tensors []TensorInfo // tensor descriptors, in file order
+
+	// DataOffset is the absolute offset of the tensor data section in the file
+	// that was read. It is 0 for a new file.
+	DataOffset int64
+
+	closer io.Closer
+}
+
+// TensorInfo describes a single tensor.
+type TensorInfo struct {
+	Name   string   // name of the tensor, e.g. "blk.0.attn_q.weight"
+	Shape  []uint64 // number of elements in each dimension, Shape[0] varies fastest
+	Type   GGMLType // data type of the tensor
+	Offset uint64   // offset of the data from the start of the data section
+
+	src  io.ReaderAt // file the data lives in, when read from a file
+	pos  int64       // absolute position of the data in src
+	span int64       // bytes from pos to the next tensor or the end of the data
+	data []byte      // data held in memory, when added with AddTensor
+}
+
+// New returns an empty File, ready for metadata and tensors to be added.
+func New() *File {
+	return &File{Version: Version}
+}
+
+// Open opens and parses the GGUF file at path. The file stays open so that
+// tensor data can be read, until Close is called.
+func Open(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+
+	f, err := Read(fh, st.Size())
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	f.closer = fh
+	return f, nil
+}
+
+// Read parses a GGUF file of the given size from r. Tensor data is read from r
+// later, so r must remain usable for as long as the File is.
+func Read(r io.ReaderAt, size int64) (*File, error) {
+	return readFile(r, size)
+}
+
+// Close closes the underlying file when the File was returned by Open.
+func (f *File) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+
+	err := f.closer.Close()
+	f.closer = nil
+	return err
+}
+
+// Architecture returns the model architecture named by general.architecture,
+// or an empty string if it is not set.
+func (f *File) Architecture() string {
+	s, _ := f.GetString(KeyArchitecture)
+	return s
+}
+
+// Alignment returns the alignment of the tensor data, which general.alignment
+// overrides when it is set.
+func (f *File) Alignment() uint64 {
+	if v, ok := f.Get(KeyAlignment); ok {
+		if a, ok := v.data.(uint32); ok && validAlignment(uint64(a)) {
+			return uint64(a)
+		}
+	}
+	return DefaultAlignment
+}
+
+// Get returns the value of the metadata key.
+func (f *File) Get(key string) (Value, bool) {
+	for _, kv := range f.KV {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// GetString returns the value of the metadata key if it is a string.
+func (f *File) GetString(key string) (string, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		return "", false
+	}
+	return v.AsString()
+}
+
+// GetStrings returns the value of the metadata key if it is an array of strings.
+func (f *File) GetStrings(key string) ([]string, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.AsStrings()
+}
+
+// GetUint64 returns the value of the metadata key if it is a non-negative integer.
+func (f *File) GetUint64(key string) (uint64, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		return 0, false
+	}
+	return v.AsUint64()
+}
+
+// GetInt64 returns the value of the metadata key if it is an integer.
+func (f *File) GetInt64(key string) (int64, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		return 0, false
+	}
+	return v.AsInt64()
+}
+
+// GetFloat64 returns the value of the metadata key if it is a number.
+func (f *File) GetFloat64(key string) (float64, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		return 0, false
+	}
+	return v.AsFloat64()
+}
+
+// GetBool returns the value of the metadata key if it is a bool.
+func (f *File) GetBool(key string) (bool, bool) {
+	v, ok := f.Get(key)
+	if !ok {
+		return false, false
+	}
+	return v.AsBool()
+}
+
+// Set sets the value of the metadata key, replacing any existing value in
+// place or otherwise adding it at the end.
+func (f *File) Set(key string, v Value) {
+	for i := range f.KV {
+		if f.KV[i].Key == key {
+			f.KV[i].Value = v
+			return
+		}
+	}
+	f.KV = append(f.KV, KV{Key: key, Value: v})
+}
+
+// SetString sets the metadata key to a string value.
+func (f *File) SetString(key, s string) {
+	f.Set(key, Value{Type: ValueTypeString, data: s})
+}
+
+// Delete removes the metadata key, if present.
+func (f *File) Delete(key string) {
+	f.KV = slices.DeleteFunc(f.KV, func(kv KV) bool {
+		return kv.Key == key
+	})
+}
+
+// Tensor returns the descriptor of the named tensor.
+func (f *File) Tensor(name string) (TensorInfo, bool) {
+	for _, t := range f.Tensors {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return TensorInfo{}, false
+}
+
+// TensorReader returns a reader for the raw data of the named tensor, in the
+// layout ggml stores it.
+func (f *File) TensorReader(name string) (*io.SectionReader, error) {
+	t, ok := f.Tensor(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTensorNotFound, name)
+	}
+	return t.reader()
+}
+
+// AddTensor adds a tensor whose data is held in memory. The length of data
+// must match the type and shape of the tensor, when the size of the type is
+// known.
+func (f *File) AddTensor(name string, typ GGMLType, shape []uint64, data []byte) error {
+	if len(shape) == 0 || len(shape) > maxDims {
+		return fmt.Errorf("tensor %s has %d dimensions", name, len(shape))
+	}
+
+	if _, ok := f.Tensor(name); ok {
+		return fmt.Errorf("duplicate tensor %s", name)
+	}
+
+	t := TensorInfo{
+		Name:  name,
+		Shape: slices.Clone(shape),
+		Type:  typ,
+		data:  data,
+	}
+
+	if size, ok := t.dataSize(); ok && size != uint64(len(data)) {
+		return fmt.Errorf("tensor %s has %d bytes of data, expected %d", name, len(data), size)
+	}
+
+	f.Tensors = append(f.Tensors, t)
+	return nil
+}
+
+// NElements returns the total number of elements in the tensor.
+func (t TensorInfo) NElements() uint64 {
+	if len(t.Shape) == 0 {
+		return 0
+	}
+
+	n := uint64(1)
+	for _, d := range t.Shape {
+		n *= d
+	}
+	return n
+}
+
+// Size returns the size in bytes of the tensor data. For a type this package
+// does not know the block size of, it is the space up to the next tensor, which
+// may include padding.
+func (t TensorInfo) Size() uint64 {
+	if t.data != nil {
+		return uint64(len(t.data))
+	}
+	if size, ok := t.dataSize(); ok {
+		return size
+	}
+	return uint64(max(t.span, 0))
+}
+
+// dataSize computes the size of the tensor data from its type and shape.
+func (t TensorInfo) dataSize() (uint64, bool) {
+	if len(t.Shape) == 0 {
+		return 0, false
+	}
+
+	row, ok := t.Type.RowSize(t.Shape[0])
+	if !ok {
+		return 0, false
+	}
+	return row * (t.NElements() / max(t.Shape[0], 1)), true
+}
+
+func (t TensorInfo) reader() (*io.SectionReader, error) {
+	if t.data != nil {
+		return io.NewSectionReader(bytes.NewReader(t.data), 0, int64(len(t.data))), nil
+	}
+	if t.src == nil {
+		return nil, fmt.Errorf("tensor %s has no data", t.Name)
+	}
+	return io.NewSectionReader(t.src, t.pos, int64(t.Size())), nil
+}
+
+func validAlignment(a uint64) bool {
+	return a != 0 && a&(a-1) == 0
+}
+
+func alignTo(n, alignment uint64) uint64 {
+	return (n + alignment - 1) / alignment * alignment
+}
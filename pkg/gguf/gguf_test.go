@@ -0,0 +1,289 @@
+package gguf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFile returns a small file with metadata of several types and two
+// tensors, one quantized.
+func testFile(t *testing.T) *File {
+	t.Helper()
+
+	f := New()
+	f.SetString(KeyArchitecture, "llama")
+	set := func(key string, v any) {
+		val, err := NewValue(v)
+		if err != nil {
+			t.Fatalf("NewValue(%v) failed: %v", v, err)
+		}
+		f.Set(key, val)
+	}
+	set("llama.block_count", uint32(2))
+	set("llama.rope.freq_base", float32(10000))
+	set("tokenizer.ggml.tokens", []string{"<s>", "</s>", "hello"})
+	set("tokenizer.ggml.scores", []float32{0, 0, -1.5})
+	set("general.flag", true)
+
+	f32 := make([]byte, 4*8)
+	for i := range f32 {
+		f32[i] = byte(i)
+	}
+	if err := f.AddTensor("token_embd.weight", GGMLTypeF32, []uint64{4, 2}, f32); err != nil {
+		t.Fatalf("AddTensor failed: %v", err)
+	}
+
+	q8 := bytes.Repeat([]byte{0xab}, 34)
+	if err := f.AddTensor("output.weight", GGMLTypeQ8_0, []uint64{32}, q8); err != nil {
+		t.Fatalf("AddTensor failed: %v", err)
+	}
+
+	return f
+}
+
+func writeTestFile(t *testing.T, f *File) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.gguf")
+	if err := f.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	f, err := Open(writeTestFile(t, testFile(t)))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	if f.Version != Version {
+		t.Fatalf("expected version %d, got %d", Version, f.Version)
+	}
+	if f.Architecture() != "llama" {
+		t.Fatalf("expected architecture llama, got %q", f.Architecture())
+	}
+	if n, ok := f.GetUint64("llama.block_count"); !ok || n != 2 {
+		t.Fatalf("expected block count 2, got %d %v", n, ok)
+	}
+	if v, ok := f.GetFloat64("llama.rope.freq_base"); !ok || v != 10000 {
+		t.Fatalf("expected rope freq base 10000, got %v %v", v, ok)
+	}
+	if b, ok := f.GetBool("general.flag"); !ok || !b {
+		t.Fatalf("expected general.flag true, got %v %v", b, ok)
+	}
+
+	tokens, ok := f.GetStrings("tokenizer.ggml.tokens")
+	if !ok || len(tokens) != 3 || tokens[2] != "hello" {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+
+	scores, _ := f.Get("tokenizer.ggml.scores")
+	if scores.ArrayType != ValueTypeFloat32 || scores.Any().([]float32)[2] != -1.5 {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	if len(f.Tensors) != 2 {
+		t.Fatalf("expected 2 tensors, got %d", len(f.Tensors))
+	}
+
+	emb, ok := f.Tensor("token_embd.weight")
+	if !ok {
+		t.Fatal("token_embd.weight not found")
+	}
+	if emb.Type != GGMLTypeF32 || len(emb.Shape) != 2 || emb.Shape[0] != 4 || emb.Shape[1] != 2 {
+		t.Fatalf("unexpected tensor %+v", emb)
+	}
+	if emb.NElements() != 8 || emb.Size() != 32 {
+		t.Fatalf("expected 8 elements in 32 bytes, got %d in %d", emb.NElements(), emb.Size())
+	}
+
+	out, _ := f.Tensor("output.weight")
+	if out.Offset%DefaultAlignment != 0 || out.Size() != 34 {
+		t.Fatalf("unexpected tensor %+v", out)
+	}
+	if f.DataOffset%DefaultAlignment != 0 {
+		t.Fatalf("data offset %d is not aligned", f.DataOffset)
+	}
+
+	r, err := f.TensorReader("token_embd.weight")
+	if err != nil {
+		t.Fatalf("TensorReader failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading tensor failed: %v", err)
+	}
+	if len(data) != 32 || data[31] != 31 {
+		t.Fatalf("unexpected tensor data %v", data)
+	}
+
+	if _, err := f.TensorReader("missing"); !errors.Is(err, ErrTensorNotFound) {
+		t.Fatalf("expected ErrTensorNotFound, got %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := testFile(t).WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	f, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(f.KV) != 6 || f.KV[0].Key != KeyArchitecture {
+		t.Fatalf("unexpected metadata %v", f.KV)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := testFile(t).WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, io.ErrUnexpectedEOF},
+		{"magic", []byte("GGML\x03\x00\x00\x00"), ErrNotGGUF},
+		{"version", []byte("GGUF\x01\x00\x00\x00"), ErrUnsupportedVersion},
+		{"truncated header", valid[:100], nil},
+		{"truncated data", valid[:len(valid)-40], nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestEditInPlace(t *testing.T) {
+	path := writeTestFile(t, testFile(t))
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	f.SetString("tokenizer.chat_template", "{{ messages }}")
+	f.Delete("general.flag")
+	if err := f.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	f.Close()
+
+	edited, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer edited.Close()
+
+	if tmpl, _ := edited.GetString("tokenizer.chat_template"); tmpl != "{{ messages }}" {
+		t.Fatalf("expected chat template to be set, got %q", tmpl)
+	}
+	if _, ok := edited.Get("general.flag"); ok {
+		t.Fatal("expected general.flag to be deleted")
+	}
+
+	r, err := edited.TensorReader("output.weight")
+	if err != nil {
+		t.Fatalf("TensorReader failed: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	if !bytes.Equal(data, bytes.Repeat([]byte{0xab}, 34)) {
+		t.Fatalf("tensor data was not copied, got %v", data)
+	}
+}
+
+func TestWriteFileMode(t *testing.T) {
+	path := writeTestFile(t, testFile(t))
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Fatalf("expected a new file to have mode 0644, got %v", info.Mode().Perm())
+	}
+
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := testFile(t).WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("expected a rewritten file to keep mode 0640, got %v", info.Mode().Perm())
+	}
+}
+
+func TestAlignment(t *testing.T) {
+	f := testFile(t)
+	f.Set(KeyAlignment, Value{Type: ValueTypeUint32, data: uint32(64)})
+
+	g, err := Open(writeTestFile(t, f))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer g.Close()
+
+	if g.Alignment() != 64 || g.DataOffset%64 != 0 {
+		t.Fatalf("expected 64 byte alignment, got %d with data at %d", g.Alignment(), g.DataOffset)
+	}
+	for _, ti := range g.Tensors {
+		if ti.Offset%64 != 0 {
+			t.Fatalf("tensor %s has offset %d", ti.Name, ti.Offset)
+		}
+	}
+
+	f.Set(KeyAlignment, Value{Type: ValueTypeUint32, data: uint32(48)})
+	if _, err := f.WriteTo(io.Discard); err == nil {
+		t.Fatal("expected error writing an invalid alignment")
+	}
+}
+
+func TestAddTensorInvalid(t *testing.T) {
+	f := New()
+	if err := f.AddTensor("a", GGMLTypeF32, []uint64{2}, make([]byte, 4)); err == nil {
+		t.Fatal("expected error for data of the wrong size")
+	}
+	if err := f.AddTensor("a", GGMLTypeF32, nil, nil); err == nil {
+		t.Fatal("expected error for a tensor without dimensions")
+	}
+	if err := f.AddTensor("a", GGMLTypeF32, []uint64{1}, make([]byte, 4)); err != nil {
+		t.Fatalf("AddTensor failed: %v", err)
+	}
+	if err := f.AddTensor("a", GGMLTypeF32, []uint64{1}, make([]byte, 4)); err == nil {
+		t.Fatal("expected error for a duplicate tensor")
+	}
+}
+
+func TestGGMLTypeString(t *testing.T) {
+	if GGMLTypeQ4_K.String() != "q4_K" {
+		t.Fatalf("expected q4_K, got %s", GGMLTypeQ4_K)
+	}
+	if GGMLType(99).String() != "GGMLType(99)" {
+		t.Fatalf("unexpected name %s", GGMLType(99))
+	}
+}
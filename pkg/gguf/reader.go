@@ -0,0 +1,355 @@
+package gguf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+func readFile(r io.ReaderAt, size int64) (*File, error) {
+	d := &decoder{r: bufio.NewReader(io.NewSectionReader(r, 0, size)), size: size}
+
+	magic, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if magic != Magic {
+		return nil, ErrNotGGUF
+	}
+
+	f := &File{}
+	if f.Version, err = d.uint32(); err != nil {
+		return nil, err
+	}
+	if f.Version < 2 || f.Version > 3 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, f.Version)
+	}
+
+	nTensors, err := d.uint64()
+	if err != nil {
+		return nil, err
+	}
+	nKV, err := d.uint64()
+	if err != nil {
+		return nil, err
+	}
+
+	f.KV = make([]KV, 0, d.capFor(nKV))
+	for range nKV {
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+
+		typ, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.value(ValueType(typ))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", key, err)
+		}
+
+		f.KV = append(f.KV, KV{Key: key, Value: v})
+	}
+
+	if v, ok := f.Get(KeyAlignment); ok {
+		a, ok := v.data.(uint32)
+		if !ok || !validAlignment(uint64(a)) {
+			return nil, fmt.Errorf("invalid %s %v", KeyAlignment, v)
+		}
+	}
+
+	f.Tensors = make([]TensorInfo, 0, d.capFor(nTensors))
+	for range nTensors {
+		var t TensorInfo
+		if t.Name, err = d.string(); err != nil {
+			return nil, err
+		}
+
+		nDims, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		if nDims == 0 || nDims > maxDims {
+			return nil, fmt.Errorf("tensor %s has %d dimensions", t.Name, nDims)
+		}
+
+		t.Shape = make([]uint64, nDims)
+		for i := range t.Shape {
+			if t.Shape[i], err = d.uint64(); err != nil {
+				return nil, err
+			}
+		}
+
+		typ, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		t.Type = GGMLType(typ)
+
+		if t.Offset, err = d.uint64(); err != nil {
+			return nil, err
+		}
+
+		f.Tensors = append(f.Tensors, t)
+	}
+
+	alignment := f.Alignment()
+	f.DataOffset = int64(alignTo(uint64(d.n), alignment))
+
+	if err := f.locateTensors(r, size, alignment); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// locateTensors checks that every tensor lies within the file and records
+// where its data is.
+func (f *File) locateTensors(r io.ReaderAt, size int64, alignment uint64) error {
+	dataSize := uint64(max(size-f.DataOffset, 0))
+
+	// the span of each tensor runs to the next tensor by offset
+	order := make([]int, len(f.Tensors))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return compareUint64(f.Tensors[a].Offset, f.Tensors[b].Offset)
+	})
+
+	for i, idx := range order {
+		t := &f.Tensors[idx]
+		if t.Offset%alignment != 0 {
+			return fmt.Errorf("tensor %s has misaligned offset %d", t.Name, t.Offset)
+		}
+
+		end := dataSize
+		if i+1 < len(order) {
+			end = f.Tensors[order[i+1]].Offset
+		}
+		if t.Offset > end {
+			return fmt.Errorf("tensor %s has offset %d past the end of the data", t.Name, t.Offset)
+		}
+
+		t.src = r
+		t.pos = f.DataOffset + int64(t.Offset)
+		t.span = int64(end - t.Offset)
+
+		if n, ok := t.dataSize(); ok && n > uint64(t.span) {
+			return fmt.Errorf("tensor %s needs %d bytes of data, only %d are available", t.Name, n, t.span)
+		}
+	}
+
+	return nil
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// decoder reads the little-endian values of a GGUF header, keeping count of
+// the bytes read so that lengths can be checked against what is left.
+type decoder struct {
+	r    *bufio.Reader
+	n    int64
+	size int64
+	buf  [8]byte
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	d.n += int64(n)
+	return d.buf[:n], nil
+}
+
+func (d *decoder) uint8() (uint8, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	b, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	b, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint64()
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(d.size-d.n) {
+		return "", fmt.Errorf("string of %d bytes runs past the end of the file", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return "", io.ErrUnexpectedEOF
+	}
+	d.n += int64(n)
+
+	return string(b), nil
+}
+
+// capFor limits the capacity preallocated for n entries read from the file,
+// so that a corrupt count cannot cause a huge allocation.
+func (d *decoder) capFor(n uint64) int {
+	return int(min(n, uint64(d.size-d.n), 1<<16))
+}
+
+func (d *decoder) value(typ ValueType) (Value, error) {
+	if typ == ValueTypeArray {
+		return d.array()
+	}
+
+	var (
+		v   any
+		err error
+	)
+	switch typ {
+	case ValueTypeUint8:
+		v, err = d.uint8()
+	case ValueTypeInt8:
+		var u uint8
+		u, err = d.uint8()
+		v = int8(u)
+	case ValueTypeUint16:
+		v, err = d.uint16()
+	case ValueTypeInt16:
+		var u uint16
+		u, err = d.uint16()
+		v = int16(u)
+	case ValueTypeUint32:
+		v, err = d.uint32()
+	case ValueTypeInt32:
+		var u uint32
+		u, err = d.uint32()
+		v = int32(u)
+	case ValueTypeFloat32:
+		var u uint32
+		u, err = d.uint32()
+		v = math.Float32frombits(u)
+	case ValueTypeBool:
+		var u uint8
+		u, err = d.uint8()
+		v = u != 0
+	case ValueTypeString:
+		v, err = d.string()
+	case ValueTypeUint64:
+		v, err = d.uint64()
+	case ValueTypeInt64:
+		var u uint64
+		u, err = d.uint64()
+		v = int64(u)
+	case ValueTypeFloat64:
+		var u uint64
+		u, err = d.uint64()
+		v = math.Float64frombits(u)
+	default:
+		return Value{}, fmt.Errorf("unknown value type %d", typ)
+	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{Type: typ, data: v}, nil
+}
+
+func (d *decoder) array() (Value, error) {
+	t, err := d.uint32()
+	if err != nil {
+		return Value{}, err
+	}
+	elem := ValueType(t)
+
+	n, err := d.uint64()
+	if err != nil {
+		return Value{}, err
+	}
+	// every element takes at least one byte
+	if n > uint64(d.size-d.n) {
+		return Value{}, fmt.Errorf("array of %d elements runs past the end of the file", n)
+	}
+
+	switch elem {
+	case ValueTypeUint8:
+		return readArray(d, elem, n, d.uint8)
+	case ValueTypeInt8:
+		return readArray(d, elem, n, func() (int8, error) { u, err := d.uint8(); return int8(u), err })
+	case ValueTypeUint16:
+		return readArray(d, elem, n, d.uint16)
+	case ValueTypeInt16:
+		return readArray(d, elem, n, func() (int16, error) { u, err := d.uint16(); return int16(u), err })
+	case ValueTypeUint32:
+		return readArray(d, elem, n, d.uint32)
+	case ValueTypeInt32:
+		return readArray(d, elem, n, func() (int32, error) { u, err := d.uint32(); return int32(u), err })
+	case ValueTypeFloat32:
+		return readArray(d, elem, n, func() (float32, error) { u, err := d.uint32(); return math.Float32frombits(u), err })
+	case ValueTypeBool:
+		return readArray(d, elem, n, func() (bool, error) { u, err := d.uint8(); return u != 0, err })
+	case ValueTypeString:
+		return readArray(d, elem, n, d.string)
+	case ValueTypeUint64:
+		return readArray(d, elem, n, d.uint64)
+	case ValueTypeInt64:
+		return readArray(d, elem, n, func() (int64, error) { u, err := d.uint64(); return int64(u), err })
+	case ValueTypeFloat64:
+		return readArray(d, elem, n, func() (float64, error) { u, err := d.uint64(); return math.Float64frombits(u), err })
+	case ValueTypeArray:
+		return readArray(d, elem, n, d.array)
+	default:
+		return Value{}, fmt.Errorf("unknown array element type %d", elem)
+	}
+}
+
+func readArray[T any](d *decoder, elem ValueType, n uint64, read func() (T, error)) (Value, error) {
+	s := make([]T, 0, d.capFor(n))
+	for range n {
+		v, err := read()
+		if err != nil {
+			return Value{}, err
+		}
+		s = append(s, v)
+	}
+	return arrayValue(elem, s), nil
+}
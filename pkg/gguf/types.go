@@ -0,0 +1,108 @@
+package gguf
+
+import "fmt"
+
+// GGMLType is the data type of a tensor, with the same values as enum ggml_type
+// and llama.GGMLType.
+type GGMLType int32
+
+const (
+	GGMLTypeF32     GGMLType = 0
+	GGMLTypeF16     GGMLType = 1
+	GGMLTypeQ4_0    GGMLType = 2
+	GGMLTypeQ4_1    GGMLType = 3
+	GGMLTypeQ5_0    GGMLType = 6
+	GGMLTypeQ5_1    GGMLType = 7
+	GGMLTypeQ8_0    GGMLType = 8
+	GGMLTypeQ8_1    GGMLType = 9
+	GGMLTypeQ2_K    GGMLType = 10
+	GGMLTypeQ3_K    GGMLType = 11
+	GGMLTypeQ4_K    GGMLType = 12
+	GGMLTypeQ5_K    GGMLType = 13
+	GGMLTypeQ6_K    GGMLType = 14
+	GGMLTypeQ8_K    GGMLType = 15
+	GGMLTypeIQ2_XXS GGMLType = 16
+	GGMLTypeIQ2_XS  GGMLType = 17
+	GGMLTypeIQ3_XXS GGMLType = 18
+	GGMLTypeIQ1_S   GGMLType = 19
+	GGMLTypeIQ4_NL  GGMLType = 20
+	GGMLTypeIQ3_S   GGMLType = 21
+	GGMLTypeIQ2_S   GGMLType = 22
+	GGMLTypeIQ4_XS  GGMLType = 23
+	GGMLTypeI8      GGMLType = 24
+	GGMLTypeI16     GGMLType = 25
+	GGMLTypeI32     GGMLType = 26
+	GGMLTypeI64     GGMLType = 27
+	GGMLTypeF64     GGMLType = 28
+	GGMLTypeIQ1_M   GGMLType = 29
+	GGMLTypeBF16    GGMLType = 30
+	GGMLTypeTQ1_0   GGMLType = 34
+	GGMLTypeTQ2_0   GGMLType = 35
+	GGMLTypeMXFP4   GGMLType = 39
+	GGMLTypeNVFP4   GGMLType = 40
+	GGMLTypeQ1_0    GGMLType = 41
+	GGMLTypeQ2_0    GGMLType = 42
+)
+
+// ggmlTypeTraits is the part of ggml's type traits needed to size tensor data.
+type ggmlTypeTraits struct {
+	name      string
+	blockSize uint64 // elements per block
+	typeSize  uint64 // bytes per block, 0 when not known here
+}
+
+var ggmlTypes = map[GGMLType]ggmlTypeTraits{
+	GGMLTypeF32:     {"f32", 1, 4},
+	GGMLTypeF16:     {"f16", 1, 2},
+	GGMLTypeQ4_0:    {"q4_0", 32, 18},
+	GGMLTypeQ4_1:    {"q4_1", 32, 20},
+	GGMLTypeQ5_0:    {"q5_0", 32, 22},
+	GGMLTypeQ5_1:    {"q5_1", 32, 24},
+	GGMLTypeQ8_0:    {"q8_0", 32, 34},
+	GGMLTypeQ8_1:    {"q8_1", 32, 36},
+	GGMLTypeQ2_K:    {"q2_K", 256, 84},
+	GGMLTypeQ3_K:    {"q3_K", 256, 110},
+	GGMLTypeQ4_K:    {"q4_K", 256, 144},
+	GGMLTypeQ5_K:    {"q5_K", 256, 176},
+	GGMLTypeQ6_K:    {"q6_K", 256, 210},
+	GGMLTypeQ8_K:    {"q8_K", 256, 292},
+	GGMLTypeIQ2_XXS: {"iq2_xxs", 256, 66},
+	GGMLTypeIQ2_XS:  {"iq2_xs", 256, 74},
+	GGMLTypeIQ3_XXS: {"iq3_xxs", 256, 98},
+	GGMLTypeIQ1_S:   {"iq1_s", 256, 50},
+	GGMLTypeIQ4_NL:  {"iq4_nl", 32, 18},
+	GGMLTypeIQ3_S:   {"iq3_s", 256, 110},
+	GGMLTypeIQ2_S:   {"iq2_s", 256, 82},
+	GGMLTypeIQ4_XS:  {"iq4_xs", 256, 136},
+	GGMLTypeI8:      {"i8", 1, 1},
+	GGMLTypeI16:     {"i16", 1, 2},
+	GGMLTypeI32:     {"i32", 1, 4},
+	GGMLTypeI64:     {"i64", 1, 8},
+	GGMLTypeF64:     {"f64", 1, 8},
+	GGMLTypeIQ1_M:   {"iq1_m", 256, 56},
+	GGMLTypeBF16:    {"bf16", 1, 2},
+	GGMLTypeTQ1_0:   {"tq1_0", 256, 54},
+	GGMLTypeTQ2_0:   {"tq2_0", 256, 66},
+	GGMLTypeMXFP4:   {"mxfp4", 32, 17},
+	GGMLTypeNVFP4:   {"nvfp4", 0, 0},
+	GGMLTypeQ1_0:    {"q1_0", 0, 0},
+	GGMLTypeQ2_0:    {"q2_0", 0, 0},
+}
+
+// String returns the name ggml uses for the type, for example "q4_K".
+func (t GGMLType) String() string {
+	if tt, ok := ggmlTypes[t]; ok {
+		return tt.name
+	}
+	return fmt.Sprintf("GGMLType(%d)", int32(t))
+}
+
+// RowSize returns the number of bytes taken by ne elements of the type, or
+// false if the size of the type is not known.
+func (t GGMLType) RowSize(ne uint64) (uint64, bool) {
+	tt, ok := ggmlTypes[t]
+	if !ok || tt.typeSize == 0 || ne%tt.blockSize != 0 {
+		return 0, false
+	}
+	return ne / tt.blockSize * tt.typeSize, true
+}
@@ -0,0 +1,302 @@
+package gguf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type of a metadata value, as stored in the file.
+type ValueType uint32
+
+const (
+	ValueTypeUint8 ValueType = iota
+	ValueTypeInt8
+	ValueTypeUint16
+	ValueTypeInt16
+	ValueTypeUint32
+	ValueTypeInt32
+	ValueTypeFloat32
+	ValueTypeBool
+	ValueTypeString
+	ValueTypeArray
+	ValueTypeUint64
+	ValueTypeInt64
+	ValueTypeFloat64
+)
+
+// String returns the name of the value type.
+func (t ValueType) String() string {
+	switch t {
+	case ValueTypeUint8:
+		return "u8"
+	case ValueTypeInt8:
+		return "i8"
+	case ValueTypeUint16:
+		return "u16"
+	case ValueTypeInt16:
+		return "i16"
+	case ValueTypeUint32:
+		return "u32"
+	case ValueTypeInt32:
+		return "i32"
+	case ValueTypeFloat32:
+		return "f32"
+	case ValueTypeBool:
+		return "bool"
+	case ValueTypeString:
+		return "str"
+	case ValueTypeArray:
+		return "arr"
+	case ValueTypeUint64:
+		return "u64"
+	case ValueTypeInt64:
+		return "i64"
+	case ValueTypeFloat64:
+		return "f64"
+	default:
+		return fmt.Sprintf("ValueType(%d)", uint32(t))
+	}
+}
+
+// KV is a single metadata entry.
+type KV struct {
+	Key   string
+	Value Value
+}
+
+// Value is a typed metadata value.
+//
+// Scalars hold the Go type matching Type, for example uint32 for
+// ValueTypeUint32. Arrays hold a slice of the element type, for example
+// []string for an array of strings, or []Value for an array of arrays.
+type Value struct {
+	Type      ValueType // type of the value
+	ArrayType ValueType // type of the elements, when Type is ValueTypeArray
+
+	data any
+}
+
+// NewValue creates a Value from a Go value. It accepts the fixed-size integer
+// and float types, bool and string, slices of those, and []Value holding
+// arrays of a single type.
+func NewValue(v any) (Value, error) {
+	switch v := v.(type) {
+	case uint8:
+		return Value{Type: ValueTypeUint8, data: v}, nil
+	case int8:
+		return Value{Type: ValueTypeInt8, data: v}, nil
+	case uint16:
+		return Value{Type: ValueTypeUint16, data: v}, nil
+	case int16:
+		return Value{Type: ValueTypeInt16, data: v}, nil
+	case uint32:
+		return Value{Type: ValueTypeUint32, data: v}, nil
+	case int32:
+		return Value{Type: ValueTypeInt32, data: v}, nil
+	case float32:
+		return Value{Type: ValueTypeFloat32, data: v}, nil
+	case bool:
+		return Value{Type: ValueTypeBool, data: v}, nil
+	case string:
+		return Value{Type: ValueTypeString, data: v}, nil
+	case uint64:
+		return Value{Type: ValueTypeUint64, data: v}, nil
+	case int64:
+		return Value{Type: ValueTypeInt64, data: v}, nil
+	case float64:
+		return Value{Type: ValueTypeFloat64, data: v}, nil
+	case []uint8:
+		return arrayValue(ValueTypeUint8, v), nil
+	case []int8:
+		return arrayValue(ValueTypeInt8, v), nil
+	case []uint16:
+		return arrayValue(ValueTypeUint16, v), nil
+	case []int16:
+		return arrayValue(ValueTypeInt16, v), nil
+	case []uint32:
+		return arrayValue(ValueTypeUint32, v), nil
+	case []int32:
+		return arrayValue(ValueTypeInt32, v), nil
+	case []float32:
+		return arrayValue(ValueTypeFloat32, v), nil
+	case []bool:
+		return arrayValue(ValueTypeBool, v), nil
+	case []string:
+		return arrayValue(ValueTypeString, v), nil
+	case []uint64:
+		return arrayValue(ValueTypeUint64, v), nil
+	case []int64:
+		return arrayValue(ValueTypeInt64, v), nil
+	case []float64:
+		return arrayValue(ValueTypeFloat64, v), nil
+	case []Value:
+		for i, e := range v {
+			if e.Type != ValueTypeArray || (i > 0 && e.ArrayType != v[0].ArrayType) {
+				return Value{}, fmt.Errorf("array of arrays must hold arrays of a single type")
+			}
+		}
+		return arrayValue(ValueTypeArray, v), nil
+	default:
+		return Value{}, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+func arrayValue(elem ValueType, data any) Value {
+	return Value{Type: ValueTypeArray, ArrayType: elem, data: data}
+}
+
+// Any returns the value as the Go type described on Value.
+func (v Value) Any() any {
+	return v.data
+}
+
+// Len returns the number of elements of an array, or 0 for any other value.
+func (v Value) Len() int {
+	switch d := v.data.(type) {
+	case []uint8:
+		return len(d)
+	case []int8:
+		return len(d)
+	case []uint16:
+		return len(d)
+	case []int16:
+		return len(d)
+	case []uint32:
+		return len(d)
+	case []int32:
+		return len(d)
+	case []float32:
+		return len(d)
+	case []bool:
+		return len(d)
+	case []string:
+		return len(d)
+	case []uint64:
+		return len(d)
+	case []int64:
+		return len(d)
+	case []float64:
+		return len(d)
+	case []Value:
+		return len(d)
+	default:
+		return 0
+	}
+}
+
+// AsString returns the value if it is a string.
+func (v Value) AsString() (string, bool) {
+	s, ok := v.data.(string)
+	return s, ok
+}
+
+// AsStrings returns the value if it is an array of strings.
+func (v Value) AsStrings() ([]string, bool) {
+	s, ok := v.data.([]string)
+	return s, ok
+}
+
+// AsBool returns the value if it is a bool.
+func (v Value) AsBool() (bool, bool) {
+	b, ok := v.data.(bool)
+	return b, ok
+}
+
+// AsUint64 returns the value if it is an integer that fits in a uint64.
+func (v Value) AsUint64() (uint64, bool) {
+	switch d := v.data.(type) {
+	case uint8:
+		return uint64(d), true
+	case uint16:
+		return uint64(d), true
+	case uint32:
+		return uint64(d), true
+	case uint64:
+		return d, true
+	}
+
+	if i, ok := v.AsInt64(); ok && i >= 0 {
+		return uint64(i), true
+	}
+	return 0, false
+}
+
+// AsInt64 returns the value if it is an integer that fits in an int64.
+func (v Value) AsInt64() (int64, bool) {
+	switch d := v.data.(type) {
+	case int8:
+		return int64(d), true
+	case int16:
+		return int64(d), true
+	case int32:
+		return int64(d), true
+	case int64:
+		return d, true
+	case uint8:
+		return int64(d), true
+	case uint16:
+		return int64(d), true
+	case uint32:
+		return int64(d), true
+	case uint64:
+		if d <= 1<<63-1 {
+			return int64(d), true
+		}
+	}
+	return 0, false
+}
+
+// AsFloat64 returns the value if it is a float or an integer.
+func (v Value) AsFloat64() (float64, bool) {
+	switch d := v.data.(type) {
+	case float32:
+		return float64(d), true
+	case float64:
+		return d, true
+	}
+
+	if i, ok := v.AsInt64(); ok {
+		return float64(i), true
+	}
+	if u, ok := v.AsUint64(); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+// String formats the value for display. Strings are returned as they are,
+// and arrays are formatted as a list with their strings quoted.
+func (v Value) String() string {
+	if s, ok := v.data.(string); ok {
+		return s
+	}
+	if v.Type != ValueTypeArray {
+		return fmt.Sprint(v.data)
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('[')
+	switch d := v.data.(type) {
+	case []string:
+		for i, s := range d {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(strconv.Quote(s))
+		}
+	case []Value:
+		for i, e := range d {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(e.String())
+		}
+	default:
+		s := fmt.Sprint(d)
+		sb.WriteString(strings.ReplaceAll(s[1:len(s)-1], " ", ", "))
+	}
+	sb.WriteByte(']')
+
+	return sb.String()
+}
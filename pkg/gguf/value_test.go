@@ -0,0 +1,92 @@
+package gguf
+
+import (
+	"testing"
+)
+
+func TestNewValue(t *testing.T) {
+	tests := []struct {
+		in        any
+		typ       ValueType
+		arrayType ValueType
+		str       string
+	}{
+		{uint8(1), ValueTypeUint8, 0, "1"},
+		{int32(-3), ValueTypeInt32, 0, "-3"},
+		{float32(0.5), ValueTypeFloat32, 0, "0.5"},
+		{true, ValueTypeBool, 0, "true"},
+		{"hello", ValueTypeString, 0, "hello"},
+		{uint64(7), ValueTypeUint64, 0, "7"},
+		{[]int32{1, 2, 3}, ValueTypeArray, ValueTypeInt32, "[1, 2, 3]"},
+		{[]string{"a", "b c"}, ValueTypeArray, ValueTypeString, `["a", "b c"]`},
+	}
+
+	for _, tt := range tests {
+		v, err := NewValue(tt.in)
+		if err != nil {
+			t.Fatalf("NewValue(%v) failed: %v", tt.in, err)
+		}
+		if v.Type != tt.typ || v.ArrayType != tt.arrayType {
+			t.Errorf("NewValue(%v): expected %v %v, got %v %v", tt.in, tt.typ, tt.arrayType, v.Type, v.ArrayType)
+		}
+		if v.String() != tt.str {
+			t.Errorf("NewValue(%v).String() = %q, expected %q", tt.in, v.String(), tt.str)
+		}
+	}
+
+	if _, err := NewValue(42); err == nil {
+		t.Fatal("expected error for int")
+	}
+}
+
+func TestNewValueNestedArray(t *testing.T) {
+	a, _ := NewValue([]int32{1})
+	b, _ := NewValue([]int32{2, 3})
+	s, _ := NewValue([]string{"x"})
+
+	v, err := NewValue([]Value{a, b})
+	if err != nil {
+		t.Fatalf("NewValue failed: %v", err)
+	}
+	if v.ArrayType != ValueTypeArray || v.Len() != 2 || v.String() != "[[1], [2, 3]]" {
+		t.Fatalf("unexpected nested array %v", v)
+	}
+
+	if _, err := NewValue([]Value{a, s}); err == nil {
+		t.Fatal("expected error for arrays of mixed types")
+	}
+}
+
+func TestValueConversions(t *testing.T) {
+	u, _ := NewValue(uint32(5))
+	if n, ok := u.AsInt64(); !ok || n != 5 {
+		t.Fatalf("AsInt64 = %d %v", n, ok)
+	}
+	if f, ok := u.AsFloat64(); !ok || f != 5 {
+		t.Fatalf("AsFloat64 = %v %v", f, ok)
+	}
+
+	neg, _ := NewValue(int8(-1))
+	if _, ok := neg.AsUint64(); ok {
+		t.Fatal("expected a negative value not to convert to uint64")
+	}
+
+	big, _ := NewValue(uint64(1 << 63))
+	if _, ok := big.AsInt64(); ok {
+		t.Fatal("expected a value above MaxInt64 not to convert to int64")
+	}
+
+	s, _ := NewValue("x")
+	if _, ok := s.AsFloat64(); ok {
+		t.Fatal("expected a string not to convert to float64")
+	}
+	if s.Len() != 0 {
+		t.Fatalf("expected length 0 for a scalar, got %d", s.Len())
+	}
+}
+
+func TestValueTypeString(t *testing.T) {
+	if ValueTypeArray.String() != "arr" || ValueType(99).String() != "ValueType(99)" {
+		t.Fatalf("unexpected names %s %s", ValueTypeArray, ValueType(99))
+	}
+}
@@ -0,0 +1,286 @@
+package gguf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// WriteTo writes the file in GGUF v3 format to w, copying the data of each
+// tensor from the file it was read from or from memory. Tensor offsets are
+// laid out afresh, so metadata and tensors can be freely added, changed and
+// removed beforehand.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	alignment := uint64(DefaultAlignment)
+	if v, ok := f.Get(KeyAlignment); ok {
+		a, ok := v.data.(uint32)
+		if !ok || !validAlignment(uint64(a)) {
+			return 0, fmt.Errorf("invalid %s %v", KeyAlignment, v)
+		}
+		alignment = uint64(a)
+	}
+
+	for _, kv := range f.KV {
+		if want, err := NewValue(kv.Value.data); err != nil || want.Type != kv.Value.Type || want.ArrayType != kv.Value.ArrayType {
+			return 0, fmt.Errorf("invalid value for %s", kv.Key)
+		}
+	}
+
+	offsets := make([]uint64, len(f.Tensors))
+	var offset uint64
+	for i, t := range f.Tensors {
+		if len(t.Shape) == 0 || len(t.Shape) > maxDims {
+			return 0, fmt.Errorf("tensor %s has %d dimensions", t.Name, len(t.Shape))
+		}
+		offsets[i] = offset
+		offset = alignTo(offset+t.Size(), alignment)
+	}
+
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.uint32(Magic)
+	e.uint32(Version)
+	e.uint64(uint64(len(f.Tensors)))
+	e.uint64(uint64(len(f.KV)))
+
+	for _, kv := range f.KV {
+		e.string(kv.Key)
+		e.uint32(uint32(kv.Value.Type))
+		if err := e.value(kv.Value); err != nil {
+			return e.n, fmt.Errorf("writing %s: %w", kv.Key, err)
+		}
+	}
+
+	for i, t := range f.Tensors {
+		e.string(t.Name)
+		e.uint32(uint32(len(t.Shape)))
+		for _, d := range t.Shape {
+			e.uint64(d)
+		}
+		e.uint32(uint32(t.Type))
+		e.uint64(offsets[i])
+	}
+
+	e.pad(alignment)
+
+	for _, t := range f.Tensors {
+		r, err := t.reader()
+		if err != nil {
+			return e.n, err
+		}
+
+		if e.err == nil {
+			n, err := io.Copy(e.w, r)
+			e.n += n
+			if err == nil && n != r.Size() {
+				err = fmt.Errorf("tensor %s: %w", t.Name, io.ErrUnexpectedEOF)
+			}
+			e.err = err
+		}
+		e.pad(alignment)
+	}
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+
+	return e.n, e.err
+}
+
+// WriteFile writes the file to path, by way of a temporary file in the same
+// directory that is renamed over path once it is complete. This makes it safe
+// to write back to the file the File was read from. An existing file keeps
+// its permissions, and a new one is created with mode 0644.
+func (f *File) WriteFile(path string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// encoder writes the little-endian values of a GGUF file, remembering the
+// first error so that a header can be written without checking every call.
+type encoder struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+
+	n, err := e.w.Write(b)
+	e.n += int64(n)
+	e.err = err
+}
+
+func (e *encoder) uint8(v uint8) {
+	e.buf[0] = v
+	e.write(e.buf[:1])
+}
+
+func (e *encoder) uint16(v uint16) {
+	binary.LittleEndian.PutUint16(e.buf[:], v)
+	e.write(e.buf[:2])
+}
+
+func (e *encoder) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(e.buf[:], v)
+	e.write(e.buf[:4])
+}
+
+func (e *encoder) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:], v)
+	e.write(e.buf[:8])
+}
+
+func (e *encoder) string(s string) {
+	e.uint64(uint64(len(s)))
+	if e.err == nil {
+		n, err := e.w.WriteString(s)
+		e.n += int64(n)
+		e.err = err
+	}
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.uint8(1)
+	} else {
+		e.uint8(0)
+	}
+}
+
+// pad writes zeros up to the next multiple of alignment.
+func (e *encoder) pad(alignment uint64) {
+	if n := alignTo(uint64(e.n), alignment) - uint64(e.n); n > 0 {
+		e.write(make([]byte, n))
+	}
+}
+
+func (e *encoder) value(v Value) error {
+	switch d := v.data.(type) {
+	case uint8:
+		e.uint8(d)
+	case int8:
+		e.uint8(uint8(d))
+	case uint16:
+		e.uint16(d)
+	case int16:
+		e.uint16(uint16(d))
+	case uint32:
+		e.uint32(d)
+	case int32:
+		e.uint32(uint32(d))
+	case float32:
+		e.uint32(math.Float32bits(d))
+	case bool:
+		e.bool(d)
+	case string:
+		e.string(d)
+	case uint64:
+		e.uint64(d)
+	case int64:
+		e.uint64(uint64(d))
+	case float64:
+		e.uint64(math.Float64bits(d))
+	default:
+		if v.Type != ValueTypeArray {
+			return fmt.Errorf("value of type %v holds %T", v.Type, v.data)
+		}
+		e.uint32(uint32(v.ArrayType))
+		e.uint64(uint64(v.Len()))
+		return e.array(v)
+	}
+
+	return nil
+}
+
+func (e *encoder) array(v Value) error {
+	switch d := v.data.(type) {
+	case []uint8:
+		e.write(d)
+	case []int8:
+		for _, x := range d {
+			e.uint8(uint8(x))
+		}
+	case []uint16:
+		for _, x := range d {
+			e.uint16(x)
+		}
+	case []int16:
+		for _, x := range d {
+			e.uint16(uint16(x))
+		}
+	case []uint32:
+		for _, x := range d {
+			e.uint32(x)
+		}
+	case []int32:
+		for _, x := range d {
+			e.uint32(uint32(x))
+		}
+	case []float32:
+		for _, x := range d {
+			e.uint32(math.Float32bits(x))
+		}
+	case []bool:
+		for _, x := range d {
+			e.bool(x)
+		}
+	case []string:
+		for _, x := range d {
+			e.string(x)
+		}
+	case []uint64:
+		for _, x := range d {
+			e.uint64(x)
+		}
+	case []int64:
+		for _, x := range d {
+			e.uint64(uint64(x))
+		}
+	case []float64:
+		for _, x := range d {
+			e.uint64(math.Float64bits(x))
+		}
+	case []Value:
+		for _, x := range d {
+			e.uint32(uint32(x.ArrayType))
+			e.uint64(uint64(x.Len()))
+			if err := e.array(x); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("array of type %v holds %T", v.ArrayType, v.data)
+	}
+
+	return nil
+}
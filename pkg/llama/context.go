@@ -357,6 +357,7 @@ func Free(ctx Context) error {
 		return errInvalidContext
 	}
 	freeFunc.Call(nil, unsafe.Pointer(&ctx))
+	releaseEvalCallback(ctx)
 	return nil
 }
 
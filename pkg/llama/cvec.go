@@ -0,0 +1,220 @@
+package llama
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/gguf"
+)
+
+// ControlVector holds the combined directions of one or more control vectors.
+// Data is laid out as NEmbd x NLayers starting from layer 1, which is the
+// layout SetAdapterCvec expects.
+type ControlVector struct {
+	NEmbd int32     // size of a single layer's direction
+	Data  []float32 // NEmbd x NLayers, starting from layer 1
+}
+
+// ControlVectorLoadInfo names a control vector file and the strength it is
+// scaled by when combined with other vectors.
+type ControlVectorLoadInfo struct {
+	Path     string
+	Strength float32
+}
+
+// controlVectorTensorPrefix is the name prefix of the per-layer tensors
+// written by llama.cpp's cvector-generator, e.g. "direction.12".
+const controlVectorTensorPrefix = "direction."
+
+var (
+	errNoControlVectors     = errors.New("no valid control vector files passed")
+	errControlVectorNEmbd   = errors.New("control vector n_embd does not match model")
+	errControlVectorEmpty   = errors.New("control vector has no data")
+	errControlVectorInvalid = errors.New("invalid control vector file")
+)
+
+// NLayers returns the number of layers covered by the control vector.
+func (cv ControlVector) NLayers() int32 {
+	if cv.NEmbd <= 0 {
+		return 0
+	}
+	return int32(len(cv.Data) / int(cv.NEmbd))
+}
+
+// ControlVectorLoad loads the control vector GGUF files described by infos and
+// combines them into a single ControlVector, scaling each by its strength.
+// Every file must have the same n_embd. Layers missing from a file contribute
+// nothing to the combined vector for that layer.
+func ControlVectorLoad(infos ...ControlVectorLoadInfo) (ControlVector, error) {
+	cv := ControlVector{NEmbd: -1}
+
+	for _, info := range infos {
+		nEmbd, layers, err := readControlVectorFile(info.Path)
+		if err != nil {
+			return ControlVector{}, err
+		}
+
+		if cv.NEmbd == -1 {
+			cv.NEmbd = nEmbd
+		} else if cv.NEmbd != nEmbd {
+			return ControlVector{}, fmt.Errorf("%s: %w: n_embd %d, expected %d", info.Path, errControlVectorInvalid, nEmbd, cv.NEmbd)
+		}
+
+		for layer, direction := range layers {
+			if need := int(nEmbd) * layer; len(cv.Data) < need {
+				cv.Data = append(cv.Data, make([]float32, need-len(cv.Data))...)
+			}
+
+			dst := cv.Data[int(nEmbd)*(layer-1):]
+			for i, v := range direction {
+				dst[i] += v * info.Strength
+			}
+		}
+	}
+
+	if cv.NEmbd == -1 {
+		return ControlVector{}, errNoControlVectors
+	}
+
+	return cv, nil
+}
+
+// ControlVectorApply applies a control vector to the context for the layers
+// ilStart through ilEnd (both inclusive). An ilStart of 0 or less starts at
+// layer 1, and an ilEnd of 0 or less ends at the last layer of the model.
+// The n_embd of the control vector must match the model of the context.
+func ControlVectorApply(ctx Context, cv ControlVector, ilStart, ilEnd int32) error {
+	if ctx == 0 {
+		return errInvalidContext
+	}
+
+	if len(cv.Data) == 0 {
+		return errControlVectorEmpty
+	}
+
+	model := GetModel(ctx)
+	if nEmbd := ModelNEmbd(model); cv.NEmbd != nEmbd {
+		return fmt.Errorf("%w: n_embd %d, model %d", errControlVectorNEmbd, cv.NEmbd, nEmbd)
+	}
+
+	if ilStart <= 0 {
+		ilStart = 1
+	}
+	if ilEnd <= 0 {
+		ilEnd = ModelNLayer(model)
+	}
+
+	if result := SetAdapterCvec(ctx, cv.Data, cv.NEmbd, ilStart, ilEnd); result != 0 {
+		return fmt.Errorf("failed to apply control vector: %d", result)
+	}
+
+	return nil
+}
+
+// ControlVectorClear removes any control vector applied to the context.
+func ControlVectorClear(ctx Context) error {
+	if ctx == 0 {
+		return errInvalidContext
+	}
+
+	if result := SetAdapterCvec(ctx, nil, 0, 0, 0); result != 0 {
+		return fmt.Errorf("failed to clear control vector: %d", result)
+	}
+
+	return nil
+}
+
+// ControlVectorSave writes a control vector to a GGUF file in the format read
+// by ControlVectorLoad and by llama.cpp, with one "direction.N" tensor per
+// layer. modelHint is stored as controlvector.model_hint, conventionally the
+// architecture of the model the vector was generated for.
+func ControlVectorSave(cv ControlVector, path, modelHint string) error {
+	nLayers := int(cv.NLayers())
+	if nLayers == 0 {
+		return errControlVectorEmpty
+	}
+
+	f := gguf.New()
+	f.SetString(gguf.KeyArchitecture, "controlvector")
+	f.SetString("controlvector.model_hint", modelHint)
+	layerCount, _ := gguf.NewValue(int32(nLayers))
+	f.Set("controlvector.layer_count", layerCount)
+
+	nEmbd := int(cv.NEmbd)
+	for il := range nLayers {
+		data := make([]byte, 4*nEmbd)
+		for i, v := range cv.Data[il*nEmbd : (il+1)*nEmbd] {
+			binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+		}
+
+		name := controlVectorTensorPrefix + strconv.Itoa(il+1)
+		if err := f.AddTensor(name, gguf.GGMLTypeF32, []uint64{uint64(nEmbd)}, data); err != nil {
+			return err
+		}
+	}
+
+	return f.WriteFile(path)
+}
+
+// readControlVectorFile reads the "direction.N" tensors from a control vector
+// GGUF file. It returns n_embd and the direction for each layer index found.
+func readControlVectorFile(path string) (int32, map[int][]float32, error) {
+	f, err := gguf.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	nEmbd := int32(-1)
+	layers := make(map[int][]float32)
+
+	for _, t := range f.Tensors {
+		name, ok := strings.CutPrefix(t.Name, controlVectorTensorPrefix)
+		if !ok {
+			continue
+		}
+
+		layer, err := strconv.Atoi(name)
+		if err != nil || layer <= 0 {
+			return 0, nil, fmt.Errorf("%s: %w: invalid direction tensor layer index %q", path, errControlVectorInvalid, name)
+		}
+
+		if t.Type != gguf.GGMLTypeF32 {
+			return 0, nil, fmt.Errorf("%s: %w: direction tensor %s is not F32", path, errControlVectorInvalid, t.Name)
+		}
+
+		if len(t.Shape) != 1 {
+			return 0, nil, fmt.Errorf("%s: %w: direction tensor %s is not one-dimensional", path, errControlVectorInvalid, t.Name)
+		}
+
+		n := int32(t.Shape[0])
+		if nEmbd == -1 {
+			nEmbd = n
+		} else if nEmbd != n {
+			return 0, nil, fmt.Errorf("%s: %w: direction tensor %s has n_embd %d, expected %d", path, errControlVectorInvalid, t.Name, n, nEmbd)
+		}
+
+		r, err := f.TensorReader(t.Name)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		buf := make([]byte, 4*int(n))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, nil, fmt.Errorf("%s: reading %s: %w", path, t.Name, err)
+		}
+
+		layers[layer] = bytesToFloat32(buf)
+	}
+
+	if nEmbd == -1 {
+		return 0, nil, fmt.Errorf("%s: %w: no direction tensors found", path, errControlVectorInvalid)
+	}
+
+	return nEmbd, layers, nil
+}
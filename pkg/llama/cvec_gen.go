@@ -0,0 +1,393 @@
+package llama
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ControlVectorMethod selects how a per-layer direction is computed from the
+// differences between positive and negative hidden states.
+type ControlVectorMethod int32
+
+const (
+	// ControlVectorMethodPCA uses the principal component of the differences.
+	ControlVectorMethodPCA ControlVectorMethod = iota
+	// ControlVectorMethodMean uses the mean of the differences.
+	ControlVectorMethodMean
+)
+
+// String returns the name of the control vector method.
+func (m ControlVectorMethod) String() string {
+	switch m {
+	case ControlVectorMethodPCA:
+		return "pca"
+	case ControlVectorMethodMean:
+		return "mean"
+	default:
+		return "ControlVectorMethod(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// ControlVectorPromptPair is a pair of prompts that differ only in the concept
+// the control vector should steer towards (Positive) or away from (Negative).
+type ControlVectorPromptPair struct {
+	Positive string
+	Negative string
+}
+
+// ControlVectorGenerateParams configures ControlVectorGenerate.
+type ControlVectorGenerateParams struct {
+	Method        ControlVectorMethod // how each layer's direction is computed
+	PCAIterations int                 // maximum power iterations for PCA (0 = 1000)
+	NThreads      int32               // number of threads to use (0 = default)
+}
+
+// ControlVectorGenerateDefaultParams returns the default parameters for ControlVectorGenerate.
+func ControlVectorGenerateDefaultParams() ControlVectorGenerateParams {
+	return ControlVectorGenerateParams{
+		Method:        ControlVectorMethodPCA,
+		PCAIterations: 1000,
+	}
+}
+
+// layerOutputPrefix is the name llama.cpp gives the output of each layer in the
+// compute graph, e.g. "l_out-12".
+const layerOutputPrefix = "l_out-"
+
+// pcaTolerance stops power iteration once the direction no longer changes.
+const pcaTolerance = 1e-7
+
+var errNoPromptPairs = errors.New("no prompt pairs passed")
+
+// ControlVectorGenerate creates a control vector for model from contrastive
+// prompt pairs, in the same way as llama.cpp's cvector-generator. Each pair is
+// evaluated and the hidden state after every layer is captured through the
+// eval callback. The per-token differences between the positive and negative
+// hidden states are then reduced to one direction per layer, using either
+// their mean or their principal component, normalised to unit length.
+//
+// Positive and negative prompts are padded with spaces to the same number of
+// tokens, so pairs should differ in as few tokens as possible.
+// The direction for layer N is computed from the output of layer N-1, and the
+// last layer is not covered, matching the files cvector-generator writes.
+func ControlVectorGenerate(model Model, pairs []ControlVectorPromptPair, params ControlVectorGenerateParams) (ControlVector, error) {
+	if model == 0 {
+		return ControlVector{}, errors.New("invalid model")
+	}
+	if len(pairs) == 0 {
+		return ControlVector{}, errNoPromptPairs
+	}
+
+	nEmbd := int(ModelNEmbd(model))
+	nLayers := int(ModelNLayer(model)) - 1
+	if nEmbd <= 0 || nLayers <= 0 {
+		return ControlVector{}, errors.New("model has no layers to steer")
+	}
+
+	vocab := ModelGetVocab(model)
+	pad := Tokenize(vocab, " ", false, false)
+	if len(pad) == 0 {
+		return ControlVector{}, errors.New("unable to tokenize padding")
+	}
+
+	tokenized := make([][2][]Token, len(pairs))
+	maxLen := 0
+	for i, p := range pairs {
+		pos := Tokenize(vocab, p.Positive, true, true)
+		neg := Tokenize(vocab, p.Negative, true, true)
+		n := max(len(pos), len(neg))
+		for len(pos) < n {
+			pos = append(pos, pad[0])
+		}
+		for len(neg) < n {
+			neg = append(neg, pad[0])
+		}
+		tokenized[i] = [2][]Token{pos, neg}
+		maxLen = max(maxLen, n)
+	}
+
+	if maxLen == 0 {
+		return ControlVector{}, errors.New("prompts are empty")
+	}
+
+	// layers[il] holds the captured output of layer il for the current prompt,
+	// as nTokens rows of nEmbd values.
+	layers := make([][]float32, nLayers)
+	cb := func(t TensorInfo, ask bool) bool {
+		il, ok := layerOutputIndex(t.Name)
+		if !ok || il >= nLayers {
+			return !ask
+		}
+
+		if ask {
+			return true
+		}
+
+		if t.Type != GGMLTypeF32 || int(t.Shape[0]) != nEmbd {
+			return true
+		}
+
+		if data, err := t.Data(); err == nil {
+			layers[il] = data
+		}
+		return true
+	}
+
+	ctxParams := ContextDefaultParams()
+	ctxParams.NCtx = uint32(maxLen)
+	ctxParams.NBatch = uint32(maxLen)
+	ctxParams.NUbatch = uint32(maxLen)
+	ctxParams.NSeqMax = 1
+	if params.NThreads > 0 {
+		ctxParams.NThreads = params.NThreads
+		ctxParams.NThreadsBatch = params.NThreads
+	}
+	ctxParams.SetEvalCallback(cb)
+
+	ctx, err := InitFromModel(model, ctxParams)
+	if err != nil {
+		return ControlVector{}, err
+	}
+	defer Free(ctx)
+
+	mem, err := GetMemory(ctx)
+	if err != nil {
+		return ControlVector{}, err
+	}
+
+	eval := func(tokens []Token) ([][]float32, error) {
+		clear(layers)
+		if err := MemoryClear(mem, true); err != nil {
+			return nil, err
+		}
+
+		ret, err := Decode(ctx, BatchGetOne(tokens))
+		if err != nil {
+			return nil, err
+		}
+		if ret != 0 {
+			return nil, fmt.Errorf("decode returned %d", ret)
+		}
+
+		out := make([][]float32, nLayers)
+		for il, l := range layers {
+			if len(l) < nEmbd*len(tokens) {
+				return nil, fmt.Errorf("missing output for layer %d", il)
+			}
+			out[il] = l[:nEmbd*len(tokens)]
+		}
+		return out, nil
+	}
+
+	// diffs[il] accumulates the non-zero difference rows for layer il
+	diffs := make([][]float32, nLayers)
+	for _, tok := range tokenized {
+		pos, err := eval(tok[0])
+		if err != nil {
+			return ControlVector{}, err
+		}
+
+		neg, err := eval(tok[1])
+		if err != nil {
+			return ControlVector{}, err
+		}
+
+		for il := range nLayers {
+			diffs[il] = appendDiffRows(diffs[il], pos[il], neg[il], nEmbd)
+		}
+	}
+
+	iterations := params.PCAIterations
+	if iterations <= 0 {
+		iterations = 1000
+	}
+
+	cv := ControlVector{NEmbd: int32(nEmbd), Data: make([]float32, nEmbd*nLayers)}
+	for il, rows := range diffs {
+		var dir []float32
+		switch params.Method {
+		case ControlVectorMethodMean:
+			dir = meanDirection(rows, nEmbd)
+		case ControlVectorMethodPCA:
+			dir = pcaDirection(rows, nEmbd, iterations)
+		default:
+			return ControlVector{}, fmt.Errorf("unknown control vector method %v", params.Method)
+		}
+		copy(cv.Data[il*nEmbd:], dir)
+	}
+
+	return cv, nil
+}
+
+// layerOutputIndex returns the layer index of a tensor named "l_out-N".
+func layerOutputIndex(name string) (int, bool) {
+	n, ok := strings.CutPrefix(name, layerOutputPrefix)
+	if !ok {
+		return 0, false
+	}
+
+	il, err := strconv.Atoi(n)
+	if err != nil || il < 0 {
+		return 0, false
+	}
+	return il, true
+}
+
+// appendDiffRows appends the rows of pos - neg to dst, skipping rows that are
+// all zero, such as those for shared padding.
+func appendDiffRows(dst, pos, neg []float32, nEmbd int) []float32 {
+	row := make([]float32, nEmbd)
+	for off := 0; off+nEmbd <= len(pos); off += nEmbd {
+		nonZero := false
+		for i := range row {
+			row[i] = pos[off+i] - neg[off+i]
+			if row[i] != 0 {
+				nonZero = true
+			}
+		}
+		if nonZero {
+			dst = append(dst, row...)
+		}
+	}
+	return dst
+}
+
+// meanDirection returns the normalised mean of the rows.
+func meanDirection(rows []float32, nEmbd int) []float32 {
+	dir := make([]float32, nEmbd)
+	nRows := len(rows) / nEmbd
+	if nRows == 0 {
+		return dir
+	}
+
+	for off := 0; off < len(rows); off += nEmbd {
+		for i := range dir {
+			dir[i] += rows[off+i]
+		}
+	}
+
+	for i := range dir {
+		dir[i] /= float32(nRows)
+	}
+
+	normalize(dir)
+	return dir
+}
+
+// pcaDirection returns the normalised principal component of the rows, found
+// by power iteration on RᵀR without forming the nEmbd x nEmbd matrix. The sign
+// is chosen so the direction agrees with the mean of the rows.
+func pcaDirection(rows []float32, nEmbd, iterations int) []float32 {
+	mean := meanDirection(rows, nEmbd)
+	if len(rows) < nEmbd {
+		return mean
+	}
+
+	// start from the mean, falling back to a fixed vector when it is zero
+	v := make([]float64, nEmbd)
+	for i := range v {
+		v[i] = float64(mean[i])
+	}
+	if norm64(v) == 0 {
+		for i := range v {
+			v[i] = 1
+		}
+	}
+	scale64(v, 1/norm64(v))
+
+	nRows := len(rows) / nEmbd
+	proj := make([]float64, nRows)
+	next := make([]float64, nEmbd)
+
+	for range iterations {
+		// proj = R v
+		for r := range nRows {
+			var s float64
+			row := rows[r*nEmbd : (r+1)*nEmbd]
+			for i, x := range row {
+				s += float64(x) * v[i]
+			}
+			proj[r] = s
+		}
+
+		// next = Rᵀ proj
+		clear(next)
+		for r := range nRows {
+			row := rows[r*nEmbd : (r+1)*nEmbd]
+			for i, x := range row {
+				next[i] += float64(x) * proj[r]
+			}
+		}
+
+		n := norm64(next)
+		if n == 0 {
+			break
+		}
+		scale64(next, 1/n)
+
+		var delta float64
+		for i := range v {
+			delta = math.Max(delta, math.Abs(next[i]-v[i]))
+		}
+		v, next = next, v
+		if delta < pcaTolerance {
+			break
+		}
+	}
+
+	var dot float64
+	for i := range v {
+		dot += v[i] * float64(mean[i])
+	}
+
+	dir := make([]float32, nEmbd)
+	for i := range dir {
+		dir[i] = float32(v[i])
+		if dot < 0 {
+			dir[i] = -dir[i]
+		}
+	}
+	return dir
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+}
+
+func norm64(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
+
+func scale64(v []float64, s float64) {
+	for i := range v {
+		v[i] *= s
+	}
+}
+
+// bytesToFloat32 decodes little-endian float32 values.
+func bytesToFloat32(b []byte) []float32 {
+	out := make([]float32, len(b)/4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return out
+}
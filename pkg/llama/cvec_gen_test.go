@@ -0,0 +1,151 @@
+package llama
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlVectorSaveAndLoad(t *testing.T) {
+	cv := ControlVector{NEmbd: 3, Data: []float32{1, 2, 3, 4, 5, 6}}
+
+	path := filepath.Join(t.TempDir(), "cvec.gguf")
+	if err := ControlVectorSave(cv, path, "llama"); err != nil {
+		t.Fatalf("ControlVectorSave failed: %v", err)
+	}
+
+	loaded, err := ControlVectorLoad(ControlVectorLoadInfo{Path: path, Strength: 1})
+	if err != nil {
+		t.Fatalf("ControlVectorLoad failed: %v", err)
+	}
+
+	if loaded.NEmbd != cv.NEmbd || len(loaded.Data) != len(cv.Data) {
+		t.Fatalf("expected n_embd %d with %d values, got n_embd %d with %d values", cv.NEmbd, len(cv.Data), loaded.NEmbd, len(loaded.Data))
+	}
+	for i := range cv.Data {
+		if loaded.Data[i] != cv.Data[i] {
+			t.Fatalf("data[%d]: expected %v, got %v", i, cv.Data[i], loaded.Data[i])
+		}
+	}
+}
+
+func TestControlVectorSaveEmpty(t *testing.T) {
+	if err := ControlVectorSave(ControlVector{}, filepath.Join(t.TempDir(), "cvec.gguf"), ""); err == nil {
+		t.Fatal("expected error saving an empty control vector")
+	}
+}
+
+func TestLayerOutputIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		il   int
+		ok   bool
+	}{
+		{"l_out-0", 0, true},
+		{"l_out-12", 12, true},
+		{"l_out", 0, false},
+		{"attn_norm-3", 0, false},
+		{"l_out-x", 0, false},
+	}
+
+	for _, tt := range tests {
+		il, ok := layerOutputIndex(tt.name)
+		if il != tt.il || ok != tt.ok {
+			t.Errorf("layerOutputIndex(%q) = %d, %v; expected %d, %v", tt.name, il, ok, tt.il, tt.ok)
+		}
+	}
+}
+
+func TestAppendDiffRows(t *testing.T) {
+	pos := []float32{1, 2, 5, 5, 3, 3}
+	neg := []float32{0, 1, 5, 5, 1, 4}
+
+	rows := appendDiffRows(nil, pos, neg, 2)
+	want := []float32{1, 1, 2, -1}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d values, got %d", len(want), len(rows))
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Fatalf("rows[%d]: expected %v, got %v", i, want[i], rows[i])
+		}
+	}
+}
+
+func TestMeanDirection(t *testing.T) {
+	dir := meanDirection([]float32{3, 0, 1, 0}, 2)
+	if math.Abs(float64(dir[0])-1) > 1e-6 || dir[1] != 0 {
+		t.Fatalf("expected [1 0], got %v", dir)
+	}
+}
+
+func TestPCADirection(t *testing.T) {
+	// rows spread mostly along (1, 1), with the mean pointing the same way
+	rows := []float32{
+		2, 2.1,
+		-1, -0.9,
+		3, 3,
+		1, 1.1,
+	}
+
+	dir := pcaDirection(rows, 2, 1000)
+
+	want := 1 / math.Sqrt2
+	for i := range dir {
+		if math.Abs(float64(dir[i])-want) > 0.05 {
+			t.Fatalf("expected direction close to (%.3f, %.3f), got %v", want, want, dir)
+		}
+	}
+
+	var norm float64
+	for _, v := range dir {
+		norm += float64(v) * float64(v)
+	}
+	if math.Abs(norm-1) > 1e-5 {
+		t.Fatalf("expected unit length direction, got length %v", math.Sqrt(norm))
+	}
+}
+
+func TestControlVectorGenerate(t *testing.T) {
+	modelFile := testModelFileName(t)
+
+	testSetup(t)
+	defer testCleanup(t)
+
+	model, err := ModelLoadFromFile(modelFile, ModelDefaultParams())
+	if err != nil {
+		t.Fatalf("ModelLoadFromFile failed: %v", err)
+	}
+	defer ModelFree(model)
+
+	pairs := []ControlVectorPromptPair{
+		{Positive: "I am feeling very happy today", Negative: "I am feeling very sad today"},
+		{Positive: "What a wonderful surprise", Negative: "What a terrible surprise"},
+	}
+
+	for _, method := range []ControlVectorMethod{ControlVectorMethodMean, ControlVectorMethodPCA} {
+		params := ControlVectorGenerateDefaultParams()
+		params.Method = method
+
+		cv, err := ControlVectorGenerate(model, pairs, params)
+		if err != nil {
+			t.Fatalf("ControlVectorGenerate(%v) failed: %v", method, err)
+		}
+
+		if cv.NEmbd != ModelNEmbd(model) {
+			t.Fatalf("expected n_embd %d, got %d", ModelNEmbd(model), cv.NEmbd)
+		}
+		if cv.NLayers() != ModelNLayer(model)-1 {
+			t.Fatalf("expected %d layers, got %d", ModelNLayer(model)-1, cv.NLayers())
+		}
+
+		path := filepath.Join(t.TempDir(), method.String()+".gguf")
+		if err := ControlVectorSave(cv, path, "llama"); err != nil {
+			t.Fatalf("ControlVectorSave failed: %v", err)
+		}
+
+		if _, err := ControlVectorLoad(ControlVectorLoadInfo{Path: path, Strength: 1}); err != nil {
+			t.Fatalf("ControlVectorLoad failed: %v", err)
+		}
+	}
+}
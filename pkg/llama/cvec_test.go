@@ -0,0 +1,173 @@
+package llama
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/gguf"
+)
+
+// writeTestControlVector writes a control vector GGUF file in the same shape
+// as llama.cpp's cvector-generator: one F32 "direction.N" tensor per layer.
+func writeTestControlVector(t *testing.T, nEmbd int, layers map[int][]float32) string {
+	t.Helper()
+
+	idx := make([]int, 0, len(layers))
+	for l := range layers {
+		idx = append(idx, l)
+	}
+	sort.Ints(idx)
+
+	f := gguf.New()
+	f.SetString(gguf.KeyArchitecture, "controlvector")
+	layerCount, _ := gguf.NewValue(int32(len(idx)))
+	f.Set("controlvector.layer_count", layerCount)
+
+	for _, l := range idx {
+		data := make([]byte, 0, 4*nEmbd)
+		for _, v := range layers[l] {
+			data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+		}
+		if err := f.AddTensor(fmt.Sprintf("direction.%d", l), gguf.GGMLTypeF32, []uint64{uint64(nEmbd)}, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "cvec.gguf")
+	if err := f.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestControlVectorLoad(t *testing.T) {
+	path := writeTestControlVector(t, 4, map[int][]float32{
+		1: {1, 2, 3, 4},
+		3: {5, 6, 7, 8},
+	})
+
+	cv, err := ControlVectorLoad(ControlVectorLoadInfo{Path: path, Strength: 0.5})
+	if err != nil {
+		t.Fatalf("ControlVectorLoad failed: %v", err)
+	}
+
+	if cv.NEmbd != 4 {
+		t.Fatalf("expected n_embd 4, got %d", cv.NEmbd)
+	}
+	if cv.NLayers() != 3 {
+		t.Fatalf("expected 3 layers, got %d", cv.NLayers())
+	}
+
+	want := []float32{0.5, 1, 1.5, 2, 0, 0, 0, 0, 2.5, 3, 3.5, 4}
+	for i := range want {
+		if cv.Data[i] != want[i] {
+			t.Fatalf("data[%d]: expected %v, got %v", i, want[i], cv.Data[i])
+		}
+	}
+}
+
+func TestControlVectorLoadCombine(t *testing.T) {
+	a := writeTestControlVector(t, 2, map[int][]float32{1: {1, 1}})
+	b := writeTestControlVector(t, 2, map[int][]float32{1: {1, 2}, 2: {3, 4}})
+
+	cv, err := ControlVectorLoad(
+		ControlVectorLoadInfo{Path: a, Strength: 1},
+		ControlVectorLoadInfo{Path: b, Strength: -2},
+	)
+	if err != nil {
+		t.Fatalf("ControlVectorLoad failed: %v", err)
+	}
+
+	want := []float32{-1, -3, -6, -8}
+	if len(cv.Data) != len(want) {
+		t.Fatalf("expected %d values, got %d", len(want), len(cv.Data))
+	}
+	for i := range want {
+		if cv.Data[i] != want[i] {
+			t.Fatalf("data[%d]: expected %v, got %v", i, want[i], cv.Data[i])
+		}
+	}
+}
+
+func TestControlVectorLoadMismatchedNEmbd(t *testing.T) {
+	a := writeTestControlVector(t, 2, map[int][]float32{1: {1, 1}})
+	b := writeTestControlVector(t, 3, map[int][]float32{1: {1, 1, 1}})
+
+	_, err := ControlVectorLoad(
+		ControlVectorLoadInfo{Path: a, Strength: 1},
+		ControlVectorLoadInfo{Path: b, Strength: 1},
+	)
+	if !errors.Is(err, errControlVectorInvalid) {
+		t.Fatalf("expected errControlVectorInvalid, got %v", err)
+	}
+}
+
+func TestControlVectorLoadInvalid(t *testing.T) {
+	if _, err := ControlVectorLoad(); !errors.Is(err, errNoControlVectors) {
+		t.Fatalf("expected errNoControlVectors, got %v", err)
+	}
+
+	zero := writeTestControlVector(t, 2, map[int][]float32{0: {1, 1}})
+	if _, err := ControlVectorLoad(ControlVectorLoadInfo{Path: zero, Strength: 1}); !errors.Is(err, errControlVectorInvalid) {
+		t.Fatalf("expected errControlVectorInvalid for layer 0, got %v", err)
+	}
+
+	notGGUF := filepath.Join(t.TempDir(), "bad.gguf")
+	if err := os.WriteFile(notGGUF, []byte("not a gguf file at all"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ControlVectorLoad(ControlVectorLoadInfo{Path: notGGUF, Strength: 1}); err == nil {
+		t.Fatal("expected error for a file that is not GGUF")
+	}
+}
+
+func TestControlVectorApplyAndClear(t *testing.T) {
+	modelFile := testModelFileName(t)
+
+	testSetup(t)
+	defer testCleanup(t)
+
+	model, err := ModelLoadFromFile(modelFile, ModelDefaultParams())
+	if err != nil {
+		t.Fatalf("ModelLoadFromFile failed: %v", err)
+	}
+	defer ModelFree(model)
+
+	ctx, err := InitFromModel(model, ContextDefaultParams())
+	if err != nil {
+		t.Fatalf("InitFromModel failed: %v", err)
+	}
+	defer Free(ctx)
+
+	nEmbd := int(ModelNEmbd(model))
+	layers := map[int][]float32{}
+	for l := 1; l <= int(ModelNLayer(model)); l++ {
+		layers[l] = make([]float32, nEmbd)
+		layers[l][0] = 0.1
+	}
+
+	cv, err := ControlVectorLoad(ControlVectorLoadInfo{Path: writeTestControlVector(t, nEmbd, layers), Strength: 1})
+	if err != nil {
+		t.Fatalf("ControlVectorLoad failed: %v", err)
+	}
+
+	if err := ControlVectorApply(ctx, cv, 0, 0); err != nil {
+		t.Fatalf("ControlVectorApply failed: %v", err)
+	}
+
+	if err := ControlVectorClear(ctx); err != nil {
+		t.Fatalf("ControlVectorClear failed: %v", err)
+	}
+
+	wrong := ControlVector{NEmbd: int32(nEmbd + 1), Data: make([]float32, nEmbd+1)}
+	if err := ControlVectorApply(ctx, wrong, 0, 0); !errors.Is(err, errControlVectorNEmbd) {
+		t.Fatalf("expected errControlVectorNEmbd, got %v", err)
+	}
+}
@@ -0,0 +1,572 @@
+package llama
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/hybridgroup/yzma/pkg/gguf"
+)
+
+// Estimate is the memory a model is expected to need once loaded and given a
+// context, broken down by device. It is computed from the GGUF metadata
+// without loading any weights.
+//
+// The figures are approximate. The KV cache is sized for the full context on
+// every attention layer, so models with sliding window attention or recurrent
+// layers use less, and compute buffers are a heuristic of the largest
+// intermediate tensors of the graph.
+type Estimate struct {
+	NGpuLayers int32            // number of layers offloaded, after resolving -1 and clamping
+	NCtx       uint32           // context size the KV cache was estimated for
+	Devices    []DeviceEstimate // the host first, then each GPU device in use
+}
+
+// DeviceEstimate is the memory expected to be used on a single device, in bytes.
+type DeviceEstimate struct {
+	Device  GGMLBackendDevice // device, the CPU device for the host
+	Name    string            // name of the device
+	Free    uint64            // free memory reported by the device, 0 if unknown
+	Weights uint64            // model weights
+	KVCache uint64            // K and V cache
+	Compute uint64            // compute buffers
+}
+
+// FitDefaultMargin is the memory FitParams leaves free on each device by default.
+const FitDefaultMargin = 1 << 30
+
+const (
+	// estimateDefaultUbatch is used when ContextParams.NUbatch is 0.
+	estimateDefaultUbatch = 512
+
+	// estimateCtxPad matches the padding llama.cpp applies to the KV cache size.
+	estimateCtxPad = 256
+
+	// fitMinCtx is the smallest context FitParams reduces NCtx to when NCtx
+	// was left at 0.
+	fitMinCtx = 4096
+)
+
+// Total returns the memory expected to be used on the device.
+func (d DeviceEstimate) Total() uint64 {
+	return d.Weights + d.KVCache + d.Compute
+}
+
+// Fits reports whether the device has margin bytes of memory left once the
+// estimate is allocated. A device whose free memory is unknown always fits.
+func (d DeviceEstimate) Fits(margin uint64) bool {
+	return d.Free == 0 || d.Total()+margin <= d.Free
+}
+
+// Weights returns the memory used by the model weights over all devices.
+func (e Estimate) Weights() uint64 {
+	var n uint64
+	for _, d := range e.Devices {
+		n += d.Weights
+	}
+	return n
+}
+
+// KVCache returns the memory used by the KV cache over all devices.
+func (e Estimate) KVCache() uint64 {
+	var n uint64
+	for _, d := range e.Devices {
+		n += d.KVCache
+	}
+	return n
+}
+
+// Compute returns the memory used by compute buffers over all devices.
+func (e Estimate) Compute() uint64 {
+	var n uint64
+	for _, d := range e.Devices {
+		n += d.Compute
+	}
+	return n
+}
+
+// Total returns the memory used over all devices.
+func (e Estimate) Total() uint64 {
+	return e.Weights() + e.KVCache() + e.Compute()
+}
+
+// Fits reports whether every GPU device has margin bytes of memory left once
+// the estimate is allocated. The host is not checked, as weights kept there
+// are memory mapped and can be paged in and out by the OS.
+func (e Estimate) Fits(margin uint64) bool {
+	for _, d := range e.Devices[1:] {
+		if !d.Fits(margin) {
+			return false
+		}
+	}
+	return true
+}
+
+// EstimateMemory estimates the memory needed to load the model at modelPath
+// with mparams and create a context with cparams, without loading the model.
+//
+// The GPU devices are those set with ModelParams.SetDevices, or otherwise all
+// GPU devices, falling back to integrated GPUs. Layers are split between them
+// as llama.cpp does, following SplitMode, MainGpu and TensorSplit.
+// The llama.cpp libraries must be loaded, to list the devices.
+func EstimateMemory(modelPath string, mparams ModelParams, cparams ContextParams) (Estimate, error) {
+	mm, err := readMemoryModel(modelPath)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	host, gpus := estimateDevices(mparams)
+	return mm.estimate(mparams, cparams, host, gpus), nil
+}
+
+// FitParams sets mparams.NGpuLayers to the largest number of layers that fits
+// in the free memory of the GPU devices, leaving margin bytes free on each.
+//
+// When cparams.NCtx is 0 the context may also be reduced: starting from the
+// training context of the model, it is halved down to no less than 4096
+// tokens while that lets more layers be offloaded, and the result is stored
+// in cparams.NCtx. A non-zero NCtx is kept as it is.
+//
+// When not even one layer fits, NGpuLayers is set to 0 and the model is left
+// to run on the host.
+func FitParams(modelPath string, mparams *ModelParams, cparams *ContextParams, margin uint64) error {
+	mm, err := readMemoryModel(modelPath)
+	if err != nil {
+		return err
+	}
+
+	host, gpus := estimateDevices(*mparams)
+	nGpu, nCtx := mm.fit(*mparams, *cparams, host, gpus, margin)
+
+	mparams.NGpuLayers = nGpu
+	cparams.NCtx = nCtx
+	return nil
+}
+
+// fit finds the number of GPU layers and context size to use.
+func (mm *memoryModel) fit(mparams ModelParams, cparams ContextParams, host estimateDevice, gpus []estimateDevice, margin uint64) (int32, uint32) {
+	ctxs := []uint32{cparams.NCtx}
+	if cparams.NCtx == 0 {
+		ctxs = []uint32{mm.nCtxTrain}
+		for c := mm.nCtxTrain / 2; c >= fitMinCtx; c /= 2 {
+			ctxs = append(ctxs, c)
+		}
+	}
+
+	maxLayers := int32(mm.nLayer + 1)
+	if len(gpus) == 0 {
+		maxLayers = 0
+	}
+
+	// a smaller context is only chosen when it allows more layers
+	bestLayers, bestCtx := int32(0), ctxs[0]
+	for _, nCtx := range ctxs {
+		cparams.NCtx = nCtx
+
+		for nGpu := maxLayers; nGpu > bestLayers; nGpu-- {
+			mparams.NGpuLayers = nGpu
+			if mm.estimate(mparams, cparams, host, gpus).Fits(margin) {
+				bestLayers, bestCtx = nGpu, nCtx
+				break
+			}
+		}
+
+		if bestLayers == maxLayers {
+			break
+		}
+	}
+
+	return bestLayers, bestCtx
+}
+
+// estimateDevice is a device as seen by the estimate.
+type estimateDevice struct {
+	dev  GGMLBackendDevice
+	name string
+	free uint64
+}
+
+func newEstimateDevice(dev GGMLBackendDevice) estimateDevice {
+	free, _ := GGMLBackendDeviceMemory(dev)
+	return estimateDevice{dev: dev, name: GGMLBackendDeviceName(dev), free: free}
+}
+
+// estimateDevices returns the host device and the GPU devices the model would
+// be offloaded to.
+func estimateDevices(mparams ModelParams) (estimateDevice, []estimateDevice) {
+	host := newEstimateDevice(GGMLBackendDeviceByType(GGMLBackendDeviceTypeCPU))
+	if host.name == "" {
+		host.name = "CPU"
+	}
+
+	var gpus []estimateDevice
+	if mparams.Devices != 0 {
+		p := *(*unsafe.Pointer)(unsafe.Pointer(&mparams.Devices))
+		for ; *(*GGMLBackendDevice)(p) != 0; p = unsafe.Add(p, unsafe.Sizeof(GGMLBackendDevice(0))) {
+			gpus = append(gpus, newEstimateDevice(*(*GGMLBackendDevice)(p)))
+		}
+		return host, gpus
+	}
+
+	for _, typ := range []GGMLBackendDeviceType{GGMLBackendDeviceTypeGPU, GGMLBackendDeviceTypeIGPU} {
+		for i := range GGMLBackendDeviceCount() {
+			if dev := GGMLBackendDeviceGet(i); GGMLBackendDevType(dev) == typ {
+				gpus = append(gpus, newEstimateDevice(dev))
+			}
+		}
+		if len(gpus) > 0 {
+			break
+		}
+	}
+
+	return host, gpus
+}
+
+// memoryModel is what the estimate needs to know about a model, read from
+// its GGUF metadata and tensor descriptors.
+type memoryModel struct {
+	nLayer    int
+	nCtxTrain uint32
+	nEmbd     uint64
+	nVocab    uint64
+
+	// per layer hyperparameters
+	nHead     []uint64
+	nHeadKV   []uint64
+	nFF       []uint64
+	keyLength []uint64
+	valLength []uint64
+
+	layerWeights  []uint64 // weights of each "blk.N." layer
+	inputWeights  uint64   // token embeddings and other tensors kept on the host
+	outputWeights uint64   // output head and norm
+}
+
+func readMemoryModel(path string) (*memoryModel, error) {
+	f, err := gguf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return newMemoryModel(f)
+}
+
+func newMemoryModel(f *gguf.File) (*memoryModel, error) {
+	arch := f.Architecture()
+	if arch == "" {
+		return nil, errors.New("model has no architecture")
+	}
+
+	nLayer, ok := f.GetUint64(arch + ".block_count")
+	if !ok || nLayer == 0 {
+		return nil, fmt.Errorf("model has no %s.block_count", arch)
+	}
+
+	mm := &memoryModel{nLayer: int(nLayer)}
+
+	if n, ok := f.GetUint64(arch + ".context_length"); ok {
+		mm.nCtxTrain = uint32(n)
+	}
+	mm.nEmbd, _ = f.GetUint64(arch + ".embedding_length")
+
+	if tokens, ok := f.Get("tokenizer.ggml.tokens"); ok {
+		mm.nVocab = uint64(tokens.Len())
+	} else {
+		mm.nVocab, _ = f.GetUint64(arch + ".vocab_size")
+	}
+
+	mm.nHead = perLayer(f, arch+".attention.head_count", mm.nLayer, nil)
+	mm.nHeadKV = perLayer(f, arch+".attention.head_count_kv", mm.nLayer, mm.nHead)
+	mm.nFF = perLayer(f, arch+".feed_forward_length", mm.nLayer, nil)
+
+	headDim := make([]uint64, mm.nLayer)
+	for il, h := range mm.nHead {
+		if h > 0 {
+			headDim[il] = mm.nEmbd / h
+		}
+	}
+	mm.keyLength = perLayer(f, arch+".attention.key_length", mm.nLayer, headDim)
+	mm.valLength = perLayer(f, arch+".attention.value_length", mm.nLayer, headDim)
+
+	mm.layerWeights = make([]uint64, mm.nLayer)
+	hasOutput := false
+	var tokenEmbd uint64
+
+	for _, t := range f.Tensors {
+		size := t.Size()
+
+		if il, ok := tensorLayer(t.Name); ok {
+			if il < mm.nLayer {
+				mm.layerWeights[il] += size
+				continue
+			}
+			// layers past block_count, such as MTP layers, stay on the host
+			mm.inputWeights += size
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(t.Name, "output."):
+			hasOutput = true
+			mm.outputWeights += size
+		case strings.HasPrefix(t.Name, "output_norm."):
+			mm.outputWeights += size
+		case strings.HasPrefix(t.Name, "token_embd."):
+			tokenEmbd += size
+			mm.inputWeights += size
+		default:
+			mm.inputWeights += size
+		}
+	}
+
+	// with tied embeddings the token embeddings are loaded a second time as
+	// the output head
+	if !hasOutput {
+		mm.outputWeights += tokenEmbd
+	}
+
+	return mm, nil
+}
+
+// perLayer reads a hyperparameter that is either a single value or an array
+// with one value per layer. def is used when the key is missing.
+func perLayer(f *gguf.File, key string, nLayer int, def []uint64) []uint64 {
+	out := make([]uint64, nLayer)
+
+	v, ok := f.Get(key)
+	if !ok {
+		copy(out, def)
+		return out
+	}
+
+	if n, ok := v.AsUint64(); ok {
+		for i := range out {
+			out[i] = n
+		}
+		return out
+	}
+
+	if v.Type == gguf.ValueTypeArray {
+		for i := range min(v.Len(), nLayer) {
+			if n, ok := arrayElem(v, i).AsUint64(); ok {
+				out[i] = n
+			}
+		}
+	}
+
+	return out
+}
+
+// arrayElem returns element i of an array of integers as a Value.
+func arrayElem(v gguf.Value, i int) gguf.Value {
+	var e any
+	switch d := v.Any().(type) {
+	case []int32:
+		e = d[i]
+	case []uint32:
+		e = d[i]
+	case []int64:
+		e = d[i]
+	case []uint64:
+		e = d[i]
+	case []int16:
+		e = d[i]
+	case []uint16:
+		e = d[i]
+	case []int8:
+		e = d[i]
+	case []uint8:
+		e = d[i]
+	}
+
+	ev, _ := gguf.NewValue(e)
+	return ev
+}
+
+// tensorLayer returns the layer index of a tensor named "blk.N.…".
+func tensorLayer(name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, "blk.")
+	if !ok {
+		return 0, false
+	}
+
+	n, _, ok := strings.Cut(rest, ".")
+	if !ok {
+		return 0, false
+	}
+
+	il, err := strconv.Atoi(n)
+	if err != nil || il < 0 {
+		return 0, false
+	}
+	return il, true
+}
+
+// estimate computes the estimate for the given parameters and devices.
+func (mm *memoryModel) estimate(mparams ModelParams, cparams ContextParams, host estimateDevice, gpus []estimateDevice) Estimate {
+	nGpu := int(mparams.NGpuLayers)
+	if nGpu < 0 || nGpu > mm.nLayer+1 {
+		nGpu = mm.nLayer + 1
+	}
+	if len(gpus) == 0 {
+		nGpu = 0
+	}
+
+	nCtx := cparams.NCtx
+	if nCtx == 0 {
+		nCtx = mm.nCtxTrain
+	}
+
+	e := Estimate{
+		NGpuLayers: int32(nGpu),
+		NCtx:       nCtx,
+		Devices:    make([]DeviceEstimate, 1+len(gpus)),
+	}
+	for i, d := range append([]estimateDevice{host}, gpus...) {
+		e.Devices[i] = DeviceEstimate{Device: d.dev, Name: d.name, Free: d.free}
+	}
+
+	layerDevice := mm.layerSplit(mparams, gpus, nGpu)
+
+	kvCtx := uint64(alignUp(nCtx, estimateCtxPad))
+	nUbatch := cparams.NUbatch
+	if nUbatch == 0 {
+		nUbatch = estimateDefaultUbatch
+	}
+	nTokens := uint64(min(nUbatch, nCtx))
+	flashAttn := cparams.FlashAttentionType == FlashAttentionTypeEnabled
+
+	layerCompute := make([]uint64, len(e.Devices))
+	for il := range mm.nLayer {
+		dev := layerDevice(il)
+		e.Devices[dev].Weights += mm.layerWeights[il]
+
+		kvDev := dev
+		if cparams.Offload_kqv == 0 {
+			kvDev = 0
+		}
+		nK := mm.keyLength[il] * mm.nHeadKV[il]
+		nV := mm.valLength[il] * mm.nHeadKV[il]
+		e.Devices[kvDev].KVCache += kvCtx * (rowSize(cparams.TypeK, nK) + rowSize(cparams.TypeV, nV))
+
+		layerCompute[dev] = max(layerCompute[dev], mm.layerCompute(il, nTokens, kvCtx, flashAttn))
+	}
+
+	outDev := 0
+	if nGpu > mm.nLayer {
+		outDev = layerDevice(mm.nLayer)
+	}
+	e.Devices[outDev].Weights += mm.outputWeights
+	e.Devices[0].Weights += mm.inputWeights
+
+	for i := range e.Devices {
+		e.Devices[i].Compute = layerCompute[i]
+	}
+
+	// logits, and the input embeddings gathered on the host
+	e.Devices[outDev].Compute += nTokens * mm.nVocab * 4
+	e.Devices[0].Compute += nTokens * mm.nEmbd * 4
+
+	return e
+}
+
+// layerSplit returns a function giving the index in Estimate.Devices of the
+// device layer il is assigned to, with index 0 the host. Layer nLayer stands
+// for the output layer.
+func (mm *memoryModel) layerSplit(mparams ModelParams, gpus []estimateDevice, nGpu int) func(il int) int {
+	gpuStart := max(mm.nLayer-nGpu, 0)
+	if nGpu == 0 {
+		return func(int) int { return 0 }
+	}
+
+	if mparams.SplitMode == SplitModeNone {
+		main := int(mparams.MainGpu)
+		if main < 0 || main >= len(gpus) {
+			main = 0
+		}
+		return func(il int) int {
+			if il < gpuStart {
+				return 0
+			}
+			return 1 + main
+		}
+	}
+
+	// proportions from TensorSplit, or otherwise the free memory of each device
+	split := make([]float64, len(gpus))
+	if mparams.TensorSplit != nil {
+		for i, v := range unsafe.Slice(mparams.TensorSplit, len(gpus)) {
+			split[i] = float64(v)
+		}
+	}
+	if sumFloat64(split) == 0 {
+		for i, d := range gpus {
+			split[i] = float64(d.free)
+		}
+	}
+	if sumFloat64(split) == 0 {
+		for i := range split {
+			split[i] = 1
+		}
+	}
+
+	total := sumFloat64(split)
+	var acc float64
+	for i := range split {
+		acc += split[i]
+		split[i] = acc / total
+	}
+
+	return func(il int) int {
+		if il < gpuStart {
+			return 0
+		}
+		frac := float64(il-gpuStart) / float64(nGpu)
+		for i, s := range split {
+			if frac < s {
+				return 1 + i
+			}
+		}
+		return len(gpus)
+	}
+}
+
+// layerCompute approximates the compute buffer needed to evaluate layer il
+// for nTokens tokens: the hidden state, the feed forward intermediates, the
+// Q, K and V projections, and without flash attention the KQ scores.
+func (mm *memoryModel) layerCompute(il int, nTokens, nCtx uint64, flashAttn bool) uint64 {
+	hidden := nTokens * mm.nEmbd * 4 * 4
+	ffn := nTokens * mm.nFF[il] * 4 * 2
+	qkv := nTokens * (mm.nHead[il]*mm.keyLength[il] + mm.nHeadKV[il]*(mm.keyLength[il]+mm.valLength[il])) * 4
+
+	var kq uint64
+	if !flashAttn {
+		kq = nTokens * nCtx * mm.nHead[il] * 4
+	}
+
+	return hidden + ffn + qkv + kq
+}
+
+// rowSize returns the size of ne elements of type t, treating a type of
+// unknown size as F16.
+func rowSize(t GGMLType, ne uint64) uint64 {
+	if n, ok := gguf.GGMLType(t).RowSize(ne); ok {
+		return n
+	}
+	return ne * 2
+}
+
+func alignUp(n, alignment uint32) uint32 {
+	return (n + alignment - 1) / alignment * alignment
+}
+
+func sumFloat64(v []float64) float64 {
+	var s float64
+	for _, x := range v {
+		s += x
+	}
+	return s
+}
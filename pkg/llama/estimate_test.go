@@ -0,0 +1,288 @@
+package llama
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/gguf"
+)
+
+const (
+	testEstimateLayers = 4
+	testEstimateEmbd   = 64
+	testEstimateVocab  = 100
+
+	// attn_q of 64x64 F16 per layer
+	testEstimateLayerWeights = testEstimateEmbd * testEstimateEmbd * 2
+	// token_embd of 64x100 F32
+	testEstimateInputWeights = testEstimateEmbd * testEstimateVocab * 4
+	// output_norm of 64 F32 plus output of 64x100 F32
+	testEstimateOutputWeights = testEstimateEmbd*4 + testEstimateEmbd*testEstimateVocab*4
+)
+
+// writeTestEstimateModel writes a small llama GGUF with 4 layers, 4 heads and
+// 2 KV heads of 16 dimensions.
+func writeTestEstimateModel(t *testing.T) string {
+	t.Helper()
+
+	f := gguf.New()
+	f.SetString(gguf.KeyArchitecture, "llama")
+	set := func(key string, v any) {
+		val, err := gguf.NewValue(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Set(key, val)
+	}
+	set("llama.block_count", uint32(testEstimateLayers))
+	set("llama.context_length", uint32(8192))
+	set("llama.embedding_length", uint32(testEstimateEmbd))
+	set("llama.feed_forward_length", uint32(128))
+	set("llama.attention.head_count", uint32(4))
+	set("llama.attention.head_count_kv", uint32(2))
+	set("tokenizer.ggml.tokens", make([]string, testEstimateVocab))
+
+	add := func(name string, typ gguf.GGMLType, shape []uint64, size int) {
+		if err := f.AddTensor(name, typ, shape, make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("token_embd.weight", gguf.GGMLTypeF32, []uint64{testEstimateEmbd, testEstimateVocab}, testEstimateInputWeights)
+	for il := range testEstimateLayers {
+		add(fmt.Sprintf("blk.%d.attn_q.weight", il), gguf.GGMLTypeF16, []uint64{testEstimateEmbd, testEstimateEmbd}, testEstimateLayerWeights)
+	}
+	add("output_norm.weight", gguf.GGMLTypeF32, []uint64{testEstimateEmbd}, testEstimateEmbd*4)
+	add("output.weight", gguf.GGMLTypeF32, []uint64{testEstimateEmbd, testEstimateVocab}, testEstimateEmbd*testEstimateVocab*4)
+
+	path := filepath.Join(t.TempDir(), "model.gguf")
+	if err := f.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testEstimateParams() (ModelParams, ContextParams) {
+	mparams := ModelParams{NGpuLayers: -1, SplitMode: SplitModeLayer}
+	cparams := ContextParams{NCtx: 512, TypeK: GGMLTypeF16, TypeV: GGMLTypeF16, Offload_kqv: 1}
+	return mparams, cparams
+}
+
+func readTestEstimateModel(t *testing.T) *memoryModel {
+	t.Helper()
+
+	mm, err := readMemoryModel(writeTestEstimateModel(t))
+	if err != nil {
+		t.Fatalf("readMemoryModel failed: %v", err)
+	}
+	return mm
+}
+
+func TestReadMemoryModel(t *testing.T) {
+	mm := readTestEstimateModel(t)
+
+	if mm.nLayer != testEstimateLayers || mm.nCtxTrain != 8192 || mm.nEmbd != testEstimateEmbd || mm.nVocab != testEstimateVocab {
+		t.Fatalf("unexpected hyperparameters %+v", mm)
+	}
+	if mm.nHeadKV[0] != 2 || mm.keyLength[0] != 16 || mm.valLength[3] != 16 {
+		t.Fatalf("unexpected attention parameters %v %v %v", mm.nHeadKV, mm.keyLength, mm.valLength)
+	}
+	if mm.layerWeights[2] != testEstimateLayerWeights {
+		t.Fatalf("expected %d bytes of weights for layer 2, got %d", testEstimateLayerWeights, mm.layerWeights[2])
+	}
+	if mm.inputWeights != testEstimateInputWeights || mm.outputWeights != testEstimateOutputWeights {
+		t.Fatalf("unexpected input %d and output %d weights", mm.inputWeights, mm.outputWeights)
+	}
+}
+
+func TestEstimateHostOnly(t *testing.T) {
+	mm := readTestEstimateModel(t)
+	mparams, cparams := testEstimateParams()
+
+	e := mm.estimate(mparams, cparams, estimateDevice{name: "CPU"}, nil)
+	if e.NGpuLayers != 0 || len(e.Devices) != 1 {
+		t.Fatalf("expected host only estimate, got %d layers on %d devices", e.NGpuLayers, len(e.Devices))
+	}
+
+	wantWeights := uint64(testEstimateLayers*testEstimateLayerWeights + testEstimateInputWeights + testEstimateOutputWeights)
+	if e.Weights() != wantWeights {
+		t.Fatalf("expected %d bytes of weights, got %d", wantWeights, e.Weights())
+	}
+
+	// 512 cells of 2 KV heads x 16 dimensions in F16, for K and V, in 4 layers
+	wantKV := uint64(512 * (2 * 16 * 2) * 2 * testEstimateLayers)
+	if e.KVCache() != wantKV {
+		t.Fatalf("expected %d bytes of KV cache, got %d", wantKV, e.KVCache())
+	}
+
+	if e.Compute() == 0 {
+		t.Fatal("expected a compute buffer estimate")
+	}
+
+	cparams.TypeK, cparams.TypeV = GGMLTypeQ8_0, GGMLTypeQ8_0
+	if q8 := mm.estimate(mparams, cparams, estimateDevice{}, nil); q8.KVCache() >= e.KVCache() {
+		t.Fatalf("expected a smaller q8_0 KV cache, got %d", q8.KVCache())
+	}
+}
+
+func TestEstimateLayerSplit(t *testing.T) {
+	mm := readTestEstimateModel(t)
+	mparams, cparams := testEstimateParams()
+	gpus := []estimateDevice{{name: "GPU0", free: 1 << 30}, {name: "GPU1", free: 1 << 30}}
+
+	// 5 layers including output split evenly: layers 0-2 and 3-output
+	e := mm.estimate(mparams, cparams, estimateDevice{name: "CPU"}, gpus)
+	if e.NGpuLayers != testEstimateLayers+1 {
+		t.Fatalf("expected all %d layers offloaded, got %d", testEstimateLayers+1, e.NGpuLayers)
+	}
+	if e.Devices[0].Weights != testEstimateInputWeights {
+		t.Fatalf("expected only the input weights on the host, got %d", e.Devices[0].Weights)
+	}
+	if e.Devices[1].Weights != 3*testEstimateLayerWeights {
+		t.Fatalf("expected 3 layers on GPU0, got %d bytes", e.Devices[1].Weights)
+	}
+	if e.Devices[2].Weights != testEstimateLayerWeights+testEstimateOutputWeights {
+		t.Fatalf("expected 1 layer and the output on GPU1, got %d bytes", e.Devices[2].Weights)
+	}
+	if e.Devices[1].KVCache != 3*e.Devices[2].KVCache {
+		t.Fatalf("expected the KV cache to follow the layers, got %d and %d", e.Devices[1].KVCache, e.Devices[2].KVCache)
+	}
+
+	// only the last 2 layers offloaded
+	mparams.NGpuLayers = 2
+	e = mm.estimate(mparams, cparams, estimateDevice{name: "CPU"}, gpus)
+	if e.Devices[0].Weights != 2*testEstimateLayerWeights+testEstimateInputWeights+testEstimateOutputWeights {
+		t.Fatalf("expected 2 layers and the output on the host, got %d bytes", e.Devices[0].Weights)
+	}
+
+	// everything on the main GPU
+	mparams.NGpuLayers = -1
+	mparams.SplitMode = SplitModeNone
+	mparams.MainGpu = 1
+	e = mm.estimate(mparams, cparams, estimateDevice{name: "CPU"}, gpus)
+	if e.Devices[1].Total() != 0 || e.Devices[2].Weights != testEstimateLayers*testEstimateLayerWeights+testEstimateOutputWeights {
+		t.Fatalf("expected all layers on GPU1, got %+v", e.Devices)
+	}
+
+	// KV cache kept on the host
+	cparams.Offload_kqv = 0
+	e = mm.estimate(mparams, cparams, estimateDevice{name: "CPU"}, gpus)
+	if e.Devices[2].KVCache != 0 || e.Devices[0].KVCache == 0 {
+		t.Fatalf("expected the KV cache on the host, got %+v", e.Devices)
+	}
+}
+
+func TestEstimateFit(t *testing.T) {
+	mm := readTestEstimateModel(t)
+	mparams, cparams := testEstimateParams()
+	host := estimateDevice{name: "CPU"}
+
+	mparams.NGpuLayers = 2
+	partial := mm.estimate(mparams, cparams, host, []estimateDevice{{name: "GPU"}})
+
+	// room for exactly 2 layers
+	gpus := []estimateDevice{{name: "GPU", free: partial.Devices[1].Total()}}
+	nGpu, nCtx := mm.fit(mparams, cparams, host, gpus, 0)
+	if nGpu != 2 || nCtx != 512 {
+		t.Fatalf("expected 2 layers with a context of 512, got %d and %d", nGpu, nCtx)
+	}
+
+	// no room at all
+	gpus[0].free = 1
+	if nGpu, _ := mm.fit(mparams, cparams, host, gpus, 0); nGpu != 0 {
+		t.Fatalf("expected no layers to fit, got %d", nGpu)
+	}
+
+	// plenty of room
+	gpus[0].free = 1 << 40
+	if nGpu, _ := mm.fit(mparams, cparams, host, gpus, 0); nGpu != testEstimateLayers+1 {
+		t.Fatalf("expected all layers to fit, got %d", nGpu)
+	}
+}
+
+func TestEstimateFitReducesContext(t *testing.T) {
+	mm := readTestEstimateModel(t)
+	mparams, cparams := testEstimateParams()
+	host := estimateDevice{name: "CPU"}
+
+	// room for everything with a 4096 context, but not with the full 8192
+	cparams.NCtx = 4096
+	full := mm.estimate(mparams, cparams, host, []estimateDevice{{name: "GPU"}})
+	gpus := []estimateDevice{{name: "GPU", free: full.Devices[1].Total()}}
+
+	cparams.NCtx = 0
+	nGpu, nCtx := mm.fit(mparams, cparams, host, gpus, 0)
+	if nGpu != testEstimateLayers+1 || nCtx != 4096 {
+		t.Fatalf("expected all layers with a context of 4096, got %d and %d", nGpu, nCtx)
+	}
+
+	// an explicit context is kept
+	cparams.NCtx = 8192
+	if _, nCtx := mm.fit(mparams, cparams, host, gpus, 0); nCtx != 8192 {
+		t.Fatalf("expected the context to stay at 8192, got %d", nCtx)
+	}
+}
+
+func TestTensorLayer(t *testing.T) {
+	tests := []struct {
+		name string
+		il   int
+		ok   bool
+	}{
+		{"blk.0.attn_q.weight", 0, true},
+		{"blk.31.ffn_down.weight", 31, true},
+		{"blk.x.attn_q.weight", 0, false},
+		{"token_embd.weight", 0, false},
+		{"blk.3", 0, false},
+	}
+
+	for _, tt := range tests {
+		il, ok := tensorLayer(tt.name)
+		if il != tt.il || ok != tt.ok {
+			t.Errorf("tensorLayer(%q) = %d, %v; expected %d, %v", tt.name, il, ok, tt.il, tt.ok)
+		}
+	}
+}
+
+func TestPerLayer(t *testing.T) {
+	f := gguf.New()
+	arr, _ := gguf.NewValue([]int32{8, 0, 8})
+	f.Set("heads", arr)
+
+	got := perLayer(f, "heads", 3, nil)
+	if got[0] != 8 || got[1] != 0 || got[2] != 8 {
+		t.Fatalf("unexpected per layer values %v", got)
+	}
+
+	def := perLayer(f, "missing", 2, []uint64{4, 5})
+	if def[0] != 4 || def[1] != 5 {
+		t.Fatalf("expected default values, got %v", def)
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	modelFile := testModelFileName(t)
+
+	testSetup(t)
+	defer testCleanup(t)
+
+	mparams := ModelDefaultParams()
+	cparams := ContextDefaultParams()
+	cparams.NCtx = 2048
+
+	e, err := EstimateMemory(modelFile, mparams, cparams)
+	if err != nil {
+		t.Fatalf("EstimateMemory failed: %v", err)
+	}
+	if e.Weights() == 0 || e.KVCache() == 0 || e.Compute() == 0 {
+		t.Fatalf("expected a non-zero estimate, got %+v", e)
+	}
+	t.Logf("estimate: weights %d, KV cache %d, compute %d", e.Weights(), e.KVCache(), e.Compute())
+
+	if err := FitParams(modelFile, &mparams, &cparams, FitDefaultMargin); err != nil {
+		t.Fatalf("FitParams failed: %v", err)
+	}
+	if cparams.NCtx != 2048 {
+		t.Fatalf("expected NCtx to stay at 2048, got %d", cparams.NCtx)
+	}
+}
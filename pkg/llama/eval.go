@@ -0,0 +1,415 @@
+package llama
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+
+	"github.com/hybridgroup/yzma/pkg/utils"
+	"github.com/jupiterrider/ffi"
+)
+
+// ggmlTensor mirrors the leading members of struct ggml_tensor, up to and
+// including nb. Only ever read through a pointer handed over by ggml, never
+// allocated or passed by value, so the members after nb need not be declared.
+type ggmlTensor struct {
+	Type   GGMLType  // enum ggml_type
+	Buffer uintptr   // struct ggml_backend_buffer *
+	Ne     [4]int64  // number of elements
+	Nb     [4]uint64 // stride in bytes
+}
+
+// ggmlTypeTraits mirrors struct ggml_type_traits.
+type ggmlTypeTraits struct {
+	TypeName           *byte   // const char *
+	BlckSize           int64   // int64_t
+	BlckSizeInterleave int64   // int64_t
+	TypeSize           uint64  // size_t
+	IsQuantized        uint8   // bool
+	ToFloat            uintptr // ggml_to_float_t
+	FromFloatRef       uintptr // ggml_from_float_t
+}
+
+// TensorInfo describes a tensor of the compute graph, as passed to an EvalCallback.
+type TensorInfo struct {
+	Name  string   // name of the tensor, e.g. "l_out-12" or "attn_norm-3"
+	Type  GGMLType // data type of the tensor
+	Shape [4]int64 // number of elements in each dimension, unused dimensions are 1
+
+	tensor uintptr
+}
+
+// EvalCallback is called by the scheduler for each tensor of the compute graph.
+//
+// It is first called with ask set to true, before the tensor is computed, and
+// returns whether it wants to see that tensor. For each tensor it asked for, it
+// is then called again with ask set to false once the tensor has been computed,
+// when Data and Bytes can be used, and returns whether computation should
+// continue.
+//
+// The callback runs on the thread calling Decode or Encode, in the middle of
+// the computation, so it must not call back into the context.
+type EvalCallback func(t TensorInfo, ask bool) bool
+
+// evalCallbackFunc is the raw form of EvalCallback, with the tensor still the
+// ggml_tensor pointer.
+type evalCallbackFunc func(tensor uintptr, ask bool) bool
+
+var (
+	evalCallbackCif     *ffi.Cif
+	evalCallbackCifOnce sync.Once
+
+	toFloatCif     *ffi.Cif
+	toFloatCifOnce sync.Once
+
+	errTensorNotReadable = errors.New("tensor has no data to read")
+	errEvalCallbackFreed = errors.New("eval callback was freed with the last context using it, call SetEvalCallback again")
+)
+
+// evalClosure is a closure created by SetEvalCallback, with the number of
+// contexts using it.
+type evalClosure struct {
+	closure  *ffi.Closure
+	contexts int
+}
+
+var (
+	evalClosuresMu sync.Mutex
+
+	// evalClosures holds the live closures by code pointer.
+	evalClosures = map[uintptr]*evalClosure{}
+
+	// freedEvalCallbacks holds the code pointers of the closures freed with
+	// their last context, to refuse params that still point to them.
+	freedEvalCallbacks = map[uintptr]bool{}
+
+	// contextEvalCallbacks maps a context to the code pointer of its closure.
+	contextEvalCallbacks = map[Context]uintptr{}
+)
+
+// SetEvalCallback sets a callback used to inspect the tensors of the compute
+// graph while the context evaluates a batch. Pass nil to clear it.
+//
+// The callback must be set before the context is created with InitFromModel.
+// Its closure is freed by Free with the last context using it, after which
+// the params need SetEvalCallback again to create another context. Replacing
+// or clearing a callback that no context uses frees it at once.
+func (p *ContextParams) SetEvalCallback(cb EvalCallback) {
+	releaseUnusedEvalCallback(p.CbEval)
+	if cb == nil {
+		p.CbEval = 0
+		p.CbEvalUserData = 0
+		return
+	}
+
+	p.CbEval = newEvalCallback(func(tensor uintptr, ask bool) bool {
+		return cb(newTensorInfo(tensor), ask)
+	})
+	p.CbEvalUserData = 0
+}
+
+// newEvalCallback creates a C-compatible ggml_backend_sched_eval_callback from
+// a Go function. The closure is registered in evalClosures, to be freed with
+// the contexts using it.
+func newEvalCallback(fn evalCallbackFunc) uintptr {
+	evalCallbackCifOnce.Do(func() {
+		evalCallbackCif = new(ffi.Cif)
+		if status := ffi.PrepCif(evalCallbackCif, ffi.DefaultAbi, 3, &ffi.TypeUint8, &ffi.TypePointer, &ffi.TypeUint8, &ffi.TypePointer); status != ffi.OK {
+			panic(status)
+		}
+	})
+
+	var code unsafe.Pointer
+	closure := ffi.ClosureAlloc(sizeOfClosure, &code)
+
+	cb := ffi.NewCallback(func(cif *ffi.Cif, ret unsafe.Pointer, args *unsafe.Pointer, userData unsafe.Pointer) uintptr {
+		if args == nil || ret == nil {
+			return 1 // error
+		}
+
+		arg := unsafe.Slice(args, cif.NArgs)
+		tensor := *(*uintptr)(arg[0])
+		ask := *(*uint8)(arg[1]) != 0
+
+		var result uint8
+		if fn(tensor, ask) {
+			result = 1
+		}
+		*(*uint8)(ret) = result
+		return 0
+	})
+
+	if closure != nil {
+		if status := ffi.PrepClosureLoc(closure, evalCallbackCif, cb, nil, code); status != ffi.OK {
+			panic(status)
+		}
+	}
+
+	registerEvalClosure(uintptr(code), closure)
+	return uintptr(code)
+}
+
+func registerEvalClosure(code uintptr, closure *ffi.Closure) {
+	evalClosuresMu.Lock()
+	defer evalClosuresMu.Unlock()
+
+	evalClosures[code] = &evalClosure{closure: closure}
+	delete(freedEvalCallbacks, code)
+}
+
+// releaseUnusedEvalCallback frees the closure at code if no context uses it.
+func releaseUnusedEvalCallback(code uintptr) {
+	evalClosuresMu.Lock()
+	defer evalClosuresMu.Unlock()
+
+	if c, ok := evalClosures[code]; ok && c.contexts == 0 {
+		freeEvalClosure(code, c)
+	}
+}
+
+// checkEvalCallback returns an error if code is a closure that was freed.
+func checkEvalCallback(code uintptr) error {
+	evalClosuresMu.Lock()
+	defer evalClosuresMu.Unlock()
+
+	if _, live := evalClosures[code]; !live && freedEvalCallbacks[code] {
+		return errEvalCallbackFreed
+	}
+	return nil
+}
+
+// retainEvalCallback records that ctx uses the closure at code, if it is one
+// created by SetEvalCallback.
+func retainEvalCallback(ctx Context, code uintptr) {
+	evalClosuresMu.Lock()
+	defer evalClosuresMu.Unlock()
+
+	if c, ok := evalClosures[code]; ok {
+		c.contexts++
+		contextEvalCallbacks[ctx] = code
+	}
+}
+
+// releaseEvalCallback drops the closure used by ctx, and frees it if ctx was
+// the last context using it.
+func releaseEvalCallback(ctx Context) {
+	evalClosuresMu.Lock()
+	defer evalClosuresMu.Unlock()
+
+	code, ok := contextEvalCallbacks[ctx]
+	if !ok {
+		return
+	}
+	delete(contextEvalCallbacks, ctx)
+
+	if c, ok := evalClosures[code]; ok {
+		if c.contexts--; c.contexts == 0 {
+			freeEvalClosure(code, c)
+			freedEvalCallbacks[code] = true
+		}
+	}
+}
+
+func freeEvalClosure(code uintptr, c *evalClosure) {
+	delete(evalClosures, code)
+	if c.closure != nil {
+		ffi.ClosureFree(c.closure)
+	}
+}
+
+func newTensorInfo(tensor uintptr) TensorInfo {
+	t := tensorHeader(tensor)
+	return TensorInfo{
+		Name:   tensorName(tensor),
+		Type:   t.Type,
+		Shape:  t.Ne,
+		tensor: tensor,
+	}
+}
+
+// NDims returns the number of dimensions of the tensor, ignoring trailing
+// dimensions of size 1. It is always at least 1.
+func (t TensorInfo) NDims() int {
+	for i := len(t.Shape) - 1; i >= 1; i-- {
+		if t.Shape[i] > 1 {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// NElements returns the total number of elements in the tensor.
+func (t TensorInfo) NElements() int64 {
+	return t.Shape[0] * t.Shape[1] * t.Shape[2] * t.Shape[3]
+}
+
+// Bytes returns a copy of the raw tensor data, in the layout ggml keeps it,
+// copied from whichever backend holds it.
+// It may only be called from the EvalCallback, when ask is false.
+func (t TensorInfo) Bytes() ([]byte, error) {
+	if t.tensor == 0 {
+		return nil, errTensorNotReadable
+	}
+	return tensorBytes(t.tensor), nil
+}
+
+// Data returns a copy of the tensor data converted to float32, in row-major
+// order with Shape[0] varying fastest. Quantized types are dequantized using
+// ggml's own conversion.
+// It may only be called from the EvalCallback, when ask is false.
+func (t TensorInfo) Data() ([]float32, error) {
+	if t.tensor == 0 {
+		return nil, errTensorNotReadable
+	}
+
+	raw := tensorBytes(t.tensor)
+	h := tensorHeader(t.tensor)
+
+	out := make([]float32, 0, t.NElements())
+	row := make([]float32, t.Shape[0])
+	for i3 := range t.Shape[3] {
+		for i2 := range t.Shape[2] {
+			for i1 := range t.Shape[1] {
+				off := uint64(i1)*h.Nb[1] + uint64(i2)*h.Nb[2] + uint64(i3)*h.Nb[3]
+				if err := rowToFloat32(row, raw, off, h.Nb[0], t.Type); err != nil {
+					return nil, err
+				}
+				out = append(out, row...)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// rowToFloat32 converts one row of len(dst) elements starting at off in src.
+// stride is the distance between elements, which for a quantized type is the
+// size of a block rather than of an element.
+func rowToFloat32(dst []float32, src []byte, off, stride uint64, typ GGMLType) error {
+	switch typ {
+	case GGMLTypeF32, GGMLTypeF16, GGMLTypeBF16, GGMLTypeF64,
+		GGMLTypeI8, GGMLTypeI16, GGMLTypeI32, GGMLTypeI64:
+	default:
+		return dequantizeRow(dst, src[off:], typ)
+	}
+
+	for i := range dst {
+		p := off + uint64(i)*stride
+
+		switch typ {
+		case GGMLTypeF32:
+			dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(src[p:]))
+		case GGMLTypeF16:
+			dst[i] = float16ToFloat32(binary.LittleEndian.Uint16(src[p:]))
+		case GGMLTypeBF16:
+			dst[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(src[p:])) << 16)
+		case GGMLTypeF64:
+			dst[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(src[p:])))
+		case GGMLTypeI8:
+			dst[i] = float32(int8(src[p]))
+		case GGMLTypeI16:
+			dst[i] = float32(int16(binary.LittleEndian.Uint16(src[p:])))
+		case GGMLTypeI32:
+			dst[i] = float32(int32(binary.LittleEndian.Uint32(src[p:])))
+		case GGMLTypeI64:
+			dst[i] = float32(int64(binary.LittleEndian.Uint64(src[p:])))
+		}
+	}
+
+	return nil
+}
+
+// dequantizeRow converts a contiguous row of a quantized type using the
+// to_float function from ggml's type traits.
+func dequantizeRow(dst []float32, src []byte, typ GGMLType) error {
+	var traits *ggmlTypeTraits
+	ggmlGetTypeTraitsFunc.Call(unsafe.Pointer(&traits), unsafe.Pointer(&typ))
+	if traits == nil || traits.ToFloat == 0 {
+		return fmt.Errorf("no conversion to float32 for tensor type %d", typ)
+	}
+
+	if traits.BlckSize > 0 && int64(len(dst))%traits.BlckSize != 0 {
+		return fmt.Errorf("row of %d elements is not a whole number of blocks", len(dst))
+	}
+
+	toFloatCifOnce.Do(func() {
+		toFloatCif = new(ffi.Cif)
+		if status := ffi.PrepCif(toFloatCif, ffi.DefaultAbi, 3, &ffi.TypeVoid, &ffi.TypePointer, &ffi.TypePointer, &ffi.TypeSint64); status != ffi.OK {
+			panic(status)
+		}
+	})
+
+	x := unsafe.Pointer(unsafe.SliceData(src))
+	y := unsafe.Pointer(unsafe.SliceData(dst))
+	k := int64(len(dst))
+	toFloat := ffi.Fun{Addr: traits.ToFloat, Cif: toFloatCif}
+	toFloat.Call(nil, &x, &y, &k)
+
+	return nil
+}
+
+// float16ToFloat32 converts an IEEE 754 half precision value.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// subnormal: normalise the mantissa
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		mant &= 0x3ff
+		return math.Float32frombits(sign | e<<23 | mant<<13)
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
+
+// tensorName returns the name of a ggml tensor.
+func tensorName(tensor uintptr) string {
+	if tensor == 0 {
+		return ""
+	}
+
+	var ret *byte
+	ggmlGetNameFunc.Call(unsafe.Pointer(&ret), unsafe.Pointer(&tensor))
+
+	return utils.BytePtrToString(ret)
+}
+
+// tensorHeader returns the type, shape and strides of a ggml tensor.
+func tensorHeader(tensor uintptr) *ggmlTensor {
+	return *(**ggmlTensor)(unsafe.Pointer(&tensor))
+}
+
+// tensorBytes copies the data of a computed ggml tensor into Go memory,
+// wherever the backend keeps it.
+func tensorBytes(tensor uintptr) []byte {
+	if tensor == 0 {
+		return nil
+	}
+
+	var size ffi.Arg
+	ggmlNbytesFunc.Call(unsafe.Pointer(&size), unsafe.Pointer(&tensor))
+	if size == 0 {
+		return nil
+	}
+
+	buf := make([]byte, size)
+	data := unsafe.Pointer(unsafe.SliceData(buf))
+	offset, n := uint64(0), uint64(size)
+	ggmlBackendTensorGetFunc.Call(nil, unsafe.Pointer(&tensor), unsafe.Pointer(&data), &offset, &n)
+
+	return buf
+}
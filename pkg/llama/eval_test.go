@@ -0,0 +1,217 @@
+package llama
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFloat16ToFloat32(t *testing.T) {
+	tests := []struct {
+		h    uint16
+		want float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.333251953125},
+		{0x7bff, 65504},
+		{0x0001, 5.960464477539063e-08}, // smallest subnormal
+	}
+
+	for _, tt := range tests {
+		if got := float16ToFloat32(tt.h); got != tt.want {
+			t.Errorf("float16ToFloat32(%#04x) = %v, expected %v", tt.h, got, tt.want)
+		}
+	}
+
+	if got := float16ToFloat32(0x7c00); !math.IsInf(float64(got), 1) {
+		t.Errorf("float16ToFloat32(0x7c00) = %v, expected +Inf", got)
+	}
+	if got := float16ToFloat32(0x7e00); !math.IsNaN(float64(got)) {
+		t.Errorf("float16ToFloat32(0x7e00) = %v, expected NaN", got)
+	}
+}
+
+func TestRowToFloat32(t *testing.T) {
+	f32 := make([]byte, 8)
+	binary.LittleEndian.PutUint32(f32, math.Float32bits(1.5))
+	binary.LittleEndian.PutUint32(f32[4:], math.Float32bits(-2))
+
+	bf16 := []byte{0xc0, 0x3f, 0x00, 0xc0} // 1.5, -2
+
+	// 1.5, 9, -2, 9 interleaved: a stride of 8 reads every other element
+	strided := make([]byte, 16)
+	binary.LittleEndian.PutUint32(strided, math.Float32bits(1.5))
+	binary.LittleEndian.PutUint32(strided[4:], math.Float32bits(9))
+	binary.LittleEndian.PutUint32(strided[8:], math.Float32bits(-2))
+	binary.LittleEndian.PutUint32(strided[12:], math.Float32bits(9))
+
+	i32 := make([]byte, 8)
+	binary.LittleEndian.PutUint32(i32, 7)
+	binary.LittleEndian.PutUint32(i32[4:], uint32(0xfffffffd)) // -3
+
+	tests := []struct {
+		name   string
+		typ    GGMLType
+		src    []byte
+		stride uint64
+		want   []float32
+	}{
+		{"f32", GGMLTypeF32, f32, 4, []float32{1.5, -2}},
+		{"bf16", GGMLTypeBF16, bf16, 2, []float32{1.5, -2}},
+		{"i32", GGMLTypeI32, i32, 4, []float32{7, -3}},
+		{"i8", GGMLTypeI8, []byte{5, 0xff}, 1, []float32{5, -1}},
+		{"f32 strided", GGMLTypeF32, strided, 8, []float32{1.5, -2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := make([]float32, len(tt.want))
+			if err := rowToFloat32(dst, tt.src, 0, tt.stride, tt.typ); err != nil {
+				t.Fatalf("rowToFloat32 failed: %v", err)
+			}
+			for i := range tt.want {
+				if dst[i] != tt.want[i] {
+					t.Fatalf("dst[%d] = %v, expected %v", i, dst[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTensorInfoShape(t *testing.T) {
+	ti := TensorInfo{Shape: [4]int64{576, 7, 1, 1}}
+	if ti.NDims() != 2 {
+		t.Fatalf("expected 2 dimensions, got %d", ti.NDims())
+	}
+	if ti.NElements() != 576*7 {
+		t.Fatalf("expected %d elements, got %d", 576*7, ti.NElements())
+	}
+
+	scalar := TensorInfo{Shape: [4]int64{1, 1, 1, 1}}
+	if scalar.NDims() != 1 {
+		t.Fatalf("expected 1 dimension, got %d", scalar.NDims())
+	}
+}
+
+func TestTensorInfoNoData(t *testing.T) {
+	var ti TensorInfo
+	if _, err := ti.Data(); err == nil {
+		t.Fatal("expected error reading data of an empty TensorInfo")
+	}
+	if _, err := ti.Bytes(); err == nil {
+		t.Fatal("expected error reading bytes of an empty TensorInfo")
+	}
+}
+
+func TestSetEvalCallbackNil(t *testing.T) {
+	p := ContextParams{CbEval: 1, CbEvalUserData: 2}
+	p.SetEvalCallback(nil)
+	if p.CbEval != 0 || p.CbEvalUserData != 0 {
+		t.Fatalf("expected eval callback to be cleared, got %v %v", p.CbEval, p.CbEvalUserData)
+	}
+}
+
+func TestEvalCallbackRelease(t *testing.T) {
+	// A fake closure, freed with the last of the two contexts using it.
+	const code = uintptr(0x1000)
+	registerEvalClosure(code, nil)
+
+	retainEvalCallback(Context(1), code)
+	retainEvalCallback(Context(2), code)
+
+	releaseEvalCallback(Context(1))
+	if _, ok := evalClosures[code]; !ok {
+		t.Fatal("closure freed while a context still uses it")
+	}
+	if err := checkEvalCallback(code); err != nil {
+		t.Fatalf("checkEvalCallback of a live closure: %v", err)
+	}
+
+	releaseEvalCallback(Context(2))
+	if _, ok := evalClosures[code]; ok {
+		t.Fatal("closure not freed with its last context")
+	}
+	if err := checkEvalCallback(code); err == nil {
+		t.Fatal("expected an error for params pointing to a freed closure")
+	}
+
+	// Clearing the callback of params that no context used frees it.
+	registerEvalClosure(code, nil)
+	if err := checkEvalCallback(code); err != nil {
+		t.Fatalf("checkEvalCallback of a new closure at the same address: %v", err)
+	}
+	p := ContextParams{CbEval: code}
+	p.SetEvalCallback(nil)
+	if _, ok := evalClosures[code]; ok {
+		t.Fatal("unused closure not freed when the callback was cleared")
+	}
+}
+
+func TestSetEvalCallback(t *testing.T) {
+	modelFile := testModelFileName(t)
+
+	testSetup(t)
+	defer testCleanup(t)
+
+	model, err := ModelLoadFromFile(modelFile, ModelDefaultParams())
+	if err != nil {
+		t.Fatalf("ModelLoadFromFile failed: %v", err)
+	}
+	defer ModelFree(model)
+
+	nEmbd := int64(ModelNEmbd(model))
+
+	var (
+		asked    int
+		captured []TensorInfo
+		data     [][]float32
+	)
+
+	params := ContextDefaultParams()
+	params.NCtx = 512
+	params.SetEvalCallback(func(ti TensorInfo, ask bool) bool {
+		if ask {
+			asked++
+			return strings.HasPrefix(ti.Name, "l_out-")
+		}
+
+		d, err := ti.Data()
+		if err != nil {
+			t.Errorf("Data failed for %s: %v", ti.Name, err)
+			return false
+		}
+		captured = append(captured, ti)
+		data = append(data, d)
+		return true
+	})
+
+	ctx, err := InitFromModel(model, params)
+	if err != nil {
+		t.Fatalf("InitFromModel failed: %v", err)
+	}
+	defer Free(ctx)
+
+	tokens := Tokenize(ModelGetVocab(model), "The quick brown fox", true, false)
+	if _, err := Decode(ctx, BatchGetOne(tokens)); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if asked == 0 {
+		t.Fatal("eval callback was never asked about a tensor")
+	}
+	if len(captured) == 0 {
+		t.Fatal("no l_out tensors were captured")
+	}
+
+	for i, ti := range captured {
+		if ti.Shape[0] != nEmbd {
+			t.Fatalf("%s: expected first dimension %d, got %d", ti.Name, nEmbd, ti.Shape[0])
+		}
+		if int64(len(data[i])) != ti.NElements() {
+			t.Fatalf("%s: expected %d values, got %d", ti.Name, ti.NElements(), len(data[i]))
+		}
+	}
+}
@@ -44,6 +44,18 @@ var (
 
 	// GGML_API const char * ggml_type_name(enum ggml_type type);
 	ggmlTypeNameFunc ffi.Fun
+
+	// GGML_API const char * ggml_get_name(const struct ggml_tensor * tensor);
+	ggmlGetNameFunc ffi.Fun
+
+	// GGML_API size_t ggml_nbytes(const struct ggml_tensor * tensor);
+	ggmlNbytesFunc ffi.Fun
+
+	// GGML_API void ggml_backend_tensor_get(const struct ggml_tensor * tensor, void * data, size_t offset, size_t size);
+	ggmlBackendTensorGetFunc ffi.Fun
+
+	// GGML_API const struct ggml_type_traits * ggml_get_type_traits(enum ggml_type type);
+	ggmlGetTypeTraitsFunc ffi.Fun
 )
 
 func loadGGMLBase(lib ffi.Lib) error {
@@ -93,6 +105,22 @@ func loadGGMLBase(lib ffi.Lib) error {
 		return loadError("ggml_type_name", err)
 	}
 
+	if ggmlGetNameFunc, err = lib.Prep("ggml_get_name", &ffi.TypePointer, &ffi.TypePointer); err != nil {
+		return loadError("ggml_get_name", err)
+	}
+
+	if ggmlNbytesFunc, err = lib.Prep("ggml_nbytes", &ffiTypeSize, &ffi.TypePointer); err != nil {
+		return loadError("ggml_nbytes", err)
+	}
+
+	if ggmlBackendTensorGetFunc, err = lib.Prep("ggml_backend_tensor_get", &ffi.TypeVoid, &ffi.TypePointer, &ffi.TypePointer, &ffiTypeSize, &ffiTypeSize); err != nil {
+		return loadError("ggml_backend_tensor_get", err)
+	}
+
+	if ggmlGetTypeTraitsFunc, err = lib.Prep("ggml_get_type_traits", &ffi.TypePointer, &ffi.TypeSint32); err != nil {
+		return loadError("ggml_get_type_traits", err)
+	}
+
 	return nil
 }
 
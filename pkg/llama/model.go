@@ -391,11 +391,15 @@ func InitFromModel(model Model, params ContextParams) (Context, error) {
 	if model == 0 {
 		return ctx, errors.New("invalid model")
 	}
+	if err := checkEvalCallback(params.CbEval); err != nil {
+		return ctx, err
+	}
 	initFromModelFunc.Call(unsafe.Pointer(&ctx), unsafe.Pointer(&model), unsafe.Pointer(&params))
 
 	if ctx == 0 {
 		return ctx, errors.New("failed to initialize model")
 	}
+	retainEvalCallback(ctx, params.CbEval)
 	return ctx, nil
 }
 
@@ -0,0 +1,345 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AnthropicMessage is a message in the Anthropic Messages wire format. The
+// system prompt is not a message in that format but a separate request field.
+type AnthropicMessage struct {
+	Role    string            `json:"role"`
+	Content *AnthropicContent `json:"content"`
+}
+
+// AnthropicContent is the content of an AnthropicMessage: either a plain
+// string or, when Blocks is not nil, an array of content blocks.
+type AnthropicContent struct {
+	Text   string
+	Blocks []AnthropicBlock
+}
+
+// AnthropicBlock is a content block. Type selects the fields in use:
+//
+//   - "text": Text
+//   - "image": Source
+//   - "thinking": Thinking and Signature
+//   - "tool_use": ID, Name and Input
+//   - "tool_result": ToolUseID, Content and IsError
+type AnthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *AnthropicImageSource `json:"source,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+	Signature string                `json:"signature,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   *AnthropicContent     `json:"content,omitempty"`
+	IsError   bool                  `json:"is_error,omitempty"`
+}
+
+// AnthropicImageSource is the source of an image block: base64 Data with a
+// MediaType when Type is "base64", or a URL when Type is "url".
+type AnthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicTool is a tool definition in the Anthropic Messages format.
+type AnthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// MarshalJSON encodes the content as a string, or as an array when Blocks is
+// not nil.
+func (c AnthropicContent) MarshalJSON() ([]byte, error) {
+	if c.Blocks != nil {
+		return json.Marshal(c.Blocks)
+	}
+	return json.Marshal(c.Text)
+}
+
+// UnmarshalJSON decodes content given as a string or an array of blocks.
+func (c *AnthropicContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		c.Text = ""
+		c.Blocks = []AnthropicBlock{}
+		return json.Unmarshal(data, &c.Blocks)
+	}
+	c.Blocks = nil
+	return json.Unmarshal(data, &c.Text)
+}
+
+// text returns the text of the content, joining the text blocks of an array.
+func (c *AnthropicContent) text() string {
+	if c == nil {
+		return ""
+	}
+	if c.Blocks == nil {
+		return c.Text
+	}
+	var b strings.Builder
+	for _, block := range c.Blocks {
+		if block.Type == "text" {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+// ToolDefinitionsFromAnthropic converts Anthropic tool definitions.
+func ToolDefinitionsFromAnthropic(tools []AnthropicTool) []ToolDefinition {
+	defs := make([]ToolDefinition, len(tools))
+	for i, t := range tools {
+		defs[i] = ToolDefinition{
+			Type: "function",
+			Function: ToolFunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			},
+		}
+	}
+	return defs
+}
+
+// ToolDefinitionsToAnthropic converts tool definitions to the Anthropic format.
+func ToolDefinitionsToAnthropic(defs []ToolDefinition) []AnthropicTool {
+	tools := make([]AnthropicTool, len(defs))
+	for i, d := range defs {
+		schema := d.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		tools[i] = AnthropicTool{Name: d.Function.Name, Description: d.Function.Description, InputSchema: schema}
+	}
+	return tools
+}
+
+// FromAnthropic converts an Anthropic Messages request into messages. A
+// non-empty system prompt becomes a leading system [Chat]. Assistant messages
+// with tool_use blocks become [Tool] messages, with their thinking blocks as
+// Reasoning and the signature of a single thinking block as
+// ReasoningSignature; each tool_result block becomes a [ToolResponse]; user
+// messages with image blocks become [Multimodal].
+//
+// The is_error flag of tool results is not kept, nor are the signatures of
+// messages with several thinking blocks, whose text is joined.
+func FromAnthropic(system string, msgs []AnthropicMessage) ([]Message, error) {
+	var out []Message
+	if system != "" {
+		out = append(out, Chat{Role: "system", Content: system})
+	}
+
+	names := make(map[string]string) // tool_use ID to tool name
+	for i, m := range msgs {
+		if m.Content == nil || m.Content.Blocks == nil {
+			out = append(out, Chat{Role: m.Role, Content: m.Content.text()})
+			continue
+		}
+
+		converted, err := fromAnthropicBlocks(m.Role, m.Content.Blocks, names)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		out = append(out, converted...)
+	}
+
+	return out, nil
+}
+
+func fromAnthropicBlocks(role string, blocks []AnthropicBlock, names map[string]string) ([]Message, error) {
+	var (
+		out       []Message
+		parts     []Part
+		reasoning strings.Builder
+		signature string
+		thinking  int
+		calls     []ToolCall
+		hasMedia  bool
+	)
+
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			parts = append(parts, TextPart(b.Text))
+
+		case "image":
+			part, err := anthropicImagePart(b.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+			hasMedia = true
+
+		case "thinking":
+			reasoning.WriteString(b.Thinking)
+			signature = b.Signature
+			thinking++
+
+		case "redacted_thinking":
+			// Encrypted reasoning that cannot be rendered again.
+
+		case "tool_use":
+			input := b.Input
+			if len(input) == 0 || string(input) == "null" {
+				input = json.RawMessage("{}")
+			}
+			call := newJSONToolCall(b.Name, input)
+			call.ID = b.ID
+			calls = append(calls, call)
+			names[b.ID] = b.Name
+
+		case "tool_result":
+			out = append(out, ToolResponse{Role: "tool", Name: names[b.ToolUseID], Content: b.Content.text(), ToolCallID: b.ToolUseID})
+
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q", b.Type)
+		}
+	}
+
+	if thinking > 1 {
+		// The signatures do not hold for the joined text.
+		signature = ""
+	}
+
+	switch {
+	case len(calls) > 0:
+		out = append(out, Tool{Role: role, Content: PartsText(parts, ""), Reasoning: reasoning.String(), ReasoningSignature: signature, ToolCalls: calls})
+	case hasMedia || (len(parts) > 0 && len(out) == 0 && reasoning.Len() == 0):
+		// Keep a block array as a block array, so that it converts back
+		// unchanged.
+		out = append(out, Multimodal{Role: role, Parts: parts})
+	case len(parts) > 0 || reasoning.Len() > 0:
+		out = append(out, Chat{Role: role, Content: PartsText(parts, ""), Reasoning: reasoning.String(), ReasoningSignature: signature})
+	}
+	return out, nil
+}
+
+func anthropicImagePart(src *AnthropicImageSource) (Part, error) {
+	if src == nil {
+		return Part{}, errors.New("image block without a source")
+	}
+	switch src.Type {
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(src.Data)
+		if err != nil {
+			return Part{}, fmt.Errorf("invalid image data: %w", err)
+		}
+		return Part{Type: PartImage, Data: data, MIMEType: src.MediaType}, nil
+	case "url":
+		return Part{Type: PartImage, URL: src.URL}, nil
+	default:
+		return Part{}, fmt.Errorf("unsupported image source type %q", src.Type)
+	}
+}
+
+// ToAnthropic converts messages into an Anthropic Messages request. System
+// messages are joined into the returned system prompt. Tool responses become
+// tool_result blocks of a user message, merged with the user turn that
+// follows them since the format requires user and assistant turns to
+// alternate. Tool calls without an ID are given one.
+//
+// Reasoning becomes a thinking block only with its ReasoningSignature, since
+// the Messages API rejects thinking blocks without the signature it gave
+// them; the reasoning of other models is left out.
+func ToAnthropic(msgs []Message) (system string, out []AnthropicMessage, err error) {
+	var systems []string
+	pending := make(map[string][]string) // tool name to generated tool_use IDs
+
+	// appendBlocks adds blocks to the last message when it has the same role.
+	appendBlocks := func(role string, blocks ...AnthropicBlock) {
+		if n := len(out); n > 0 && out[n-1].Role == role && out[n-1].Content.Blocks != nil {
+			out[n-1].Content.Blocks = append(out[n-1].Content.Blocks, blocks...)
+			return
+		}
+		out = append(out, AnthropicMessage{Role: role, Content: &AnthropicContent{Blocks: blocks}})
+	}
+
+	for i, m := range msgs {
+		switch m := m.(type) {
+		case Chat:
+			switch {
+			case m.Role == "system":
+				systems = append(systems, m.Content)
+			case m.Reasoning != "" && m.ReasoningSignature != "":
+				appendBlocks(m.Role,
+					AnthropicBlock{Type: "thinking", Thinking: m.Reasoning, Signature: m.ReasoningSignature},
+					AnthropicBlock{Type: "text", Text: m.Content})
+			case len(out) > 0 && out[len(out)-1].Role == m.Role && out[len(out)-1].Content.Blocks != nil:
+				appendBlocks(m.Role, AnthropicBlock{Type: "text", Text: m.Content})
+			default:
+				out = append(out, AnthropicMessage{Role: m.Role, Content: &AnthropicContent{Text: m.Content}})
+			}
+
+		case Multimodal:
+			blocks, err := partsToAnthropic(m.Parts)
+			if err != nil {
+				return "", nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			appendBlocks(m.Role, blocks...)
+
+		case Tool:
+			var blocks []AnthropicBlock
+			if m.Reasoning != "" && m.ReasoningSignature != "" {
+				blocks = append(blocks, AnthropicBlock{Type: "thinking", Thinking: m.Reasoning, Signature: m.ReasoningSignature})
+			}
+			if m.Content != "" {
+				blocks = append(blocks, AnthropicBlock{Type: "text", Text: m.Content})
+			}
+			for j, call := range m.ToolCalls {
+				id := call.ID
+				if id == "" {
+					id = fmt.Sprintf("toolu_%d_%d", i, j)
+					pending[call.Function.Name] = append(pending[call.Function.Name], id)
+				}
+				blocks = append(blocks, AnthropicBlock{Type: "tool_use", ID: id, Name: call.Function.Name, Input: call.Function.ArgumentsJSON()})
+			}
+			appendBlocks("assistant", blocks...)
+
+		case ToolResponse:
+			id := m.ToolCallID
+			if ids := pending[m.Name]; id == "" && len(ids) > 0 {
+				id, pending[m.Name] = ids[0], ids[1:]
+			}
+			appendBlocks("user", AnthropicBlock{Type: "tool_result", ToolUseID: id, Content: &AnthropicContent{Text: m.Content}})
+
+		default:
+			return "", nil, fmt.Errorf("message %d: unsupported message type %T", i, m)
+		}
+	}
+
+	return strings.Join(systems, "\n\n"), out, nil
+}
+
+func partsToAnthropic(parts []Part) ([]AnthropicBlock, error) {
+	blocks := make([]AnthropicBlock, 0, len(parts))
+	for _, p := range parts {
+		switch {
+		case p.Type == PartText:
+			blocks = append(blocks, AnthropicBlock{Type: "text", Text: p.Text})
+		case p.Type == PartImage && len(p.Data) > 0:
+			blocks = append(blocks, AnthropicBlock{Type: "image", Source: &AnthropicImageSource{
+				Type:      "base64",
+				MediaType: p.MIMEType,
+				Data:      base64.StdEncoding.EncodeToString(p.Data),
+			}})
+		case p.Type == PartImage && p.URL != "":
+			blocks = append(blocks, AnthropicBlock{Type: "image", Source: &AnthropicImageSource{Type: "url", URL: p.URL}})
+		default:
+			return nil, fmt.Errorf("unsupported %s part", p.Type)
+		}
+	}
+	return blocks, nil
+}
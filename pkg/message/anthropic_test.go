@@ -0,0 +1,196 @@
+package message
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const anthropicConversation = `[
+	{"role": "user", "content": "What is the weather in Paris?"},
+	{"role": "assistant", "content": [
+		{"type": "thinking", "thinking": "I should call the weather tool.", "signature": "EqQBCkYIBhgCKkB0c2lnbmF0dXJl"},
+		{"type": "text", "text": "Let me check."},
+		{"type": "tool_use", "id": "toolu_01", "name": "get_weather", "input": {"days": 3, "location": "Paris"}}
+	]},
+	{"role": "user", "content": [
+		{"type": "tool_result", "tool_use_id": "toolu_01", "content": "Sunny, 22C"},
+		{"type": "text", "text": "And what does this show?"},
+		{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}
+	]},
+	{"role": "assistant", "content": [{"type": "text", "text": "It is sunny, and the image shows a cat."}]}
+]`
+
+func TestFromAnthropic(t *testing.T) {
+	var in []AnthropicMessage
+	if err := json.Unmarshal([]byte(anthropicConversation), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs, err := FromAnthropic("Be brief.", in)
+	if err != nil {
+		t.Fatalf("FromAnthropic: %v", err)
+	}
+	if len(msgs) != 6 {
+		t.Fatalf("expected 6 messages, got %d: %+v", len(msgs), msgs)
+	}
+
+	if sys, ok := msgs[0].(Chat); !ok || sys.Role != "system" || sys.Content != "Be brief." {
+		t.Errorf("msgs[0]: got %+v", msgs[0])
+	}
+
+	tool, ok := msgs[2].(Tool)
+	if !ok {
+		t.Fatalf("msgs[2]: got %T, want Tool", msgs[2])
+	}
+	if tool.Reasoning != "I should call the weather tool." || tool.ReasoningSignature != "EqQBCkYIBhgCKkB0c2lnbmF0dXJl" || tool.Content != "Let me check." {
+		t.Errorf("tool: got %+v", tool)
+	}
+	call := tool.ToolCalls[0]
+	if call.ID != "toolu_01" || call.Function.Arguments["location"] != "Paris" {
+		t.Errorf("call: got %+v", call)
+	}
+	if call.Function.TypedArguments["days"] != json.Number("3") {
+		t.Errorf("days: got %#v", call.Function.TypedArguments["days"])
+	}
+
+	resp, ok := msgs[3].(ToolResponse)
+	if !ok {
+		t.Fatalf("msgs[3]: got %T, want ToolResponse", msgs[3])
+	}
+	if resp.Name != "get_weather" || resp.ToolCallID != "toolu_01" || resp.Content != "Sunny, 22C" {
+		t.Errorf("tool response: got %+v", resp)
+	}
+
+	mm, ok := msgs[4].(Multimodal)
+	if !ok {
+		t.Fatalf("msgs[4]: got %T, want Multimodal", msgs[4])
+	}
+	if len(mm.Parts) != 2 || mm.Parts[1].MIMEType != "image/png" {
+		t.Errorf("parts: got %+v", mm.Parts)
+	}
+}
+
+func TestAnthropic_RoundTrip(t *testing.T) {
+	var in []AnthropicMessage
+	if err := json.Unmarshal([]byte(anthropicConversation), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs, err := FromAnthropic("Be brief.", in)
+	if err != nil {
+		t.Fatalf("FromAnthropic: %v", err)
+	}
+	system, out, err := ToAnthropic(msgs)
+	if err != nil {
+		t.Fatalf("ToAnthropic: %v", err)
+	}
+	if system != "Be brief." {
+		t.Errorf("system: got %q", system)
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var want, got any
+	json.Unmarshal([]byte(anthropicConversation), &want)
+	json.Unmarshal(data, &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\ngot  %s\nwant %s", data, anthropicConversation)
+	}
+}
+
+func TestToAnthropic_UnsignedReasoning(t *testing.T) {
+	msgs := []Message{
+		Chat{Role: "user", Content: "Hi"},
+		Chat{Role: "assistant", Content: "Hello!", Reasoning: "Greet back."},
+		Chat{Role: "user", Content: "Weather?"},
+		Tool{Role: "assistant", Reasoning: "Call the tool.", ToolCalls: []ToolCall{
+			{ID: "toolu_01", Type: "function", Function: ToolFunction{Name: "get_weather"}},
+		}},
+	}
+
+	_, out, err := ToAnthropic(msgs)
+	if err != nil {
+		t.Fatalf("ToAnthropic: %v", err)
+	}
+	if len(out) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(out))
+	}
+	if out[1].Content.Blocks != nil || out[1].Content.Text != "Hello!" {
+		t.Errorf("assistant message: got %+v", out[1].Content)
+	}
+	for _, b := range out[3].Content.Blocks {
+		if b.Type == "thinking" {
+			t.Errorf("tool message has an unsigned thinking block: %+v", b)
+		}
+	}
+}
+
+func TestFromAnthropic_SeveralThinkingBlocks(t *testing.T) {
+	msgs, err := FromAnthropic("", []AnthropicMessage{
+		{Role: "assistant", Content: &AnthropicContent{Blocks: []AnthropicBlock{
+			{Type: "thinking", Thinking: "First. ", Signature: "sig1"},
+			{Type: "thinking", Thinking: "Second.", Signature: "sig2"},
+			{Type: "text", Text: "Done."},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("FromAnthropic: %v", err)
+	}
+	chat, ok := msgs[0].(Chat)
+	if !ok || chat.Reasoning != "First. Second." || chat.ReasoningSignature != "" {
+		t.Errorf("got %+v, want joined reasoning without a signature", msgs[0])
+	}
+}
+
+func TestToAnthropic_MergesToolResults(t *testing.T) {
+	msgs := []Message{
+		Chat{Role: "user", Content: "Weather and time?"},
+		Tool{Role: "assistant", ToolCalls: []ToolCall{
+			{Type: "function", Function: ToolFunction{Name: "get_weather"}},
+			{Type: "function", Function: ToolFunction{Name: "get_time"}},
+		}},
+		ToolResponse{Role: "tool", Name: "get_time", Content: "09:00"},
+		ToolResponse{Role: "tool", Name: "get_weather", Content: "Sunny"},
+	}
+
+	_, out, err := ToAnthropic(msgs)
+	if err != nil {
+		t.Fatalf("ToAnthropic: %v", err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(out))
+	}
+
+	uses := out[1].Content.Blocks
+	results := out[2].Content.Blocks
+	if out[2].Role != "user" || len(results) != 2 {
+		t.Fatalf("tool results: got %+v", out[2])
+	}
+	if results[0].ToolUseID != uses[1].ID || results[1].ToolUseID != uses[0].ID {
+		t.Errorf("tool_use_id: got %q and %q, want %q and %q",
+			results[0].ToolUseID, results[1].ToolUseID, uses[1].ID, uses[0].ID)
+	}
+	if string(uses[0].Input) != "{}" {
+		t.Errorf("input: got %s", uses[0].Input)
+	}
+}
+
+func TestAnthropicTools(t *testing.T) {
+	tools := []AnthropicTool{{
+		Name:        "get_weather",
+		Description: "Get the weather",
+		InputSchema: map[string]any{"type": "object", "required": []any{"location"}},
+	}}
+
+	defs := ToolDefinitionsFromAnthropic(tools)
+
+	if defs[0].Type != "function" || defs[0].Function.Name != "get_weather" {
+		t.Errorf("definition: got %+v", defs[0])
+	}
+	if back := ToolDefinitionsToAnthropic(defs); !reflect.DeepEqual(back, tools) {
+		t.Errorf("round trip: got %+v, want %+v", back, tools)
+	}
+}
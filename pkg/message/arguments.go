@@ -0,0 +1,351 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// ArgumentsJSON returns the arguments of the function as a JSON object,
+// using TypedArguments when they are set and Arguments otherwise.
+func (f ToolFunction) ArgumentsJSON() json.RawMessage {
+	var v any = f.Arguments
+	if f.TypedArguments != nil {
+		v = f.TypedArguments
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return json.RawMessage("{}")
+	}
+	return b
+}
+
+// CoerceArguments returns a copy of call whose TypedArguments are converted
+// to the types declared for them in the JSON Schema of the matching tool in
+// defs. It is meant for tag-based formats such as Qwen, GLM and Gemma, where
+// every value is parsed as a string: for example "3" becomes a json.Number for
+// an integer property, and "[1, 2]" becomes a []any for an array property.
+// Values that do not convert cleanly, and calls to tools not in defs, are
+// left unchanged.
+func CoerceArguments(call ToolCall, defs []ToolDefinition) ToolCall {
+	def, ok := findToolDefinition(call.Function.Name, defs)
+	if !ok {
+		return call
+	}
+	properties, _ := def.Function.Parameters["properties"].(map[string]any)
+	if len(properties) == 0 {
+		return call
+	}
+
+	typed := call.Function.TypedArguments
+	if typed == nil {
+		typed = stringValues(call.Function.Arguments)
+	}
+
+	coerced := make(map[string]any, len(typed))
+	for k, v := range typed {
+		schema, _ := properties[k].(map[string]any)
+		coerced[k] = coerceValue(v, schema)
+	}
+	call.Function.TypedArguments = coerced
+	return call
+}
+
+// findToolDefinition returns the definition of the named tool.
+func findToolDefinition(name string, defs []ToolDefinition) (ToolDefinition, bool) {
+	for _, def := range defs {
+		if def.Function.Name == name {
+			return def, true
+		}
+	}
+	return ToolDefinition{}, false
+}
+
+// coerceValue converts a string value to the first type in schema it can be
+// parsed as. Values are left as they are when the schema accepts strings.
+func coerceValue(v any, schema map[string]any) any {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+
+	types := schemaTypes(schema)
+	for _, t := range types {
+		if t == "string" {
+			return v
+		}
+	}
+
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if _, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+				return json.Number(strings.TrimSpace(s))
+			}
+		case "number":
+			if n, ok := jsonNumber(strings.TrimSpace(s)); ok {
+				return n
+			}
+		case "boolean":
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true":
+				return true
+			case "false":
+				return false
+			}
+		case "null":
+			if strings.TrimSpace(s) == "null" {
+				return nil
+			}
+		case "array":
+			if a, ok := decodeJSONValue(s).([]any); ok {
+				return a
+			}
+		case "object":
+			if m, ok := decodeJSONValue(s).(map[string]any); ok {
+				return m
+			}
+		}
+	}
+	return v
+}
+
+// schemaTypes returns the types a JSON Schema accepts, from a "type" given
+// either as a string or a list of strings.
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []any:
+		var types []string
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// decodeJSONValue decodes a JSON value keeping numbers as json.Number. It
+// returns nil if s is not valid JSON.
+func decodeJSONValue(s string) any {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil
+	}
+	return v
+}
+
+// decodeJSONValues decodes a JSON object keeping numbers as json.Number, or
+// returns nil if data is not a JSON object.
+func decodeJSONValues(data []byte) map[string]any {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// decodeJSONArguments decodes the "arguments" or "args" member of a JSON tool
+// call object keeping numbers as json.Number.
+func decodeJSONArguments(data []byte) map[string]any {
+	var parsed struct {
+		Arguments json.RawMessage `json:"arguments"`
+		Args      json.RawMessage `json:"args"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil
+	}
+	if len(parsed.Arguments) > 0 {
+		return decodeJSONValues(parsed.Arguments)
+	}
+	return decodeJSONValues(parsed.Args)
+}
+
+// jsonNumber returns s as a json.Number if it is a valid JSON number.
+func jsonNumber(s string) (json.Number, bool) {
+	if s == "" || !json.Valid([]byte(s)) || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return "", false
+	}
+	return json.Number(s), true
+}
+
+// stringValues converts string arguments to typed arguments.
+func stringValues(args map[string]string) map[string]any {
+	if args == nil {
+		return nil
+	}
+	m := make(map[string]any, len(args))
+	for k, v := range args {
+		m[k] = v
+	}
+	return m
+}
+
+// plainValue converts json.Number values in v to int64 or float64, so that
+// typed arguments can be used by templates that do not know json.Number.
+func plainValue(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	case map[string]any:
+		m := make(map[string]any, len(val))
+		for k, e := range val {
+			m[k] = plainValue(e)
+		}
+		return m
+	case []any:
+		a := make([]any, len(val))
+		for i, e := range val {
+			a[i] = plainValue(e)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// parseGemmaValues parses a Gemma 4 argument block like parseGemmaArgs, but
+// keeps the structure of the values: quoted values are strings, bare values
+// are numbers, booleans or null where they parse as such, and nested {…} and
+// […] values are objects and arrays. It returns nil if the block is malformed.
+func parseGemmaValues(raw string) map[string]any {
+	p := gemmaValueParser{s: raw}
+	m, ok := p.object(0)
+	if !ok {
+		return nil
+	}
+	return m
+}
+
+// gemmaValueParser parses the value syntax of Gemma 4 tool calls.
+type gemmaValueParser struct {
+	s string
+	i int
+}
+
+// object parses key:value members up to the closing byte end, or to the end
+// of the input when end is 0.
+func (p *gemmaValueParser) object(end byte) (map[string]any, bool) {
+	m := make(map[string]any)
+	for {
+		p.skip(", \t\r\n")
+		if p.i >= len(p.s) {
+			return m, end == 0
+		}
+		if p.s[p.i] == end {
+			p.i++
+			return m, true
+		}
+
+		colon := strings.IndexByte(p.s[p.i:], ':')
+		if colon == -1 {
+			return nil, false
+		}
+		key := strings.Trim(strings.TrimSpace(p.s[p.i:p.i+colon]), `"`)
+		p.i += colon + 1
+
+		v, ok := p.value()
+		if !ok || key == "" {
+			return nil, false
+		}
+		m[key] = v
+	}
+}
+
+// array parses values up to the closing ].
+func (p *gemmaValueParser) array() ([]any, bool) {
+	a := []any{}
+	for {
+		p.skip(", \t\r\n")
+		if p.i >= len(p.s) {
+			return nil, false
+		}
+		if p.s[p.i] == ']' {
+			p.i++
+			return a, true
+		}
+		v, ok := p.value()
+		if !ok {
+			return nil, false
+		}
+		a = append(a, v)
+	}
+}
+
+func (p *gemmaValueParser) value() (any, bool) {
+	p.skip(" \t\r\n")
+	rest := p.s[p.i:]
+
+	for _, tok := range gemmaQuoteTokens {
+		if strings.HasPrefix(rest, tok) {
+			end := findClosingGemmaQuote(rest[len(tok):], tok)
+			if end == -1 {
+				return nil, false
+			}
+			p.i += len(tok) + end + len(tok)
+			return rest[len(tok) : len(tok)+end], true
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(rest, `"`):
+		end := findClosingStandardQuote(rest[1:])
+		if end == -1 {
+			return nil, false
+		}
+		p.i += end + 2
+		var s string
+		if err := json.Unmarshal([]byte(rest[:end+2]), &s); err != nil {
+			s = rest[1 : end+1]
+		}
+		return s, true
+	case strings.HasPrefix(rest, "{"):
+		p.i++
+		return p.object('}')
+	case strings.HasPrefix(rest, "["):
+		p.i++
+		return p.array()
+	}
+
+	end := strings.IndexAny(rest, ",}]")
+	if end == -1 {
+		end = len(rest)
+	}
+	p.i += end
+
+	bare := strings.TrimSpace(rest[:end])
+	switch bare {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	}
+	if n, ok := jsonNumber(bare); ok {
+		return n, true
+	}
+	return bare, true
+}
+
+func (p *gemmaValueParser) skip(chars string) {
+	for p.i < len(p.s) && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
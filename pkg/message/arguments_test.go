@@ -0,0 +1,197 @@
+package message
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTypedArguments_JSONFormats(t *testing.T) {
+	want := map[string]any{
+		"ids":    []any{json.Number("12345678901234567"), json.Number("2")},
+		"filter": map[string]any{"active": true, "tag": nil},
+		"limit":  json.Number("10"),
+		"query":  "go",
+	}
+	args := `{"ids": [12345678901234567, 2], "filter": {"active": true, "tag": null}, "limit": 10, "query": "go"}`
+
+	responses := map[string]string{
+		"standard": `<tool_call>{"name": "search", "arguments": ` + args + `}</tool_call>`,
+		"inline":   `{"name": "search", "args": ` + args + `}`,
+		"mistral":  `[TOOL_CALLS]search[ARGS]` + args,
+		"gpt":      `.search <|message|>` + args,
+	}
+
+	for name, response := range responses {
+		calls := ParseToolCalls(response)
+		if len(calls) != 1 {
+			t.Fatalf("%s: expected 1 call, got %d", name, len(calls))
+		}
+		if !reflect.DeepEqual(calls[0].Function.TypedArguments, want) {
+			t.Errorf("%s: typed arguments: got %#v", name, calls[0].Function.TypedArguments)
+		}
+		if calls[0].Function.Arguments["limit"] != "10" {
+			t.Errorf("%s: string arguments changed: got %q", name, calls[0].Function.Arguments["limit"])
+		}
+	}
+}
+
+func TestTypedArguments_StandardFlattened(t *testing.T) {
+	calls := ParseToolCalls(`<tool_call>{"name": "move", "arguments": {"command": "turn", "arguments": {"angle": 90}}}</tool_call>`)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+
+	want := map[string]any{"command": "turn", "angle": json.Number("90")}
+	if !reflect.DeepEqual(calls[0].Function.TypedArguments, want) {
+		t.Errorf("typed arguments: got %#v", calls[0].Function.TypedArguments)
+	}
+}
+
+func TestTypedArguments_TagFormats(t *testing.T) {
+	responses := map[string]string{
+		"qwen": "<function=search>\n<parameter=limit>\n10\n</parameter>\n</function>",
+		"glm":  "search<arg_key>limit</arg_key><arg_value>10</arg_value>",
+	}
+
+	for name, response := range responses {
+		calls := ParseToolCalls(response)
+		if len(calls) != 1 {
+			t.Fatalf("%s: expected 1 call, got %d", name, len(calls))
+		}
+		if v := calls[0].Function.TypedArguments["limit"]; v != "10" {
+			t.Errorf("%s: expected the string \"10\", got %#v", name, v)
+		}
+	}
+}
+
+func TestTypedArguments_Gemma(t *testing.T) {
+	calls := ParseToolCalls(`call:search{query:<|"|>go, rust<|"|>,limit:10,exact:false,ids:[1,2],filter:{tag:<|"|>new<|"|>}}`)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+
+	want := map[string]any{
+		"query":  "go, rust",
+		"limit":  json.Number("10"),
+		"exact":  false,
+		"ids":    []any{json.Number("1"), json.Number("2")},
+		"filter": map[string]any{"tag": "new"},
+	}
+	if !reflect.DeepEqual(calls[0].Function.TypedArguments, want) {
+		t.Errorf("typed arguments: got %#v", calls[0].Function.TypedArguments)
+	}
+}
+
+func TestParseGemmaValues_Malformed(t *testing.T) {
+	if v := parseGemmaValues(`query:<|"|>unterminated`); v != nil {
+		t.Errorf("expected nil for an unterminated value, got %#v", v)
+	}
+	if v := parseGemmaValues(`ids:[1,2`); v != nil {
+		t.Errorf("expected nil for an unterminated array, got %#v", v)
+	}
+}
+
+func TestCoerceArguments(t *testing.T) {
+	defs := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name: "search",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query":  map[string]any{"type": "string"},
+					"limit":  map[string]any{"type": "integer"},
+					"score":  map[string]any{"type": "number"},
+					"exact":  map[string]any{"type": "boolean"},
+					"ids":    map[string]any{"type": "array"},
+					"filter": map[string]any{"type": "object"},
+					"tag":    map[string]any{"type": []any{"string", "null"}},
+					"page":   map[string]any{"type": "integer"},
+				},
+			},
+		},
+	}}
+
+	call := ToolCall{
+		Type: "function",
+		Function: ToolFunction{
+			Name: "search",
+			Arguments: map[string]string{
+				"query":  "42",
+				"limit":  "10",
+				"score":  "0.5",
+				"exact":  "True",
+				"ids":    "[1, 2]",
+				"filter": `{"active": true}`,
+				"tag":    "null",
+				"page":   "first",
+				"extra":  "7",
+			},
+		},
+	}
+
+	got := CoerceArguments(call, defs)
+
+	want := map[string]any{
+		"query":  "42",
+		"limit":  json.Number("10"),
+		"score":  json.Number("0.5"),
+		"exact":  true,
+		"ids":    []any{json.Number("1"), json.Number("2")},
+		"filter": map[string]any{"active": true},
+		"tag":    "null",
+		"page":   "first",
+		"extra":  "7",
+	}
+	if !reflect.DeepEqual(got.Function.TypedArguments, want) {
+		t.Errorf("coerced arguments: got %#v", got.Function.TypedArguments)
+	}
+	if call.Function.TypedArguments != nil {
+		t.Error("expected the original call to be left unchanged")
+	}
+
+	unknown := CoerceArguments(ToolCall{Function: ToolFunction{Name: "other"}}, defs)
+	if unknown.Function.TypedArguments != nil {
+		t.Errorf("expected no change for an unknown tool, got %#v", unknown.Function.TypedArguments)
+	}
+}
+
+func TestArgumentsJSON(t *testing.T) {
+	f := ToolFunction{
+		Arguments:      map[string]string{"ids": "[1,2]"},
+		TypedArguments: map[string]any{"ids": []any{json.Number("1"), json.Number("2")}},
+	}
+	if got := string(f.ArgumentsJSON()); got != `{"ids":[1,2]}` {
+		t.Errorf("typed: got %s", got)
+	}
+
+	f.TypedArguments = nil
+	if got := string(f.ArgumentsJSON()); got != `{"ids":"[1,2]"}` {
+		t.Errorf("strings: got %s", got)
+	}
+
+	if got := string((ToolFunction{}).ArgumentsJSON()); got != `{}` {
+		t.Errorf("empty: got %s", got)
+	}
+}
+
+func TestToolMessage_GetContentTyped(t *testing.T) {
+	msg := Tool{
+		Role: "assistant",
+		ToolCalls: []ToolCall{{
+			Type: "function",
+			Function: ToolFunction{
+				Name:           "add",
+				Arguments:      map[string]string{"a": "1", "b": "2.5"},
+				TypedArguments: map[string]any{"a": json.Number("1"), "b": json.Number("2.5")},
+			},
+		}},
+	}
+
+	calls := msg.GetContent()["tool_calls"].([]map[string]interface{})
+	args := calls[0]["function"].(map[string]interface{})["arguments"].(map[string]interface{})
+	if args["a"] != int64(1) || args["b"] != 2.5 {
+		t.Errorf("arguments: got %#v", args)
+	}
+}
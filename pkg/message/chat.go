@@ -1,9 +1,15 @@
 package message
 
 // Chat represents a standard chat message with a role and content.
+// Reasoning may hold the reasoning an assistant produced before its content,
+// as returned by SplitReasoning. ReasoningSignature holds the signature that
+// the Anthropic Messages API gives its thinking, without which it does not
+// accept the thinking back.
 type Chat struct {
-	Role    string
-	Content string
+	Role               string
+	Content            string
+	Reasoning          string
+	ReasoningSignature string
 }
 
 // GetRole returns the role of the chat message.
@@ -13,7 +19,19 @@ func (cm Chat) GetRole() string {
 
 // GetContent returns the content of the chat message as a map.
 func (cm Chat) GetContent() map[string]interface{} {
-	return map[string]interface{}{
+	m := map[string]interface{}{
 		"content": cm.Content,
 	}
+	addReasoning(m, cm.Reasoning)
+	return m
+}
+
+// addReasoning adds reasoning to message content under the names used by
+// chat templates: reasoning_content (Qwen3, GLM, DeepSeek) and thinking
+// (GPT-OSS).
+func addReasoning(m map[string]interface{}, reasoning string) {
+	if reasoning != "" {
+		m["reasoning_content"] = reasoning
+		m["thinking"] = reasoning
+	}
 }
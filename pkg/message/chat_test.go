@@ -21,3 +21,16 @@ func TestChatMessage_GetContent(t *testing.T) {
 		t.Errorf("GetContent() = %v, want %v", content, expected)
 	}
 }
+
+func TestChatMessage_GetContentReasoning(t *testing.T) {
+	msg := Chat{Role: "assistant", Content: "42", Reasoning: "6 times 7"}
+	content := msg.GetContent()
+	expected := map[string]interface{}{
+		"content":           "42",
+		"reasoning_content": "6 times 7",
+		"thinking":          "6 times 7",
+	}
+	if !reflect.DeepEqual(content, expected) {
+		t.Errorf("GetContent() = %v, want %v", content, expected)
+	}
+}
@@ -0,0 +1,179 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/mtmd"
+)
+
+// MediaMarker is the placeholder that stands for an image or audio part in
+// prompt text. It is the default marker of the mtmd projectors; use
+// mtmd.GetMarker to get the marker of a specific projector context.
+const MediaMarker = "<__media__>"
+
+// PartType is the type of a content Part.
+type PartType string
+
+// Content part types.
+const (
+	PartText  PartType = "text"
+	PartImage PartType = "image"
+	PartAudio PartType = "audio"
+)
+
+// Part is one piece of the content of a Multimodal message.
+// Images and audio are given either as the bytes of an encoded file (Data),
+// as a file path (Path), or for audio as PCM F32 samples (Samples). MIMEType
+// optionally records the media type of Data, e.g. "image/png". URL holds a
+// remote image received over an API; it must be downloaded into Data before
+// Bitmaps can load it.
+type Part struct {
+	Type     PartType
+	Text     string
+	Data     []byte
+	MIMEType string
+	Path     string
+	URL      string
+	Samples  []float32
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+// ImagePart returns an image content part from the bytes of an encoded image
+// file, e.g. a JPEG or PNG.
+func ImagePart(data []byte) Part {
+	return Part{Type: PartImage, Data: data}
+}
+
+// ImageFilePart returns an image content part read from path.
+func ImageFilePart(path string) Part {
+	return Part{Type: PartImage, Path: path}
+}
+
+// AudioPart returns an audio content part from PCM F32 samples at the
+// sample rate of the projector (see mtmd.GetAudioSampleRate).
+func AudioPart(samples []float32) Part {
+	return Part{Type: PartAudio, Samples: samples}
+}
+
+// AudioFilePart returns an audio content part read from path, e.g. a WAV or
+// MP3 file.
+func AudioFilePart(path string) Part {
+	return Part{Type: PartAudio, Path: path}
+}
+
+// IsMedia reports whether the part is an image or audio part.
+func (p Part) IsMedia() bool {
+	return p.Type == PartImage || p.Type == PartAudio
+}
+
+// Multimodal is a chat message whose content is made of ordered text, image
+// and audio parts.
+type Multimodal struct {
+	Role      string
+	Parts     []Part
+	Reasoning string
+}
+
+// MediaMessage is a Message with image or audio parts. template.Apply renders
+// each media part of such a message as a media marker.
+type MediaMessage interface {
+	Message
+	GetParts() []Part
+}
+
+// GetRole returns the role of the message.
+func (m Multimodal) GetRole() string {
+	return m.Role
+}
+
+// GetParts returns the content parts of the message.
+func (m Multimodal) GetParts() []Part {
+	return m.Parts
+}
+
+// GetContent returns the content of the message as a map. The content is the
+// text of the parts with each media part replaced by MediaMarker.
+func (m Multimodal) GetContent() map[string]interface{} {
+	c := map[string]interface{}{
+		"content": PartsText(m.Parts, MediaMarker),
+	}
+	addReasoning(c, m.Reasoning)
+	return c
+}
+
+// PartsText returns the text of parts with each image or audio part replaced
+// by marker.
+func PartsText(parts []Part, marker string) string {
+	var b strings.Builder
+	for _, p := range parts {
+		switch {
+		case p.Type == PartText:
+			b.WriteString(p.Text)
+		case p.IsMedia():
+			b.WriteString(marker)
+		}
+	}
+	return b.String()
+}
+
+// Bitmaps returns the bitmaps of the image and audio parts of messages in
+// the order in which their markers appear in the prompt rendered from the
+// same messages, ready to be passed to mtmd.Tokenize. The caller must free
+// them with FreeBitmaps.
+func Bitmaps(ctx mtmd.Context, messages []Message) ([]mtmd.Bitmap, error) {
+	var bitmaps []mtmd.Bitmap
+	for _, m := range messages {
+		mm, ok := m.(MediaMessage)
+		if !ok {
+			continue
+		}
+		for _, p := range mm.GetParts() {
+			if !p.IsMedia() {
+				continue
+			}
+			bitmap, err := partBitmap(ctx, p)
+			if err != nil {
+				FreeBitmaps(bitmaps)
+				return nil, err
+			}
+			bitmaps = append(bitmaps, bitmap)
+		}
+	}
+	return bitmaps, nil
+}
+
+// FreeBitmaps frees bitmaps returned by Bitmaps.
+func FreeBitmaps(bitmaps []mtmd.Bitmap) {
+	for _, b := range bitmaps {
+		mtmd.BitmapFree(b)
+	}
+}
+
+func partBitmap(ctx mtmd.Context, p Part) (mtmd.Bitmap, error) {
+	var bitmap mtmd.Bitmap
+	switch {
+	case p.Type == PartAudio && len(p.Samples) > 0:
+		bitmap = mtmd.BitmapInitFromAudio(uint64(len(p.Samples)), &p.Samples[0])
+	case len(p.Data) > 0:
+		bitmap = mtmd.BitmapInitFromBuf(ctx, &p.Data[0], uint64(len(p.Data)), false).Bitmap
+	case p.Path != "":
+		bitmap = mtmd.BitmapInitFromFile(ctx, p.Path, false).Bitmap
+	case p.URL != "":
+		return 0, fmt.Errorf("unable to load %s from %s: remote URLs must be downloaded first", p.Type, p.URL)
+	default:
+		return 0, fmt.Errorf("empty %s part", p.Type)
+	}
+
+	if bitmap == 0 {
+		if p.Path != "" {
+			return 0, fmt.Errorf("unable to load %s from %s", p.Type, p.Path)
+		}
+		return 0, fmt.Errorf("unable to load %s", p.Type)
+	}
+	return bitmap, nil
+}
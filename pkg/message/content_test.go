@@ -0,0 +1,64 @@
+package message
+
+import "testing"
+
+func TestPartsText(t *testing.T) {
+	parts := []Part{
+		TextPart("What is in "),
+		ImagePart([]byte{0xff, 0xd8}),
+		TextPart(" and "),
+		AudioPart([]float32{0, 0.5}),
+		TextPart("?"),
+	}
+
+	got := PartsText(parts, "<m>")
+
+	if got != "What is in <m> and <m>?" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMultimodal_GetContent(t *testing.T) {
+	m := Multimodal{
+		Role:  "user",
+		Parts: []Part{ImageFilePart("cat.jpg"), TextPart("Describe this image.")},
+	}
+
+	if m.GetRole() != "user" {
+		t.Errorf("role: got %q", m.GetRole())
+	}
+	if got := m.GetContent()["content"]; got != MediaMarker+"Describe this image." {
+		t.Errorf("content: got %q", got)
+	}
+
+	var msg Message = m
+	if _, ok := msg.(MediaMessage); !ok {
+		t.Error("Multimodal should implement MediaMessage")
+	}
+}
+
+func TestBitmaps_NoMedia(t *testing.T) {
+	messages := []Message{
+		Chat{Role: "user", Content: "Hello"},
+		Multimodal{Role: "user", Parts: []Part{TextPart("Just text.")}},
+	}
+
+	bitmaps, err := Bitmaps(0, messages)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bitmaps) != 0 {
+		t.Errorf("expected no bitmaps, got %d", len(bitmaps))
+	}
+}
+
+func TestBitmaps_EmptyPart(t *testing.T) {
+	messages := []Message{
+		Multimodal{Role: "user", Parts: []Part{{Type: PartImage}}},
+	}
+
+	if _, err := Bitmaps(0, messages); err == nil {
+		t.Fatal("expected an error for an image part without data")
+	}
+}
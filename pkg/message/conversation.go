@@ -0,0 +1,290 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+// ErrConversationTooLong is returned by Conversation.Fit when the policies
+// cannot bring the conversation within the token budget.
+var ErrConversationTooLong = errors.New("conversation does not fit in the token budget")
+
+// RenderFunc renders messages into a prompt, usually by applying the model's
+// chat template with template.Apply:
+//
+//	func(msgs []message.Message) (string, error) {
+//		return template.Apply(tmpl, msgs, true)
+//	}
+type RenderFunc func(msgs []Message) (string, error)
+
+// Conversation is a conversation history that knows how many tokens it
+// renders to and can be truncated to fit a context window.
+type Conversation struct {
+	Messages []Message
+
+	// Render renders the messages into the prompt.
+	Render RenderFunc
+
+	// CountTokens returns the number of tokens in text. NewConversation sets
+	// it to tokenize with the model vocabulary.
+	CountTokens func(text string) int
+
+	// counts caches the token counts of single rendered messages.
+	counts map[string]int
+}
+
+// NewConversation returns an empty Conversation that renders with render and
+// counts tokens with llama.Tokenize and vocab.
+func NewConversation(vocab llama.Vocab, render RenderFunc) *Conversation {
+	return &Conversation{
+		Render: render,
+		CountTokens: func(text string) int {
+			return len(llama.Tokenize(vocab, text, true, true))
+		},
+	}
+}
+
+// Append adds messages to the end of the conversation.
+func (c *Conversation) Append(msgs ...Message) {
+	c.Messages = append(c.Messages, msgs...)
+}
+
+// Prompt returns the rendered conversation.
+func (c *Conversation) Prompt() (string, error) {
+	return c.Render(c.Messages)
+}
+
+// Tokens returns the number of tokens of the rendered conversation.
+func (c *Conversation) Tokens() (int, error) {
+	prompt, err := c.Prompt()
+	if err != nil {
+		return 0, err
+	}
+	return c.CountTokens(prompt), nil
+}
+
+// MessageTokens returns the number of tokens that the message at index i
+// renders to on its own, including its template markup. Counts are cached,
+// so calling it again for an unchanged message is cheap.
+func (c *Conversation) MessageTokens(i int) int {
+	m := c.Messages[i]
+	text, err := c.Render([]Message{m})
+	if err != nil {
+		// Some templates reject a lone message, e.g. a tool response
+		// without its call; fall back to the content alone.
+		text = fmt.Sprint(m.GetContent()["content"])
+	}
+	return c.count(text)
+}
+
+func (c *Conversation) count(text string) int {
+	if n, ok := c.counts[text]; ok {
+		return n
+	}
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	n := c.CountTokens(text)
+	c.counts[text] = n
+	return n
+}
+
+// A TruncationPolicy removes or replaces messages of a conversation that
+// renders to more than maxTokens tokens. It returns once the conversation
+// fits, or when it can remove nothing more.
+type TruncationPolicy func(c *Conversation, maxTokens int) error
+
+// Fit applies policies in order until the conversation renders to at most
+// maxTokens tokens, e.g. the context size less the tokens to generate. It
+// returns ErrConversationTooLong if it still does not fit.
+//
+// Policies never split a tool call from its tool responses, and never
+// remove the leading system messages.
+func (c *Conversation) Fit(maxTokens int, policies ...TruncationPolicy) error {
+	for _, p := range policies {
+		n, err := c.Tokens()
+		if err != nil {
+			return err
+		}
+		if n <= maxTokens {
+			return nil
+		}
+		if err := p(c, maxTokens); err != nil {
+			return err
+		}
+	}
+
+	n, err := c.Tokens()
+	if err != nil {
+		return err
+	}
+	if n > maxTokens {
+		return fmt.Errorf("%w: %d tokens, budget %d", ErrConversationTooLong, n, maxTokens)
+	}
+	return nil
+}
+
+// KeepLastTurns drops the oldest turns while the conversation does not fit,
+// keeping the system prompt and at least the last n turns. A turn starts
+// with a user message and holds everything up to the next user message.
+func KeepLastTurns(n int) TruncationPolicy {
+	return func(c *Conversation, maxTokens int) error {
+		turns := c.turns()
+		if len(turns) <= n {
+			return nil
+		}
+		return c.dropWhileOver(maxTokens, turns[:len(turns)-n])
+	}
+}
+
+// DropOldestToolResults drops the oldest tool calls, together with their
+// tool responses, while the conversation does not fit. The tool calls of the
+// last turn are kept, as the model is still answering them.
+func DropOldestToolResults() TruncationPolicy {
+	return func(c *Conversation, maxTokens int) error {
+		var groups []span
+		turns := c.turns()
+		for _, s := range c.units() {
+			if len(turns) > 0 && s.start >= turns[len(turns)-1].start {
+				break
+			}
+			if _, ok := c.Messages[s.start].(Tool); ok {
+				groups = append(groups, s)
+			}
+		}
+		return c.dropWhileOver(maxTokens, groups)
+	}
+}
+
+// Summarize replaces the oldest messages, up to but not including the last
+// turn, with the single message that summarize returns for them, e.g. an
+// assistant or system message with a summary generated by the model. It
+// summarizes as few messages as its token estimate allows.
+func Summarize(summarize func(msgs []Message) (Message, error)) TruncationPolicy {
+	return func(c *Conversation, maxTokens int) error {
+		turns := c.turns()
+		if len(turns) < 2 {
+			return nil
+		}
+
+		over, err := c.overBy(maxTokens)
+		if err != nil || over <= 0 {
+			return err
+		}
+
+		// Choose whole turns whose estimated size covers the excess.
+		start := turns[0].start
+		end := start
+		for _, t := range turns[:len(turns)-1] {
+			end = t.end
+			over -= c.spanTokens(t)
+			if over <= 0 {
+				break
+			}
+		}
+
+		summary, err := summarize(append([]Message(nil), c.Messages[start:end]...))
+		if err != nil {
+			return fmt.Errorf("unable to summarize conversation: %w", err)
+		}
+		c.Messages = append(append(c.Messages[:start:start], summary), c.Messages[end:]...)
+		return nil
+	}
+}
+
+// span is the range [start, end) of Messages.
+type span struct{ start, end int }
+
+// units splits the messages after the leading system messages into the
+// smallest pieces that may be removed: single messages, or a Tool message
+// together with the tool responses that follow it.
+func (c *Conversation) units() []span {
+	var units []span
+	i := c.systemEnd()
+	for i < len(c.Messages) {
+		end := i + 1
+		if _, ok := c.Messages[i].(Tool); ok {
+			for end < len(c.Messages) {
+				if _, ok := c.Messages[end].(ToolResponse); !ok {
+					break
+				}
+				end++
+			}
+		}
+		units = append(units, span{i, end})
+		i = end
+	}
+	return units
+}
+
+// turns groups the units into turns that each start with a user message.
+// Messages before the first user message form a turn of their own.
+func (c *Conversation) turns() []span {
+	var turns []span
+	for _, u := range c.units() {
+		if len(turns) == 0 || c.Messages[u.start].GetRole() == "user" {
+			turns = append(turns, u)
+			continue
+		}
+		turns[len(turns)-1].end = u.end
+	}
+	return turns
+}
+
+// systemEnd returns the index after the leading system messages.
+func (c *Conversation) systemEnd() int {
+	i := 0
+	for i < len(c.Messages) && c.Messages[i].GetRole() == "system" {
+		i++
+	}
+	return i
+}
+
+func (c *Conversation) spanTokens(s span) int {
+	n := 0
+	for i := s.start; i < s.end; i++ {
+		n += c.MessageTokens(i)
+	}
+	return n
+}
+
+func (c *Conversation) overBy(maxTokens int) (int, error) {
+	n, err := c.Tokens()
+	if err != nil {
+		return 0, err
+	}
+	return n - maxTokens, nil
+}
+
+// dropWhileOver removes spans, oldest first, until the conversation fits.
+// It estimates how many spans to remove from their cached token counts, and
+// then checks the exact count of the rendered conversation.
+func (c *Conversation) dropWhileOver(maxTokens int, spans []span) error {
+	for len(spans) > 0 {
+		over, err := c.overBy(maxTokens)
+		if err != nil || over <= 0 {
+			return err
+		}
+
+		n := 0
+		for n < len(spans) && over > 0 {
+			over -= c.spanTokens(spans[n])
+			n++
+		}
+
+		removed := 0
+		for _, s := range spans[:n] {
+			c.Messages = slices.Delete(c.Messages, s.start-removed, s.end-removed)
+			removed += s.end - s.start
+		}
+		spans = spans[n:]
+		for i := range spans {
+			spans[i].start -= removed
+			spans[i].end -= removed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package message
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestConversation returns a Conversation that renders one line per
+// message and counts one token per word.
+func newTestConversation(msgs ...Message) *Conversation {
+	return &Conversation{
+		Messages: msgs,
+		Render: func(msgs []Message) (string, error) {
+			var b strings.Builder
+			for _, m := range msgs {
+				b.WriteString(m.GetRole() + ": ")
+				if content, ok := m.GetContent()["content"].(string); ok {
+					b.WriteString(content)
+				}
+				b.WriteString("\n")
+			}
+			return b.String(), nil
+		},
+		CountTokens: func(text string) int {
+			return len(strings.Fields(text))
+		},
+	}
+}
+
+func toolTurn(question, name string) []Message {
+	return []Message{
+		Chat{Role: "user", Content: question},
+		Tool{Role: "assistant", ToolCalls: []ToolCall{{Type: "function", Function: ToolFunction{Name: name}}}},
+		ToolResponse{Role: "tool", Name: name, Content: "a long tool result with many many words in it"},
+		Chat{Role: "assistant", Content: "the answer"},
+	}
+}
+
+func TestConversation_Tokens(t *testing.T) {
+	c := newTestConversation(
+		Chat{Role: "system", Content: "be brief"},
+		Chat{Role: "user", Content: "hello there"},
+	)
+
+	n, err := c.Tokens()
+	if err != nil {
+		t.Fatalf("Tokens: %v", err)
+	}
+	if n != 6 {
+		t.Errorf("tokens: got %d, want 6", n)
+	}
+	if got := c.MessageTokens(1); got != 3 {
+		t.Errorf("message tokens: got %d, want 3", got)
+	}
+}
+
+func TestConversation_CachesMessageTokens(t *testing.T) {
+	c := newTestConversation(Chat{Role: "user", Content: "hello there"})
+	calls := 0
+	count := c.CountTokens
+	c.CountTokens = func(text string) int {
+		calls++
+		return count(text)
+	}
+
+	c.MessageTokens(0)
+	c.MessageTokens(0)
+
+	if calls != 1 {
+		t.Errorf("CountTokens called %d times, want 1", calls)
+	}
+}
+
+func TestConversation_FitKeepLastTurns(t *testing.T) {
+	c := newTestConversation(Chat{Role: "system", Content: "be brief"})
+	c.Append(toolTurn("first question", "a")...)
+	c.Append(toolTurn("second question", "b")...)
+	c.Append(toolTurn("third question", "c")...)
+
+	if err := c.Fit(25, KeepLastTurns(1)); err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+
+	if len(c.Messages) != 5 {
+		t.Fatalf("expected the system prompt and one turn, got %d messages", len(c.Messages))
+	}
+	if c.Messages[0].GetRole() != "system" || c.Messages[1].(Chat).Content != "third question" {
+		t.Errorf("kept the wrong messages: %+v", c.Messages)
+	}
+}
+
+func TestConversation_FitKeepsMinimumTurns(t *testing.T) {
+	c := newTestConversation(toolTurn("first question", "a")...)
+	c.Append(toolTurn("second question", "b")...)
+
+	err := c.Fit(10, KeepLastTurns(1))
+
+	if !errors.Is(err, ErrConversationTooLong) {
+		t.Fatalf("expected ErrConversationTooLong, got %v", err)
+	}
+	if len(c.Messages) != 4 {
+		t.Errorf("expected the last turn to be kept, got %d messages", len(c.Messages))
+	}
+}
+
+func TestConversation_FitDropOldestToolResults(t *testing.T) {
+	c := newTestConversation(toolTurn("first question", "a")...)
+	c.Append(toolTurn("second question", "b")...)
+	c.Append(toolTurn("third question", "c")...)
+
+	if err := c.Fit(45, DropOldestToolResults()); err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+
+	var calls []string
+	for i, m := range c.Messages {
+		switch m := m.(type) {
+		case Tool:
+			calls = append(calls, m.ToolCalls[0].Function.Name)
+			if _, ok := c.Messages[i+1].(ToolResponse); !ok {
+				t.Errorf("tool call %d was split from its response", i)
+			}
+		case ToolResponse:
+			if _, ok := c.Messages[i-1].(Tool); !ok {
+				t.Errorf("tool response %d was split from its call", i)
+			}
+		}
+	}
+	if strings.Join(calls, ",") != "b,c" {
+		t.Errorf("kept tool calls %v, want [b c]", calls)
+	}
+	if len(c.Messages) != 10 {
+		t.Errorf("expected the questions and answers to be kept, got %d messages", len(c.Messages))
+	}
+}
+
+func TestConversation_FitSummarize(t *testing.T) {
+	c := newTestConversation(Chat{Role: "system", Content: "be brief"})
+	c.Append(toolTurn("first question", "a")...)
+	c.Append(toolTurn("second question", "b")...)
+	c.Append(toolTurn("third question", "c")...)
+
+	var summarized []Message
+	summarize := func(msgs []Message) (Message, error) {
+		summarized = msgs
+		return Chat{Role: "system", Content: "summary of earlier turns"}, nil
+	}
+
+	if err := c.Fit(30, Summarize(summarize)); err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+
+	if len(summarized) != 8 {
+		t.Errorf("summarized %d messages, want the first two turns", len(summarized))
+	}
+	if c.Messages[1].(Chat).Content != "summary of earlier turns" {
+		t.Errorf("expected the summary after the system prompt, got %+v", c.Messages[1])
+	}
+	if c.Messages[2].(Chat).Content != "third question" {
+		t.Errorf("expected the last turn after the summary, got %+v", c.Messages[2])
+	}
+}
+
+func TestConversation_FitAlreadyFits(t *testing.T) {
+	c := newTestConversation(toolTurn("question", "a")...)
+
+	called := false
+	err := c.Fit(1000, Summarize(func([]Message) (Message, error) {
+		called = true
+		return nil, nil
+	}))
+
+	if err != nil || called || len(c.Messages) != 4 {
+		t.Errorf("expected no change: err %v, called %v, %d messages", err, called, len(c.Messages))
+	}
+}
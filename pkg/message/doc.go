@@ -3,18 +3,43 @@
 //
 // # Message types
 //
-// The [Message] interface is the core abstraction. Three concrete types
+// The [Message] interface is the core abstraction. Four concrete types
 // implement it:
 //
 //   - [Chat] - a standard user/assistant/system turn.
+//   - [Multimodal] - a turn made of ordered text, image and audio [Part] values.
 //   - [Tool] - an assistant turn that contains one or more tool calls.
 //   - [ToolResponse] - a tool turn carrying the result of a tool call.
 //
+// Chat templates render each image or audio part as a media marker.
+// [Bitmaps] returns the matching mtmd bitmaps in the same order, so that
+// mtmd.Tokenize pairs every marker with its image or audio.
+//
+// # Conversations
+//
+// [Conversation] holds a conversation history, counts the tokens it renders
+// to through a chat template, and trims it to fit a context window with
+// [Conversation.Fit] and truncation policies such as [KeepLastTurns],
+// [DropOldestToolResults] and [Summarize].
+//
+// # Wire formats
+//
+// [FromOpenAI] and [ToOpenAI] convert between messages and the OpenAI Chat
+// Completions wire format ([OpenAIMessage]), including tool call IDs and
+// arrays of content parts. [ToolDefinition] already matches the OpenAI tool
+// JSON, and [OpenAIResponseFormat] holds the response_format option.
+// [FromAnthropic] and [ToAnthropic] do the same for the Anthropic Messages
+// format, with its content blocks, and [FromOllama] and [ToOllama] for the
+// Ollama /api/chat format.
+//
 // # Tool calls
 //
 // [ParseToolCalls] parses tool calls from a raw model response string,
 // automatically detecting the grammar used. All argument values are
-// normalised to strings in the returned [ToolCall] slice.
+// normalised to strings in [ToolFunction.Arguments], while
+// [ToolFunction.TypedArguments] keeps their JSON types. For tag-based formats,
+// where every value is a string, [CoerceArguments] converts the typed values
+// to the types declared in the tool's JSON Schema.
 //
 // [DetectFormat] identifies which grammar a piece of content uses and
 // returns the corresponding [Format] constant. The following formats are
@@ -25,11 +50,43 @@
 //   - [FormatGLM] - GLM key/value tags: name<arg_key>k</arg_key><arg_value>v</arg_value>
 //   - [FormatMistral] - Mistral/Devstral markers: [TOOL_CALLS]name[ARGS]{…}
 //   - [FormatGemma] - Gemma 4 call syntax: call:name{key:<|"|>val<|"|>}
-//   - [FormatGPT] - GPT tool call syntax: .name <|message|>{…}
+//   - [FormatGPT] - GPT-OSS harmony messages to=functions.name <|message|>{…}, or .name <|message|>{…}
+//   - [FormatLlama3] - Llama 3.x JSON: <|python_tag|>{"name":"…","parameters":{…}}
+//   - [FormatDeepSeek] - DeepSeek blocks: <｜tool▁call▁begin｜>name<｜tool▁sep｜>{…}<｜tool▁call▁end｜>
+//   - [FormatGranite] - Granite lists: <|tool_call|>[{"name":"…","arguments":{…}}]
+//   - [FormatCommandR] - Command-R actions: <|START_ACTION|>[{"tool_name":"…","parameters":{…}}]<|END_ACTION|>
+//   - [FormatFunctionary] - Functionary v3 recipients: >>>name\n{…}
+//
+// [FormatHermes] models use the standard format; it is detected from the
+// model path so that the matching stop markers are used.
+//
+// [DetectFormatFromModel] picks the format of a loaded model from its chat
+// template, special tokens and architecture, falling back to
+// [DetectFormatFromPath] on the model name.
 //
 // Standard-format responses wrap bare JSON inside <tool_call>…</tool_call>
 // envelope tags; all other formats are detected from the raw content.
 //
+// [ValidateToolCall] checks a parsed call against the JSON Schema of the
+// matching [ToolDefinition] and returns [ValidationErrors] describing every
+// problem. [ValidationResponse] turns those errors into a [ToolResponse] that
+// lets the model correct its call and try again.
+//
+// # Streaming
+//
+// [StreamParser] parses a response incrementally while it is generated.
+// Each call to [StreamParser.Write] returns [StreamEvent] values for plain
+// text, reasoning, the start of a tool call once its name is known, argument
+// text as it arrives, and each completed tool call, so that callers can show
+// progress and stop generation as soon as a call is complete.
+//
+// # Reasoning
+//
+// [SplitReasoning] separates the reasoning of a response from its content,
+// for <think> blocks, Gemma 4 thought channels and GPT-OSS analysis channels.
+// The reasoning can be stored in the Reasoning field of [Chat] or [Tool] so
+// that chat templates can render it again in later turns.
+//
 // # Markup stripping
 //
 // [StripMarkup] removes all tool-call blocks and model-specific markers
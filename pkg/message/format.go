@@ -35,6 +35,7 @@ const (
 	FormatGemma
 
 	// FormatGPT expects GPT-model tool calls:
+	//   <|channel|>commentary to=functions.FUNC_NAME <|constrain|>json<|message|>JSON_ARGS
 	//   .FUNC_NAME <|message|>JSON_ARGS
 	FormatGPT
 
@@ -43,14 +44,54 @@ const (
 	// (<|end|>, <|user|>, <|assistant|>, <|system|>) that must be treated as
 	// generation stop markers.
 	FormatPhi
+
+	// FormatHermes is used for Hermes-family models (Hermes 2 Pro, Hermes 3).
+	// They use standard JSON tool calls in <tool_call> tags and ChatML turns.
+	FormatHermes
+
+	// FormatLlama3 expects Llama 3.x JSON tool calls with "parameters":
+	//   <|python_tag|>{"name":"...","parameters":{...}}
+	// The <|python_tag|> prefix is optional.
+	FormatLlama3
+
+	// FormatDeepSeek expects DeepSeek V3/R1 tool call blocks:
+	//   <｜tool▁calls▁begin｜><｜tool▁call▁begin｜>function<｜tool▁sep｜>name
+	//   ```json\n{...}\n```<｜tool▁call▁end｜><｜tool▁calls▁end｜>
+	FormatDeepSeek
+
+	// FormatGranite expects IBM Granite tool call lists:
+	//   <|tool_call|>[{"name":"...","arguments":{...}}]
+	FormatGranite
+
+	// FormatCommandR expects Cohere Command-R actions:
+	//   Action: ```json\n[{"tool_name":"...","parameters":{...}}]\n```
+	// or <|START_ACTION|>[…]<|END_ACTION|> in Command-R7B.
+	FormatCommandR
+
+	// FormatFunctionary expects Functionary v3 streams:
+	//   >>>name\n{...}>>>all\ntext
+	FormatFunctionary
 )
 
 // DetectFormat inspects a tool-call content block and returns the Format that
 // matches it, or FormatAuto when no grammar is recognized. It only examines
 // structural markers in the content — it does NOT inspect model names. Use
-// DetectFormatFromPath to identify the format from a model file path.
+// DetectFormatFromModel to identify the format of a loaded model, or
+// DetectFormatFromPath to identify it from a model file path.
 func DetectFormat(content string) Format {
 	switch {
+	case strings.Contains(content, deepseekCallBegin):
+		return FormatDeepSeek
+	case strings.Contains(content, "<|python_tag|>"),
+		strings.HasPrefix(content, "{\"name\"") && strings.Contains(content, "\"parameters\""),
+		strings.HasPrefix(content, "{\"type\": \"function\""):
+		return FormatLlama3
+	case strings.Contains(content, "<|tool_call|>"):
+		return FormatGranite
+	case strings.Contains(content, "<|START_ACTION|>"), strings.Contains(content, "Action: ```json"):
+		return FormatCommandR
+	case functionaryCallRE.MatchString(content):
+		return FormatFunctionary
 	case strings.HasPrefix(content, "{\"name\""):
 		return FormatStandard
 	case strings.HasPrefix(content, "<function="):
@@ -71,9 +112,17 @@ func DetectFormat(content string) Format {
 // DetectFormatFromPath inspects a model file path and returns the Format for
 // that model family based on well-known name substrings (case-insensitive).
 // Returns FormatAuto when the path does not match any known family.
+// DetectFormatFromModel is more reliable once the model is loaded, as it does
+// not depend on the file name.
 func DetectFormatFromPath(path string) Format {
 	lower := strings.ToLower(path)
 	switch {
+	case strings.Contains(lower, "hermes"):
+		return FormatHermes
+	case strings.Contains(lower, "functionary"):
+		return FormatFunctionary
+	case strings.Contains(lower, "deepseek"):
+		return FormatDeepSeek
 	case strings.Contains(lower, "qwen"):
 		return FormatQwen
 	case strings.Contains(lower, "gemma-3"), strings.Contains(lower, "gemma3"):
@@ -86,6 +135,12 @@ func DetectFormatFromPath(path string) Format {
 		return FormatGLM
 	case strings.Contains(lower, "phi"):
 		return FormatPhi
+	case strings.Contains(lower, "granite"):
+		return FormatGranite
+	case strings.Contains(lower, "command-r"), strings.Contains(lower, "command_r"):
+		return FormatCommandR
+	case strings.Contains(lower, "llama-3"), strings.Contains(lower, "llama3"), strings.Contains(lower, "llama_3"):
+		return FormatLlama3
 	default:
 		return FormatAuto
 	}
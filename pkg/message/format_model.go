@@ -0,0 +1,197 @@
+package message
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+// Confidence of a format detected from each kind of model metadata.
+const (
+	confidenceTemplate     = 0.9
+	confidenceToken        = 0.7
+	confidenceArchitecture = 0.6
+	confidenceName         = 0.3
+)
+
+// ModelHints is the model metadata used by [DetectFormatFromHints]. Use
+// [ReadModelHints] to read it from a loaded model.
+type ModelHints struct {
+	// Architecture is the general.architecture metadata, e.g. "qwen3".
+	Architecture string
+
+	// Name is the general.name metadata, e.g. "Hermes 3 Llama 3.1 8B".
+	Name string
+
+	// ChatTemplate is the tokenizer.chat_template metadata.
+	ChatTemplate string
+
+	// Tokens are the tool-call and turn markers that the vocabulary holds as
+	// single control or user-defined tokens.
+	Tokens []string
+}
+
+// FormatDetection is the result of detecting a model's tool-call format.
+type FormatDetection struct {
+	Format Format
+
+	// Confidence is between 0 (nothing matched, Format is FormatAuto) and 1.
+	Confidence float64
+
+	// Source names the metadata the format was detected from:
+	// "chat_template", "vocab", "architecture" or "name".
+	Source string
+}
+
+// formatMarker is a piece of chat template text or a special token that
+// identifies a format. Weak markers are shared by several families.
+type formatMarker struct {
+	marker string
+	format Format
+	weak   bool
+}
+
+// formatMarkers are checked in order, so markers of formats that embed
+// another family's markup (e.g. DeepSeek distills of Qwen, GLM with
+// <tool_call>) come first.
+var formatMarkers = []formatMarker{
+	{marker: deepseekCallsBegin, format: FormatDeepSeek},
+	{marker: "<｜Assistant｜>", format: FormatDeepSeek},
+	{marker: ">>>", format: FormatFunctionary},
+	{marker: commandRStartAction, format: FormatCommandR},
+	{marker: "<|START_OF_TURN_TOKEN|>", format: FormatCommandR},
+	{marker: "<|start_of_role|>", format: FormatGranite},
+	{marker: "[TOOL_CALLS]", format: FormatMistral},
+	{marker: "<|channel|>", format: FormatGPT},
+	{marker: "<arg_key>", format: FormatGLM},
+	{marker: "[gMASK]", format: FormatGLM},
+	{marker: "<function=", format: FormatQwen},
+	{marker: "<|python_tag|>", format: FormatLlama3},
+	{marker: "<|eom_id|>", format: FormatLlama3},
+	{marker: "<|start_header_id|>", format: FormatLlama3, weak: true},
+	{marker: "<start_of_turn>", format: FormatGemma3},
+	{marker: "<|turn>", format: FormatGemma},
+	{marker: "<|assistant|>", format: FormatPhi},
+	{marker: "<tool_call>", format: FormatStandard},
+	{marker: "<|im_start|>", format: FormatStandard, weak: true},
+}
+
+// architectureFormats maps general.architecture values to formats. The
+// "llama" architecture is shared by too many families to be useful.
+var architectureFormats = map[string]Format{
+	"qwen2":         FormatQwen,
+	"qwen3":         FormatQwen,
+	"qwen3moe":      FormatQwen,
+	"gemma3":        FormatGemma3,
+	"gemma3n":       FormatGemma3,
+	"gemma4":        FormatGemma,
+	"phi3":          FormatPhi,
+	"chatglm":       FormatGLM,
+	"glm4":          FormatGLM,
+	"glm4moe":       FormatGLM,
+	"gpt-oss":       FormatGPT,
+	"deepseek2":     FormatDeepSeek,
+	"granite":       FormatGranite,
+	"granitemoe":    FormatGranite,
+	"granitehybrid": FormatGranite,
+	"command-r":     FormatCommandR,
+	"cohere2":       FormatCommandR,
+	"mistral3":      FormatMistral,
+}
+
+// DetectFormatFromModel returns the tool-call format of a loaded model. It
+// inspects the chat template, the special tokens of the vocabulary and the
+// architecture, and falls back to [DetectFormatFromPath] on the model name.
+// Use [DetectFormatFromHints] to also get the confidence of the result.
+func DetectFormatFromModel(model llama.Model) Format {
+	return DetectFormatFromHints(ReadModelHints(model)).Format
+}
+
+// ReadModelHints reads the metadata that [DetectFormatFromHints] inspects from
+// a loaded model.
+func ReadModelHints(model llama.Model) ModelHints {
+	var h ModelHints
+	if model == 0 {
+		return h
+	}
+
+	h.Architecture, _ = llama.ModelMetaValStr(model, "general.architecture")
+	h.Name, _ = llama.ModelMetaValStr(model, "general.name")
+	h.ChatTemplate = llama.ModelChatTemplate(model, "")
+
+	vocab := llama.ModelGetVocab(model)
+	h.Tokens = specialMarkers(func(marker string) (llama.TokenAttr, bool) {
+		// A marker in the vocabulary is tokenized to itself when special
+		// tokens are parsed; other text is split into several tokens.
+		toks := llama.Tokenize(vocab, marker, false, true)
+		if len(toks) != 1 {
+			return 0, false
+		}
+		return llama.VocabGetAttr(vocab, toks[0]), true
+	})
+	return h
+}
+
+// specialMarkers returns the formatMarkers that are single control or
+// user-defined tokens, given the attributes of the token that each marker is
+// tokenized to. Markers such as ">>>" may also be ordinary tokens of the
+// vocabulary, which say nothing about the format.
+func specialMarkers(tokenAttr func(marker string) (llama.TokenAttr, bool)) []string {
+	var markers []string
+	for _, m := range formatMarkers {
+		if attr, ok := tokenAttr(m.marker); ok && attr&(llama.TokenAttrControl|llama.TokenAttrUserDef) != 0 {
+			markers = append(markers, m.marker)
+		}
+	}
+	return markers
+}
+
+// DetectFormatFromHints returns the tool-call format that the model metadata
+// in h points to. The chat template is the most reliable source, followed by
+// the special tokens, the architecture and finally the model name.
+func DetectFormatFromHints(h ModelHints) FormatDetection {
+	d := detectFormatFromMarkers(h)
+	if f, ok := architectureFormats[strings.ToLower(h.Architecture)]; ok && d.Confidence < confidenceArchitecture {
+		d = FormatDetection{Format: f, Confidence: confidenceArchitecture, Source: "architecture"}
+	}
+	if f := DetectFormatFromPath(h.Name); f != FormatAuto && d.Confidence < confidenceName {
+		d = FormatDetection{Format: f, Confidence: confidenceName, Source: "name"}
+	}
+
+	// Hermes models use the standard format; only the name tells them apart.
+	if d.Format == FormatStandard && strings.Contains(strings.ToLower(h.Name), "hermes") {
+		d.Format = FormatHermes
+	}
+	return d
+}
+
+// detectFormatFromMarkers matches formatMarkers against the chat template and
+// then against the special tokens. A weak match is only used, at half the
+// confidence, when no other marker matches.
+func detectFormatFromMarkers(h ModelHints) FormatDetection {
+	var weak FormatDetection
+	for _, src := range []struct {
+		name       string
+		confidence float64
+		has        func(string) bool
+	}{
+		{"chat_template", confidenceTemplate, func(m string) bool { return strings.Contains(h.ChatTemplate, m) }},
+		{"vocab", confidenceToken, func(m string) bool { return slices.Contains(h.Tokens, m) }},
+	} {
+		for _, m := range formatMarkers {
+			if !src.has(m.marker) {
+				continue
+			}
+			d := FormatDetection{Format: m.format, Confidence: src.confidence, Source: src.name}
+			if !m.weak {
+				return d
+			}
+			if weak.Format == FormatAuto {
+				d.Confidence /= 2
+				weak = d
+			}
+		}
+	}
+	return weak
+}
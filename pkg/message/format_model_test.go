@@ -0,0 +1,133 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+func TestDetectFormatFromHints(t *testing.T) {
+	tests := []struct {
+		name   string
+		hints  ModelHints
+		want   Format
+		source string
+	}{
+		{
+			name:   "qwen2.5 template",
+			hints:  ModelHints{Architecture: "qwen2", ChatTemplate: "<|im_start|>system\n{{ tools }}<tool_call>\n{\"name\": ...}\n</tool_call>"},
+			want:   FormatStandard,
+			source: "chat_template",
+		},
+		{
+			name:   "qwen3-coder template",
+			hints:  ModelHints{ChatTemplate: "<|im_start|>assistant\n<tool_call>\n<function={{ name }}>\n<parameter=x>"},
+			want:   FormatQwen,
+			source: "chat_template",
+		},
+		{
+			name:   "hermes renamed file",
+			hints:  ModelHints{Architecture: "llama", Name: "Hermes 3 Llama 3.1 8B", ChatTemplate: "<|im_start|>assistant\n<tool_call>"},
+			want:   FormatHermes,
+			source: "chat_template",
+		},
+		{
+			name:   "llama 3.1 template",
+			hints:  ModelHints{Architecture: "llama", ChatTemplate: "<|start_header_id|>ipython<|end_header_id|>{{ '<|python_tag|>' }}"},
+			want:   FormatLlama3,
+			source: "chat_template",
+		},
+		{
+			name:   "mistral special token",
+			hints:  ModelHints{Architecture: "llama", Tokens: []string{"[TOOL_CALLS]"}},
+			want:   FormatMistral,
+			source: "vocab",
+		},
+		{
+			name:   "deepseek distill of qwen",
+			hints:  ModelHints{Architecture: "qwen2", ChatTemplate: "<｜User｜>{{ content }}<｜Assistant｜><｜tool▁calls▁begin｜>"},
+			want:   FormatDeepSeek,
+			source: "chat_template",
+		},
+		{
+			name:   "architecture only",
+			hints:  ModelHints{Architecture: "gemma3"},
+			want:   FormatGemma3,
+			source: "architecture",
+		},
+		{
+			name:   "architecture beats weak marker",
+			hints:  ModelHints{Architecture: "granite", ChatTemplate: "<|im_start|>"},
+			want:   FormatGranite,
+			source: "architecture",
+		},
+		{
+			name:   "name fallback",
+			hints:  ModelHints{Architecture: "llama", Name: "Phi 3 Mini"},
+			want:   FormatPhi,
+			source: "name",
+		},
+		{
+			name:  "nothing known",
+			hints: ModelHints{Architecture: "llama", Name: "My Model"},
+			want:  FormatAuto,
+		},
+	}
+
+	for _, tt := range tests {
+		d := DetectFormatFromHints(tt.hints)
+		if d.Format != tt.want {
+			t.Errorf("%s: format: got %v, want %v", tt.name, d.Format, tt.want)
+		}
+		if d.Source != tt.source {
+			t.Errorf("%s: source: got %q, want %q", tt.name, d.Source, tt.source)
+		}
+	}
+}
+
+func TestDetectFormatFromHints_Confidence(t *testing.T) {
+	template := DetectFormatFromHints(ModelHints{ChatTemplate: "[TOOL_CALLS]"})
+	token := DetectFormatFromHints(ModelHints{Tokens: []string{"[TOOL_CALLS]"}})
+	weak := DetectFormatFromHints(ModelHints{ChatTemplate: "<|im_start|>"})
+	none := DetectFormatFromHints(ModelHints{})
+
+	if !(template.Confidence > token.Confidence && token.Confidence > weak.Confidence && weak.Confidence > none.Confidence) {
+		t.Errorf("confidence order: template %v, token %v, weak %v, none %v",
+			template.Confidence, token.Confidence, weak.Confidence, none.Confidence)
+	}
+	if none.Confidence != 0 || none.Format != FormatAuto {
+		t.Errorf("no hints: got %+v", none)
+	}
+}
+
+func TestSpecialMarkers(t *testing.T) {
+	attrs := map[string]llama.TokenAttr{
+		">>>":          llama.TokenAttrNormal,
+		"<|im_start|>": llama.TokenAttrControl,
+		"<tool_call>":  llama.TokenAttrUserDef,
+	}
+	tokenAttr := func(marker string) (llama.TokenAttr, bool) {
+		attr, ok := attrs[marker]
+		return attr, ok
+	}
+
+	got := specialMarkers(tokenAttr)
+	if want := []string{"<tool_call>", "<|im_start|>"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("specialMarkers: got %q, want %q", got, want)
+	}
+
+	// A vocabulary where ">>>" is only an ordinary token is not Functionary.
+	delete(attrs, "<|im_start|>")
+	delete(attrs, "<tool_call>")
+	d := DetectFormatFromHints(ModelHints{Architecture: "llama", Tokens: specialMarkers(tokenAttr)})
+	if d.Format == FormatFunctionary || d.Confidence != 0 {
+		t.Errorf("ordinary >>> token: got %+v, want no detection", d)
+	}
+}
+
+func TestDetectFormatFromModel_NoModel(t *testing.T) {
+	if got := DetectFormatFromModel(0); got != FormatAuto {
+		t.Errorf("DetectFormatFromModel(0) = %v, want FormatAuto", got)
+	}
+}
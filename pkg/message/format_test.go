@@ -31,7 +31,13 @@ func TestDetectFormatFromPath_KnownFamilies(t *testing.T) {
 		{"models/mistral-7b-instruct-v0.2.Q4_K_M.gguf", FormatMistral},
 		{"models/devstral-small.gguf", FormatMistral},
 		{"models/glm-4-9b-chat-q4.gguf", FormatGLM},
-		{"models/llama-3.2-3B-instruct.gguf", FormatAuto},
+		{"models/llama-3.2-3B-instruct.gguf", FormatLlama3},
+		{"models/Meta-Llama-3.1-8B-Instruct-Q4_K_M.gguf", FormatLlama3},
+		{"models/Hermes-3-Llama-3.1-8B.Q4_K_M.gguf", FormatHermes},
+		{"models/DeepSeek-R1-Distill-Qwen-7B-Q4_K_M.gguf", FormatDeepSeek},
+		{"models/granite-3.3-8b-instruct-Q4_K_M.gguf", FormatGranite},
+		{"models/c4ai-command-r7b-12-2024-Q4_K_M.gguf", FormatCommandR},
+		{"models/functionary-small-v3.2.Q4_0.gguf", FormatFunctionary},
 	}
 	for _, tt := range tests {
 		got := DetectFormatFromPath(tt.path)
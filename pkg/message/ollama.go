@@ -0,0 +1,123 @@
+package message
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// OllamaMessage is a message in the Ollama /api/chat wire format. Images
+// are base64 encoded. Tool definitions need no conversion: [ToolDefinition]
+// already has the Ollama "tools" JSON shape.
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// OllamaToolCall is a tool call of an assistant message. Unlike OpenAI, the
+// arguments are a JSON object rather than a string.
+type OllamaToolCall struct {
+	Function OllamaFunctionCall `json:"function"`
+}
+
+// OllamaFunctionCall is the function of an OllamaToolCall.
+type OllamaFunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// FromOllama converts Ollama /api/chat messages into messages. Assistant
+// messages with tool_calls become [Tool] messages, tool messages become
+// [ToolResponse], and messages with images become [Multimodal] with the
+// images before the text.
+func FromOllama(msgs []OllamaMessage) ([]Message, error) {
+	out := make([]Message, 0, len(msgs))
+
+	for i, m := range msgs {
+		switch {
+		case len(m.ToolCalls) > 0:
+			tool := Tool{Role: m.Role, Content: m.Content, Reasoning: m.Thinking}
+			for _, tc := range m.ToolCalls {
+				args := tc.Function.Arguments
+				if len(args) == 0 || string(args) == "null" {
+					args = json.RawMessage("{}")
+				}
+				if !json.Valid(args) {
+					return nil, fmt.Errorf("message %d: tool call %s: arguments are not valid JSON", i, tc.Function.Name)
+				}
+				tool.ToolCalls = append(tool.ToolCalls, newJSONToolCall(tc.Function.Name, args))
+			}
+			out = append(out, tool)
+
+		case m.Role == "tool":
+			out = append(out, ToolResponse{Role: m.Role, Name: m.ToolName, Content: m.Content})
+
+		case len(m.Images) > 0:
+			parts := make([]Part, 0, len(m.Images)+1)
+			for _, img := range m.Images {
+				data, err := base64.StdEncoding.DecodeString(img)
+				if err != nil {
+					return nil, fmt.Errorf("message %d: invalid image data: %w", i, err)
+				}
+				parts = append(parts, ImagePart(data))
+			}
+			if m.Content != "" {
+				parts = append(parts, TextPart(m.Content))
+			}
+			out = append(out, Multimodal{Role: m.Role, Parts: parts, Reasoning: m.Thinking})
+
+		default:
+			out = append(out, Chat{Role: m.Role, Content: m.Content, Reasoning: m.Thinking})
+		}
+	}
+
+	return out, nil
+}
+
+// ToOllama converts messages into Ollama /api/chat messages. The text parts
+// of a [Multimodal] message are joined into the content and its images are
+// sent as base64 data; audio and remote image URLs are not supported.
+func ToOllama(msgs []Message) ([]OllamaMessage, error) {
+	out := make([]OllamaMessage, 0, len(msgs))
+
+	for i, m := range msgs {
+		switch m := m.(type) {
+		case Chat:
+			out = append(out, OllamaMessage{Role: m.Role, Content: m.Content, Thinking: m.Reasoning})
+
+		case Multimodal:
+			msg := OllamaMessage{Role: m.Role, Content: PartsText(m.Parts, ""), Thinking: m.Reasoning}
+			for _, p := range m.Parts {
+				if !p.IsMedia() {
+					continue
+				}
+				if p.Type != PartImage || len(p.Data) == 0 {
+					return nil, fmt.Errorf("message %d: unsupported %s part", i, p.Type)
+				}
+				msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(p.Data))
+			}
+			out = append(out, msg)
+
+		case Tool:
+			msg := OllamaMessage{Role: m.Role, Content: m.Content, Thinking: m.Reasoning}
+			for _, call := range m.ToolCalls {
+				msg.ToolCalls = append(msg.ToolCalls, OllamaToolCall{
+					Function: OllamaFunctionCall{Name: call.Function.Name, Arguments: call.Function.ArgumentsJSON()},
+				})
+			}
+			out = append(out, msg)
+
+		case ToolResponse:
+			out = append(out, OllamaMessage{Role: m.Role, Content: m.Content, ToolName: m.Name})
+
+		default:
+			return nil, fmt.Errorf("message %d: unsupported message type %T", i, m)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package message
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const ollamaConversation = `[
+	{"role": "system", "content": "Be brief."},
+	{"role": "user", "content": "What is in this image?", "images": ["iVBORw0KGgo="]},
+	{"role": "assistant", "content": "", "thinking": "I need the weather.", "tool_calls": [
+		{"function": {"name": "get_weather", "arguments": {"days": 3, "location": "Paris"}}}
+	]},
+	{"role": "tool", "content": "Sunny, 22C", "tool_name": "get_weather"},
+	{"role": "assistant", "content": "A cat in sunny Paris."}
+]`
+
+func TestFromOllama(t *testing.T) {
+	var in []OllamaMessage
+	if err := json.Unmarshal([]byte(ollamaConversation), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs, err := FromOllama(in)
+	if err != nil {
+		t.Fatalf("FromOllama: %v", err)
+	}
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 messages, got %d", len(msgs))
+	}
+
+	mm, ok := msgs[1].(Multimodal)
+	if !ok {
+		t.Fatalf("msgs[1]: got %T, want Multimodal", msgs[1])
+	}
+	if len(mm.Parts) != 2 || mm.Parts[0].Type != PartImage || mm.Parts[1].Text != "What is in this image?" {
+		t.Errorf("parts: got %+v", mm.Parts)
+	}
+
+	tool, ok := msgs[2].(Tool)
+	if !ok {
+		t.Fatalf("msgs[2]: got %T, want Tool", msgs[2])
+	}
+	if tool.Reasoning != "I need the weather." {
+		t.Errorf("reasoning: got %q", tool.Reasoning)
+	}
+	if tool.ToolCalls[0].Function.Arguments["days"] != "3" {
+		t.Errorf("days: got %q", tool.ToolCalls[0].Function.Arguments["days"])
+	}
+
+	if resp, ok := msgs[3].(ToolResponse); !ok || resp.Name != "get_weather" {
+		t.Errorf("msgs[3]: got %+v", msgs[3])
+	}
+}
+
+func TestOllama_RoundTrip(t *testing.T) {
+	var in []OllamaMessage
+	if err := json.Unmarshal([]byte(ollamaConversation), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs, err := FromOllama(in)
+	if err != nil {
+		t.Fatalf("FromOllama: %v", err)
+	}
+	out, err := ToOllama(msgs)
+	if err != nil {
+		t.Fatalf("ToOllama: %v", err)
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var want, got any
+	json.Unmarshal([]byte(ollamaConversation), &want)
+	json.Unmarshal(data, &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\ngot  %s\nwant %s", data, ollamaConversation)
+	}
+}
+
+func TestToOllama_UnsupportedAudio(t *testing.T) {
+	msgs := []Message{Multimodal{Role: "user", Parts: []Part{AudioPart([]float32{0})}}}
+
+	if _, err := ToOllama(msgs); err == nil {
+		t.Fatal("expected an error for an audio part")
+	}
+}
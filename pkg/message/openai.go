@@ -0,0 +1,363 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OpenAIMessage is a message in the OpenAI Chat Completions wire format.
+// Tool definitions need no conversion: [ToolDefinition] already has the
+// OpenAI "tools" JSON shape.
+type OpenAIMessage struct {
+	Role             string           `json:"role"`
+	Content          *OpenAIContent   `json:"content"`
+	Name             string           `json:"name,omitempty"`
+	ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID       string           `json:"tool_call_id,omitempty"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+}
+
+// OpenAIContent is the content of an OpenAIMessage: either a plain string
+// or, when Parts is not nil, an array of content parts. A nil *OpenAIContent
+// is encoded as null.
+type OpenAIContent struct {
+	Text  string
+	Parts []OpenAIContentPart
+}
+
+// OpenAIContentPart is one element of an array of content parts.
+type OpenAIContentPart struct {
+	Type       string            `json:"type"`
+	Text       string            `json:"text,omitempty"`
+	ImageURL   *OpenAIImageURL   `json:"image_url,omitempty"`
+	InputAudio *OpenAIInputAudio `json:"input_audio,omitempty"`
+}
+
+// OpenAIImageURL is the image of an "image_url" content part. URL is either
+// a remote URL or a base64 data URL.
+type OpenAIImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// OpenAIInputAudio is the base64 encoded audio of an "input_audio" content
+// part, with Format "wav" or "mp3".
+type OpenAIInputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+// OpenAIToolCall is a tool call of an assistant message. Arguments is a
+// JSON object encoded as a string.
+type OpenAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIFunctionCall is the function of an OpenAIToolCall.
+type OpenAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// OpenAIResponseFormat is the response_format option of a Chat Completions
+// request. Type is "text", "json_object" or "json_schema".
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema is the schema of a "json_schema" response format.
+type OpenAIJSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+// Schema returns the JSON Schema that the response must match, or nil if the
+// response is free text. A "json_object" format accepts any JSON object.
+func (f OpenAIResponseFormat) Schema() map[string]any {
+	switch f.Type {
+	case "json_object":
+		return map[string]any{"type": "object"}
+	case "json_schema":
+		if f.JSONSchema != nil {
+			return f.JSONSchema.Schema
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the content as a string, or as an array when Parts is
+// not nil.
+func (c OpenAIContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	return json.Marshal(c.Text)
+}
+
+// UnmarshalJSON decodes content given as a string or an array of parts.
+func (c *OpenAIContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		c.Text = ""
+		c.Parts = []OpenAIContentPart{}
+		return json.Unmarshal(data, &c.Parts)
+	}
+	c.Parts = nil
+	return json.Unmarshal(data, &c.Text)
+}
+
+// text returns the text of the content, joining the text parts of an array.
+func (c *OpenAIContent) text() string {
+	if c == nil {
+		return ""
+	}
+	if c.Parts == nil {
+		return c.Text
+	}
+	var b strings.Builder
+	for _, p := range c.Parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+// FromOpenAI converts OpenAI Chat Completions messages into messages:
+//
+//   - assistant messages with tool_calls become [Tool] messages;
+//   - user messages with an array of content parts become [Multimodal];
+//   - tool messages become [ToolResponse], named after the call they answer;
+//   - every other message becomes a [Chat].
+//
+// The name of user messages and the detail level of images are not kept.
+func FromOpenAI(msgs []OpenAIMessage) ([]Message, error) {
+	names := make(map[string]string) // tool call ID to function name
+	out := make([]Message, 0, len(msgs))
+
+	for i, m := range msgs {
+		switch {
+		case m.Role == "assistant" && len(m.ToolCalls) > 0:
+			tool := Tool{Role: m.Role, Content: m.Content.text(), Reasoning: m.ReasoningContent}
+			for _, tc := range m.ToolCalls {
+				call, err := toolCallFromOpenAI(tc)
+				if err != nil {
+					return nil, fmt.Errorf("message %d: %w", i, err)
+				}
+				names[tc.ID] = tc.Function.Name
+				tool.ToolCalls = append(tool.ToolCalls, call)
+			}
+			out = append(out, tool)
+
+		case m.Role == "tool":
+			name := m.Name
+			if name == "" {
+				name = names[m.ToolCallID]
+			}
+			out = append(out, ToolResponse{Role: m.Role, Name: name, Content: m.Content.text(), ToolCallID: m.ToolCallID})
+
+		case m.Content != nil && m.Content.Parts != nil:
+			parts, err := partsFromOpenAI(m.Content.Parts)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			out = append(out, Multimodal{Role: m.Role, Parts: parts, Reasoning: m.ReasoningContent})
+
+		default:
+			out = append(out, Chat{Role: m.Role, Content: m.Content.text(), Reasoning: m.ReasoningContent})
+		}
+	}
+
+	return out, nil
+}
+
+// ToOpenAI converts messages into OpenAI Chat Completions messages. It is the
+// inverse of FromOpenAI. Tool calls without an ID are given one, as OpenAI
+// requires it, and a later ToolResponse without a ToolCallID refers to the
+// first unanswered call with its Name.
+func ToOpenAI(msgs []Message) ([]OpenAIMessage, error) {
+	pending := make(map[string][]string) // function name to generated call IDs
+	out := make([]OpenAIMessage, 0, len(msgs))
+
+	for i, m := range msgs {
+		switch m := m.(type) {
+		case Chat:
+			out = append(out, OpenAIMessage{Role: m.Role, Content: &OpenAIContent{Text: m.Content}, ReasoningContent: m.Reasoning})
+
+		case Multimodal:
+			parts, err := partsToOpenAI(m.Parts)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			out = append(out, OpenAIMessage{Role: m.Role, Content: &OpenAIContent{Parts: parts}, ReasoningContent: m.Reasoning})
+
+		case Tool:
+			msg := OpenAIMessage{Role: m.Role, ReasoningContent: m.Reasoning}
+			if m.Content != "" {
+				msg.Content = &OpenAIContent{Text: m.Content}
+			}
+			for j, call := range m.ToolCalls {
+				tc := toolCallToOpenAI(call, fmt.Sprintf("call_%d_%d", i, j))
+				if call.ID == "" {
+					pending[tc.Function.Name] = append(pending[tc.Function.Name], tc.ID)
+				}
+				msg.ToolCalls = append(msg.ToolCalls, tc)
+			}
+			out = append(out, msg)
+
+		case ToolResponse:
+			id := m.ToolCallID
+			if ids := pending[m.Name]; id == "" && len(ids) > 0 {
+				id, pending[m.Name] = ids[0], ids[1:]
+			}
+			out = append(out, OpenAIMessage{Role: m.Role, Content: &OpenAIContent{Text: m.Content}, ToolCallID: id})
+
+		default:
+			return nil, fmt.Errorf("message %d: unsupported message type %T", i, m)
+		}
+	}
+
+	return out, nil
+}
+
+func toolCallFromOpenAI(tc OpenAIToolCall) (ToolCall, error) {
+	args := strings.TrimSpace(tc.Function.Arguments)
+	if args == "" {
+		args = "{}"
+	}
+	if !json.Valid([]byte(args)) {
+		return ToolCall{}, fmt.Errorf("tool call %s: arguments are not valid JSON", tc.ID)
+	}
+
+	call := newJSONToolCall(tc.Function.Name, json.RawMessage(args))
+	call.ID = tc.ID
+	if tc.Type != "" {
+		call.Type = tc.Type
+	}
+	return call, nil
+}
+
+func toolCallToOpenAI(call ToolCall, id string) OpenAIToolCall {
+	if call.ID != "" {
+		id = call.ID
+	}
+	typ := call.Type
+	if typ == "" {
+		typ = "function"
+	}
+	return OpenAIToolCall{
+		ID:   id,
+		Type: typ,
+		Function: OpenAIFunctionCall{
+			Name:      call.Function.Name,
+			Arguments: string(call.Function.ArgumentsJSON()),
+		},
+	}
+}
+
+func partsFromOpenAI(in []OpenAIContentPart) ([]Part, error) {
+	parts := make([]Part, 0, len(in))
+	for _, p := range in {
+		switch p.Type {
+		case "text":
+			parts = append(parts, TextPart(p.Text))
+
+		case "image_url":
+			if p.ImageURL == nil {
+				return nil, errors.New("image_url part without an image_url")
+			}
+			part := Part{Type: PartImage}
+			if mime, data, ok := parseDataURL(p.ImageURL.URL); ok {
+				part.MIMEType = mime
+				part.Data = data
+			} else if strings.HasPrefix(p.ImageURL.URL, "data:") {
+				return nil, errors.New("invalid image data URL")
+			} else {
+				part.URL = p.ImageURL.URL
+			}
+			parts = append(parts, part)
+
+		case "input_audio":
+			if p.InputAudio == nil {
+				return nil, errors.New("input_audio part without input_audio")
+			}
+			data, err := base64.StdEncoding.DecodeString(p.InputAudio.Data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid input_audio data: %w", err)
+			}
+			parts = append(parts, Part{Type: PartAudio, Data: data, MIMEType: "audio/" + p.InputAudio.Format})
+
+		default:
+			return nil, fmt.Errorf("unsupported content part type %q", p.Type)
+		}
+	}
+	return parts, nil
+}
+
+func partsToOpenAI(in []Part) ([]OpenAIContentPart, error) {
+	parts := make([]OpenAIContentPart, 0, len(in))
+	for _, p := range in {
+		switch p.Type {
+		case PartText:
+			parts = append(parts, OpenAIContentPart{Type: "text", Text: p.Text})
+
+		case PartImage:
+			url := p.URL
+			if len(p.Data) > 0 {
+				mime := p.MIMEType
+				if mime == "" {
+					mime = "application/octet-stream"
+				}
+				url = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(p.Data)
+			}
+			if url == "" {
+				return nil, errors.New("image part has no data or URL")
+			}
+			parts = append(parts, OpenAIContentPart{Type: "image_url", ImageURL: &OpenAIImageURL{URL: url}})
+
+		case PartAudio:
+			format, ok := strings.CutPrefix(p.MIMEType, "audio/")
+			if len(p.Data) == 0 || !ok {
+				return nil, errors.New("audio part must hold encoded audio data with an audio/ MIME type")
+			}
+			parts = append(parts, OpenAIContentPart{
+				Type:       "input_audio",
+				InputAudio: &OpenAIInputAudio{Data: base64.StdEncoding.EncodeToString(p.Data), Format: format},
+			})
+
+		default:
+			return nil, fmt.Errorf("unsupported content part type %q", p.Type)
+		}
+	}
+	return parts, nil
+}
+
+// parseDataURL decodes a base64 data URL of the form data:<mime>;base64,<data>.
+func parseDataURL(url string) (mime string, data []byte, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", nil, false
+	}
+	meta, encoded, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, false
+	}
+	mime, ok = strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return "", nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+	return mime, data, true
+}
@@ -0,0 +1,211 @@
+package message
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const openAIConversation = `[
+	{"role": "system", "content": "You are a helpful assistant."},
+	{"role": "user", "content": [
+		{"type": "text", "text": "What is in this image, and what is the weather there?"},
+		{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}},
+		{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg"}},
+		{"type": "input_audio", "input_audio": {"data": "UklGRg==", "format": "wav"}}
+	]},
+	{"role": "assistant", "content": null, "reasoning_content": "I need the weather.", "tool_calls": [
+		{"id": "call_abc", "type": "function", "function": {"name": "get_weather", "arguments": "{\"days\":3,\"location\":\"Paris\",\"metric\":true}"}}
+	]},
+	{"role": "tool", "tool_call_id": "call_abc", "content": "Sunny, 22C"},
+	{"role": "assistant", "content": "A cat in sunny Paris."}
+]`
+
+func TestFromOpenAI(t *testing.T) {
+	var in []OpenAIMessage
+	if err := json.Unmarshal([]byte(openAIConversation), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs, err := FromOpenAI(in)
+	if err != nil {
+		t.Fatalf("FromOpenAI: %v", err)
+	}
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 messages, got %d", len(msgs))
+	}
+
+	if _, ok := msgs[0].(Chat); !ok {
+		t.Errorf("msgs[0]: got %T, want Chat", msgs[0])
+	}
+
+	mm, ok := msgs[1].(Multimodal)
+	if !ok {
+		t.Fatalf("msgs[1]: got %T, want Multimodal", msgs[1])
+	}
+	if len(mm.Parts) != 4 {
+		t.Fatalf("parts: got %d, want 4", len(mm.Parts))
+	}
+	if mm.Parts[1].MIMEType != "image/png" || len(mm.Parts[1].Data) == 0 {
+		t.Errorf("data URL image: got %+v", mm.Parts[1])
+	}
+	if mm.Parts[2].URL != "https://example.com/cat.jpg" {
+		t.Errorf("remote image: got %+v", mm.Parts[2])
+	}
+	if mm.Parts[3].Type != PartAudio || string(mm.Parts[3].Data) != "RIFF" {
+		t.Errorf("audio: got %+v", mm.Parts[3])
+	}
+
+	tool, ok := msgs[2].(Tool)
+	if !ok {
+		t.Fatalf("msgs[2]: got %T, want Tool", msgs[2])
+	}
+	call := tool.ToolCalls[0]
+	if call.ID != "call_abc" || call.Function.Name != "get_weather" {
+		t.Errorf("call: got %+v", call)
+	}
+	if call.Function.Arguments["location"] != "Paris" {
+		t.Errorf("location: got %q", call.Function.Arguments["location"])
+	}
+	if call.Function.TypedArguments["metric"] != true {
+		t.Errorf("metric: got %#v", call.Function.TypedArguments["metric"])
+	}
+	if tool.Reasoning != "I need the weather." {
+		t.Errorf("reasoning: got %q", tool.Reasoning)
+	}
+
+	resp, ok := msgs[3].(ToolResponse)
+	if !ok {
+		t.Fatalf("msgs[3]: got %T, want ToolResponse", msgs[3])
+	}
+	if resp.ToolCallID != "call_abc" || resp.Name != "get_weather" {
+		t.Errorf("tool response: got %+v", resp)
+	}
+}
+
+func TestOpenAI_RoundTrip(t *testing.T) {
+	var in []OpenAIMessage
+	if err := json.Unmarshal([]byte(openAIConversation), &in); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	msgs, err := FromOpenAI(in)
+	if err != nil {
+		t.Fatalf("FromOpenAI: %v", err)
+	}
+	out, err := ToOpenAI(msgs)
+	if err != nil {
+		t.Fatalf("ToOpenAI: %v", err)
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var want, got any
+	json.Unmarshal([]byte(openAIConversation), &want)
+	json.Unmarshal(data, &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\ngot  %s\nwant %s", data, openAIConversation)
+	}
+}
+
+func TestToOpenAI_RoundTrip(t *testing.T) {
+	msgs := []Message{
+		Chat{Role: "user", Content: "What time is it in Tokyo?"},
+		Tool{Role: "assistant", ToolCalls: []ToolCall{{
+			ID:   "call_1",
+			Type: "function",
+			Function: ToolFunction{
+				Name:           "get_time",
+				Arguments:      map[string]string{"timezone": "Asia/Tokyo"},
+				TypedArguments: map[string]any{"timezone": "Asia/Tokyo"},
+			},
+		}}},
+		ToolResponse{Role: "tool", Name: "get_time", Content: "09:00", ToolCallID: "call_1"},
+		Multimodal{Role: "user", Parts: []Part{TextPart("And this?"), {Type: PartImage, Data: []byte("img"), MIMEType: "image/jpeg"}}},
+	}
+
+	out, err := ToOpenAI(msgs)
+	if err != nil {
+		t.Fatalf("ToOpenAI: %v", err)
+	}
+	if out[1].ToolCalls[0].Function.Arguments != `{"timezone":"Asia/Tokyo"}` {
+		t.Errorf("arguments: got %q", out[1].ToolCalls[0].Function.Arguments)
+	}
+
+	back, err := FromOpenAI(out)
+	if err != nil {
+		t.Fatalf("FromOpenAI: %v", err)
+	}
+	if !reflect.DeepEqual(back, msgs) {
+		t.Errorf("round trip:\ngot  %+v\nwant %+v", back, msgs)
+	}
+}
+
+func TestToOpenAI_GeneratesToolCallIDs(t *testing.T) {
+	msgs := []Message{
+		Tool{Role: "assistant", ToolCalls: []ToolCall{
+			{Type: "function", Function: ToolFunction{Name: "a"}},
+			{Type: "function", Function: ToolFunction{Name: "b"}},
+		}},
+		ToolResponse{Role: "tool", Name: "b", Content: "B"},
+		ToolResponse{Role: "tool", Name: "a", Content: "A"},
+	}
+
+	out, err := ToOpenAI(msgs)
+	if err != nil {
+		t.Fatalf("ToOpenAI: %v", err)
+	}
+	calls := out[0].ToolCalls
+	if calls[0].ID == "" || calls[1].ID == "" || calls[0].ID == calls[1].ID {
+		t.Errorf("expected distinct IDs, got %q and %q", calls[0].ID, calls[1].ID)
+	}
+	if calls[0].Function.Arguments != "{}" {
+		t.Errorf("arguments: got %q, want {}", calls[0].Function.Arguments)
+	}
+	if out[1].ToolCallID != calls[1].ID || out[2].ToolCallID != calls[0].ID {
+		t.Errorf("responses: got IDs %q and %q", out[1].ToolCallID, out[2].ToolCallID)
+	}
+}
+
+func TestFromOpenAI_InvalidArguments(t *testing.T) {
+	in := []OpenAIMessage{{
+		Role:      "assistant",
+		ToolCalls: []OpenAIToolCall{{ID: "x", Type: "function", Function: OpenAIFunctionCall{Name: "f", Arguments: "{not json"}}},
+	}}
+
+	if _, err := FromOpenAI(in); err == nil {
+		t.Fatal("expected an error for invalid arguments")
+	}
+}
+
+func TestOpenAIResponseFormat_Schema(t *testing.T) {
+	var f OpenAIResponseFormat
+	data := `{"type": "json_schema", "json_schema": {"name": "weather", "strict": true, "schema": {"type": "object", "required": ["city"]}}}`
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if f.JSONSchema.Name != "weather" || f.JSONSchema.Strict == nil || !*f.JSONSchema.Strict {
+		t.Errorf("json_schema: got %+v", f.JSONSchema)
+	}
+	if f.Schema()["type"] != "object" {
+		t.Errorf("schema: got %v", f.Schema())
+	}
+	if (OpenAIResponseFormat{Type: "json_object"}).Schema()["type"] != "object" {
+		t.Error("json_object should accept any object")
+	}
+	if (OpenAIResponseFormat{Type: "text"}).Schema() != nil {
+		t.Error("text should have no schema")
+	}
+
+	out, _ := json.Marshal(f)
+	var got, want any
+	json.Unmarshal(out, &got)
+	json.Unmarshal([]byte(data), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip: got %s", out)
+	}
+}
@@ -73,6 +73,16 @@ func parseToolCalls(content string) []ToolCall {
 		return parseGemmaToolCalls(content)
 	case FormatGPT:
 		return parseGPTToolCalls(content)
+	case FormatLlama3:
+		return parseLlama3ToolCalls(content)
+	case FormatDeepSeek:
+		return parseDeepSeekToolCalls(content)
+	case FormatGranite:
+		return parseGraniteToolCalls(content)
+	case FormatCommandR:
+		return parseCommandRToolCalls(content)
+	case FormatFunctionary:
+		return parseFunctionaryToolCalls(content)
 	default:
 		return nil
 	}
@@ -205,8 +215,10 @@ func parseOneStandardToolCall(content string) *ToolCall {
 	// Some models (e.g. Qwen fine-tunes) emit truncated JSON that is
 	// missing one or more closing braces. Attempt to repair it before
 	// giving up on the unmarshal.
+	data := content
 	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
 		if repaired := repairJSON(content); repaired != content {
+			data = repaired
 			_ = json.Unmarshal([]byte(repaired), &parsed)
 		}
 	}
@@ -236,8 +248,9 @@ func parseOneStandardToolCall(content string) *ToolCall {
 		return &ToolCall{
 			Type: "function",
 			Function: ToolFunction{
-				Name:      parsed.Name,
-				Arguments: args,
+				Name:           parsed.Name,
+				Arguments:      args,
+				TypedArguments: flattenNestedArguments(decodeJSONArguments([]byte(data))),
 			},
 		}
 	}
@@ -283,6 +296,22 @@ func unmarshalJSONArgs(raw json.RawMessage) map[string]string {
 	return args
 }
 
+// newJSONToolCall returns a tool call whose arguments are the JSON object
+// raw. Truncated JSON is repaired when possible.
+func newJSONToolCall(name string, raw json.RawMessage) ToolCall {
+	if !json.Valid(raw) {
+		raw = json.RawMessage(repairJSON(string(raw)))
+	}
+	return ToolCall{
+		Type: "function",
+		Function: ToolFunction{
+			Name:           name,
+			Arguments:      unmarshalJSONArgs(raw),
+			TypedArguments: decodeJSONValues(raw),
+		},
+	}
+}
+
 // parseInlineJSONToolCalls scans s for bare JSON objects of the form
 // {"name":"funcname","args":{...}} or {"name":"funcname","arguments":{...}}
 // — as emitted by some Gemma 4 fine-tunes without any wrapper tags — and
@@ -334,8 +363,9 @@ func parseInlineJSONToolCalls(s string) []ToolCall {
 		calls = append(calls, ToolCall{
 			Type: "function",
 			Function: ToolFunction{
-				Name:      parsed.Name,
-				Arguments: parsedArgs,
+				Name:           parsed.Name,
+				Arguments:      parsedArgs,
+				TypedArguments: decodeJSONValues(argsJSON),
 			},
 		})
 	}
@@ -343,9 +373,10 @@ func parseInlineJSONToolCalls(s string) []ToolCall {
 }
 
 // stripInlineJSONToolCallBlocks removes bare JSON tool call objects of the form
-// {"name":"funcname","args":{...}} or {"name":"funcname","arguments":{...}} from
-// s, preserving all other text content. JSON objects with a "name" field but
-// no "args"/"arguments" field (e.g. serialised data objects) are left intact.
+// {"name":"funcname","args":{...}}, {"name":"funcname","arguments":{...}} or
+// {"name":"funcname","parameters":{...}} from s, preserving all other text
+// content. JSON objects with a "name" field but none of those fields (e.g.
+// serialised data objects) are left intact.
 func stripInlineJSONToolCallBlocks(s string) string {
 	var b strings.Builder
 	remaining := s
@@ -362,8 +393,9 @@ func stripInlineJSONToolCallBlocks(s string) string {
 			break
 		}
 		objStr := sub[:end]
-		// Only strip if the object has "args" or "arguments" — it is a tool call.
-		if strings.Contains(objStr, `"args":`) || strings.Contains(objStr, `"arguments":`) {
+		// Only strip if the object has "args", "arguments" or Llama 3's
+		// "parameters" — it is a tool call.
+		if strings.Contains(objStr, `"args":`) || strings.Contains(objStr, `"arguments":`) || strings.Contains(objStr, `"parameters":`) {
 			b.WriteString(remaining[:idx])
 		} else {
 			// Not a tool call object — keep it.
@@ -563,6 +595,32 @@ func StripMarkup(s string) string {
 		}
 	}
 
+	// Strip the end-of-turn and turn boundary tokens of Llama 3 (also used by
+	// Functionary), DeepSeek, Granite and Command-R, truncating at the first
+	// occurrence like the tokens above.
+	for _, f := range []Format{FormatLlama3, FormatDeepSeek, FormatGranite, FormatCommandR} {
+		for _, marker := range turnMarkers[f] {
+			if idx := strings.Index(s, marker); idx >= 0 {
+				s = strings.TrimSpace(s[:idx])
+			}
+		}
+	}
+
+	// Remove DeepSeek <｜tool▁calls▁begin｜>…<｜tool▁calls▁end｜> blocks.
+	s = stripDeepSeekToolCallBlocks(s)
+
+	// Remove Granite <|tool_call|>[…] lists.
+	s = stripGraniteToolCallBlocks(s)
+
+	// Remove Llama 3 <|python_tag|> calls.
+	s = stripLlama3ToolCallBlocks(s)
+
+	// Remove Command-R "Action: ```json" and <|START_ACTION|> blocks.
+	s = stripCommandRActionBlocks(s)
+
+	// Remove Functionary >>>name segments, keeping the >>>all text.
+	s = stripFunctionaryToolCalls(s)
+
 	// Remove Standard <tool_call>…</tool_call> blocks.
 	s = stripStandardToolCallBlocks(s)
 
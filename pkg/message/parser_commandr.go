@@ -0,0 +1,91 @@
+package message
+
+import "strings"
+
+// Command-R action markers.
+const (
+	commandRActionFence = "Action: ```json"
+	commandRStartAction = "<|START_ACTION|>"
+	commandREndAction   = "<|END_ACTION|>"
+)
+
+// commandRDirectAnswer are the pseudo-tools Command-R calls to answer without
+// using a tool.
+var commandRDirectAnswer = []string{"directly_answer", "directly-answer"}
+
+// stripCommandRActionBlocks removes Command-R action blocks from s. A block
+// with no end marker is removed up to the end of s.
+func stripCommandRActionBlocks(s string) string {
+	for {
+		start, _, end := findCommandRAction(s)
+		if start == -1 {
+			break
+		}
+		s = s[:start] + s[end:]
+	}
+	return s
+}
+
+// parseCommandRToolCalls parses Cohere Command-R tool calls.
+// Command-R and Command-R+ format:
+//
+//	Action: ```json
+//	[{"tool_name": "get_weather", "parameters": {"location": "NYC"}}]
+//	```
+//
+// Command-R7B format: <|START_ACTION|>[{"tool_call_id": "0", "tool_name": "get_weather", "parameters": {…}}]<|END_ACTION|>
+func parseCommandRToolCalls(content string) []ToolCall {
+	var calls []ToolCall
+
+	for {
+		start, body, end := findCommandRAction(content)
+		if start == -1 {
+			break
+		}
+		content = content[end:]
+
+		for _, call := range parseJSONToolCallList(strings.TrimSpace(body), "tool_name", "parameters") {
+			if !isCommandRDirectAnswer(call.Function.Name) {
+				calls = append(calls, call)
+			}
+		}
+	}
+
+	return calls
+}
+
+// findCommandRAction returns the start of the first action block in s, the
+// JSON text inside it, and the end of the block. start is -1 if there is no
+// action block.
+func findCommandRAction(s string) (start int, body string, end int) {
+	fence := strings.Index(s, commandRActionFence)
+	action := strings.Index(s, commandRStartAction)
+
+	switch {
+	case fence == -1 && action == -1:
+		return -1, "", -1
+	case action == -1 || (fence >= 0 && fence < action):
+		from := fence + len(commandRActionFence)
+		closing := strings.Index(s[from:], "```")
+		if closing == -1 {
+			return fence, s[from:], len(s)
+		}
+		return fence, s[from : from+closing], from + closing + len("```")
+	default:
+		from := action + len(commandRStartAction)
+		closing := strings.Index(s[from:], commandREndAction)
+		if closing == -1 {
+			return action, s[from:], len(s)
+		}
+		return action, s[from : from+closing], from + closing + len(commandREndAction)
+	}
+}
+
+func isCommandRDirectAnswer(name string) bool {
+	for _, n := range commandRDirectAnswer {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
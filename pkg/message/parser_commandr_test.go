@@ -0,0 +1,68 @@
+package message
+
+import "testing"
+
+func TestParseCommandRToolCalls_ActionFence(t *testing.T) {
+	response := "Action: ```json\n" +
+		`[{"tool_name": "get_weather", "parameters": {"location": "NYC"}}]` +
+		"\n```"
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+}
+
+func TestParseCommandRToolCalls_StartAction(t *testing.T) {
+	response := `<|START_THINKING|>I need the weather.<|END_THINKING|><|START_ACTION|>[` +
+		`{"tool_call_id": "0", "tool_name": "get_weather", "parameters": {"location": "NYC"}},` +
+		`{"tool_call_id": "1", "tool_name": "get_time", "parameters": {"timezone": "UTC"}}` +
+		`]<|END_ACTION|>`
+
+	calls := parseCommandRToolCalls(response)
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if calls[1].Function.Name != "get_time" {
+		t.Errorf("call[1] name: got %q, want %q", calls[1].Function.Name, "get_time")
+	}
+	if calls[1].Function.Arguments["timezone"] != "UTC" {
+		t.Errorf("timezone: got %q, want %q", calls[1].Function.Arguments["timezone"], "UTC")
+	}
+}
+
+func TestParseCommandRToolCalls_DirectlyAnswer(t *testing.T) {
+	response := "Action: ```json\n" +
+		`[{"tool_name": "directly_answer", "parameters": {}}]` +
+		"\n```"
+
+	calls := parseCommandRToolCalls(response)
+
+	if len(calls) != 0 {
+		t.Fatalf("expected 0 calls, got %d", len(calls))
+	}
+}
+
+func TestStripMarkup_CommandR(t *testing.T) {
+	response := "Let me check.<|START_ACTION|>[{\"tool_name\": \"get_weather\", \"parameters\": {}}]<|END_ACTION|><|END_OF_TURN_TOKEN|>"
+
+	got := StripMarkup(response)
+
+	if got != "Let me check." {
+		t.Errorf("got %q, want %q", got, "Let me check.")
+	}
+}
+
+func TestDetectFormat_CommandR(t *testing.T) {
+	if got := DetectFormat("Action: ```json\n[]\n```"); got != FormatCommandR {
+		t.Errorf("DetectFormat = %v, want %v", got, FormatCommandR)
+	}
+}
@@ -0,0 +1,110 @@
+package message
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// DeepSeek tool call markers. The bars and the separators in them are the
+// full-width ｜ and ▁ characters used by the DeepSeek tokenizer.
+const (
+	deepseekCallsBegin = "<｜tool▁calls▁begin｜>"
+	deepseekCallsEnd   = "<｜tool▁calls▁end｜>"
+	deepseekCallBegin  = "<｜tool▁call▁begin｜>"
+	deepseekCallEnd    = "<｜tool▁call▁end｜>"
+	deepseekSep        = "<｜tool▁sep｜>"
+)
+
+// stripDeepSeekToolCallBlocks removes DeepSeek tool call blocks from s. A
+// block with no end marker is removed up to the end of s.
+func stripDeepSeekToolCallBlocks(s string) string {
+	for _, b := range []struct{ open, close string }{
+		{deepseekCallsBegin, deepseekCallsEnd},
+		{deepseekCallBegin, deepseekCallEnd},
+	} {
+		for {
+			start := strings.Index(s, b.open)
+			if start == -1 {
+				break
+			}
+			end := strings.Index(s[start:], b.close)
+			if end == -1 {
+				s = s[:start]
+				break
+			}
+			s = s[:start] + s[start+end+len(b.close):]
+		}
+	}
+	return s
+}
+
+// parseDeepSeekToolCalls parses DeepSeek V3/R1 and V3.1 tool calls.
+// V3/R1 format:
+//
+//	<｜tool▁call▁begin｜>function<｜tool▁sep｜>get_weather
+//	```json
+//	{"location": "NYC"}
+//	```<｜tool▁call▁end｜>
+//
+// V3.1 format: <｜tool▁call▁begin｜>get_weather<｜tool▁sep｜>{"location": "NYC"}<｜tool▁call▁end｜>
+func parseDeepSeekToolCalls(content string) []ToolCall {
+	var calls []ToolCall
+
+	remaining := content
+	for {
+		start := strings.Index(remaining, deepseekCallBegin)
+		if start == -1 {
+			break
+		}
+		remaining = remaining[start+len(deepseekCallBegin):]
+
+		block := remaining
+		if end := strings.Index(remaining, deepseekCallEnd); end >= 0 {
+			block = remaining[:end]
+			remaining = remaining[end+len(deepseekCallEnd):]
+		} else {
+			remaining = ""
+		}
+
+		name, args, ok := splitDeepSeekCall(block)
+		if ok && name != "" {
+			calls = append(calls, newJSONToolCall(name, json.RawMessage(args)))
+		}
+
+		if remaining == "" {
+			break
+		}
+	}
+
+	return calls
+}
+
+// splitDeepSeekCall returns the function name and the JSON arguments of the
+// text of a single DeepSeek tool call.
+func splitDeepSeekCall(block string) (name, args string, ok bool) {
+	head, rest, ok := strings.Cut(block, deepseekSep)
+	if !ok {
+		return "", "", false
+	}
+
+	name = strings.TrimSpace(head)
+	if name == "function" {
+		// V3/R1: the name follows the separator on its own line.
+		name, rest, _ = strings.Cut(rest, "\n")
+		name = strings.TrimSpace(name)
+	}
+	return name, stripCodeFence(rest), true
+}
+
+// stripCodeFence removes a surrounding ```json … ``` Markdown fence from s.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "```") {
+		s = s[3:]
+		if nl := strings.Index(s, "\n"); nl >= 0 && !strings.ContainsAny(s[:nl], "{[") {
+			s = s[nl+1:]
+		}
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,71 @@
+package message
+
+import "testing"
+
+func TestParseDeepSeekToolCalls_V3(t *testing.T) {
+	response := "<｜tool▁calls▁begin｜><｜tool▁call▁begin｜>function<｜tool▁sep｜>get_weather\n" +
+		"```json\n{\"location\": \"NYC\"}\n```<｜tool▁call▁end｜>\n" +
+		"<｜tool▁call▁begin｜>function<｜tool▁sep｜>get_time\n" +
+		"```json\n{\"timezone\": \"UTC\"}\n```<｜tool▁call▁end｜><｜tool▁calls▁end｜>"
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("call[0] name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+	if calls[1].Function.Arguments["timezone"] != "UTC" {
+		t.Errorf("timezone: got %q, want %q", calls[1].Function.Arguments["timezone"], "UTC")
+	}
+}
+
+func TestParseDeepSeekToolCalls_V31(t *testing.T) {
+	response := "<｜tool▁calls▁begin｜><｜tool▁call▁begin｜>get_weather<｜tool▁sep｜>{\"location\": \"NYC\"}<｜tool▁call▁end｜><｜tool▁calls▁end｜>"
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+}
+
+func TestParseDeepSeekToolCalls_Unterminated(t *testing.T) {
+	response := "<｜tool▁calls▁begin｜><｜tool▁call▁begin｜>get_weather<｜tool▁sep｜>{\"location\": \"NYC\""
+
+	calls := parseDeepSeekToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+}
+
+func TestStripMarkup_DeepSeek(t *testing.T) {
+	response := "Let me check.<｜tool▁calls▁begin｜><｜tool▁call▁begin｜>get_weather<｜tool▁sep｜>{}<｜tool▁call▁end｜><｜tool▁calls▁end｜><｜end▁of▁sentence｜>"
+
+	got := StripMarkup(response)
+
+	if got != "Let me check." {
+		t.Errorf("got %q, want %q", got, "Let me check.")
+	}
+}
+
+func TestDetectFormat_DeepSeek(t *testing.T) {
+	s := "<｜tool▁call▁begin｜>get_weather<｜tool▁sep｜>{}<｜tool▁call▁end｜>"
+	if got := DetectFormat(s); got != FormatDeepSeek {
+		t.Errorf("DetectFormat = %v, want %v", got, FormatDeepSeek)
+	}
+}
@@ -0,0 +1,77 @@
+package message
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// functionaryCallRE matches a Functionary v3 recipient header: >>> followed
+// by a function name, or "all" for plain text, on its own line.
+var functionaryCallRE = regexp.MustCompile(`>>>([A-Za-z_][A-Za-z0-9_.-]*)\n`)
+
+// functionaryTextRecipient is the recipient of plain text in Functionary v3.
+const functionaryTextRecipient = "all"
+
+// functionarySegments splits a Functionary v3 stream into its >>>recipient
+// segments. Text before the first header is returned with an empty recipient.
+func functionarySegments(s string) (recipients, bodies []string) {
+	locs := functionaryCallRE.FindAllStringSubmatchIndex(s, -1)
+	if len(locs) == 0 || locs[0][0] > 0 {
+		end := len(s)
+		if len(locs) > 0 {
+			end = locs[0][0]
+		}
+		recipients, bodies = append(recipients, ""), append(bodies, s[:end])
+	}
+	for i, loc := range locs {
+		end := len(s)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		recipients, bodies = append(recipients, s[loc[2]:loc[3]]), append(bodies, s[loc[1]:end])
+	}
+	return recipients, bodies
+}
+
+// stripFunctionaryToolCalls removes Functionary v3 function call segments from
+// s, keeping the text of the >>>all segments.
+func stripFunctionaryToolCalls(s string) string {
+	if !functionaryCallRE.MatchString(s) {
+		return s
+	}
+
+	var b strings.Builder
+	recipients, bodies := functionarySegments(s)
+	for i, r := range recipients {
+		if r == "" || r == functionaryTextRecipient {
+			b.WriteString(bodies[i])
+		}
+	}
+	return b.String()
+}
+
+// parseFunctionaryToolCalls parses Functionary v3 tool calls.
+// Format: >>>get_weather\n{"location": "NYC"}>>>all\nIt is sunny.
+// Segments addressed to "all" are plain text rather than function calls.
+func parseFunctionaryToolCalls(content string) []ToolCall {
+	var calls []ToolCall
+
+	recipients, bodies := functionarySegments(content)
+	for i, name := range recipients {
+		if name == "" || name == functionaryTextRecipient {
+			continue
+		}
+
+		args := strings.TrimSpace(bodies[i])
+		if end := findJSONObjectEnd(args); end >= 0 {
+			args = args[:end]
+		}
+		if args == "" {
+			args = "{}"
+		}
+		calls = append(calls, newJSONToolCall(name, json.RawMessage(args)))
+	}
+
+	return calls
+}
@@ -0,0 +1,59 @@
+package message
+
+import "testing"
+
+func TestParseFunctionaryToolCalls_Single(t *testing.T) {
+	response := ">>>get_weather\n{\"location\": \"NYC\"}"
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+}
+
+func TestParseFunctionaryToolCalls_SkipsText(t *testing.T) {
+	response := ">>>all\nLet me check.>>>get_weather\n{\"location\": \"NYC\"}>>>get_time\n{\"timezone\": \"UTC\"}"
+
+	calls := parseFunctionaryToolCalls(response)
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("call[0] name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[1].Function.Arguments["timezone"] != "UTC" {
+		t.Errorf("timezone: got %q, want %q", calls[1].Function.Arguments["timezone"], "UTC")
+	}
+}
+
+func TestParseFunctionaryToolCalls_TextOnly(t *testing.T) {
+	calls := parseFunctionaryToolCalls(">>>all\nIt is sunny.")
+
+	if len(calls) != 0 {
+		t.Fatalf("expected 0 calls, got %d", len(calls))
+	}
+}
+
+func TestStripMarkup_Functionary(t *testing.T) {
+	response := ">>>all\nLet me check.>>>get_weather\n{\"location\": \"NYC\"}"
+
+	got := StripMarkup(response)
+
+	if got != "Let me check." {
+		t.Errorf("got %q, want %q", got, "Let me check.")
+	}
+}
+
+func TestDetectFormat_Functionary(t *testing.T) {
+	if got := DetectFormat(">>>get_weather\n{}"); got != FormatFunctionary {
+		t.Errorf("DetectFormat = %v, want %v", got, FormatFunctionary)
+	}
+}
@@ -129,6 +129,10 @@ func parseGemmaToolCalls(response string) []ToolCall {
 		}
 
 		args := parseGemmaArgs(argsRaw)
+		typed := parseGemmaValues(argsRaw)
+		if typed == nil {
+			typed = stringValues(args)
+		}
 		// Only create a tool call when the function has a name and at least
 		// one argument.  An empty brace block call:func{} is a model error —
 		// skip it rather than dispatching a call that will always fail.
@@ -136,8 +140,9 @@ func parseGemmaToolCalls(response string) []ToolCall {
 			calls = append(calls, ToolCall{
 				Type: "function",
 				Function: ToolFunction{
-					Name:      name,
-					Arguments: args,
+					Name:           name,
+					Arguments:      args,
+					TypedArguments: typed,
 				},
 			})
 		}
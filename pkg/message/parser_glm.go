@@ -67,8 +67,9 @@ func parseGLMToolCalls(content string) []ToolCall {
 			calls = append(calls, ToolCall{
 				Type: "function",
 				Function: ToolFunction{
-					Name:      name,
-					Arguments: args,
+					Name:           name,
+					Arguments:      args,
+					TypedArguments: stringValues(args),
 				},
 			})
 		}
@@ -30,44 +30,32 @@ func stripGPTToolCallBlocks(s string) string {
 	return s
 }
 
-// parseGPTToolCalls parses GPT-model tool calls.
-// Format: .FUNC_NAME <|message|>JSON_ARGS
+// parseGPTToolCalls parses GPT-model tool calls: harmony messages whose
+// header names a function as recipient, such as
+//
+//	<|channel|>commentary to=functions.FUNC_NAME <|constrain|>json<|message|>JSON_ARGS
+//
+// and the short form .FUNC_NAME <|message|>JSON_ARGS. Other messages, such as
+// the analysis and final channels, are skipped.
 func parseGPTToolCalls(content string) []ToolCall {
 	var calls []ToolCall
 
-	remaining := content
-	for {
-		dotIdx := strings.Index(remaining, ".")
-		if dotIdx == -1 {
+	for pos := 0; ; {
+		idx := strings.Index(content[pos:], harmonyMessage)
+		if idx == -1 {
 			break
 		}
-
-		remaining = remaining[dotIdx:]
-
-		msgIdx := strings.Index(remaining, "<|message|>")
-		if msgIdx == -1 {
-			break
+		name, _ := gptRecipient(gptHeader(content[pos : pos+idx]))
+		pos += idx + len(harmonyMessage)
+		if name == "" {
+			continue
 		}
 
-		// Extract function name (between . and space before <|message|>).
-		prefix := remaining[:msgIdx]
-		parts := strings.SplitN(prefix, " ", 2)
-		name := strings.TrimPrefix(parts[0], ".")
-
-		// Move past <|message|> to get the JSON.
-		jsonStart := msgIdx + len("<|message|>")
-		remaining = remaining[jsonStart:]
-
-		jsonEnd := findJSONObjectEnd(remaining)
-		var argsJSON string
-		switch {
-		case jsonEnd == -1:
-			argsJSON = remaining
-			remaining = ""
-		default:
-			argsJSON = remaining[:jsonEnd]
-			remaining = remaining[jsonEnd:]
+		argsJSON := content[pos:]
+		if jsonEnd := findJSONObjectEnd(argsJSON); jsonEnd >= 0 {
+			argsJSON = argsJSON[:jsonEnd]
 		}
+		pos += len(argsJSON)
 
 		var rawArgs map[string]any
 		args := make(map[string]string)
@@ -88,20 +76,54 @@ func parseGPTToolCalls(content string) []ToolCall {
 			}
 		}
 
-		if name != "" {
-			calls = append(calls, ToolCall{
-				Type: "function",
-				Function: ToolFunction{
-					Name:      name,
-					Arguments: args,
-				},
-			})
+		calls = append(calls, ToolCall{
+			Type: "function",
+			Function: ToolFunction{
+				Name:           name,
+				Arguments:      args,
+				TypedArguments: decodeJSONValues([]byte(argsJSON)),
+			},
+		})
+	}
+
+	return calls
+}
+
+// gptHeader returns the header of the harmony message whose <|message|>
+// marker follows s: the text after the end of the previous message.
+func gptHeader(s string) string {
+	for _, m := range []string{"<|end|>", "<|return|>", "<|call|>"} {
+		if idx := strings.LastIndex(s, m); idx >= 0 {
+			s = s[idx+len(m):]
 		}
+	}
+	return s
+}
 
-		if remaining == "" {
-			break
+// gptFunctionsPrefix introduces the function recipient of a harmony header.
+const gptFunctionsPrefix = "to=functions."
+
+// gptRecipient returns the function that a harmony message header is
+// addressed to, from a to=functions.NAME recipient or a trailing .NAME, or ""
+// if there is none. complete reports whether the name is followed by more of
+// the header, so that it cannot grow as more text arrives.
+func gptRecipient(header string) (name string, complete bool) {
+	if idx := strings.LastIndex(header, gptFunctionsPrefix); idx >= 0 {
+		rest := header[idx+len(gptFunctionsPrefix):]
+		n := 0
+		for n < len(rest) && isFunctionNameChar(rest[n]) {
+			n++
 		}
+		return rest[:n], n < len(rest)
 	}
 
-	return calls
+	trimmed := strings.TrimRight(header, " ")
+	start := len(trimmed)
+	for start > 0 && isFunctionNameChar(trimmed[start-1]) {
+		start--
+	}
+	if token := trimmed[start:]; strings.HasPrefix(token, ".") {
+		return token[1:], false
+	}
+	return "", false
 }
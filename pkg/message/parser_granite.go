@@ -0,0 +1,118 @@
+package message
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// stripGraniteToolCallBlocks removes all <|tool_call|>[…] blocks from s.
+func stripGraniteToolCallBlocks(s string) string {
+	for {
+		start := strings.Index(s, "<|tool_call|>")
+		if start == -1 {
+			break
+		}
+		listStart := start + len("<|tool_call|>")
+		listStart += len(s[listStart:]) - len(strings.TrimLeft(s[listStart:], " \t\r\n"))
+		end := findJSONValueEnd(s[listStart:])
+		if end == -1 {
+			s = s[:start]
+			break
+		}
+		s = s[:start] + s[listStart+end:]
+	}
+	return s
+}
+
+// parseGraniteToolCalls parses IBM Granite tool calls.
+// Format: <|tool_call|>[{"name": "get_weather", "arguments": {"location": "NYC"}}]
+func parseGraniteToolCalls(content string) []ToolCall {
+	var calls []ToolCall
+
+	remaining := content
+	for {
+		start := strings.Index(remaining, "<|tool_call|>")
+		if start == -1 {
+			break
+		}
+		remaining = strings.TrimLeft(remaining[start+len("<|tool_call|>"):], " \t\r\n")
+
+		end := findJSONValueEnd(remaining)
+		list := remaining
+		if end == -1 {
+			list = repairJSON(remaining)
+			remaining = ""
+		} else {
+			list = remaining[:end]
+			remaining = remaining[end:]
+		}
+
+		calls = append(calls, parseJSONToolCallList(list, "name", "arguments")...)
+
+		if remaining == "" {
+			break
+		}
+	}
+
+	return calls
+}
+
+// parseJSONToolCallList parses a JSON list of tool call objects, or a single
+// object, taking the name and the arguments from the given members.
+func parseJSONToolCallList(list, nameKey, argsKey string) []ToolCall {
+	var objs []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(list), &objs); err != nil {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(list), &obj); err != nil {
+			return nil
+		}
+		objs = append(objs, obj)
+	}
+
+	var calls []ToolCall
+	for _, obj := range objs {
+		var name string
+		if err := json.Unmarshal(obj[nameKey], &name); err != nil || name == "" {
+			continue
+		}
+		args := obj[argsKey]
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		calls = append(calls, newJSONToolCall(name, args))
+	}
+	return calls
+}
+
+// findJSONValueEnd returns the index one past the end of the JSON object or
+// array that starts s, or -1 if it is not complete.
+func findJSONValueEnd(s string) int {
+	if s == "" || (s[0] != '{' && s[0] != '[') {
+		return -1
+	}
+	depth := 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			if c == '\\' {
+				i++ // skip escaped character
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,60 @@
+package message
+
+import "testing"
+
+func TestParseGraniteToolCalls_List(t *testing.T) {
+	response := `<|tool_call|>[{"name": "get_weather", "arguments": {"location": "NYC"}}, {"name": "get_time", "arguments": {"timezone": "UTC"}}]`
+
+	calls := parseGraniteToolCalls(response)
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("call[0] name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+	if calls[1].Function.Arguments["timezone"] != "UTC" {
+		t.Errorf("timezone: got %q, want %q", calls[1].Function.Arguments["timezone"], "UTC")
+	}
+}
+
+func TestParseGraniteToolCalls_ViaParseToolCalls(t *testing.T) {
+	calls := ParseToolCalls(`<|tool_call|>[{"name": "get_weather", "arguments": {"location": "NYC"}}]`)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+}
+
+func TestParseGraniteToolCalls_NoArguments(t *testing.T) {
+	calls := parseGraniteToolCalls(`<|tool_call|>[{"name": "get_time"}]`)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if len(calls[0].Function.Arguments) != 0 {
+		t.Errorf("arguments: got %v, want none", calls[0].Function.Arguments)
+	}
+}
+
+func TestStripMarkup_Granite(t *testing.T) {
+	response := `Let me check.<|tool_call|>[{"name": "get_weather", "arguments": {}}]<|end_of_text|>`
+
+	got := StripMarkup(response)
+
+	if got != "Let me check." {
+		t.Errorf("got %q, want %q", got, "Let me check.")
+	}
+}
+
+func TestDetectFormat_Granite(t *testing.T) {
+	if got := DetectFormat(`<|tool_call|>[{"name": "f", "arguments": {}}]`); got != FormatGranite {
+		t.Errorf("DetectFormat = %v, want %v", got, FormatGranite)
+	}
+}
@@ -0,0 +1,122 @@
+package message
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// llama3BuiltinCallRE matches a Llama 3.1 built-in tool call such as
+// brave_search.call(query="weather in NYC").
+var llama3BuiltinCallRE = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\.call\((.*)\)\s*$`)
+
+// llama3BuiltinArgRE matches one key="value" or key=value argument of a
+// built-in tool call.
+var llama3BuiltinArgRE = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*=\s*("(?:[^"\\]|\\.)*"|[^,]+)`)
+
+// llama3EndTokens end the text of a <|python_tag|> tool call.
+var llama3EndTokens = []string{"<|eom_id|>", "<|eot_id|>"}
+
+// stripLlama3ToolCallBlocks removes <|python_tag|> tool calls from s, up to the
+// end of message token or the end of s.
+func stripLlama3ToolCallBlocks(s string) string {
+	for {
+		start := strings.Index(s, "<|python_tag|>")
+		if start == -1 {
+			break
+		}
+		end := len(s)
+		for _, tok := range llama3EndTokens {
+			if idx := strings.Index(s[start:], tok); idx >= 0 && start+idx+len(tok) < end {
+				end = start + idx + len(tok)
+			}
+		}
+		s = s[:start] + s[end:]
+	}
+	return s
+}
+
+// parseLlama3ToolCalls parses Llama 3.x style tool calls.
+// Format: <|python_tag|>{"name": "get_weather", "parameters": {"location": "NYC"}}
+// The <|python_tag|> prefix is optional, several calls may be separated by
+// ";", and the Llama 3.1 built-in form brave_search.call(query="…") is also
+// accepted after <|python_tag|>.
+func parseLlama3ToolCalls(content string) []ToolCall {
+	var calls []ToolCall
+
+	for _, tok := range llama3EndTokens {
+		content = strings.ReplaceAll(content, tok, "")
+	}
+
+	if idx := strings.Index(content, "<|python_tag|>"); idx >= 0 {
+		code := content[idx+len("<|python_tag|>"):]
+		if m := llama3BuiltinCallRE.FindStringSubmatch(code); m != nil {
+			return []ToolCall{parseLlama3BuiltinCall(m[1], m[2])}
+		}
+		content = strings.ReplaceAll(content, "<|python_tag|>", "")
+	}
+
+	remaining := content
+	for {
+		start := strings.Index(remaining, "{")
+		if start == -1 {
+			break
+		}
+		end := findJSONObjectEnd(remaining[start:])
+		if end == -1 {
+			break
+		}
+		obj := remaining[start : start+end]
+		remaining = remaining[start+end:]
+
+		var parsed struct {
+			Name       string          `json:"name"`
+			Parameters json.RawMessage `json:"parameters"`
+			Arguments  json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal([]byte(obj), &parsed); err != nil || parsed.Name == "" {
+			continue
+		}
+
+		args := parsed.Parameters
+		if len(args) == 0 {
+			args = parsed.Arguments
+		}
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		calls = append(calls, newJSONToolCall(parsed.Name, args))
+	}
+
+	return calls
+}
+
+// parseLlama3BuiltinCall parses the arguments of a built-in tool call.
+func parseLlama3BuiltinCall(name, rawArgs string) ToolCall {
+	args := make(map[string]string)
+	typed := make(map[string]any)
+	for _, m := range llama3BuiltinArgRE.FindAllStringSubmatch(rawArgs, -1) {
+		v := strings.TrimSpace(m[2])
+		if s, err := strconv.Unquote(v); err == nil {
+			args[m[1]] = s
+			typed[m[1]] = s
+			continue
+		}
+		args[m[1]] = v
+		if n, ok := jsonNumber(v); ok {
+			typed[m[1]] = n
+		} else {
+			typed[m[1]] = v
+		}
+	}
+
+	return ToolCall{
+		Type: "function",
+		Function: ToolFunction{
+			Name:           name,
+			Arguments:      args,
+			TypedArguments: typed,
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package message
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseLlama3ToolCalls_PythonTag(t *testing.T) {
+	response := `<|python_tag|>{"name": "get_weather", "parameters": {"location": "NYC", "days": 3}}<|eom_id|>`
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "get_weather" {
+		t.Errorf("name: got %q, want %q", calls[0].Function.Name, "get_weather")
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+	if calls[0].Function.TypedArguments["days"] != json.Number("3") {
+		t.Errorf("days: got %#v, want json.Number(\"3\")", calls[0].Function.TypedArguments["days"])
+	}
+}
+
+func TestParseLlama3ToolCalls_NoPythonTag(t *testing.T) {
+	response := `{"name": "get_weather", "parameters": {"location": "NYC"}}`
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Arguments["location"] != "NYC" {
+		t.Errorf("location: got %q, want %q", calls[0].Function.Arguments["location"], "NYC")
+	}
+}
+
+func TestParseLlama3ToolCalls_Multiple(t *testing.T) {
+	response := `<|python_tag|>{"name": "get_weather", "parameters": {"location": "NYC"}}; {"name": "get_time", "parameters": {"timezone": "UTC"}}`
+
+	calls := parseLlama3ToolCalls(response)
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if calls[1].Function.Name != "get_time" {
+		t.Errorf("call[1] name: got %q, want %q", calls[1].Function.Name, "get_time")
+	}
+}
+
+func TestParseLlama3ToolCalls_Builtin(t *testing.T) {
+	response := `<|python_tag|>brave_search.call(query="weather in NYC", count=5)<|eom_id|>`
+
+	calls := ParseToolCalls(response)
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Function.Name != "brave_search" {
+		t.Errorf("name: got %q, want %q", calls[0].Function.Name, "brave_search")
+	}
+	if calls[0].Function.Arguments["query"] != "weather in NYC" {
+		t.Errorf("query: got %q, want %q", calls[0].Function.Arguments["query"], "weather in NYC")
+	}
+	if calls[0].Function.Arguments["count"] != "5" {
+		t.Errorf("count: got %q, want %q", calls[0].Function.Arguments["count"], "5")
+	}
+}
+
+func TestParseLlama3ToolCalls_IgnoresDataObjects(t *testing.T) {
+	calls := parseLlama3ToolCalls(`The user is {"age": 42}.`)
+
+	if len(calls) != 0 {
+		t.Fatalf("expected 0 calls, got %d", len(calls))
+	}
+}
+
+func TestStripMarkup_Llama3(t *testing.T) {
+	got := StripMarkup("Let me check.<|python_tag|>{\"name\": \"get_weather\", \"parameters\": {}}<|eom_id|>")
+	if got != "Let me check." {
+		t.Errorf("got %q, want %q", got, "Let me check.")
+	}
+
+	got = StripMarkup("It is sunny.<|eot_id|><|start_header_id|>user")
+	if got != "It is sunny." {
+		t.Errorf("got %q, want %q", got, "It is sunny.")
+	}
+}
+
+func TestDetectFormat_Llama3(t *testing.T) {
+	for _, s := range []string{
+		`<|python_tag|>{"name": "f", "parameters": {}}`,
+		`{"name": "f", "parameters": {}}`,
+	} {
+		if got := DetectFormat(s); got != FormatLlama3 {
+			t.Errorf("DetectFormat(%q) = %v, want %v", s, got, FormatLlama3)
+		}
+	}
+}
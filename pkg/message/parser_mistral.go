@@ -82,8 +82,9 @@ func parseMistralToolCalls(content string) []ToolCall {
 		calls = append(calls, ToolCall{
 			Type: "function",
 			Function: ToolFunction{
-				Name:      name,
-				Arguments: args,
+				Name:           name,
+				Arguments:      args,
+				TypedArguments: decodeJSONValues([]byte(argsJSON)),
 			},
 		})
 	}
@@ -146,8 +146,9 @@ func parseQwenToolCalls(content string) []ToolCall {
 			calls = append(calls, ToolCall{
 				Type: "function",
 				Function: ToolFunction{
-					Name:      name,
-					Arguments: args,
+					Name:           name,
+					Arguments:      args,
+					TypedArguments: stringValues(args),
 				},
 			})
 		}
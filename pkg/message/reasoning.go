@@ -0,0 +1,140 @@
+package message
+
+import "strings"
+
+// reasoningBlock is a pair of markers that enclose reasoning content.
+type reasoningBlock struct {
+	open, close string
+}
+
+var (
+	// thinkBlocks are used by Qwen3, DeepSeek-R1, GLM and many other
+	// reasoning models.
+	thinkBlocks = []reasoningBlock{{"<think>", "</think>"}}
+
+	// gemmaThoughtBlocks are the Gemma 4 thought channel, in the canonical
+	// pipe-delimited and the decoded forms.
+	gemmaThoughtBlocks = []reasoningBlock{
+		{"<|channel>thought", "<channel|>"},
+		{"<channel>thought", "<channel>"},
+	}
+)
+
+// harmony (GPT-OSS) markers.
+const (
+	harmonyChannel  = "<|channel|>"
+	harmonyMessage  = "<|message|>"
+	harmonyAnalysis = harmonyChannel + "analysis" + harmonyMessage
+	harmonyFinal    = harmonyChannel + "final" + harmonyMessage
+)
+
+// harmonyEnds are the markers that end a harmony message.
+var harmonyEnds = []string{"<|end|>", "<|return|>", "<|call|>", "<|start|>", harmonyChannel}
+
+// SplitReasoning separates the reasoning a model produced from the content of
+// its response. It handles <think>…</think> blocks, including a response that
+// starts mid-thought because <think> was part of the prompt, Gemma 4
+// <|channel>thought…<channel|> blocks, and the analysis and final channels of
+// GPT-OSS. A block with no closing marker is reasoning up to the end of s.
+//
+// The format selects which markers are recognised; FormatAuto recognises all
+// of them. Multiple reasoning blocks are joined with a newline. The content
+// is returned with the reasoning removed and surrounding space trimmed, but
+// otherwise unchanged, so tool calls in it can still be parsed.
+func SplitReasoning(s string, f Format) (reasoning, content string) {
+	var parts []string
+
+	s, parts = splitOrphanThink(s, parts)
+	s, parts = splitReasoningBlocks(s, thinkBlocks, parts)
+
+	if f == FormatAuto || f == FormatGemma || f == FormatGemma3 {
+		s, parts = splitReasoningBlocks(s, gemmaThoughtBlocks, parts)
+	}
+	if f == FormatAuto || f == FormatGPT {
+		s, parts = splitHarmony(s, parts)
+	}
+
+	return strings.Join(parts, "\n"), strings.TrimSpace(s)
+}
+
+// splitOrphanThink handles a </think> with no <think> before it, which
+// happens when the chat template opened the block in the prompt.
+func splitOrphanThink(s string, parts []string) (string, []string) {
+	idx := strings.Index(s, "</think>")
+	if idx == -1 || strings.Contains(s[:idx], "<think>") {
+		return s, parts
+	}
+	return s[idx+len("</think>"):], appendReasoning(parts, s[:idx])
+}
+
+// splitReasoningBlocks removes all blocks of the given kinds from s.
+func splitReasoningBlocks(s string, blocks []reasoningBlock, parts []string) (string, []string) {
+	for _, b := range blocks {
+		for {
+			start := strings.Index(s, b.open)
+			if start == -1 {
+				break
+			}
+			from := start + len(b.open)
+			end := strings.Index(s[from:], b.close)
+			if end == -1 {
+				parts = appendReasoning(parts, s[from:])
+				s = s[:start]
+				break
+			}
+			parts = appendReasoning(parts, s[from:from+end])
+			s = s[:start] + s[from+end+len(b.close):]
+		}
+	}
+	return s, parts
+}
+
+// splitHarmony removes GPT-OSS analysis messages from s, and unwraps the
+// final message so that only its text remains.
+func splitHarmony(s string, parts []string) (string, []string) {
+	for {
+		start := strings.Index(s, harmonyAnalysis)
+		if start == -1 {
+			break
+		}
+		from := start + len(harmonyAnalysis)
+		end, endLen := harmonyEnd(s[from:])
+		parts = appendReasoning(parts, s[from:from+end])
+
+		// Drop the end marker and the <|start|>assistant headers around
+		// the removed message.
+		prefix := strings.TrimSuffix(s[:start], "<|start|>assistant")
+		rest := s[from+end:]
+		if endLen > 0 && !strings.HasPrefix(rest, "<|start|>") && !strings.HasPrefix(rest, harmonyChannel) {
+			rest = rest[endLen:]
+		}
+		s = prefix + strings.TrimPrefix(rest, "<|start|>assistant")
+	}
+
+	if start := strings.Index(s, harmonyFinal); start >= 0 {
+		from := start + len(harmonyFinal)
+		end, _ := harmonyEnd(s[from:])
+		prefix := strings.TrimSuffix(s[:start], "<|start|>assistant")
+		s = prefix + s[from:from+end]
+	}
+	return s, parts
+}
+
+// harmonyEnd returns the position and length of the marker that ends a
+// harmony message, or len(s) and 0 if the message is not terminated.
+func harmonyEnd(s string) (int, int) {
+	end, endLen := len(s), 0
+	for _, m := range harmonyEnds {
+		if idx := strings.Index(s, m); idx >= 0 && idx < end {
+			end, endLen = idx, len(m)
+		}
+	}
+	return end, endLen
+}
+
+func appendReasoning(parts []string, r string) []string {
+	if r = strings.TrimSpace(r); r != "" {
+		parts = append(parts, r)
+	}
+	return parts
+}
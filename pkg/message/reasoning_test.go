@@ -0,0 +1,110 @@
+package message
+
+import "testing"
+
+func TestSplitReasoning(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    Format
+		in        string
+		reasoning string
+		content   string
+	}{
+		{
+			name:      "think",
+			format:    FormatQwen,
+			in:        "<think>\nThe user greets me.\n</think>\n\nHello!",
+			reasoning: "The user greets me.",
+			content:   "Hello!",
+		},
+		{
+			name:      "think in prompt",
+			format:    FormatQwen,
+			in:        "The user greets me.\n</think>\nHello!",
+			reasoning: "The user greets me.",
+			content:   "Hello!",
+		},
+		{
+			name:      "unterminated think",
+			format:    FormatAuto,
+			in:        "Sure. <think>still going",
+			reasoning: "still going",
+			content:   "Sure.",
+		},
+		{
+			name:      "multiple blocks",
+			format:    FormatAuto,
+			in:        "<think>one</think>A<think>two</think>B",
+			reasoning: "one\ntwo",
+			content:   "AB",
+		},
+		{
+			name:      "gemma channel",
+			format:    FormatGemma,
+			in:        "<|channel>thought\nPlan the call.<channel|>call:get_weather{location:<|\"|>NYC<|\"|>}",
+			reasoning: "Plan the call.",
+			content:   "call:get_weather{location:<|\"|>NYC<|\"|>}",
+		},
+		{
+			name:      "gemma decoded channel",
+			format:    FormatAuto,
+			in:        "<channel>thought hmm<channel>Answer",
+			reasoning: "hmm",
+			content:   "Answer",
+		},
+		{
+			name:      "gpt-oss analysis and final",
+			format:    FormatGPT,
+			in:        "<|channel|>analysis<|message|>Simple greeting.<|end|><|start|>assistant<|channel|>final<|message|>Hello!<|return|>",
+			reasoning: "Simple greeting.",
+			content:   "Hello!",
+		},
+		{
+			name:      "gpt-oss tool call",
+			format:    FormatGPT,
+			in:        "<|channel|>analysis<|message|>Need weather.<|end|><|start|>assistant<|channel|>commentary .get_weather <|message|>{\"location\":\"NYC\"}<|call|>",
+			reasoning: "Need weather.",
+			content:   "<|channel|>commentary .get_weather <|message|>{\"location\":\"NYC\"}<|call|>",
+		},
+		{
+			name:      "gpt-oss unterminated analysis",
+			format:    FormatAuto,
+			in:        "<|channel|>analysis<|message|>Thinking",
+			reasoning: "Thinking",
+			content:   "",
+		},
+		{
+			name:      "format limits markers",
+			format:    FormatQwen,
+			in:        "<|channel>thought x<channel|>y",
+			reasoning: "",
+			content:   "<|channel>thought x<channel|>y",
+		},
+		{
+			name:      "no reasoning",
+			format:    FormatAuto,
+			in:        "  Just text. ",
+			reasoning: "",
+			content:   "Just text.",
+		},
+	}
+
+	for _, tt := range tests {
+		reasoning, content := SplitReasoning(tt.in, tt.format)
+		if reasoning != tt.reasoning {
+			t.Errorf("%s: reasoning: got %q, want %q", tt.name, reasoning, tt.reasoning)
+		}
+		if content != tt.content {
+			t.Errorf("%s: content: got %q, want %q", tt.name, content, tt.content)
+		}
+	}
+}
+
+func TestSplitReasoning_ToolCallsStillParse(t *testing.T) {
+	_, content := SplitReasoning("<think>call a tool</think><tool_call>{\"name\": \"get_weather\", \"arguments\": {\"location\": \"NYC\"}}</tool_call>", FormatAuto)
+
+	calls := ParseToolCalls(content)
+	if len(calls) != 1 || calls[0].Function.Name != "get_weather" {
+		t.Fatalf("expected the tool call to survive, got %+v", calls)
+	}
+}
@@ -50,6 +50,13 @@ func StopMarkers(vocab llama.Vocab, format Format) []string {
 			// Phi-3/4 turn-boundary tokens.
 			"<|user|>", "<|assistant|>", "<|system|>",
 		)
+	case FormatHermes:
+		markers = append(markers,
+			// Hermes models use ChatML turns.
+			"<|im_start|>", "<|im_end|>",
+		)
+	case FormatLlama3, FormatDeepSeek, FormatGranite, FormatCommandR, FormatFunctionary:
+		markers = append(markers, turnMarkers[format]...)
 	case FormatStandard, FormatAuto:
 		// Include ChatML tokens as a safety net for unknown/auto models.
 		markers = append(markers,
@@ -69,6 +76,22 @@ func StopMarkers(vocab llama.Vocab, format Format) []string {
 	return markers
 }
 
+// turnMarkers are the end-of-turn and turn-boundary tokens of formats whose
+// markers are also removed by StripMarkup.
+var turnMarkers = map[Format][]string{
+	// Llama 3 end of turn and end of message (after a <|python_tag|> call)
+	// tokens, and the header that starts the next turn.
+	FormatLlama3: {"<|eot_id|>", "<|eom_id|>", "<|start_header_id|>"},
+	// DeepSeek end of sentence token and the next user turn.
+	FormatDeepSeek: {"<｜end▁of▁sentence｜>", "<｜User｜>"},
+	// Granite end of text token and the role header of the next turn.
+	FormatGranite: {"<|end_of_text|>", "<|start_of_role|>"},
+	// Command-R end of turn token and the start of the next turn.
+	FormatCommandR: {"<|END_OF_TURN_TOKEN|>", "<|START_OF_TURN_TOKEN|>"},
+	// Functionary v3.2 is based on Llama 3.1 and shares its tokens.
+	FormatFunctionary: {"<|eot_id|>", "<|start_header_id|>"},
+}
+
 // eotMarkers returns a deduplicated list of strings for the model's EOT token.
 // It uses TokenToPiece (the decoded form that appears in the output stream) as
 // the primary value, with VocabGetText as a fallback, so the returned string
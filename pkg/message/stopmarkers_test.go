@@ -79,7 +79,7 @@ func TestStopMarkers_AllFormats_ContainToolResultMarkers(t *testing.T) {
 		`tool{"status"`,
 		"<turnend>", "<|turnend>",
 	}
-	for _, format := range []Format{FormatGemma, FormatGemma3, FormatQwen, FormatPhi, FormatStandard, FormatAuto} {
+	for _, format := range []Format{FormatGemma, FormatGemma3, FormatQwen, FormatPhi, FormatStandard, FormatAuto, FormatLlama3, FormatHermes} {
 		markers := StopMarkers(llama.Vocab(0), format)
 		for _, want := range toolMarkers {
 			if !slices.Contains(markers, want) {
@@ -109,6 +109,28 @@ func TestStopMarkers_Gemma3_DoesNotContainGemma4Tokens(t *testing.T) {
 	}
 }
 
+func TestStopMarkers_NewFormats_ContainTurnTokens(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   []string
+	}{
+		{FormatHermes, []string{"<|im_start|>", "<|im_end|>"}},
+		{FormatLlama3, []string{"<|eot_id|>", "<|eom_id|>", "<|start_header_id|>"}},
+		{FormatDeepSeek, []string{"<｜end▁of▁sentence｜>", "<｜User｜>"}},
+		{FormatGranite, []string{"<|end_of_text|>", "<|start_of_role|>"}},
+		{FormatCommandR, []string{"<|END_OF_TURN_TOKEN|>", "<|START_OF_TURN_TOKEN|>"}},
+		{FormatFunctionary, []string{"<|eot_id|>", "<|start_header_id|>"}},
+	}
+	for _, tt := range tests {
+		markers := StopMarkers(llama.Vocab(0), tt.format)
+		for _, want := range tt.want {
+			if !slices.Contains(markers, want) {
+				t.Errorf("StopMarkers(format=%v) missing %q", tt.format, want)
+			}
+		}
+	}
+}
+
 func TestDetectFormatFromPath_PhiReturnsPhi(t *testing.T) {
 	tests := []string{
 		"models/phi-4-mini-instruct-abliterated-Q4_K_M.gguf",
@@ -0,0 +1,1173 @@
+package message
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// StreamEventType identifies the kind of a StreamEvent.
+type StreamEventType int
+
+const (
+	// StreamText is a delta of plain response text.
+	StreamText StreamEventType = iota
+
+	// StreamReasoning is a delta of reasoning text from a <think> block, a
+	// <|channel>thought block or a GPT-OSS analysis message. The block
+	// markers are not included.
+	StreamReasoning
+
+	// StreamToolCallStart reports that a tool call has started and its
+	// function name is known. ToolCall holds the type and name only.
+	StreamToolCallStart
+
+	// StreamToolCallArgs is a delta of the raw argument text of the current
+	// tool call, in the syntax of the model's own grammar.
+	StreamToolCallArgs
+
+	// StreamToolCallEnd reports a complete tool call. ToolCall holds the call
+	// as parsed by the same code used by ParseToolCalls.
+	StreamToolCallEnd
+
+	// StreamToolCallDiscard reports that a started tool call could not be
+	// parsed once complete. Text holds the raw text of the block.
+	StreamToolCallDiscard
+)
+
+// StreamEvent is an event produced by a StreamParser.
+type StreamEvent struct {
+	Type     StreamEventType
+	Text     string   // text, reasoning or argument delta
+	Index    int      // index of the tool call in the response, for tool call events
+	ToolCall ToolCall // the tool call, for start and end events
+}
+
+// StreamParser parses a model response incrementally as it is generated.
+// Text deltas are passed to Write, which returns the events that can be
+// determined so far. Text that might be the beginning of a tool call or
+// reasoning marker is held back until it can be classified.
+//
+// Once the response is finished, Close flushes any held back text and
+// ToolCalls returns the same result as ParseToolCalls on the full response.
+type StreamParser struct {
+	openers []streamOpener
+	full    strings.Builder
+	pending string
+
+	reasoning string        // closing marker while in a reasoning block
+	call      *streamOpener // grammar of the current tool call block
+	block     streamBlock   // scan state of the current tool call block
+	started   bool          // whether the current call has been reported
+	argsSent  int           // offset in pending of the argument text sent
+	index     int           // index of the next tool call
+	closed    bool
+}
+
+// NewStreamParser returns a StreamParser for the given Format. FormatAuto
+// recognises every grammar that ParseToolCalls understands, while a specific
+// format only recognises the markers of that grammar, which avoids holding
+// back text that can only be a tool call in other grammars.
+func NewStreamParser(f Format) *StreamParser {
+	p := &StreamParser{}
+	for _, o := range streamOpeners {
+		if o.enabled(f) {
+			p.openers = append(p.openers, o)
+		}
+	}
+	return p
+}
+
+// Write adds a delta of generated text and returns the resulting events.
+func (p *StreamParser) Write(delta string) []StreamEvent {
+	if p.closed {
+		return nil
+	}
+
+	// pending is the end of the full response, so it grows without a copy.
+	p.full.WriteString(delta)
+	full := p.full.String()
+	p.pending = full[len(full)-len(p.pending)-len(delta):]
+
+	var events []StreamEvent
+	for p.step(&events, false) {
+	}
+	return events
+}
+
+// Close marks the end of the response and returns the remaining events.
+// An unterminated tool call is completed if it can be parsed as it is.
+func (p *StreamParser) Close() []StreamEvent {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	var events []StreamEvent
+	for p.step(&events, true) {
+	}
+	return events
+}
+
+// ToolCalls returns the tool calls in the response written so far, exactly as
+// ParseToolCalls would return them.
+func (p *StreamParser) ToolCalls() []ToolCall {
+	return ParseToolCalls(p.full.String())
+}
+
+// Text returns the full response written so far.
+func (p *StreamParser) Text() string {
+	return p.full.String()
+}
+
+// step makes one state transition, appending events. It returns true if it
+// should be called again.
+func (p *StreamParser) step(events *[]StreamEvent, final bool) bool {
+	switch {
+	case p.reasoning != "":
+		return p.stepReasoning(events, final)
+	case p.call != nil:
+		return p.stepCall(events, final)
+	default:
+		return p.stepText(events, final)
+	}
+}
+
+func (p *StreamParser) stepText(events *[]StreamEvent, final bool) bool {
+	start, at := -1, -1
+	var opener *streamOpener
+	for i := range p.openers {
+		o := &p.openers[i]
+		idx := strings.Index(p.pending, o.marker)
+		if idx == -1 {
+			continue
+		}
+		s := idx
+		if o.back != nil {
+			s -= o.back(p.pending[:idx])
+		}
+		if start == -1 || s < start {
+			start, at, opener = s, idx, o
+		}
+	}
+
+	if opener != nil {
+		emit(events, StreamText, p.pending[:start])
+		if opener.reasoning != "" {
+			p.reasoning = opener.reasoning
+			p.pending = p.pending[at+len(opener.marker):]
+			return true
+		}
+		p.pending = p.pending[start:]
+		p.call = opener
+		p.block.reset(p.pending)
+		p.started = false
+		p.argsSent = 0
+		return true
+	}
+
+	hold := len(p.pending)
+	if !final {
+		for _, o := range p.openers {
+			s := len(p.pending) - partialSuffix(p.pending, o.marker)
+			if o.back != nil {
+				s -= o.back(p.pending[:s])
+			}
+			hold = min(hold, s)
+		}
+	}
+	emit(events, StreamText, p.pending[:hold])
+	p.pending = p.pending[hold:]
+	return false
+}
+
+func (p *StreamParser) stepReasoning(events *[]StreamEvent, final bool) bool {
+	if idx := strings.Index(p.pending, p.reasoning); idx >= 0 {
+		emit(events, StreamReasoning, p.pending[:idx])
+		p.pending = p.pending[idx+len(p.reasoning):]
+		p.reasoning = ""
+		return true
+	}
+
+	hold := len(p.pending)
+	if !final {
+		hold -= partialSuffix(p.pending, p.reasoning)
+	}
+	emit(events, StreamReasoning, p.pending[:hold])
+	p.pending = p.pending[hold:]
+	return false
+}
+
+func (p *StreamParser) stepCall(events *[]StreamEvent, final bool) bool {
+	p.block.text = p.pending
+	sc := p.call.scan(&p.block)
+	if final && sc.end == -1 {
+		sc.end = len(p.pending)
+		if sc.args >= 0 {
+			sc.argsEnd = len(p.pending)
+		}
+	}
+
+	if sc.notCall {
+		// Not a tool call after all: pass the text through, including at
+		// least the marker so it is not matched again.
+		end := max(sc.end, strings.Index(p.pending, p.call.marker)+len(p.call.marker))
+		emit(events, StreamText, p.pending[:end])
+		p.pending = p.pending[end:]
+		p.call = nil
+		return true
+	}
+	if sc.drop {
+		p.pending = p.pending[sc.end:]
+		p.call = nil
+		return true
+	}
+	if sc.reasoning != "" {
+		p.pending = p.pending[sc.end:]
+		p.call = nil
+		p.reasoning = sc.reasoning
+		return true
+	}
+
+	if !p.started && sc.name != "" {
+		p.start(events, sc.name)
+	}
+	if p.started {
+		p.args(events, sc)
+	}
+	if sc.end == -1 {
+		return false
+	}
+
+	block := p.pending[:sc.end]
+	calls := p.call.parse(block)
+	if len(calls) > 0 && !p.started {
+		p.start(events, calls[0].Function.Name)
+		p.args(events, sc)
+	}
+	p.pending = p.pending[sc.end:]
+	p.call = nil
+
+	switch {
+	case len(calls) > 0:
+		// Some grammars hold a list of calls in a single block.
+		for i, call := range calls {
+			if i > 0 {
+				p.start(events, call.Function.Name)
+			}
+			*events = append(*events, StreamEvent{Type: StreamToolCallEnd, Index: p.index, ToolCall: call})
+			p.index++
+		}
+	case p.started:
+		*events = append(*events, StreamEvent{Type: StreamToolCallDiscard, Index: p.index, Text: block})
+		p.index++
+	default:
+		emit(events, StreamText, block)
+	}
+	return true
+}
+
+func (p *StreamParser) start(events *[]StreamEvent, name string) {
+	p.started = true
+	*events = append(*events, StreamEvent{
+		Type:     StreamToolCallStart,
+		Index:    p.index,
+		ToolCall: ToolCall{Type: "function", Function: ToolFunction{Name: name}},
+	})
+}
+
+func (p *StreamParser) args(events *[]StreamEvent, sc streamScan) {
+	if sc.args == -1 {
+		return
+	}
+	from := max(p.argsSent, sc.args)
+	if sc.argsEnd > from {
+		*events = append(*events, StreamEvent{Type: StreamToolCallArgs, Index: p.index, Text: p.pending[from:sc.argsEnd]})
+		p.argsSent = sc.argsEnd
+	}
+}
+
+// emit appends a text or reasoning event, skipping empty deltas.
+func emit(events *[]StreamEvent, typ StreamEventType, text string) {
+	if text != "" {
+		*events = append(*events, StreamEvent{Type: typ, Text: text})
+	}
+}
+
+// streamOpener describes a marker that opens a reasoning block or a tool call.
+type streamOpener struct {
+	marker  string
+	formats []Format // formats using the marker, all formats when empty
+
+	// reasoning is the closing marker of a reasoning block.
+	reasoning string
+
+	// back returns the length of the text just before the marker that
+	// belongs to the call, for grammars that put the name first.
+	back func(before string) int
+
+	// scan inspects a call block starting at the opener.
+	scan func(b *streamBlock) streamScan
+
+	// parse parses a complete call block.
+	parse func(block string) []ToolCall
+}
+
+func (o streamOpener) enabled(f Format) bool {
+	if f == FormatPhi || f == FormatHermes {
+		f = FormatStandard
+	}
+	if len(o.formats) == 0 || f == FormatAuto || f == FormatGemma3 {
+		return true
+	}
+	for _, of := range o.formats {
+		if of == f {
+			return true
+		}
+	}
+	return false
+}
+
+// streamScan is the state of a partial tool call block.
+type streamScan struct {
+	name    string // function name, empty until known
+	args    int    // start of the argument text, -1 until known
+	argsEnd int    // end of the argument text that is known so far
+	end     int    // end of the block, -1 until complete
+	notCall bool   // the block turned out not to be a tool call; end is set
+	drop    bool   // the block up to end is markup to remove; end is set
+
+	// reasoning is set when the block up to end is the header of a
+	// reasoning block, which ends with the reasoning marker.
+	reasoning string
+}
+
+// streamBlock is the text of the current tool call block, which grows with
+// each Write while its start stays put. Its search methods keep their
+// progress between scans, keyed by where they start, so that each byte of a
+// long block is only scanned once.
+type streamBlock struct {
+	text     string
+	searches map[blockSearch]*blockProgress
+}
+
+// blockSearch identifies a search in a streamBlock.
+type blockSearch struct {
+	kind byte // 'i' index, 'o' JSON object, 'v' JSON value, 'm' member, 'g' Gemma braces
+	from int
+	s    string
+}
+
+// blockProgress is the state of a search, to resume it when the block grows.
+type blockProgress struct {
+	pos      int  // where to resume
+	depth    int  // nesting depth of braces and brackets
+	inString bool // inside a JSON string
+	done     bool // result is final
+	result   int
+
+	strStart int    // member: start of the string it is in
+	key      string // member: the last string at depth 1
+	afterKey bool   // member: a colon may follow key
+	found    bool   // member: key and its colon were seen
+
+	quote     string // Gemma: the quote token of the string it is in
+	jsonQuote bool   // Gemma: strings use JSON quotes
+}
+
+func (b *streamBlock) reset(text string) {
+	b.text = text
+	clear(b.searches)
+}
+
+func (b *streamBlock) progress(kind byte, from int, s string) *blockProgress {
+	if b.searches == nil {
+		b.searches = make(map[blockSearch]*blockProgress)
+	}
+	key := blockSearch{kind, from, s}
+	p := b.searches[key]
+	if p == nil {
+		p = &blockProgress{pos: from, result: -1}
+		b.searches[key] = p
+	}
+	return p
+}
+
+// index returns the index of the first marker at or after from, or -1.
+func (b *streamBlock) index(from int, marker string) int {
+	p := b.progress('i', from, marker)
+	if p.done || p.pos > len(b.text) {
+		return p.result
+	}
+	if idx := strings.Index(b.text[p.pos:], marker); idx >= 0 {
+		p.done, p.result = true, p.pos+idx
+		return p.result
+	}
+	p.pos = max(p.pos, len(b.text)-len(marker)+1)
+	return -1
+}
+
+// jsonEnd returns the index one past the end of the first complete JSON
+// object at or after from, like findJSONObjectEnd, or -1. If values is set,
+// the block must hold a JSON object or array at from, like findJSONValueEnd.
+func (b *streamBlock) jsonEnd(from int, values bool) int {
+	kind := byte('o')
+	if values {
+		kind = 'v'
+	}
+	p := b.progress(kind, from, "")
+	if p.done {
+		return p.result
+	}
+	if values && p.pos == from {
+		if from >= len(b.text) {
+			return -1
+		}
+		if c := b.text[from]; c != '{' && c != '[' {
+			p.done = true
+			return -1
+		}
+	}
+
+	i := p.pos
+	for ; i < len(b.text); i++ {
+		c := b.text[i]
+		if p.inString {
+			if c == '\\' {
+				i++ // skip escaped character
+			} else if c == '"' {
+				p.inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			p.inString = true
+		case c == '{' || (values && c == '['):
+			p.depth++
+		case c == '}' || (values && c == ']'):
+			p.depth--
+			if p.depth == 0 {
+				p.done, p.result = true, i+1
+				return p.result
+			}
+		}
+	}
+	p.pos = i
+	return -1
+}
+
+// member returns the index of the value of the top-level member key in the
+// JSON object that starts at from, or -1 if it has not been seen yet.
+func (b *streamBlock) member(from int, key string) int {
+	p := b.progress('m', from, key)
+	if p.done {
+		return p.result
+	}
+
+	i := p.pos
+	for ; i < len(b.text); i++ {
+		c := b.text[i]
+		if p.inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				p.inString = false
+				p.afterKey = p.depth == 1
+				p.key = b.text[p.strStart:i]
+			}
+			continue
+		}
+		if (c == ' ' || c == '\t' || c == '\r' || c == '\n') && (p.afterKey || p.found) {
+			continue
+		}
+		if p.found {
+			p.done, p.result = true, i
+			return i
+		}
+		if p.afterKey {
+			p.afterKey = false
+			if c == ':' {
+				p.found = p.key == key
+				continue
+			}
+		}
+		switch c {
+		case '"':
+			p.inString = true
+			p.strStart = i + 1
+		case '{', '[':
+			p.depth++
+		case '}', ']':
+			p.depth--
+		}
+	}
+	p.pos = i
+	return -1
+}
+
+// gemmaBraceEnd returns the index of the brace that closes the one at from,
+// like findGemmaBraceEnd, or -1. Strings use Gemma quote tokens if the block
+// has any, else JSON quotes, so the scan starts over once a quote token
+// shows up.
+func (b *streamBlock) gemmaBraceEnd(from int) int {
+	p := b.progress('g', from, "")
+	if p.done {
+		return p.result
+	}
+	gemmaQuotes := false
+	for _, tok := range gemmaQuoteTokens {
+		if b.index(from, tok) >= 0 {
+			gemmaQuotes = true
+		}
+	}
+	if p.pos == from {
+		p.jsonQuote = !gemmaQuotes
+	} else if p.jsonQuote && gemmaQuotes {
+		*p = blockProgress{pos: from, result: -1}
+	}
+
+	i := p.pos
+	for i < len(b.text) {
+		rest := b.text[i:]
+		switch {
+		case p.quote != "":
+			if strings.HasPrefix(rest, p.quote) {
+				i += len(p.quote)
+				p.quote = ""
+				continue
+			}
+			if len(rest) < len(p.quote) && strings.HasPrefix(p.quote, rest) {
+				p.pos = i
+				return -1
+			}
+			i++
+			continue
+		case p.inString:
+			if rest[0] == '\\' {
+				i += 2
+				continue
+			}
+			if rest[0] == '"' {
+				p.inString = false
+			}
+			i++
+			continue
+		}
+
+		if !p.jsonQuote {
+			quoted := false
+			for _, tok := range gemmaQuoteTokens {
+				if strings.HasPrefix(rest, tok) {
+					p.quote = tok
+					i += len(tok)
+					quoted = true
+					break
+				}
+				if len(rest) < len(tok) && strings.HasPrefix(tok, rest) {
+					p.pos = i
+					return -1
+				}
+			}
+			if quoted {
+				continue
+			}
+		}
+
+		switch {
+		case p.jsonQuote && rest[0] == '"':
+			p.inString = true
+		case rest[0] == '{':
+			p.depth++
+		case rest[0] == '}':
+			p.depth--
+			if p.depth == 0 {
+				p.done, p.result = true, i
+				return i
+			}
+		}
+		i++
+	}
+	p.pos = i
+	return -1
+}
+
+var streamOpeners = []streamOpener{
+	{marker: "<think>", reasoning: "</think>"},
+	{marker: "<|channel>thought", reasoning: "<channel|>"},
+	{marker: "<channel>thought", reasoning: "<channel>"},
+	{
+		marker:  "<tool_call>",
+		formats: []Format{FormatStandard, FormatQwen},
+		scan:    scanStandardStream("<tool_call>"),
+		parse:   parseStandardToolCalls,
+	},
+	{
+		marker:  "<|tool_call>",
+		formats: []Format{FormatStandard},
+		scan:    scanStandardStream("<|tool_call>"),
+		parse: func(block string) []ToolCall {
+			return parseStandardToolCalls(strings.Replace(block, "<|tool_call>", "<tool_call>", 1))
+		},
+	},
+	{
+		marker:  "<function=",
+		formats: []Format{FormatQwen},
+		scan:    scanQwenStream,
+		parse:   parseQwenToolCalls,
+	},
+	{
+		marker:  "[TOOL_CALLS]",
+		formats: []Format{FormatMistral},
+		scan:    scanMistralStream,
+		parse:   parseMistralToolCalls,
+	},
+	{
+		marker:  "call:",
+		formats: []Format{FormatGemma},
+		scan:    scanGemmaStream,
+		parse:   parseGemmaToolCalls,
+	},
+	{
+		marker:  "<|start|>assistant",
+		formats: []Format{FormatGPT},
+		scan:    scanHarmonyStream,
+		parse:   parseGPTToolCalls,
+	},
+	{
+		marker:  harmonyChannel,
+		formats: []Format{FormatGPT},
+		scan:    scanHarmonyStream,
+		parse:   parseGPTToolCalls,
+	},
+	{
+		marker:  harmonyMessage,
+		formats: []Format{FormatGPT},
+		back:    gptNameBefore,
+		scan:    scanGPTStream,
+		parse:   parseGPTToolCalls,
+	},
+	{
+		marker:  "<|end|>",
+		formats: []Format{FormatGPT},
+		scan:    dropMarker("<|end|>"),
+	},
+	{
+		marker:  "<|return|>",
+		formats: []Format{FormatGPT},
+		scan:    dropMarker("<|return|>"),
+	},
+	{
+		marker:  "<|call|>",
+		formats: []Format{FormatGPT},
+		scan:    dropMarker("<|call|>"),
+	},
+	{
+		marker:  "<arg_key>",
+		formats: []Format{FormatGLM},
+		back:    glmNameBefore,
+		scan:    scanGLMStream,
+		parse:   parseGLMToolCalls,
+	},
+	{
+		marker:  `{"name":`,
+		formats: []Format{FormatStandard, FormatGemma, FormatLlama3},
+		scan:    scanInlineJSONStream,
+		parse: func(block string) []ToolCall {
+			if calls := parseInlineJSONToolCalls(block); len(calls) > 0 {
+				return calls
+			}
+			if strings.Contains(block, `"parameters":`) {
+				return parseLlama3ToolCalls(block)
+			}
+			return nil
+		},
+	},
+	{
+		marker:  "<|python_tag|>",
+		formats: []Format{FormatLlama3},
+		scan:    scanLlama3Stream,
+		parse:   parseLlama3ToolCalls,
+	},
+	{
+		marker:  deepseekCallsBegin,
+		formats: []Format{FormatDeepSeek},
+		scan:    dropMarker(deepseekCallsBegin),
+	},
+	{
+		marker:  deepseekCallsEnd,
+		formats: []Format{FormatDeepSeek},
+		scan:    dropMarker(deepseekCallsEnd),
+	},
+	{
+		marker:  deepseekCallBegin,
+		formats: []Format{FormatDeepSeek},
+		scan:    scanDeepSeekStream,
+		parse:   parseDeepSeekToolCalls,
+	},
+	{
+		marker:  "<|tool_call|>",
+		formats: []Format{FormatGranite},
+		scan:    scanGraniteStream,
+		parse:   parseGraniteToolCalls,
+	},
+	{
+		marker:  commandRStartAction,
+		formats: []Format{FormatCommandR},
+		scan:    scanCommandRStream(commandRStartAction, commandREndAction),
+		parse:   parseCommandRToolCalls,
+	},
+	{
+		marker:  commandRActionFence,
+		formats: []Format{FormatCommandR},
+		scan:    scanCommandRStream(commandRActionFence, "```"),
+		parse:   parseCommandRToolCalls,
+	},
+	{
+		marker:  ">>>",
+		formats: []Format{FormatFunctionary},
+		scan:    scanFunctionaryStream,
+		parse:   parseFunctionaryToolCalls,
+	},
+}
+
+// scanStandardStream returns a scanner for <tool_call>…</tool_call> blocks
+// holding either JSON or a Qwen <function=…> block.
+func scanStandardStream(open string) func(*streamBlock) streamScan {
+	const closeTag = "</tool_call>"
+	return func(b *streamBlock) streamScan {
+		sc := streamScan{args: -1, end: -1}
+		innerEnd := len(b.text)
+		if idx := b.index(len(open), closeTag); idx >= 0 {
+			innerEnd = idx
+			sc.end = idx + len(closeTag)
+		} else {
+			innerEnd -= partialSuffix(b.text[len(open):], closeTag)
+		}
+		inner := b.text[len(open):innerEnd]
+
+		var s streamScan
+		if idx := b.index(len(open), "<function="); idx >= 0 && idx+len("<function=") <= innerEnd && !strings.HasPrefix(strings.TrimSpace(inner), "{") {
+			s = scanQwenAt(b, idx, innerEnd)
+		} else {
+			s = scanJSONMembersAt(b, len(open), innerEnd, "name", jsonCallArgKeys...)
+		}
+		sc.name, sc.args, sc.argsEnd = s.name, s.args, s.argsEnd
+		return sc
+	}
+}
+
+// jsonCallArgKeys are the members that hold the arguments of a JSON call.
+var jsonCallArgKeys = []string{"arguments", "args", "parameters"}
+
+// scanJSONMembersAt scans a JSON tool call object that starts at from and
+// ends by limit, with the name in the member nameKey and the arguments in the
+// first of argKeys that is present.
+func scanJSONMembersAt(b *streamBlock, from, limit int, nameKey string, argKeys ...string) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	if v := b.member(from, nameKey); v >= 0 && v < limit {
+		sc.name = jsonStringValue(b.text[v:limit])
+	}
+	for _, key := range argKeys {
+		if v := b.member(from, key); v >= 0 && v < limit {
+			sc.args, sc.argsEnd = v, limit
+			if end := b.jsonEnd(v, false); end >= 0 && end <= limit {
+				sc.argsEnd = end
+			}
+			break
+		}
+	}
+	if end := b.jsonEnd(from, false); end >= 0 && end <= limit {
+		sc.end = end
+	}
+	return sc
+}
+
+// scanInlineJSONStream scans a bare JSON tool call object. The call is only
+// reported once an arguments member is seen, so that other JSON objects with
+// a "name" member pass through as text.
+func scanInlineJSONStream(b *streamBlock) streamScan {
+	sc := scanJSONMembersAt(b, 0, len(b.text), "name", jsonCallArgKeys...)
+	if sc.args == -1 || strings.ContainsAny(sc.name, " \t\n") {
+		sc.name = ""
+	}
+	return sc
+}
+
+// scanQwenStream scans a <function=name>…</function> block.
+func scanQwenStream(b *streamBlock) streamScan {
+	return scanQwenAt(b, 0, len(b.text))
+}
+
+// scanQwenAt scans a <function=name>…</function> block that starts at from
+// and ends by limit.
+func scanQwenAt(b *streamBlock, from, limit int) streamScan {
+	const closeTag = "</function>"
+	sc := streamScan{args: -1, end: -1}
+	gt := b.index(from, ">")
+	if gt == -1 || gt >= limit {
+		return sc
+	}
+	sc.name = strings.TrimSpace(b.text[from+len("<function=") : gt])
+	sc.args = gt + 1
+	if idx := b.index(sc.args, closeTag); idx >= 0 && idx+len(closeTag) <= limit {
+		sc.argsEnd = idx
+		sc.end = idx + len(closeTag)
+	} else {
+		sc.argsEnd = limit - partialSuffix(b.text[sc.args:limit], closeTag)
+	}
+	return sc
+}
+
+// scanMistralStream scans a [TOOL_CALLS]name[ARGS]{…} block.
+func scanMistralStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	idx := b.index(0, "[ARGS]")
+	if idx == -1 {
+		return sc
+	}
+	sc.name = strings.TrimSpace(b.text[len("[TOOL_CALLS]"):idx])
+	return scanJSONArgs(b, idx+len("[ARGS]"), sc)
+}
+
+// scanGemmaStream scans a call:name{…} block. Text such as "recall: it",
+// where the marker is not directly followed by a function name, is passed
+// through.
+func scanGemmaStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	idx := b.index(len("call:"), "{")
+	name := b.text[len("call:"):]
+	if idx >= 0 {
+		name = b.text[len("call:"):idx]
+	}
+	if !isFunctionName(strings.TrimRight(name, " ")) {
+		sc.notCall, sc.end = true, len("call:")
+		return sc
+	}
+	if idx == -1 {
+		return sc
+	}
+
+	sc.name = strings.TrimSpace(name)
+	sc.args, sc.argsEnd = idx, len(b.text)
+	if end := b.gemmaBraceEnd(idx); end >= 0 {
+		sc.argsEnd = end + 1
+		sc.end = sc.argsEnd
+	}
+	return sc
+}
+
+// scanGPTStream scans a .name <|message|>{…} block. A <|message|> marker
+// without a name before it is passed through as text.
+func scanGPTStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	idx := b.index(0, harmonyMessage)
+	sc.name, _ = gptRecipient(b.text[:idx])
+	if sc.name == "" {
+		sc.notCall, sc.end = true, idx+len(harmonyMessage)
+		return sc
+	}
+	return scanJSONArgs(b, idx+len(harmonyMessage), sc)
+}
+
+// maxHarmonyHeader is the length after which a harmony header that has not
+// reached its <|message|> marker is taken for text.
+const maxHarmonyHeader = 256
+
+// scanHarmonyStream scans a GPT-OSS harmony message that starts with a
+// <|start|>assistant or <|channel|> header. A header addressed to
+// functions.name opens a tool call, whose name is reported as soon as the
+// header has moved past it. The header of an analysis message opens a
+// reasoning block, and that of other messages is removed so that their
+// content streams as text.
+func scanHarmonyStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	msg := b.index(0, harmonyMessage)
+	header := b.text
+	if msg >= 0 {
+		header = b.text[:msg]
+	}
+	if strings.Contains(header, "\n") || (msg == -1 && len(header) > maxHarmonyHeader) {
+		sc.notCall, sc.end = true, 0
+		return sc
+	}
+
+	name, complete := gptRecipient(header)
+	if msg == -1 {
+		if complete {
+			sc.name = name
+		}
+		return sc
+	}
+
+	sc.end = msg + len(harmonyMessage)
+	switch {
+	case name != "":
+		sc.name = name
+		return scanJSONArgs(b, sc.end, sc)
+	case harmonyChannelName(header) == "analysis":
+		sc.reasoning = "<|end|>"
+	default:
+		sc.drop = true
+	}
+	return sc
+}
+
+// scanJSONArgs scans JSON arguments that start at args and end the block.
+func scanJSONArgs(b *streamBlock, args int, sc streamScan) streamScan {
+	sc.args, sc.argsEnd, sc.end = args, len(b.text), -1
+	if end := b.jsonEnd(args, false); end >= 0 {
+		sc.argsEnd = end
+		sc.end = end
+	}
+	return sc
+}
+
+// harmonyChannelName returns the channel named in a harmony header.
+func harmonyChannelName(header string) string {
+	idx := strings.LastIndex(header, harmonyChannel)
+	if idx == -1 {
+		return ""
+	}
+	name := header[idx+len(harmonyChannel):]
+	if end := strings.IndexAny(name, " <"); end >= 0 {
+		name = name[:end]
+	}
+	return name
+}
+
+// scanGLMStream scans a name<arg_key>…</arg_value> line.
+func scanGLMStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	idx := b.index(0, "<arg_key>")
+	sc.name = strings.TrimSpace(b.text[:idx])
+	sc.args, sc.argsEnd = idx, len(b.text)
+	if nl := b.index(0, "\n"); nl >= 0 {
+		sc.argsEnd = nl
+		sc.end = nl + 1
+	}
+	return sc
+}
+
+// dropMarker returns a scanner that removes marker from the text.
+func dropMarker(marker string) func(*streamBlock) streamScan {
+	return func(*streamBlock) streamScan {
+		return streamScan{args: -1, end: len(marker), drop: true}
+	}
+}
+
+// scanLlama3Stream scans a <|python_tag|> call, either JSON or a built-in
+// tool call such as brave_search.call(query="…").
+func scanLlama3Stream(b *streamBlock) streamScan {
+	block := b.text
+	inner := block[len("<|python_tag|>"):]
+	off := len(block) - len(strings.TrimLeft(inner, " \t\r\n"))
+	if off == len(block) {
+		return streamScan{args: -1, end: -1}
+	}
+
+	if block[off] == '{' {
+		return scanJSONMembersAt(b, off, len(block), "name", jsonCallArgKeys...)
+	}
+
+	sc := streamScan{args: -1, end: -1}
+	if idx := b.index(off, ".call("); idx >= 0 {
+		sc.name = block[off:idx]
+		sc.args, sc.argsEnd = idx+len(".call"), len(block)
+	}
+	for _, tok := range llama3EndTokens {
+		if idx := b.index(0, tok); idx >= 0 {
+			sc.argsEnd = min(sc.argsEnd, idx)
+			sc.end = idx + len(tok)
+		}
+	}
+	return sc
+}
+
+// scanDeepSeekStream scans a <｜tool▁call▁begin｜>…<｜tool▁call▁end｜> block.
+func scanDeepSeekStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	sep := b.index(0, deepseekSep)
+	if sep == -1 {
+		return sc
+	}
+
+	sc.name = strings.TrimSpace(b.text[len(deepseekCallBegin):sep])
+	sc.args = sep + len(deepseekSep)
+	if sc.name == "function" {
+		nl := b.index(sc.args, "\n")
+		if nl == -1 {
+			sc.name, sc.args = "", -1
+			return sc
+		}
+		sc.name = strings.TrimSpace(b.text[sc.args:nl])
+		sc.args = nl + 1
+	}
+
+	if idx := b.index(sc.args, deepseekCallEnd); idx >= 0 {
+		sc.argsEnd = idx
+		sc.end = sc.argsEnd + len(deepseekCallEnd)
+	} else {
+		sc.argsEnd = len(b.text) - partialSuffix(b.text, deepseekCallEnd)
+	}
+	return sc
+}
+
+// scanGraniteStream scans a <|tool_call|>[…] list, reporting the first call.
+func scanGraniteStream(b *streamBlock) streamScan {
+	return scanJSONListStream(b, len("<|tool_call|>"), "name", "arguments")
+}
+
+// scanJSONListStream scans a JSON list of tool call objects that starts at
+// offset from in the block, reporting the name and arguments of the first
+// call. The block ends with the list.
+func scanJSONListStream(b *streamBlock, from int, nameKey string, argKeys ...string) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	block := b.text
+	off := len(block) - len(strings.TrimLeft(block[from:], " \t\r\n"))
+	if off == len(block) {
+		return sc
+	}
+	if block[off] != '[' {
+		sc.notCall, sc.end = true, from
+		return sc
+	}
+
+	if idx := b.index(off, "{"); idx >= 0 {
+		s := scanJSONMembersAt(b, idx, len(block), nameKey, argKeys...)
+		sc.name, sc.args, sc.argsEnd = s.name, s.args, s.argsEnd
+	}
+	if end := b.jsonEnd(off, true); end >= 0 {
+		sc.end = end
+	}
+	return sc
+}
+
+// scanCommandRStream returns a scanner for Command-R action blocks that start
+// with open and end with closeMarker, reporting the first call.
+func scanCommandRStream(open, closeMarker string) func(*streamBlock) streamScan {
+	return func(b *streamBlock) streamScan {
+		sc := scanJSONListStream(b, len(open), "tool_name", "parameters")
+		sc.notCall = false
+		sc.end = -1
+		if idx := b.index(len(open), closeMarker); idx >= 0 {
+			sc.end = idx + len(closeMarker)
+			sc.argsEnd = min(sc.argsEnd, idx)
+		}
+		return sc
+	}
+}
+
+// scanFunctionaryStream scans a >>>name\n{…} segment. A >>>all segment is
+// plain text, so only its header is removed.
+func scanFunctionaryStream(b *streamBlock) streamScan {
+	sc := streamScan{args: -1, end: -1}
+	block := b.text
+	nl := b.index(0, "\n")
+	name := block[len(">>>"):]
+	if nl >= 0 {
+		name = block[len(">>>"):nl]
+	}
+	if !isFunctionName(name) || (nl >= 0 && name == "") {
+		sc.notCall, sc.end = true, len(">>>")
+		return sc
+	}
+	if nl == -1 {
+		return sc
+	}
+	if name == functionaryTextRecipient {
+		sc.drop, sc.end = true, nl+1
+		return sc
+	}
+
+	sc.name = name
+	off := len(block) - len(strings.TrimLeft(block[nl+1:], " \t\r\n"))
+	if off == len(block) {
+		return sc
+	}
+	if block[off] != '{' {
+		sc.end = off
+		return sc
+	}
+	return scanJSONArgs(b, off, sc)
+}
+
+// gptNameBefore returns the length of a trailing ".name " in before.
+func gptNameBefore(before string) int {
+	trimmed := strings.TrimRight(before, " ")
+	start := len(trimmed)
+	for start > 0 && isFunctionNameChar(trimmed[start-1]) {
+		start--
+	}
+	if !strings.HasPrefix(trimmed[start:], ".") {
+		return 0
+	}
+	return len(before) - start
+}
+
+// glmNameBefore returns the length of a function name at the start of the
+// last line of before.
+func glmNameBefore(before string) int {
+	line := before[strings.LastIndex(before, "\n")+1:]
+	if !isFunctionName(strings.TrimLeft(line, " \t")) {
+		return 0
+	}
+	return len(line)
+}
+
+// isFunctionName reports whether s only holds characters used in function
+// names. The empty string is accepted, since it may be the start of a name.
+func isFunctionName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isFunctionNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFunctionNameChar reports whether c may appear in a function name.
+func isFunctionNameChar(c byte) bool {
+	return isWordChar(c) || c == '-' || c == '.'
+}
+
+// partialSuffix returns the length of the longest suffix of s that is a
+// proper prefix of marker.
+func partialSuffix(s, marker string) int {
+	for n := min(len(s), len(marker)-1); n > 0; n-- {
+		if strings.HasSuffix(s, marker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// jsonStringValue decodes the JSON string at the start of s, returning "" if
+// it is not a complete string.
+func jsonStringValue(s string) string {
+	if !strings.HasPrefix(s, `"`) {
+		return ""
+	}
+	end := jsonStringEnd(s[1:])
+	if end == -1 {
+		return ""
+	}
+	var str string
+	if err := json.Unmarshal([]byte(s[:end+2]), &str); err != nil {
+		return ""
+	}
+	return str
+}
+
+// jsonStringEnd returns the index of the unescaped quote that ends the JSON
+// string whose contents start s, or -1 if the string is not complete.
+func jsonStringEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,496 @@
+package message
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// streamResult collects the events of a StreamParser fed one byte at a time.
+type streamResult struct {
+	text      string
+	reasoning string
+	args      map[int]string
+	started   []string
+	calls     []ToolCall
+	discarded []string
+	events    []StreamEvent
+}
+
+func streamBytes(f Format, response string) streamResult {
+	p := NewStreamParser(f)
+	var events []StreamEvent
+	for i := 0; i < len(response); i++ {
+		events = append(events, p.Write(response[i:i+1])...)
+	}
+	events = append(events, p.Close()...)
+
+	r := streamResult{args: make(map[int]string), events: events}
+	for _, ev := range events {
+		switch ev.Type {
+		case StreamText:
+			r.text += ev.Text
+		case StreamReasoning:
+			r.reasoning += ev.Text
+		case StreamToolCallStart:
+			r.started = append(r.started, ev.ToolCall.Function.Name)
+		case StreamToolCallArgs:
+			r.args[ev.Index] += ev.Text
+		case StreamToolCallEnd:
+			r.calls = append(r.calls, ev.ToolCall)
+		case StreamToolCallDiscard:
+			r.discarded = append(r.discarded, ev.Text)
+		}
+	}
+	return r
+}
+
+func TestStreamParser_MatchesBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		response string
+		text     string
+		args     string
+	}{
+		{
+			name:     "standard",
+			format:   FormatStandard,
+			response: `Checking. <tool_call>{"name": "get_weather", "arguments": {"location": "NYC"}}</tool_call>`,
+			text:     "Checking. ",
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "phi",
+			format:   FormatPhi,
+			response: `<|tool_call>{"name": "get_weather", "arguments": {"location": "NYC"}}</tool_call>`,
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "qwen",
+			format:   FormatQwen,
+			response: "Sure.\n<function=get_weather>\n<parameter=location>\nNYC\n</parameter>\n</function>",
+			text:     "Sure.\n",
+			args:     "\n<parameter=location>\nNYC\n</parameter>\n",
+		},
+		{
+			name:     "qwen in tool_call",
+			format:   FormatQwen,
+			response: "<tool_call>\n<function=get_weather>\n<parameter=location>\nNYC\n</parameter>\n</function>\n</tool_call>",
+			args:     "\n<parameter=location>\nNYC\n</parameter>\n",
+		},
+		{
+			name:     "glm",
+			format:   FormatGLM,
+			response: "get_weather<arg_key>location</arg_key><arg_value>NYC</arg_value>",
+			args:     "<arg_key>location</arg_key><arg_value>NYC</arg_value>",
+		},
+		{
+			name:     "mistral",
+			format:   FormatMistral,
+			response: `[TOOL_CALLS]get_weather[ARGS]{"location": "NYC"}`,
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "gemma",
+			format:   FormatGemma,
+			response: `call:get_weather{location:<|"|>NYC<|"|>}`,
+			args:     `{location:<|"|>NYC<|"|>}`,
+		},
+		{
+			name:     "gpt",
+			format:   FormatGPT,
+			response: `.get_weather <|message|>{"location": "NYC"}`,
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "inline json",
+			format:   FormatGemma,
+			response: `{"name":"get_weather","args":{"location":"NYC"}}`,
+			args:     `{"location":"NYC"}`,
+		},
+		{
+			name:     "llama3",
+			format:   FormatLlama3,
+			response: `<|python_tag|>{"name": "get_weather", "parameters": {"location": "NYC"}}`,
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "llama3 without python tag",
+			format:   FormatLlama3,
+			response: `{"name": "get_weather", "parameters": {"location": "NYC"}}`,
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "deepseek",
+			format:   FormatDeepSeek,
+			response: "<｜tool▁calls▁begin｜><｜tool▁call▁begin｜>function<｜tool▁sep｜>get_weather\n```json\n{\"location\": \"NYC\"}\n```<｜tool▁call▁end｜><｜tool▁calls▁end｜>",
+			args:     "```json\n{\"location\": \"NYC\"}\n```",
+		},
+		{
+			name:     "granite",
+			format:   FormatGranite,
+			response: `<|tool_call|>[{"name": "get_weather", "arguments": {"location": "NYC"}}]`,
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "command-r",
+			format:   FormatCommandR,
+			response: "Action: ```json\n[{\"tool_name\": \"get_weather\", \"parameters\": {\"location\": \"NYC\"}}]\n```",
+			args:     `{"location": "NYC"}`,
+		},
+		{
+			name:     "functionary",
+			format:   FormatFunctionary,
+			response: ">>>all\nLet me check.>>>get_weather\n{\"location\": \"NYC\"}",
+			text:     "Let me check.",
+			args:     `{"location": "NYC"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, f := range []Format{tt.format, FormatAuto} {
+			r := streamBytes(f, tt.response)
+			want := ParseToolCalls(tt.response)
+
+			if len(want) == 0 {
+				t.Fatalf("%s: batch parser found no calls", tt.name)
+			}
+			if !reflect.DeepEqual(r.calls, want) {
+				t.Errorf("%s (format %d): calls: got %+v, want %+v", tt.name, f, r.calls, want)
+			}
+			if len(r.started) != 1 || r.started[0] != "get_weather" {
+				t.Errorf("%s (format %d): started: got %v", tt.name, f, r.started)
+			}
+			if r.args[0] != tt.args {
+				t.Errorf("%s (format %d): args: got %q, want %q", tt.name, f, r.args[0], tt.args)
+			}
+			if r.text != tt.text {
+				t.Errorf("%s (format %d): text: got %q, want %q", tt.name, f, r.text, tt.text)
+			}
+		}
+	}
+}
+
+func TestStreamParser_EventOrder(t *testing.T) {
+	r := streamBytes(FormatAuto, `<tool_call>{"name": "get_weather", "arguments": {"location": "NYC"}}</tool_call>`)
+
+	var types []StreamEventType
+	for _, ev := range r.events {
+		if len(types) == 0 || types[len(types)-1] != ev.Type {
+			types = append(types, ev.Type)
+		}
+	}
+	want := []StreamEventType{StreamToolCallStart, StreamToolCallArgs, StreamToolCallEnd}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("event order: got %v, want %v", types, want)
+	}
+}
+
+func TestStreamParser_CompletesBeforeClose(t *testing.T) {
+	p := NewStreamParser(FormatMistral)
+
+	var ended bool
+	for _, ev := range p.Write(`[TOOL_CALLS]get_weather[ARGS]{"location": "NYC"}`) {
+		if ev.Type == StreamToolCallEnd {
+			ended = true
+		}
+	}
+	if !ended {
+		t.Fatal("expected the call to complete without waiting for Close")
+	}
+}
+
+func TestStreamParser_MultipleCalls(t *testing.T) {
+	response := `[TOOL_CALLS]get_weather[ARGS]{"location": "NYC"}[TOOL_CALLS]get_time[ARGS]{"timezone": "UTC"}`
+
+	r := streamBytes(FormatAuto, response)
+
+	if !reflect.DeepEqual(r.calls, ParseToolCalls(response)) {
+		t.Fatalf("calls: got %+v", r.calls)
+	}
+	if !reflect.DeepEqual(r.started, []string{"get_weather", "get_time"}) {
+		t.Errorf("started: got %v", r.started)
+	}
+	if r.args[1] != `{"timezone": "UTC"}` {
+		t.Errorf("args: got %q", r.args[1])
+	}
+}
+
+func TestStreamParser_MultipleCallsInOneBlock(t *testing.T) {
+	response := `<|tool_call|>[{"name": "get_weather", "arguments": {"location": "NYC"}}, {"name": "get_time", "arguments": {"timezone": "UTC"}}]`
+
+	r := streamBytes(FormatGranite, response)
+
+	if !reflect.DeepEqual(r.calls, ParseToolCalls(response)) {
+		t.Fatalf("calls: got %+v", r.calls)
+	}
+	if !reflect.DeepEqual(r.started, []string{"get_weather", "get_time"}) {
+		t.Errorf("started: got %v", r.started)
+	}
+	if r.calls[1].Function.Arguments["timezone"] != "UTC" {
+		t.Errorf("timezone: got %q", r.calls[1].Function.Arguments["timezone"])
+	}
+}
+
+func TestStreamParser_Reasoning(t *testing.T) {
+	response := "<think>The user wants weather.</think>Let me check.<|channel>thought more<channel|> Done."
+
+	r := streamBytes(FormatAuto, response)
+
+	if r.reasoning != "The user wants weather. more" {
+		t.Errorf("reasoning: got %q", r.reasoning)
+	}
+	if r.text != "Let me check. Done." {
+		t.Errorf("text: got %q", r.text)
+	}
+}
+
+func TestStreamParser_UnterminatedReasoning(t *testing.T) {
+	r := streamBytes(FormatAuto, "<think>still thinking")
+
+	if r.reasoning != "still thinking" || r.text != "" {
+		t.Errorf("got reasoning %q, text %q", r.reasoning, r.text)
+	}
+}
+
+func TestStreamParser_Harmony(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		reasoning string
+		text      string
+		call      string
+	}{
+		{
+			name:      "tool call",
+			response:  `<|channel|>analysis<|message|>User asks weather in Paris. Need to call tool.<|end|><|start|>assistant<|channel|>commentary to=functions.get_weather <|constrain|>json<|message|>{"location":"Paris"}<|call|>`,
+			reasoning: "User asks weather in Paris. Need to call tool.",
+			call:      "get_weather",
+		},
+		{
+			name:      "tool call without constrain",
+			response:  `<|channel|>analysis<|message|>Need the weather.<|end|><|start|>assistant<|channel|>commentary to=functions.get_weather<|message|>{"location":"Paris"}<|call|>`,
+			reasoning: "Need the weather.",
+			call:      "get_weather",
+		},
+		{
+			name:     "recipient before channel",
+			response: `<|start|>assistant to=functions.get_weather<|channel|>commentary json<|message|>{"location":"Paris"}<|call|>`,
+			call:     "get_weather",
+		},
+		{
+			name:      "final answer",
+			response:  `<|channel|>analysis<|message|>Simple greeting. Reply politely.<|end|><|start|>assistant<|channel|>final<|message|>Hello! How can I help you today?<|return|>`,
+			reasoning: "Simple greeting. Reply politely.",
+			text:      "Hello! How can I help you today?",
+		},
+		{
+			name:     "commentary preamble",
+			response: `<|channel|>commentary<|message|>Checking the weather.<|end|><|start|>assistant<|channel|>commentary to=functions.get_weather <|constrain|>json<|message|>{"location":"Paris"}<|call|>`,
+			text:     "Checking the weather.",
+			call:     "get_weather",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, f := range []Format{FormatGPT, FormatAuto} {
+			p := NewStreamParser(f)
+			var r streamResult
+			for i := 0; i < len(tt.response); i += 3 {
+				for _, ev := range p.Write(tt.response[i:min(i+3, len(tt.response))]) {
+					switch ev.Type {
+					case StreamText:
+						r.text += ev.Text
+					case StreamReasoning:
+						r.reasoning += ev.Text
+					case StreamToolCallStart:
+						r.started = append(r.started, ev.ToolCall.Function.Name)
+					case StreamToolCallEnd:
+						r.calls = append(r.calls, ev.ToolCall)
+					}
+				}
+			}
+			closing := p.Close()
+
+			if r.reasoning != tt.reasoning {
+				t.Errorf("%s (format %d): reasoning: got %q, want %q", tt.name, f, r.reasoning, tt.reasoning)
+			}
+			if r.text != tt.text {
+				t.Errorf("%s (format %d): text: got %q, want %q", tt.name, f, r.text, tt.text)
+			}
+			if tt.call == "" {
+				if len(r.started) != 0 || len(r.calls) != 0 || len(ParseToolCalls(tt.response)) != 0 {
+					t.Errorf("%s (format %d): got calls %v, want none", tt.name, f, r.started)
+				}
+			} else {
+				if !reflect.DeepEqual(r.started, []string{tt.call}) {
+					t.Errorf("%s (format %d): started: got %v", tt.name, f, r.started)
+				}
+				if want := ParseToolCalls(tt.response); len(want) != 1 || !reflect.DeepEqual(r.calls, want) {
+					t.Errorf("%s (format %d): calls: got %+v, want %+v", tt.name, f, r.calls, want)
+				}
+			}
+			if len(closing) != 0 {
+				t.Errorf("%s (format %d): events left for Close: %+v", tt.name, f, closing)
+			}
+		}
+	}
+}
+
+func TestStreamParser_HarmonyEarlyStart(t *testing.T) {
+	p := NewStreamParser(FormatGPT)
+
+	var started bool
+	for _, ev := range p.Write(`<|start|>assistant<|channel|>commentary to=functions.get_weather <|constrain|>json`) {
+		if ev.Type == StreamToolCallStart && ev.ToolCall.Function.Name == "get_weather" {
+			started = true
+		}
+	}
+	if !started {
+		t.Fatal("expected the call to start once the recipient is known")
+	}
+}
+
+func TestStreamParser_PlainText(t *testing.T) {
+	responses := []string{
+		"The value of pi is 3.14. Please recall: it is irrational.",
+		`The user is {"name": "Bob", "age": 42} in the database.`,
+		"Use a <b>bold</b> tag [like this].",
+		"first line\nsecond line",
+	}
+
+	for _, response := range responses {
+		r := streamBytes(FormatAuto, response)
+		if r.text != response {
+			t.Errorf("text: got %q, want %q", r.text, response)
+		}
+		if len(r.started) != 0 || len(r.calls) != 0 {
+			t.Errorf("%q: unexpected tool calls %v %v", response, r.started, r.calls)
+		}
+	}
+}
+
+func TestStreamParser_HoldsBackPartialMarker(t *testing.T) {
+	p := NewStreamParser(FormatStandard)
+
+	events := p.Write("Hello <tool_")
+	if len(events) != 1 || events[0].Text != "Hello " {
+		t.Fatalf("expected only the text before the partial marker, got %+v", events)
+	}
+
+	events = p.Write("box>")
+	if len(events) != 1 || events[0].Text != "<tool_box>" {
+		t.Fatalf("expected the held back text once it is not a marker, got %+v", events)
+	}
+}
+
+func TestStreamParser_UnclosedStandard(t *testing.T) {
+	response := `<tool_call>{"name": "get_weather", "arguments": {"location": "NYC"}}`
+
+	r := streamBytes(FormatStandard, response)
+
+	if !reflect.DeepEqual(r.calls, ParseToolCalls(response)) || len(r.calls) != 1 {
+		t.Fatalf("calls: got %+v", r.calls)
+	}
+}
+
+func TestStreamParser_Discard(t *testing.T) {
+	r := streamBytes(FormatQwen, "<function=get_weather>\n<parameter=location>\nNYC")
+
+	if len(r.started) != 1 || len(r.calls) != 0 {
+		t.Fatalf("expected a started call that does not complete, got %v %v", r.started, r.calls)
+	}
+	if len(r.discarded) != 1 || !strings.HasPrefix(r.discarded[0], "<function=get_weather>") {
+		t.Errorf("discarded: got %q", r.discarded)
+	}
+}
+
+func TestStreamParser_ToolCalls(t *testing.T) {
+	response := "<tool_call>\n<function=a>\n</function>\n</tool_call>\n<function=b>\n</function>"
+
+	p := NewStreamParser(FormatAuto)
+	p.Write(response)
+	p.Close()
+
+	if !reflect.DeepEqual(p.ToolCalls(), ParseToolCalls(response)) {
+		t.Fatalf("ToolCalls: got %+v", p.ToolCalls())
+	}
+	if p.Text() != response {
+		t.Errorf("Text: got %q", p.Text())
+	}
+}
+
+func TestStreamParser_DeltaSizes(t *testing.T) {
+	responses := []struct {
+		format   Format
+		response string
+	}{
+		{FormatStandard, `<tool_call>{"name": "a", "arguments": {"s": "x\\\"}\"y", "n": {"m": [1, 2]}}}</tool_call>`},
+		{FormatStandard, `<tool_call>{"arguments" : {"k": "}"}, "name" : "a"}</tool_call>`},
+		{FormatLlama3, `{"name": "a", "parameters": {"args": "{", "arguments": 1}}`},
+		{FormatMistral, `[TOOL_CALLS]a[ARGS]{"s": "{\"}"}[TOOL_CALLS]b[ARGS]{}`},
+		{FormatGemma, `call:a{s:"}",t:1}`},
+		{FormatGemma, `call:a{s:"x",t:<|"|>}"{<|"|>}`},
+		{FormatGemma, `call:a{s:<|>}<|>,t:<">{<">}`},
+		{FormatGranite, `<|tool_call|>[{"name": "a", "arguments": {"s": "]"}}, {"name": "b", "arguments": {"t": 1}}]`},
+		{FormatQwen, "<tool_call>\n<function=a>\n<parameter=s>\n</function\n</parameter>\n</function>\n</tool_call>"},
+	}
+
+	for _, tt := range responses {
+		want := ParseToolCalls(tt.response)
+		if len(want) == 0 {
+			t.Fatalf("%q: batch parser found no calls", tt.response)
+		}
+		for size := 1; size <= 8; size++ {
+			p := NewStreamParser(tt.format)
+			var calls []ToolCall
+			for i := 0; i < len(tt.response); i += size {
+				for _, ev := range p.Write(tt.response[i:min(i+size, len(tt.response))]) {
+					if ev.Type == StreamToolCallEnd {
+						calls = append(calls, ev.ToolCall)
+					}
+				}
+			}
+			for _, ev := range p.Close() {
+				if ev.Type == StreamToolCallEnd {
+					calls = append(calls, ev.ToolCall)
+				}
+			}
+			if !reflect.DeepEqual(calls, want) {
+				t.Errorf("%q in deltas of %d: got %+v, want %+v", tt.response, size, calls, want)
+			}
+		}
+	}
+}
+
+// BenchmarkStreamParser streams a tool call with a 20 KB argument in
+// token-sized deltas.
+func BenchmarkStreamParser(b *testing.B) {
+	value := strings.Repeat("lorem ipsum, ", 1600)
+	responses := []struct {
+		name     string
+		format   Format
+		response string
+	}{
+		{"standard", FormatStandard, `<tool_call>{"name": "write_file", "arguments": {"path": "a.txt", "content": "` + value + `"}}</tool_call>`},
+		{"inline", FormatLlama3, `{"name": "write_file", "parameters": {"path": "a.txt", "content": "` + value + `"}}`},
+		{"mistral", FormatMistral, `[TOOL_CALLS]write_file[ARGS]{"path": "a.txt", "content": "` + value + `"}`},
+		{"gemma", FormatGemma, `<|tool_call>call:write_file{path:<|"|>a.txt<|"|>,content:<|"|>` + value + `<|"|>}<tool_call|>`},
+		{"qwen", FormatQwen, "<tool_call>\n<function=write_file>\n<parameter=content>\n" + value + "\n</parameter>\n</function>\n</tool_call>"},
+		{"granite", FormatGranite, `<|tool_call|>[{"name": "write_file", "arguments": {"content": "` + value + `"}}]`},
+	}
+
+	for _, r := range responses {
+		b.Run(r.name, func(b *testing.B) {
+			b.SetBytes(int64(len(r.response)))
+			for range b.N {
+				p := NewStreamParser(r.format)
+				for i := 0; i < len(r.response); i += 4 {
+					p.Write(r.response[i:min(i+4, len(r.response))])
+				}
+				p.Close()
+			}
+		})
+	}
+}
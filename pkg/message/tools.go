@@ -32,23 +32,38 @@ type ToolFunctionDefinition struct {
 
 // Tool represents a message that contains tool calls.
 // Content may optionally hold any spoken text that was generated alongside the
-// tool calls so that conversation history preserves both.
+// tool calls so that conversation history preserves both. Reasoning may hold
+// the reasoning that led to the calls, as returned by SplitReasoning, and
+// ReasoningSignature its signature from the Anthropic Messages API, as in
+// Chat.
 type Tool struct {
-	Role      string
-	Content   string
-	ToolCalls []ToolCall
+	Role               string
+	Content            string
+	Reasoning          string
+	ReasoningSignature string
+	ToolCalls          []ToolCall
 }
 
 // ToolCall represents a call to a tool function within a tool message.
+// ID optionally identifies the call, so that a ToolResponse can refer to it
+// with its ToolCallID.
 type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
 	Type     string       `json:"type"`
 	Function ToolFunction `json:"function"`
 }
 
 // ToolFunction represents a function within a tool call.
+//
+// Arguments holds every argument value as a string. TypedArguments holds the
+// same arguments with their JSON types preserved: string, bool, nil,
+// json.Number, []any and map[string]any. Parsers of JSON-based formats fill it
+// from the JSON, while tag-based formats hold strings until converted with
+// CoerceArguments.
 type ToolFunction struct {
-	Name      string            `json:"name"`
-	Arguments map[string]string `json:"arguments"`
+	Name           string            `json:"name"`
+	Arguments      map[string]string `json:"arguments"`
+	TypedArguments map[string]any    `json:"-"`
 }
 
 // GetRole returns the role of the tool message.
@@ -64,6 +79,9 @@ func (tm Tool) GetContent() map[string]interface{} {
 		for k, v := range call.Function.Arguments {
 			args[k] = v
 		}
+		for k, v := range call.Function.TypedArguments {
+			args[k] = plainValue(v)
+		}
 		calls[i] = map[string]interface{}{
 			"type": call.Type,
 			"function": map[string]interface{}{
@@ -71,6 +89,9 @@ func (tm Tool) GetContent() map[string]interface{} {
 				"arguments": args,
 			},
 		}
+		if call.ID != "" {
+			calls[i]["id"] = call.ID
+		}
 	}
 	m := map[string]interface{}{
 		"tool_calls": calls,
@@ -78,14 +99,17 @@ func (tm Tool) GetContent() map[string]interface{} {
 	if tm.Content != "" {
 		m["content"] = tm.Content
 	}
+	addReasoning(m, tm.Reasoning)
 	return m
 }
 
 // ToolResponse represents a message that contains a tool response.
+// ToolCallID optionally holds the ID of the ToolCall it responds to.
 type ToolResponse struct {
-	Role    string
-	Name    string
-	Content string
+	Role       string
+	Name       string
+	Content    string
+	ToolCallID string
 }
 
 // GetRole returns the role of the tool response message.
@@ -95,8 +119,12 @@ func (trm ToolResponse) GetRole() string {
 
 // GetContent returns the content of the tool response message as a map.
 func (trm ToolResponse) GetContent() map[string]interface{} {
-	return map[string]interface{}{
+	m := map[string]interface{}{
 		"name":    trm.Name,
 		"content": trm.Content,
 	}
+	if trm.ToolCallID != "" {
+		m["tool_call_id"] = trm.ToolCallID
+	}
+	return m
 }
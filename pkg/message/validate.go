@@ -0,0 +1,306 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidationError describes a single problem with a tool call.
+type ValidationError struct {
+	Tool string // name of the called tool
+	Path string // path of the argument, such as "filter.tags[1]", or empty for the call itself
+	Msg  string // description of the problem
+}
+
+// Error returns the description of the problem, prefixed with the argument
+// path when there is one.
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("argument %q: %s", e.Path, e.Msg)
+}
+
+// ValidationErrors is the list of problems returned by ValidateToolCall.
+type ValidationErrors []ValidationError
+
+// Error returns all problems joined into a single line.
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateToolCall checks that call names one of the tools in defs and that
+// its arguments match the JSON Schema in the tool's Parameters: required
+// properties are present, values have the declared types and enum values,
+// and no unknown properties are given unless additionalProperties allows it.
+// Nested objects and array items are checked the same way.
+//
+// String values from tag-based formats are first converted with
+// CoerceArguments, so "3" is accepted for an integer property. It returns nil
+// if the call is valid, or ValidationErrors listing every problem found.
+func ValidateToolCall(call ToolCall, defs []ToolDefinition) error {
+	name := call.Function.Name
+	def, ok := findToolDefinition(name, defs)
+	if !ok {
+		return ValidationErrors{{Tool: name, Msg: fmt.Sprintf("unknown tool %q", name)}}
+	}
+
+	call = CoerceArguments(call, defs)
+	args := call.Function.TypedArguments
+	if args == nil {
+		args = stringValues(call.Function.Arguments)
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	v := validator{tool: name}
+	if def.Function.Parameters != nil {
+		v.object(args, def.Function.Parameters, "")
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// ValidationResponse returns a tool response that explains to the model why
+// its call was rejected, so that it can correct the call and try again.
+func ValidationResponse(call ToolCall, err error) ToolResponse {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Error: the call to %q is invalid.\n", call.Function.Name)
+
+	if errs, ok := err.(ValidationErrors); ok {
+		for _, e := range errs {
+			fmt.Fprintf(&sb, "- %s\n", e.Error())
+		}
+	} else if err != nil {
+		fmt.Fprintf(&sb, "- %s\n", err.Error())
+	}
+	sb.WriteString("Fix the arguments and call the tool again.")
+
+	return ToolResponse{
+		Role:    "tool",
+		Name:    call.Function.Name,
+		Content: sb.String(),
+	}
+}
+
+// validator collects the problems found in a tool call.
+type validator struct {
+	tool string
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(path, format string, args ...any) {
+	v.errs = append(v.errs, ValidationError{Tool: v.tool, Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+// value checks a value against a schema.
+func (v *validator) value(val any, schema map[string]any, path string) {
+	if types := schemaTypes(schema); len(types) > 0 && !matchesAnyType(val, types) {
+		v.errorf(path, "expected %s, got %s", strings.Join(types, " or "), jsonTypeName(val))
+		return
+	}
+
+	if enum, ok := schema["enum"]; ok && !inEnum(val, enum) {
+		v.errorf(path, "value %s is not one of %s", jsonString(val), jsonString(enum))
+		return
+	}
+
+	switch val := val.(type) {
+	case map[string]any:
+		v.object(val, schema, path)
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return
+		}
+		for i, e := range val {
+			v.value(e, items, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// object checks the properties of an object against a schema.
+func (v *validator) object(obj map[string]any, schema map[string]any, path string) {
+	properties, _ := schema["properties"].(map[string]any)
+
+	for _, name := range stringList(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			v.errorf(joinPath(path, name), "missing required argument")
+		}
+	}
+
+	additional := true
+	if properties != nil {
+		additional = false
+	}
+	switch a := schema["additionalProperties"].(type) {
+	case bool:
+		additional = a
+	case map[string]any:
+		additional = true
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := joinPath(path, k)
+		propSchema, ok := properties[k].(map[string]any)
+		switch {
+		case ok:
+			v.value(obj[k], propSchema, p)
+		case !additional:
+			v.errorf(p, "unknown argument")
+		default:
+			if extra, ok := schema["additionalProperties"].(map[string]any); ok {
+				v.value(obj[k], extra, p)
+			}
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// matchesAnyType reports whether val has one of the JSON Schema types.
+func matchesAnyType(val any, types []string) bool {
+	for _, t := range types {
+		if matchesType(val, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(val any, t string) bool {
+	switch t {
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "null":
+		return val == nil
+	case "object":
+		_, ok := val.(map[string]any)
+		return ok
+	case "array":
+		_, ok := val.([]any)
+		return ok
+	case "number":
+		_, ok := numberValue(val)
+		return ok
+	case "integer":
+		f, ok := numberValue(val)
+		return ok && f == float64(int64(f))
+	default:
+		return true
+	}
+}
+
+// numberValue returns val as a float64 if it is a number.
+func numberValue(val any) (float64, bool) {
+	switch n := val.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// jsonTypeName returns the JSON type of val for error messages.
+func jsonTypeName(val any) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if f, ok := numberValue(val); ok {
+		if f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+// inEnum reports whether val is one of the values of enum, which may be any
+// slice type. Numbers compare by value.
+func inEnum(val any, enum any) bool {
+	rv := reflect.ValueOf(enum)
+	if rv.Kind() != reflect.Slice {
+		return true
+	}
+	for i := 0; i < rv.Len(); i++ {
+		e := rv.Index(i).Interface()
+		if a, ok := numberValue(val); ok {
+			if b, ok := numberValue(e); ok && a == b {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(val, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList returns the strings of a []string or []any.
+func stringList(v any) []string {
+	switch l := v.(type) {
+	case []string:
+		return l
+	case []any:
+		var s []string
+		for _, e := range l {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// jsonString formats v as JSON for error messages.
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,150 @@
+package message
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var validateTestTools = []ToolDefinition{{
+	Type: "function",
+	Function: ToolFunctionDefinition{
+		Name: "search",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string"},
+				"limit": map[string]any{"type": "integer"},
+				"sort":  map[string]any{"type": "string", "enum": []string{"date", "score"}},
+				"ids": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"type": "integer"},
+				},
+				"filter": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"tag": map[string]any{"type": "string"},
+					},
+					"required": []any{"tag"},
+				},
+			},
+			"required": []string{"query"},
+		},
+	},
+}}
+
+func validateErrors(t *testing.T, err error) ValidationErrors {
+	t.Helper()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	return errs
+}
+
+func TestValidateToolCall_Valid(t *testing.T) {
+	calls := ParseToolCalls(`<tool_call>{"name": "search", "arguments": {"query": "go", "limit": 5, "sort": "date", "ids": [1, 2], "filter": {"tag": "new"}}}</tool_call>`)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if err := ValidateToolCall(calls[0], validateTestTools); err != nil {
+		t.Fatalf("expected a valid call, got %v", err)
+	}
+}
+
+func TestValidateToolCall_CoercesTagValues(t *testing.T) {
+	calls := ParseToolCalls("<function=search>\n<parameter=query>\ngo\n</parameter>\n<parameter=limit>\n5\n</parameter>\n</function>")
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if err := ValidateToolCall(calls[0], validateTestTools); err != nil {
+		t.Fatalf("expected a valid call, got %v", err)
+	}
+}
+
+func TestValidateToolCall_UnknownTool(t *testing.T) {
+	err := ValidateToolCall(ToolCall{Type: "function", Function: ToolFunction{Name: "delete_all"}}, validateTestTools)
+
+	errs := validateErrors(t, err)
+	if len(errs) != 1 || errs[0].Path != "" || errs[0].Msg != `unknown tool "delete_all"` {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestValidateToolCall_Invalid(t *testing.T) {
+	call := ToolCall{
+		Type: "function",
+		Function: ToolFunction{
+			Name: "search",
+			TypedArguments: map[string]any{
+				"limit":  "many",
+				"sort":   "name",
+				"ids":    []any{"a"},
+				"filter": map[string]any{},
+				"extra":  true,
+			},
+		},
+	}
+
+	errs := validateErrors(t, ValidateToolCall(call, validateTestTools))
+
+	want := map[string]string{
+		"query":      "missing required argument",
+		"extra":      "unknown argument",
+		"filter.tag": "missing required argument",
+		"ids[0]":     "expected integer, got string",
+		"limit":      "expected integer, got string",
+		"sort":       `value "name" is not one of ["date","score"]`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for _, e := range errs {
+		if want[e.Path] != e.Msg {
+			t.Errorf("%s: got %q, want %q", e.Path, e.Msg, want[e.Path])
+		}
+		if e.Tool != "search" {
+			t.Errorf("%s: tool got %q", e.Path, e.Tool)
+		}
+	}
+}
+
+func TestValidateToolCall_AdditionalProperties(t *testing.T) {
+	defs := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name: "log",
+			Parameters: map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{"msg": map[string]any{"type": "string"}},
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+		},
+	}}
+
+	call := ToolCall{Function: ToolFunction{Name: "log", TypedArguments: map[string]any{"msg": "hi", "level": "info"}}}
+	if err := ValidateToolCall(call, defs); err != nil {
+		t.Fatalf("expected a valid call, got %v", err)
+	}
+
+	call.Function.TypedArguments["count"] = true
+	errs := validateErrors(t, ValidateToolCall(call, defs))
+	if len(errs) != 1 || errs[0].Path != "count" {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestValidationResponse(t *testing.T) {
+	call := ToolCall{Type: "function", Function: ToolFunction{Name: "search"}}
+	resp := ValidationResponse(call, ValidateToolCall(call, validateTestTools))
+
+	if resp.Role != "tool" || resp.Name != "search" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if !strings.Contains(resp.Content, `- argument "query": missing required argument`) {
+		t.Errorf("content does not list the error: %q", resp.Content)
+	}
+	if !strings.HasSuffix(resp.Content, "call the tool again.") {
+		t.Errorf("content does not ask for a retry: %q", resp.Content)
+	}
+}
@@ -0,0 +1,5 @@
+// Package prompt manages task prompts: named prompts with typed variables,
+// written as Go text/template templates, and few-shot examples that are
+// selected to fit a token budget. A rendered prompt is a []message.Message
+// that is ready for template.Apply.
+package prompt
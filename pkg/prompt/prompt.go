@@ -0,0 +1,396 @@
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+// ErrUnknownPrompt is returned by Library.Render for a prompt that the
+// library does not have.
+var ErrUnknownPrompt = errors.New("unknown prompt")
+
+// Variable types.
+const (
+	TypeString  = "string"
+	TypeInt     = "int"
+	TypeFloat   = "float"
+	TypeBool    = "bool"
+	TypeStrings = "[]string"
+	TypeAny     = "any"
+)
+
+// Variable declares a variable of a prompt.
+type Variable struct {
+	// Name is the name of the variable, used as {{.name}} in the templates.
+	Name string `json:"name"`
+
+	// Type is one of the Type constants. It defaults to TypeString.
+	Type string `json:"type,omitempty"`
+
+	// Default is the value of the variable when it is not given. Variables
+	// without a default are required.
+	Default any `json:"default,omitempty"`
+}
+
+// Example is a few-shot example: the variables of a user message, rendered
+// with the user template of the prompt, and the expected answer.
+type Example struct {
+	Vars   map[string]any `json:"vars"`
+	Output string         `json:"output"`
+}
+
+// Prompt is a task prompt.
+type Prompt struct {
+	// Name is the name of the prompt. Prompts loaded with Load are named
+	// after their file, without the .json extension, e.g. "code/review".
+	Name string `json:"-"`
+
+	// Description says what the prompt is for.
+	Description string `json:"description,omitempty"`
+
+	// System is the template of the system message. The system message is
+	// left out when it renders empty. Besides the text/template builtins,
+	// the templates can use the join, lower, upper and trim functions of
+	// the strings package.
+	System string `json:"system,omitempty"`
+
+	// User is the template of the user message.
+	User string `json:"user"`
+
+	// Variables declares the variables that the templates use.
+	Variables []Variable `json:"variables,omitempty"`
+
+	// Examples are the few-shot examples, in order of preference.
+	Examples []Example `json:"examples,omitempty"`
+
+	system *template.Template
+	user   *template.Template
+}
+
+// Parse parses a prompt from its JSON definition and checks its templates
+// and examples.
+func Parse(name string, data []byte) (*Prompt, error) {
+	p := &Prompt{Name: name}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
+	}
+	return p, nil
+}
+
+func (p *Prompt) compile() error {
+	for i, v := range p.Variables {
+		if v.Type == "" {
+			p.Variables[i].Type = TypeString
+		}
+		if _, ok := zeroValues[p.Variables[i].Type]; !ok {
+			return fmt.Errorf("variable %s: unknown type %q", v.Name, v.Type)
+		}
+		if v.Default != nil {
+			if _, err := convert(p.Variables[i], v.Default); err != nil {
+				return fmt.Errorf("variable %s: default: %w", v.Name, err)
+			}
+		}
+	}
+
+	var err error
+	if p.system, err = template.New("system").Funcs(funcs).Option("missingkey=error").Parse(p.System); err != nil {
+		return err
+	}
+	if p.user, err = template.New("user").Funcs(funcs).Option("missingkey=error").Parse(p.User); err != nil {
+		return err
+	}
+
+	// Execute the templates with zero values to find the variables that
+	// they use without declaring them.
+	zero := make(map[string]any, len(p.Variables))
+	for _, v := range p.Variables {
+		zero[v.Name] = zeroValues[v.Type]
+	}
+	for _, tmpl := range []*template.Template{p.system, p.user} {
+		if err := tmpl.Execute(io.Discard, zero); err != nil && strings.Contains(err.Error(), "map has no entry for key") {
+			return err
+		}
+	}
+
+	for i, ex := range p.Examples {
+		if _, err := p.render(p.user, ex.Vars); err != nil {
+			return fmt.Errorf("example %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+var zeroValues = map[string]any{
+	TypeString:  "",
+	TypeInt:     0,
+	TypeFloat:   0.0,
+	TypeBool:    false,
+	TypeStrings: []string(nil),
+	TypeAny:     nil,
+}
+
+// Options controls how a prompt is rendered.
+type Options struct {
+	// ExampleBudget is the number of tokens that the few-shot examples may
+	// use. Examples are taken in order, skipping those that do not fit in
+	// what is left of the budget. Zero means no limit.
+	ExampleBudget int
+
+	// MaxExamples is the maximum number of examples. Zero means no limit,
+	// and a negative value leaves out the examples.
+	MaxExamples int
+
+	// CountTokens returns the number of tokens in text. It is required when
+	// ExampleBudget is set; use TokenCounter to count with the vocabulary
+	// of a model.
+	CountTokens func(text string) int
+}
+
+// TokenCounter returns a CountTokens function that tokenizes with vocab.
+func TokenCounter(vocab llama.Vocab) func(text string) int {
+	return func(text string) int {
+		return len(llama.Tokenize(vocab, text, false, true))
+	}
+}
+
+// Render renders the prompt with vars: the system message, a user and an
+// assistant message per selected example, and the user message.
+func (p *Prompt) Render(vars map[string]any, opts Options) ([]message.Message, error) {
+	if p.user == nil {
+		return nil, fmt.Errorf("prompt %s: not compiled, use Parse or Library.Add", p.Name)
+	}
+	if opts.ExampleBudget > 0 && opts.CountTokens == nil {
+		return nil, fmt.Errorf("prompt %s: an example budget needs CountTokens", p.Name)
+	}
+
+	system, err := p.render(p.system, vars)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", p.Name, err)
+	}
+	user, err := p.render(p.user, vars)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", p.Name, err)
+	}
+
+	var msgs []message.Message
+	if system != "" {
+		msgs = append(msgs, message.Chat{Role: "system", Content: system})
+	}
+
+	budget := opts.ExampleBudget
+	n := 0
+	for _, ex := range p.Examples {
+		if opts.MaxExamples < 0 || (opts.MaxExamples > 0 && n == opts.MaxExamples) {
+			break
+		}
+		input, err := p.render(p.user, ex.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: %w", p.Name, err)
+		}
+		if opts.ExampleBudget > 0 {
+			tokens := opts.CountTokens(input) + opts.CountTokens(ex.Output)
+			if tokens > budget {
+				continue
+			}
+			budget -= tokens
+		}
+		msgs = append(msgs,
+			message.Chat{Role: "user", Content: input},
+			message.Chat{Role: "assistant", Content: ex.Output},
+		)
+		n++
+	}
+
+	return append(msgs, message.Chat{Role: "user", Content: user}), nil
+}
+
+// render executes tmpl with vars after checking them against the declared
+// variables and filling in the defaults.
+func (p *Prompt) render(tmpl *template.Template, vars map[string]any) (string, error) {
+	data := make(map[string]any, len(p.Variables))
+	for name := range vars {
+		if !slices.ContainsFunc(p.Variables, func(v Variable) bool { return v.Name == name }) {
+			return "", fmt.Errorf("unknown variable %s", name)
+		}
+	}
+	for _, v := range p.Variables {
+		value, ok := vars[v.Name]
+		if !ok {
+			if v.Default == nil {
+				return "", fmt.Errorf("missing variable %s", v.Name)
+			}
+			value = v.Default
+		}
+		value, err := convert(v, value)
+		if err != nil {
+			return "", fmt.Errorf("variable %s: %w", v.Name, err)
+		}
+		data[v.Name] = value
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// convert checks that value has the type of v and returns it as that type.
+// Numbers decoded from JSON are float64, so integral floats in the int range
+// are accepted as ints, and a []any of strings as a []string. Ints, int32s
+// and int64s are accepted as both ints and floats.
+func convert(v Variable, value any) (any, error) {
+	switch v.Type {
+	case TypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case TypeInt:
+		switch n := value.(type) {
+		case int:
+			return n, nil
+		case int32:
+			return int(n), nil
+		case int64:
+			if n < math.MinInt || n > math.MaxInt {
+				return nil, fmt.Errorf("%d is out of the %s range", n, v.Type)
+			}
+			return int(n), nil
+		case float64:
+			if n != math.Trunc(n) {
+				break
+			}
+			// -math.MinInt is one more than math.MaxInt, and exact as a
+			// float64, unlike math.MaxInt.
+			if n < math.MinInt || n >= -math.MinInt {
+				return nil, fmt.Errorf("%g is out of the %s range", n, v.Type)
+			}
+			return int(n), nil
+		}
+	case TypeFloat:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case float32:
+			return float64(n), nil
+		case int:
+			return float64(n), nil
+		case int32:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		}
+	case TypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case TypeStrings:
+		switch l := value.(type) {
+		case []string:
+			return l, nil
+		case []any:
+			s := make([]string, len(l))
+			for i, e := range l {
+				str, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("want %s, got %T element", v.Type, e)
+				}
+				s[i] = str
+			}
+			return s, nil
+		}
+	case TypeAny:
+		return value, nil
+	}
+	return nil, fmt.Errorf("want %s, got %T", v.Type, value)
+}
+
+// Library is a set of named prompts.
+type Library struct {
+	prompts map[string]*Prompt
+}
+
+// Load loads the prompts of the .json files in fsys and its subdirectories.
+// Each prompt is named after its path, without the extension.
+func Load(fsys fs.FS) (*Library, error) {
+	l := &Library{prompts: make(map[string]*Prompt)}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".json" {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		p, err := Parse(strings.TrimSuffix(name, ".json"), data)
+		if err != nil {
+			return err
+		}
+		l.prompts[p.Name] = p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Add checks p and adds it to the library, replacing any prompt with the
+// same name.
+func (l *Library) Add(p *Prompt) error {
+	if err := p.compile(); err != nil {
+		return fmt.Errorf("prompt %s: %w", p.Name, err)
+	}
+	if l.prompts == nil {
+		l.prompts = make(map[string]*Prompt)
+	}
+	l.prompts[p.Name] = p
+	return nil
+}
+
+// Get returns the prompt with the given name.
+func (l *Library) Get(name string) (*Prompt, bool) {
+	p, ok := l.prompts[name]
+	return p, ok
+}
+
+// Names returns the names of the prompts, sorted.
+func (l *Library) Names() []string {
+	names := make([]string, 0, len(l.prompts))
+	for name := range l.prompts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Render renders the prompt with the given name, see Prompt.Render.
+func (l *Library) Render(name string, vars map[string]any, opts Options) ([]message.Message, error) {
+	p, ok := l.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrompt, name)
+	}
+	return p.Render(vars, opts)
+}
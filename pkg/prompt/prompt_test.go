@@ -0,0 +1,203 @@
+package prompt
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+const summarize = `{
+	"description": "Summarize a text",
+	"system": "You summarize texts in {{.words}} words or less.",
+	"user": "Summarize:\n{{.text}}{{if .keywords}}\nKeywords: {{join .keywords \", \"}}{{end}}",
+	"variables": [
+		{"name": "text"},
+		{"name": "words", "type": "int", "default": 20},
+		{"name": "keywords", "type": "[]string", "default": []}
+	],
+	"examples": [
+		{"vars": {"text": "The cat sat on the mat all day long."}, "output": "A cat sat on a mat."},
+		{"vars": {"text": "It rained in Paris on Monday, and the Seine rose by a metre by the evening."}, "output": "Rain raised the Seine."},
+		{"vars": {"text": "Go 1.26 is out."}, "output": "Go 1.26 released."}
+	]
+}`
+
+// countWords counts a word as a token.
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+func contents(msgs []message.Message) []string {
+	var s []string
+	for _, m := range msgs {
+		s = append(s, m.GetRole()+": "+m.GetContent()["content"].(string))
+	}
+	return s
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"summarize.json":   {Data: []byte(summarize)},
+		"code/review.json": {Data: []byte(`{"user": "Review {{.code}}", "variables": [{"name": "code"}]}`)},
+		"README.md":        {Data: []byte("not a prompt")},
+	}
+
+	lib, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := lib.Names(), []string{"code/review", "summarize"}; !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+
+	msgs, err := lib.Render("code/review", map[string]any{"code": "x := 1"}, Options{})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if got, want := contents(msgs), []string{"user: Review x := 1"}; !slices.Equal(got, want) {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	if _, err := lib.Render("missing", nil, Options{}); !errors.Is(err, ErrUnknownPrompt) {
+		t.Errorf("Render(missing) error = %v, want ErrUnknownPrompt", err)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := map[string]string{
+		"bad json":           `{"user": `,
+		"bad template":       `{"user": "{{.text"}`,
+		"undeclared":         `{"user": "{{.text}} {{.other}}", "variables": [{"name": "text"}]}`,
+		"unknown type":       `{"user": "{{.n}}", "variables": [{"name": "n", "type": "complex"}]}`,
+		"bad default":        `{"user": "{{.n}}", "variables": [{"name": "n", "type": "int", "default": "ten"}]}`,
+		"bad example":        `{"user": "{{.n}}", "variables": [{"name": "n", "type": "int"}], "examples": [{"vars": {"n": 1.5}, "output": "x"}]}`,
+		"missing in example": `{"user": "{{.n}}", "variables": [{"name": "n"}], "examples": [{"vars": {}, "output": "x"}]}`,
+	}
+
+	for name, def := range tests {
+		if _, err := Load(fstest.MapFS{"p.json": {Data: []byte(def)}}); err == nil {
+			t.Errorf("%s: Load succeeded, want an error", name)
+		}
+	}
+}
+
+func TestPrompt_Render(t *testing.T) {
+	p, err := Parse("summarize", []byte(summarize))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	msgs, err := p.Render(map[string]any{"text": "Long text.", "words": 5, "keywords": []string{"a", "b"}}, Options{MaxExamples: 1})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := []string{
+		"system: You summarize texts in 5 words or less.",
+		"user: Summarize:\nThe cat sat on the mat all day long.",
+		"assistant: A cat sat on a mat.",
+		"user: Summarize:\nLong text.\nKeywords: a, b",
+	}
+	if got := contents(msgs); !slices.Equal(got, want) {
+		t.Errorf("Render() =\n%q\nwant\n%q", got, want)
+	}
+
+	msgs, err = p.Render(map[string]any{"text": "Long text."}, Options{MaxExamples: -1})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want = []string{
+		"system: You summarize texts in 20 words or less.",
+		"user: Summarize:\nLong text.",
+	}
+	if got := contents(msgs); !slices.Equal(got, want) {
+		t.Errorf("Render() with defaults =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestPrompt_RenderExampleBudget(t *testing.T) {
+	p, err := Parse("summarize", []byte(summarize))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// The examples use 16, 21 and 8 words: the second does not fit in what
+	// is left after the first, the third does.
+	msgs, err := p.Render(map[string]any{"text": "Long text."}, Options{ExampleBudget: 25, CountTokens: countWords})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if len(msgs) != 6 {
+		t.Fatalf("got %d messages, want 6: %q", len(msgs), contents(msgs))
+	}
+	if got := msgs[4].GetContent()["content"]; got != "Go 1.26 released." {
+		t.Errorf("second example output = %q, want the third example", got)
+	}
+
+	if _, err := p.Render(map[string]any{"text": "x"}, Options{ExampleBudget: 10}); err == nil {
+		t.Error("Render with a budget and no CountTokens succeeded, want an error")
+	}
+}
+
+func TestPrompt_RenderTypeErrors(t *testing.T) {
+	p, err := Parse("summarize", []byte(summarize))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := map[string]map[string]any{
+		"missing":      {},
+		"unknown":      {"text": "x", "colour": "red"},
+		"wrong type":   {"text": 42},
+		"not integral": {"text": "x", "words": 2.5},
+		"huge":         {"text": "x", "words": 1e300},
+		"too large":    {"text": "x", "words": 9223372036854775808.0},
+		"infinite":     {"text": "x", "words": math.Inf(1)},
+		"bad list":     {"text": "x", "keywords": []any{"a", 1}},
+	}
+	for name, vars := range tests {
+		if _, err := p.Render(vars, Options{}); err == nil {
+			t.Errorf("%s: Render succeeded, want an error", name)
+		}
+	}
+}
+
+func TestConvert_Numbers(t *testing.T) {
+	for _, value := range []any{3, int32(3), int64(3), 3.0} {
+		if got, err := convert(Variable{Name: "n", Type: TypeInt}, value); err != nil || got != 3 {
+			t.Errorf("convert(%T %v) to int = %v, %v, want 3", value, value, got, err)
+		}
+		if got, err := convert(Variable{Name: "n", Type: TypeFloat}, value); err != nil || got != 3.0 {
+			t.Errorf("convert(%T %v) to float = %v, %v, want 3", value, value, got, err)
+		}
+	}
+
+	if got, err := convert(Variable{Name: "n", Type: TypeInt}, float64(math.MinInt)); err != nil || got != math.MinInt {
+		t.Errorf("convert(MinInt) = %v, %v, want %d", got, err, math.MinInt)
+	}
+	if _, err := convert(Variable{Name: "n", Type: TypeInt}, -float64(math.MinInt)); err == nil {
+		t.Error("convert(MaxInt + 1) succeeded, want an error")
+	}
+}
+
+func TestLibrary_Add(t *testing.T) {
+	var lib Library
+	if err := lib.Add(&Prompt{Name: "greet", User: "Hello {{.name}}", Variables: []Variable{{Name: "name"}}}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	msgs, err := lib.Render("greet", map[string]any{"name": "Ada"}, Options{})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if got, want := contents(msgs), []string{"user: Hello Ada"}; !slices.Equal(got, want) {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	if err := lib.Add(&Prompt{Name: "bad", User: "{{.missing}}"}); err == nil {
+		t.Error("Add of a prompt with an undeclared variable succeeded, want an error")
+	}
+}
@@ -0,0 +1,155 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+// builtinAliases maps llama.cpp template names to the built-in template that
+// renders the same prompt.
+var builtinAliases = map[string]string{
+	"gemma": "gemma3",
+}
+
+// BuiltinTemplateNames returns the names of the built-in templates, sorted.
+func BuiltinTemplateNames() []string {
+	files, _ := fs.Glob(builtinTemplates, "prompts/*.jinja")
+	names := make([]string, 0, len(files)+len(builtinAliases))
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(path.Base(f), ".jinja"))
+	}
+	for alias := range builtinAliases {
+		names = append(names, alias)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// builtinNames maps fragments of model names to built-in templates. The
+// first match wins, so more specific fragments come first.
+var builtinNames = []struct{ fragment, template string }{
+	{"llama-4", "llama4"},
+	{"llama-3", "llama3"},
+	{"llama3", "llama3"},
+	{"llama-2", "llama2-sys"},
+	{"llama2", "llama2-sys"},
+	{"mistral-small-3", "mistral-v7-tekken"},
+	{"magistral", "mistral-v7-tekken"},
+	{"devstral", "mistral-v7-tekken"},
+	{"mistral-nemo", "mistral-v3-tekken"},
+	{"pixtral", "mistral-v3-tekken"},
+	{"mixtral", "mistral-v1"},
+	{"mistral", "mistral-v3"},
+	{"phi-4-mini", "phi3"},
+	{"phi-4", "phi4"},
+	{"phi4", "phi4"},
+	{"phi-3", "phi3"},
+	{"phi3", "phi3"},
+	{"falcon3", "falcon3"},
+	{"falcon-3", "falcon3"},
+	{"zephyr", "zephyr"},
+	{"openchat", "openchat"},
+	{"vicuna", "vicuna"},
+	{"deepseek-coder", "deepseek"},
+	{"deepseek-v2", "deepseek2"},
+	{"deepseek", "deepseek3"},
+	{"command-r", "command-r"},
+	{"c4ai", "command-r"},
+	{"granite", "granite"},
+	{"gpt-oss", "gpt-oss"},
+	{"gemma", "gemma3"},
+	{"smolvlm", "smolvlm"},
+	{"smollm", "chatml"},
+	{"qwen", "qwen2.5-instruct"},
+	{"exaone-4", "exaone4"},
+	{"exaone", "exaone3"},
+	{"chatglm3", "chatglm3"},
+	{"glm-edge", "glmedge"},
+	{"glm-4", "chatglm4"},
+	{"glm4", "chatglm4"},
+	{"minicpm", "minicpm"},
+	{"rwkv", "rwkv-world"},
+	{"gigachat", "gigachat"},
+	{"megrez", "megrez"},
+	{"kimi-k2", "kimi-k2"},
+	{"seed-oss", "seed_oss"},
+	{"orion", "orion"},
+	{"grok-2", "grok-2"},
+}
+
+// builtinArchitectures maps GGUF architectures to built-in templates, for
+// models whose name does not give the template away.
+var builtinArchitectures = map[string]string{
+	"llama4":        "llama4",
+	"gemma":         "gemma3",
+	"gemma2":        "gemma3",
+	"gemma3":        "gemma3",
+	"phi3":          "phi3",
+	"command-r":     "command-r",
+	"cohere2":       "command-r",
+	"granite":       "granite",
+	"granitemoe":    "granite",
+	"gpt-oss":       "gpt-oss",
+	"deepseek2":     "deepseek3",
+	"exaone":        "exaone3",
+	"exaone4":       "exaone4",
+	"chatglm":       "chatglm4",
+	"glm4":          "chatglm4",
+	"minicpm":       "minicpm",
+	"rwkv6":         "rwkv-world",
+	"rwkv7":         "rwkv-world",
+	"orion":         "orion",
+	"bailingmoe":    "bailing",
+	"hunyuan-moe":   "hunyuan-moe",
+	"hunyuan-dense": "hunyuan-dense",
+	"qwen2":         "qwen2.5-instruct",
+	"qwen2moe":      "qwen2.5-instruct",
+	"qwen3":         "qwen2.5-instruct",
+	"qwen3moe":      "qwen2.5-instruct",
+	"seed_oss":      "seed_oss",
+	"grok":          "grok-2",
+}
+
+// MatchBuiltin returns the name of the built-in template for a model with
+// the given name and architecture, as stored in the general.name and
+// general.architecture metadata of a GGUF file. The name is checked first,
+// since several model families share an architecture. The second return
+// value is false when no built-in matches.
+func MatchBuiltin(name, architecture string) (string, bool) {
+	name = strings.NewReplacer(" ", "-", "_", "-").Replace(strings.ToLower(name))
+	for _, b := range builtinNames {
+		if strings.Contains(name, b.fragment) {
+			return b.template, true
+		}
+	}
+	if t, ok := builtinArchitectures[strings.ToLower(architecture)]; ok {
+		return t, true
+	}
+	return "", false
+}
+
+// ForModel returns the chat template of model: the template stored in the
+// GGUF file, else the built-in template that matches the model name or
+// architecture. It returns an error wrapping ErrNoChatTemplate when the model
+// has no template and no built-in matches.
+func ForModel(model llama.Model) (*Template, error) {
+	t, err := FromModel(model)
+	if !errors.Is(err, ErrNoChatTemplate) {
+		return t, err
+	}
+
+	name, _ := llama.ModelMetaValStr(model, "general.name")
+	arch, _ := llama.ModelMetaValStr(model, "general.architecture")
+	builtin, ok := MatchBuiltin(name, arch)
+	if !ok {
+		return nil, fmt.Errorf("%w and no built-in template matches model %q (architecture %q)", ErrNoChatTemplate, name, arch)
+	}
+	source, _ := BuiltinTemplate(builtin)
+	return cachedCompile(source)
+}
@@ -0,0 +1,179 @@
+package template
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+var builtinConversation = []message.Message{
+	message.Chat{Role: "system", Content: "You are a helpful assistant."},
+	message.Chat{Role: "user", Content: "Hello!"},
+	message.Chat{Role: "assistant", Content: "Hi there."},
+	message.Chat{Role: "user", Content: "How are you?"},
+}
+
+func TestBuiltinTemplate_LlamaCppNames(t *testing.T) {
+	// The prompts that llama.cpp renders for these names.
+	tests := map[string]string{
+		"llama2":            "[INST] You are a helpful assistant.\nHello! [/INST]Hi there.</s>[INST] How are you? [/INST]",
+		"llama2-sys":        "[INST] <<SYS>>\nYou are a helpful assistant.\n<</SYS>>\n\nHello! [/INST]Hi there.</s>[INST] How are you? [/INST]",
+		"llama2-sys-bos":    "[INST] <<SYS>>\nYou are a helpful assistant.\n<</SYS>>\n\nHello! [/INST]Hi there.</s><s>[INST] How are you? [/INST]",
+		"mistral-v1":        " [INST] You are a helpful assistant.\n\nHello! [/INST] Hi there.</s> [INST] How are you? [/INST]",
+		"mistral-v3":        "[INST] You are a helpful assistant.\n\nHello![/INST] Hi there.</s>[INST] How are you?[/INST]",
+		"mistral-v3-tekken": "[INST]You are a helpful assistant.\n\nHello![/INST]Hi there.</s>[INST]How are you?[/INST]",
+		"mistral-v7":        "[SYSTEM_PROMPT] You are a helpful assistant.[/SYSTEM_PROMPT][INST] Hello![/INST] Hi there.</s>[INST] How are you?[/INST]",
+		"mistral-v7-tekken": "[SYSTEM_PROMPT]You are a helpful assistant.[/SYSTEM_PROMPT][INST]Hello![/INST]Hi there.</s>[INST]How are you?[/INST]",
+		"llama3": "<|start_header_id|>system<|end_header_id|>\n\nYou are a helpful assistant.<|eot_id|>" +
+			"<|start_header_id|>user<|end_header_id|>\n\nHello!<|eot_id|>" +
+			"<|start_header_id|>assistant<|end_header_id|>\n\nHi there.<|eot_id|>" +
+			"<|start_header_id|>user<|end_header_id|>\n\nHow are you?<|eot_id|>" +
+			"<|start_header_id|>assistant<|end_header_id|>\n\n",
+		"phi4": "<|im_start|>system<|im_sep|>You are a helpful assistant.<|im_end|>" +
+			"<|im_start|>user<|im_sep|>Hello!<|im_end|>" +
+			"<|im_start|>assistant<|im_sep|>Hi there.<|im_end|>" +
+			"<|im_start|>user<|im_sep|>How are you?<|im_end|>" +
+			"<|im_start|>assistant<|im_sep|>",
+		"deepseek3": "You are a helpful assistant.\n\n<｜User｜>Hello!<｜Assistant｜>Hi there.<｜end▁of▁sentence｜><｜User｜>How are you?<｜Assistant｜>",
+		"gemma": "<start_of_turn>user\nYou are a helpful assistant.\n\nHello!<end_of_turn>\n" +
+			"<start_of_turn>model\nHi there.<end_of_turn>\n" +
+			"<start_of_turn>user\nHow are you?<end_of_turn>\n" +
+			"<start_of_turn>model\n",
+		"openchat":   "You are a helpful assistant.<|end_of_turn|>GPT4 Correct User: Hello!<|end_of_turn|>GPT4 Correct Assistant: Hi there.<|end_of_turn|>GPT4 Correct User: How are you?<|end_of_turn|>GPT4 Correct Assistant:",
+		"orion":      "Human: You are a helpful assistant.\n\nHello!\n\nAssistant: </s>Hi there.</s>Human: How are you?\n\nAssistant: </s>",
+		"rwkv-world": "System: You are a helpful assistant.\n\nUser: Hello!\n\nAssistant: Hi there.\n\nUser: How are you?\n\nAssistant:",
+		"bailing":    "<role>SYSTEM</role>You are a helpful assistant.<role>HUMAN</role>Hello!<role>ASSISTANT</role>Hi there.<role>HUMAN</role>How are you?<role>ASSISTANT</role>",
+		"gpt-oss": "<|start|>system<|message|>You are a helpful assistant.<|end|>" +
+			"<|start|>user<|message|>Hello!<|end|>" +
+			"<|start|>assistant<|message|>Hi there.<|return|>" +
+			"<|start|>user<|message|>How are you?<|end|>" +
+			"<|start|>assistant",
+	}
+
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpl, ok := BuiltinTemplate(name)
+			if !ok {
+				t.Fatalf("no built-in template %q", name)
+			}
+			got, err := Apply(tmpl, builtinConversation, true)
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if got != want {
+				t.Errorf("prompt mismatch:\n got: %q\nwant: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBuiltinTemplateNames(t *testing.T) {
+	names := BuiltinTemplateNames()
+	for _, name := range []string{"chatml", "gemma", "gemma3", "llama2", "llama3", "mistral-v7", "phi3", "phi4", "deepseek3", "command-r", "granite", "gpt-oss"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("BuiltinTemplateNames() does not contain %q", name)
+		}
+	}
+
+	for _, name := range names {
+		tmpl, ok := BuiltinTemplate(name)
+		if !ok {
+			t.Errorf("BuiltinTemplate(%q) not found", name)
+			continue
+		}
+		if _, err := Apply(tmpl, builtinConversation, true); err != nil {
+			t.Errorf("%s: Apply failed: %v", name, err)
+		}
+	}
+}
+
+// unportedBuiltins are the llama.cpp template names that knowingly have no
+// built-in template. A new llama.cpp template fails the parity test until it
+// is added here or to prompts.
+var unportedBuiltins = []string{
+	"bailing2",
+	"exaone-moe",
+	"pangu-embedded",
+	"solar-open",
+}
+
+// TestBuiltinTemplate_LlamaCppParity compares the built-in templates with
+// the prompts that llama.cpp renders for the same names. It needs the llama
+// library, set with YZMA_LIB.
+func TestBuiltinTemplate_LlamaCppParity(t *testing.T) {
+	lib := os.Getenv("YZMA_LIB")
+	if lib == "" {
+		t.Skip("no YZMA_LIB set for tests")
+	}
+	if err := llama.Load(lib); err != nil {
+		t.Fatal("unable to load library", err.Error())
+	}
+
+	chat := make([]llama.ChatMessage, len(builtinConversation))
+	for i, m := range builtinConversation {
+		chat[i] = llama.NewChatMessage(m.GetRole(), m.GetContent()["content"].(string))
+	}
+
+	for _, name := range llama.ChatBuiltinTemplates() {
+		tmpl, ok := BuiltinTemplate(name)
+		if !ok {
+			if !slices.Contains(unportedBuiltins, name) {
+				t.Errorf("llama.cpp template %q has no built-in template", name)
+			}
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			buf := make([]byte, 4096)
+			n := llama.ChatApplyTemplate(name, chat, true, buf)
+			if n < 0 {
+				t.Skipf("llama.cpp cannot render %q", name)
+			}
+			want := string(buf[:n])
+
+			got, err := Apply(tmpl, builtinConversation, true)
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if got != want {
+				t.Errorf("prompt mismatch:\n got: %q\nwant: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestMatchBuiltin(t *testing.T) {
+	tests := []struct {
+		name, arch, want string
+	}{
+		{"Meta Llama 3.1 8B Instruct", "llama", "llama3"},
+		{"Llama 2 7B Chat", "llama", "llama2-sys"},
+		{"Mistral Small 3.1 24B Instruct", "llama", "mistral-v7-tekken"},
+		{"Mistral 7B Instruct v0.3", "llama", "mistral-v3"},
+		{"Phi 4 Mini Instruct", "phi3", "phi3"},
+		{"phi-4", "phi3", "phi4"},
+		{"Falcon3 7B Instruct", "llama", "falcon3"},
+		{"DeepSeek Coder 6.7B Instruct", "llama", "deepseek"},
+		{"DeepSeek R1", "deepseek2", "deepseek3"},
+		{"Granite 3.3 8b Instruct", "granite", "granite"},
+		{"", "gpt-oss", "gpt-oss"},
+		{"Some Model", "gemma3", "gemma3"},
+		{"Qwen3 0.6B", "qwen3", "qwen2.5-instruct"},
+	}
+
+	for _, tt := range tests {
+		got, ok := MatchBuiltin(tt.name, tt.arch)
+		if !ok || got != tt.want {
+			t.Errorf("MatchBuiltin(%q, %q) = %q, %v; want %q", tt.name, tt.arch, got, ok, tt.want)
+		}
+		if _, ok := BuiltinTemplate(got); !ok {
+			t.Errorf("MatchBuiltin(%q, %q) returned unknown template %q", tt.name, tt.arch, got)
+		}
+	}
+
+	if got, ok := MatchBuiltin("Unknown Model", "unknown"); ok {
+		t.Errorf("MatchBuiltin(unknown) = %q, want no match", got)
+	}
+}
@@ -0,0 +1,318 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/jinja"
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+// Report is the result of Check.
+type Report struct {
+	// Err is set when the template does not compile.
+	Err error
+
+	// Unsupported lists the filters, tests, methods and functions that the
+	// template uses but that the template engine does not provide, e.g.
+	// `filter "format"`. Rendering fails if the template reaches them.
+	Unsupported []string
+
+	// Scenarios holds the results of the standard conversations.
+	Scenarios []ScenarioResult
+}
+
+// ScenarioResult is the result of rendering one standard conversation.
+type ScenarioResult struct {
+	// Name is the name of the conversation, e.g. "tool-responses".
+	Name string
+
+	// Prompt is the rendered prompt.
+	Prompt string
+
+	// Err is set when the template fails to render the conversation.
+	Err error
+
+	// Problems describes how the prompt differs from a complete rendering
+	// of the conversation, e.g. a tool response that the template silently
+	// drops.
+	Problems []string
+}
+
+// OK reports whether the template rendered every standard conversation
+// completely, with no unsupported features.
+func (r Report) OK() bool {
+	if r.Err != nil || len(r.Unsupported) > 0 {
+		return false
+	}
+	for _, s := range r.Scenarios {
+		if s.Err != nil || len(s.Problems) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a summary of the report, one line per problem.
+func (r Report) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("template does not compile: %v\n", r.Err)
+	}
+
+	var b strings.Builder
+	for _, u := range r.Unsupported {
+		fmt.Fprintf(&b, "unsupported: %s\n", u)
+	}
+	for _, s := range r.Scenarios {
+		switch {
+		case s.Err != nil:
+			fmt.Fprintf(&b, "%s: error: %v\n", s.Name, s.Err)
+		case len(s.Problems) > 0:
+			fmt.Fprintf(&b, "%s: %s\n", s.Name, strings.Join(s.Problems, "; "))
+		default:
+			fmt.Fprintf(&b, "%s: ok\n", s.Name)
+		}
+	}
+	return b.String()
+}
+
+// scenario is a standard conversation rendered by Check. Expect lists the
+// texts that a complete prompt contains.
+type scenario struct {
+	name                string
+	messages            []message.Message
+	tools               bool
+	addGenerationPrompt bool
+	expect              []string
+}
+
+var checkTool = message.ToolDefinition{
+	Type: "function",
+	Function: message.ToolFunctionDefinition{
+		Name:        "get_weather",
+		Description: "Get the current weather in a city",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"city": map[string]any{"type": "string", "description": "The city name"},
+			},
+			"required": []string{"city"},
+		},
+	},
+}
+
+var checkToolCall = message.Tool{
+	Role: "assistant",
+	ToolCalls: []message.ToolCall{{
+		ID:   "call_1",
+		Type: "function",
+		Function: message.ToolFunction{
+			Name:      "get_weather",
+			Arguments: map[string]string{"city": "Paris"},
+		},
+	}},
+}
+
+var scenarios = []scenario{
+	{
+		name: "system",
+		messages: []message.Message{
+			message.Chat{Role: "system", Content: "You are a helpful assistant."},
+			message.Chat{Role: "user", Content: "Hello!"},
+		},
+		addGenerationPrompt: true,
+		expect:              []string{"You are a helpful assistant.", "Hello!"},
+	},
+	{
+		name: "multi-turn",
+		messages: []message.Message{
+			message.Chat{Role: "user", Content: "What is the capital of France?"},
+			message.Chat{Role: "assistant", Content: "The capital of France is Paris."},
+			message.Chat{Role: "user", Content: "And of Italy?"},
+		},
+		addGenerationPrompt: true,
+		expect:              []string{"What is the capital of France?", "The capital of France is Paris.", "And of Italy?"},
+	},
+	{
+		name: "tool-calls",
+		messages: []message.Message{
+			message.Chat{Role: "user", Content: "What is the weather like in the capital of France?"},
+			checkToolCall,
+		},
+		tools:  true,
+		expect: []string{"Get the current weather in a city", "What is the weather like in the capital of France?", "get_weather", "Paris"},
+	},
+	{
+		name: "tool-responses",
+		messages: []message.Message{
+			message.Chat{Role: "user", Content: "What is the weather like in the capital of France?"},
+			checkToolCall,
+			message.ToolResponse{Role: "tool", Name: "get_weather", Content: "Sunny, 22 degrees", ToolCallID: "call_1"},
+		},
+		tools:               true,
+		addGenerationPrompt: true,
+		expect:              []string{"What is the weather like in the capital of France?", "Sunny, 22 degrees"},
+	},
+	{
+		name: "reasoning",
+		messages: []message.Message{
+			message.Chat{Role: "user", Content: "What is 2 + 2?"},
+			message.Chat{Role: "assistant", Content: "2 + 2 = 4.", Reasoning: "Adding two and two gives four."},
+			message.Chat{Role: "user", Content: "And 3 + 3?"},
+		},
+		addGenerationPrompt: true,
+		expect:              []string{"What is 2 + 2?", "2 + 2 = 4.", "And 3 + 3?"},
+	},
+}
+
+// misrenderings are texts found in broken prompts, with the problem they show.
+var misrenderings = []struct{ text, problem string }{
+	{`{'city': 'Paris'}`, "tool call arguments rendered as a Python dict, the template expects a JSON string"},
+}
+
+// Check renders a set of standard conversations with tmpl: a system prompt,
+// several turns, tool calls, tool responses and reasoning. It reports the
+// conversations that fail to render or that lose content, and the template
+// features that the template engine does not support, so that the chat
+// template of a new model can be vetted before it is deployed.
+//
+// The conversations are rendered with placeholder bos and eos tokens and a
+// fixed date, so that the prompts are reproducible.
+func Check(tmpl string) Report {
+	var r Report
+	t, err := Compile(tmpl)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Unsupported = unsupportedFeatures(tmpl)
+
+	for _, s := range scenarios {
+		opts := checkOptions()
+		if s.tools {
+			opts.Tools = []message.ToolDefinition{checkTool}
+		}
+
+		res := ScenarioResult{Name: s.name}
+		res.Prompt, res.Err = t.RenderWithOptions(s.messages, s.addGenerationPrompt, opts)
+		if res.Err == nil {
+			for _, text := range s.expect {
+				if !strings.Contains(res.Prompt, text) {
+					res.Problems = append(res.Problems, fmt.Sprintf("missing %q", text))
+				}
+			}
+			for _, m := range misrenderings {
+				if strings.Contains(res.Prompt, m.text) {
+					res.Problems = append(res.Problems, m.problem)
+				}
+			}
+		}
+		r.Scenarios = append(r.Scenarios, res)
+	}
+	return r
+}
+
+func checkOptions() Options {
+	opts := DefaultOptions()
+	opts.BOSToken = "<bos>"
+	opts.EOSToken = "<eos>"
+	opts.Now = func() time.Time { return time.Date(2025, time.January, 2, 12, 0, 0, 0, time.UTC) }
+	return opts
+}
+
+var (
+	// tagRE matches the expression and statement tags of a template.
+	tagRE = regexp.MustCompile(`(?s)\{[{%]-?(.*?)-?[%}]\}`)
+
+	// stringRE matches string literals, which are removed from the tags
+	// before looking for features.
+	stringRE = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+
+	filterRE = regexp.MustCompile(`\|\s*([A-Za-z_]\w*)`)
+	testRE   = regexp.MustCompile(`\bis\s+(?:not\s+)?([A-Za-z_]\w*)`)
+	methodRE = regexp.MustCompile(`\.([A-Za-z_]\w*)\s*\(`)
+	callRE   = regexp.MustCompile(`(?:^|[^.\w])([A-Za-z_]\w*)\s*\(`)
+	macroRE  = regexp.MustCompile(`\bmacro\s+([A-Za-z_]\w*)`)
+)
+
+// keywords are the words that can precede a parenthesis in a tag without
+// being a function call.
+var keywords = []string{"and", "or", "not", "in", "is", "if", "elif", "else", "for", "caller", "set", "macro", "call"}
+
+// unsupportedFeatures returns the filters, tests, methods and functions used
+// in the tags of tmpl that the template engine does not provide. Each name
+// is checked by rendering a small template that uses it.
+func unsupportedFeatures(tmpl string) []string {
+	var code strings.Builder
+	for _, m := range tagRE.FindAllStringSubmatch(stripComments(tmpl), -1) {
+		code.WriteString(stringRE.ReplaceAllString(m[1], `""`))
+		// Separate the tags, so that a word at the end of a tag is not
+		// taken for a call by a parenthesis in the next one.
+		code.WriteString(";\n")
+	}
+	src := code.String()
+
+	var macros []string
+	for _, m := range macroRE.FindAllStringSubmatch(src, -1) {
+		macros = append(macros, m[1])
+	}
+
+	var unsupported []string
+	check := func(re *regexp.Regexp, kind string, supported func(name string) bool) {
+		seen := make(map[string]bool)
+		for _, m := range re.FindAllStringSubmatch(src, -1) {
+			name := m[1]
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if !supported(name) {
+				unsupported = append(unsupported, fmt.Sprintf("%s %q", kind, name))
+			}
+		}
+	}
+
+	check(filterRE, "filter", func(name string) bool {
+		return !renderFails(`{{ none | `+name+` }}`, "unknown filter")
+	})
+	check(testRE, "test", func(name string) bool {
+		return !renderFails(`{{ none is `+name+` }}`, "unknown test")
+	})
+	check(methodRE, "method", func(name string) bool {
+		for _, recv := range []string{`""`, `[]`, `{}`} {
+			if !renderFails(`{{ `+recv+`.`+name+`() }}`, "not callable") {
+				return true
+			}
+		}
+		return false
+	})
+	// Filters with arguments look like function calls.
+	src = filterRE.ReplaceAllString(src, "|")
+	check(callRE, "function", func(name string) bool {
+		if slices.Contains(keywords, name) || slices.Contains(macros, name) {
+			return true
+		}
+		t, err := Compile(`{{ ` + name + ` is defined }}`)
+		if err != nil {
+			return false
+		}
+		out, err := t.RenderWithOptions(nil, false, checkOptions())
+		return err == nil && out == "True"
+	})
+
+	return unsupported
+}
+
+// renderFails reports whether rendering src fails with an error containing
+// msg. Templates that do not compile fail with any error.
+func renderFails(src, msg string) bool {
+	t, err := jinja.Compile(src)
+	if err != nil {
+		return true
+	}
+	_, err = t.Render(nil)
+	return err != nil && strings.Contains(err.Error(), msg)
+}
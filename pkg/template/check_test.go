@@ -0,0 +1,143 @@
+package template
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the template corpus")
+
+// corpus returns the paths of the templates checked against golden files:
+// the real model templates in testdata/corpus and the built-in templates.
+func corpus(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob("testdata/corpus/*.jinja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtins, err := fs.Glob(builtinTemplates, "prompts/*.jinja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(paths, builtins...)
+}
+
+// TestCheck_Corpus renders the standard conversations with every corpus
+// template and compares the prompts and the report with the golden files in
+// testdata/golden. Run go test -update to rewrite them after a change, and
+// review the diff.
+func TestCheck_Corpus(t *testing.T) {
+	for _, path := range corpus(t) {
+		name := strings.TrimSuffix(path, ".jinja")
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			tmpl, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := Check(string(tmpl))
+			if r.Err != nil {
+				t.Fatalf("template does not compile: %v", r.Err)
+			}
+
+			dir := filepath.Join("testdata/golden", strings.TrimPrefix(name, "testdata/"))
+			compareGolden(t, filepath.Join(dir, "report.txt"), r.String())
+			for _, s := range r.Scenarios {
+				if s.Err == nil {
+					compareGolden(t, filepath.Join(dir, s.Name+".txt"), s.Prompt)
+				}
+			}
+		})
+	}
+}
+
+func compareGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run go test -update: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestCheck_OK(t *testing.T) {
+	tmpl, _ := BuiltinTemplate("qwen2.5-instruct")
+	r := Check(tmpl)
+	if !r.OK() {
+		t.Errorf("expected qwen2.5-instruct to pass, got:\n%s", r)
+	}
+	if len(r.Scenarios) != len(scenarios) {
+		t.Errorf("expected %d scenarios, got %d", len(scenarios), len(r.Scenarios))
+	}
+}
+
+func TestCheck_CompileError(t *testing.T) {
+	r := Check(`{% for message in messages %}`)
+	if r.Err == nil || r.OK() {
+		t.Fatalf("expected a compile error, got:\n%s", r)
+	}
+	if !strings.HasPrefix(r.String(), "template does not compile") {
+		t.Errorf("unexpected report:\n%s", r)
+	}
+}
+
+func TestCheck_Unsupported(t *testing.T) {
+	tmpl := `{%- macro render(m) %}{{ m.role | upper }}: {{ m.content.rsplit('.', 1)[0] }}{% endmacro %}
+{%- for message in messages %}{{ render(message) }}{{ '%s'|format(message.role) }}{% endfor %}
+{%- if tools is sequence %}{{ unknown_helper(tools) }}{% endif %}`
+
+	r := Check(tmpl)
+	want := []string{`filter "format"`, `method "rsplit"`, `function "unknown_helper"`}
+	if strings.Join(r.Unsupported, ",") != strings.Join(want, ",") {
+		t.Errorf("expected unsupported %v, got %v", want, r.Unsupported)
+	}
+	if r.OK() {
+		t.Error("expected the report not to be OK")
+	}
+}
+
+func TestCheck_Problems(t *testing.T) {
+	// Renders only user and assistant text, like templates without tool
+	// support, and tool arguments as a Python dict.
+	tmpl := `{%- for message in messages %}
+{%- if message.role in ['system', 'user'] or (message.role == 'assistant' and message.content) %}{{ message.role }}: {{ message.content }}
+{% elif message.tool_calls %}{{ message.tool_calls[0].function.name }} {{ '' + message.tool_calls[0].function.arguments }}
+{% endif %}
+{%- endfor %}`
+
+	r := Check(tmpl)
+	got := make(map[string]string)
+	for _, s := range r.Scenarios {
+		if s.Err != nil {
+			t.Fatalf("%s: unexpected error: %v", s.Name, s.Err)
+		}
+		got[s.Name] = strings.Join(s.Problems, "; ")
+	}
+
+	if got["system"] != "" || got["multi-turn"] != "" || got["reasoning"] != "" {
+		t.Errorf("expected no problems with plain conversations, got %v", got)
+	}
+	if !strings.Contains(got["tool-calls"], `missing "Get the current weather in a city"`) ||
+		!strings.Contains(got["tool-calls"], "Python dict") {
+		t.Errorf("expected the tool definitions and arguments to be reported, got %q", got["tool-calls"])
+	}
+	if !strings.Contains(got["tool-responses"], `missing "Sunny, 22 degrees"`) {
+		t.Errorf("expected the tool response to be reported, got %q", got["tool-responses"])
+	}
+}
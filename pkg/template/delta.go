@@ -0,0 +1,72 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+// ErrHistoryRewritten is returned by RenderDelta when the template renders
+// the earlier messages differently once more messages follow them, e.g.
+// because it strips the reasoning of past assistant turns.
+var ErrHistoryRewritten = errors.New("template rewrites earlier messages")
+
+// RenderDelta renders a conversation that grew from prev to next, and
+// returns only the text that next adds: the prompt to tokenize and decode
+// when the KV cache already holds prev, without a BOS token.
+//
+// prev is rendered without the generation prompt, as the model has answered
+// it, and next with it. If the rendering of prev is not a prefix of the
+// rendering of next, RenderDelta returns the whole rendering of next and an
+// error wrapping ErrHistoryRewritten; clear the KV cache and decode it all.
+func RenderDelta(tmpl string, prev, next []message.Message) (string, error) {
+	return RenderDeltaWithOptions(tmpl, prev, next, DefaultOptions())
+}
+
+// RenderDeltaWithOptions is like RenderDelta but accepts an Options struct.
+func RenderDeltaWithOptions(tmpl string, prev, next []message.Message, opts Options) (string, error) {
+	t, err := cachedCompile(tmpl)
+	if err != nil {
+		return "", err
+	}
+	return t.RenderDeltaWithOptions(prev, next, opts)
+}
+
+// RenderDelta renders the text that next adds to prev like RenderDelta.
+func (t *Template) RenderDelta(prev, next []message.Message) (string, error) {
+	return t.RenderDeltaWithOptions(prev, next, DefaultOptions())
+}
+
+// RenderDeltaWithOptions renders the text that next adds to prev like
+// RenderDeltaWithOptions.
+func (t *Template) RenderDeltaWithOptions(prev, next []message.Message, opts Options) (string, error) {
+	nextPrompt, err := t.RenderWithOptions(next, true, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(prev) == 0 {
+		return nextPrompt, nil
+	}
+
+	prevPrompt, err := t.RenderWithOptions(prev, false, opts)
+	if err != nil {
+		return "", err
+	}
+
+	n := commonPrefixLen(prevPrompt, nextPrompt)
+	if n < len(prevPrompt) {
+		return nextPrompt, fmt.Errorf("%w: prompts differ at byte %d", ErrHistoryRewritten, n)
+	}
+	return nextPrompt[n:], nil
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
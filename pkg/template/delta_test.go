@@ -0,0 +1,86 @@
+package template
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+func TestRenderDelta(t *testing.T) {
+	tmpl, _ := BuiltinTemplate("qwen2.5-instruct")
+
+	prev := []message.Message{
+		message.Chat{Role: "system", Content: "You are terse."},
+		message.Chat{Role: "user", Content: "Hi"},
+		message.Chat{Role: "assistant", Content: "Hello."},
+	}
+	next := append(append([]message.Message(nil), prev...), message.Chat{Role: "user", Content: "How are you?"})
+
+	delta, err := RenderDelta(tmpl, prev, next)
+	if err != nil {
+		t.Fatalf("RenderDelta failed: %v", err)
+	}
+	want := "<|im_start|>user\nHow are you?<|im_end|>\n<|im_start|>assistant\n"
+	if delta != want {
+		t.Errorf("expected %q, got %q", want, delta)
+	}
+
+	full, err := Apply(tmpl, next, true)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	prevPrompt, err := Apply(tmpl, prev, false)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if prevPrompt+delta != full {
+		t.Errorf("expected the previous prompt and the delta to make the full prompt")
+	}
+}
+
+func TestRenderDelta_NoPrevious(t *testing.T) {
+	tmpl, _ := BuiltinTemplate("chatml")
+	next := []message.Message{message.Chat{Role: "user", Content: "Hi"}}
+
+	delta, err := RenderDelta(tmpl, nil, next)
+	if err != nil {
+		t.Fatalf("RenderDelta failed: %v", err)
+	}
+	full, _ := Apply(tmpl, next, true)
+	if delta != full {
+		t.Errorf("expected the full prompt %q, got %q", full, delta)
+	}
+}
+
+func TestRenderDelta_HistoryRewritten(t *testing.T) {
+	// Qwen3 keeps the reasoning of the last assistant turn only.
+	src, err := os.ReadFile("testdata/corpus/qwen3.jinja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := Compile(string(src))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	prev := []message.Message{
+		message.Chat{Role: "user", Content: "What is 2 + 2?"},
+		message.Chat{Role: "assistant", Content: "4", Reasoning: "Two plus two is four."},
+	}
+	next := append(append([]message.Message(nil), prev...), message.Chat{Role: "user", Content: "And 3 + 3?"})
+
+	delta, err := tmpl.RenderDelta(prev, next)
+	if !errors.Is(err, ErrHistoryRewritten) {
+		t.Fatalf("expected ErrHistoryRewritten, got %v", err)
+	}
+	full, _ := tmpl.Render(next, true)
+	if delta != full {
+		t.Errorf("expected the full prompt on a rewrite, got %q", delta)
+	}
+	if strings.Contains(delta, "Two plus two is four.") {
+		t.Errorf("expected the past reasoning to be stripped, got %q", delta)
+	}
+}
@@ -3,8 +3,10 @@ package template
 import (
 	"embed"
 	"strings"
+	"time"
 
 	"github.com/ardanlabs/jinja"
+	"github.com/hybridgroup/yzma/pkg/llama"
 	"github.com/hybridgroup/yzma/pkg/message"
 )
 
@@ -12,10 +14,16 @@ import (
 var builtinTemplates embed.FS
 
 // BuiltinTemplate returns the raw Jinja template string for a named built-in
-// template (e.g. "gemma3", "chatml", "qwen2.5-instruct"). The second return
+// template (e.g. "gemma3", "chatml", "qwen2.5-instruct"). The built-in
+// template names of llama.cpp, as returned by llama.ChatBuiltinTemplates, are
+// supported too (e.g. "llama3", "mistral-v7", "deepseek3"). The second return
 // value is false when no built-in with that name exists.
 func BuiltinTemplate(name string) (string, bool) {
-	data, err := builtinTemplates.ReadFile("prompts/" + strings.TrimSuffix(name, ".jinja") + ".jinja")
+	name = strings.TrimSuffix(name, ".jinja")
+	if alias, ok := builtinAliases[name]; ok {
+		name = alias
+	}
+	data, err := builtinTemplates.ReadFile("prompts/" + name + ".jinja")
 	if err != nil {
 		return "", false
 	}
@@ -30,6 +38,36 @@ type Options struct {
 	// directly. Models whose templates do not use this variable ignore it.
 	// Defaults to true (thinking enabled) so existing callers are unaffected.
 	EnableThinking bool
+
+	// OmitReasoning removes the reasoning of the assistant turns before the
+	// last user message from the messages passed to the template, for models
+	// that should not see their previous reasoning again. The reasoning of
+	// the current turn, such as that between tool calls, is kept.
+	OmitReasoning bool
+
+	// MediaMarker is the text that stands for each image or audio part of a
+	// message.MediaMessage. Use mtmd.GetMarker to get the marker of the
+	// projector. Defaults to message.MediaMarker when empty.
+	MediaMarker string
+
+	// Tools are the tools available to the model, passed to the template as
+	// the tools variable. Templates that support tool calling describe them
+	// to the model, so they need not be added to the system prompt by hand.
+	Tools []message.ToolDefinition
+
+	// BOSToken and EOSToken are passed to the template as bos_token and
+	// eos_token. Use SetSpecialTokens to fill them from the model vocabulary.
+	BOSToken string
+	EOSToken string
+
+	// Vars holds extra template variables, e.g. date_string or
+	// reasoning_effort. They take precedence over the variables set by
+	// ApplyWithOptions. Values may be jinja.Value, e.g. a function made
+	// with jinja.NewCallable.
+	Vars map[string]any
+
+	// Now returns the time used by strftime_now. Defaults to time.Now.
+	Now func() time.Time
 }
 
 // DefaultOptions returns Options with all fields set to their defaults.
@@ -39,6 +77,13 @@ func DefaultOptions() Options {
 	}
 }
 
+// SetSpecialTokens sets BOSToken and EOSToken to the text of the
+// beginning and end of sequence tokens of vocab.
+func (o *Options) SetSpecialTokens(vocab llama.Vocab) {
+	o.BOSToken = llama.VocabGetText(vocab, llama.VocabBOS(vocab))
+	o.EOSToken = llama.VocabGetText(vocab, llama.VocabEOS(vocab))
+}
+
 // Apply applies a jinja chat template to a slice of [message.Message].
 // Set addAssistantPrompt to true to generate the assistant prompt.
 // Thinking mode is enabled by default; use ApplyWithOptions to disable it.
@@ -47,27 +92,135 @@ func Apply(tmpl string, messages []message.Message, addAssistantPrompt bool) (st
 }
 
 // ApplyWithOptions is like Apply but accepts an Options struct to control
-// template rendering behaviour such as thinking mode.
+// template rendering behaviour such as thinking mode. Compiled templates are
+// cached, so applying the same template again does not compile it again.
+//
+// Besides the variables set from opts, templates can use the helpers that
+// Hugging Face chat templates expect: raise_exception(message), which fails
+// the rendering with message, strftime_now(format), and the tojson filter,
+// which accepts an indent argument, e.g. {{ tools | tojson(indent=4) }}.
 func ApplyWithOptions(tmpl string, messages []message.Message, addAssistantPrompt bool, opts Options) (string, error) {
-	t, err := jinja.Compile(tmpl)
+	t, err := cachedCompile(tmpl)
 	if err != nil {
 		return "", err
 	}
+	return t.RenderWithOptions(messages, addAssistantPrompt, opts)
+}
+
+// compile compiles a template. Comments are removed first, as the template
+// engine fails on comments that hold quotes, such as "we're".
+func compile(tmpl string) (*jinja.Template, error) {
+	return jinja.Compile(stripComments(tmpl))
+}
 
-	msgs := make([]any, len(messages))
-	for i, m := range messages {
-		msg := map[string]any{
-			"role": m.GetRole(),
+// stripComments removes the {# #} comments of a template, honouring the
+// whitespace control of {#- and -#}.
+func stripComments(tmpl string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(tmpl, "{#")
+		if start < 0 {
+			break
 		}
-		for k, v := range m.GetContent() {
-			msg[k] = v
+		end := strings.Index(tmpl[start+2:], "#}")
+		if end < 0 {
+			break
+		}
+		comment := tmpl[start : start+2+end+2]
+
+		before := tmpl[:start]
+		if strings.HasPrefix(comment, "{#-") {
+			before = strings.TrimRight(before, " \t\r\n")
+		}
+		b.WriteString(before)
+
+		tmpl = tmpl[start+len(comment):]
+		if strings.HasSuffix(comment, "-#}") {
+			tmpl = strings.TrimLeft(tmpl, " \t\r\n")
 		}
-		msgs[i] = msg
 	}
+	b.WriteString(tmpl)
+	return b.String()
+}
 
-	return t.Render(map[string]any{
-		"messages":              msgs,
-		"add_generation_prompt": addAssistantPrompt,
-		"enable_thinking":       opts.EnableThinking,
+// strftimeNow returns the strftime_now template function, which formats the
+// time returned by now with a Python strftime format.
+func strftimeNow(now func() time.Time) jinja.Value {
+	if now == nil {
+		now = time.Now
+	}
+	return jinja.NewCallable("strftime_now", func(args []jinja.Value, _ map[string]jinja.Value) (jinja.Value, error) {
+		format := "%Y-%m-%d"
+		if len(args) > 0 && args[0].IsString() {
+			format = args[0].AsString()
+		}
+		return jinja.NewString(strftime(now(), format)), nil
 	})
 }
+
+// strftime formats t with the Python strftime directives that chat
+// templates use. Other directives are written unchanged.
+func strftime(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case '-':
+			// Unpadded day or month, as in "%-d %B %Y".
+			switch {
+			case strings.HasPrefix(format[i:], "-d"):
+				b.WriteString(t.Format("2"))
+				i++
+			case strings.HasPrefix(format[i:], "-m"):
+				b.WriteString(t.Format("1"))
+				i++
+			default:
+				b.WriteString("%-")
+			}
+		case 'e':
+			b.WriteString(t.Format("_2"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'I':
+			b.WriteString(t.Format("03"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'Z':
+			b.WriteString(t.Format("MST"))
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'j':
+			b.WriteString(t.Format("002"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hybridgroup/yzma/pkg/message"
 )
@@ -382,3 +383,223 @@ func TestGemma3Template_SystemMessageMergedIntoFirstUserTurn(t *testing.T) {
 		t.Error("User content appears before system instruction within the user turn")
 	}
 }
+
+func TestApplyWithOptions_Reasoning(t *testing.T) {
+	tmpl := `{%- for message in messages %}{{ message.role }}:{% if message.reasoning_content %}<think>{{ message.reasoning_content }}</think>{% endif %}{{ message.content }}
+{% endfor %}`
+
+	messages := []message.Message{
+		message.Chat{Role: "user", Content: "Hi"},
+		message.Chat{Role: "assistant", Content: "Hello!", Reasoning: "Greet back."},
+	}
+
+	result, err := Apply(tmpl, messages, false)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !strings.Contains(result, "assistant:<think>Greet back.</think>Hello!") {
+		t.Errorf("expected the reasoning to be rendered, got %q", result)
+	}
+
+	// The reasoning of the current turn, after the last user message, is
+	// kept; that of earlier turns is omitted.
+	opts := DefaultOptions()
+	opts.OmitReasoning = true
+	result, err = ApplyWithOptions(tmpl, messages, false, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if !strings.Contains(result, "assistant:<think>Greet back.</think>Hello!") {
+		t.Errorf("expected the reasoning of the current turn to be kept, got %q", result)
+	}
+
+	messages = append(messages,
+		message.Chat{Role: "user", Content: "Weather in Paris?"},
+		message.Tool{Role: "assistant", Content: "Checking.", Reasoning: "Call the tool.", ToolCalls: []message.ToolCall{
+			{Type: "function", Function: message.ToolFunction{Name: "get_weather", Arguments: map[string]string{"location": "Paris"}}},
+		}},
+		message.ToolResponse{Role: "tool", Name: "get_weather", Content: "sunny"},
+	)
+	result, err = ApplyWithOptions(tmpl, messages, false, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if strings.Contains(result, "Greet back.") || !strings.Contains(result, "assistant:Hello!") {
+		t.Errorf("expected the reasoning of earlier turns to be omitted, got %q", result)
+	}
+	if !strings.Contains(result, "assistant:<think>Call the tool.</think>Checking.") {
+		t.Errorf("expected the reasoning of the current turn to be kept, got %q", result)
+	}
+}
+
+func TestApplyWithOptions_MediaMarker(t *testing.T) {
+	tmpl := `{%- for message in messages %}{{ message.role }}:{{ message.content }}
+{% endfor %}`
+
+	messages := []message.Message{
+		message.Multimodal{Role: "user", Parts: []message.Part{
+			message.TextPart("Compare "),
+			message.ImageFilePart("a.jpg"),
+			message.TextPart(" with "),
+			message.ImageFilePart("b.jpg"),
+		}},
+	}
+
+	result, err := Apply(tmpl, messages, false)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !strings.Contains(result, "user:Compare <__media__> with <__media__>") {
+		t.Errorf("expected the default media marker, got %q", result)
+	}
+
+	opts := DefaultOptions()
+	opts.MediaMarker = "<start_of_image>"
+	result, err = ApplyWithOptions(tmpl, messages, false, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if !strings.Contains(result, "user:Compare <start_of_image> with <start_of_image>") {
+		t.Errorf("expected the projector media marker, got %q", result)
+	}
+}
+
+func TestApplyWithOptions_Tools(t *testing.T) {
+	tmpl, ok := BuiltinTemplate("qwen2.5-instruct")
+	if !ok {
+		t.Fatal("qwen2.5-instruct template not found")
+	}
+
+	messages := []message.Message{
+		message.Chat{Role: "user", Content: "What is the weather in Paris?"},
+	}
+
+	opts := DefaultOptions()
+	opts.Tools = []message.ToolDefinition{{
+		Type: "function",
+		Function: message.ToolFunctionDefinition{
+			Name:        "get_weather",
+			Description: "Get the current weather",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+				"required":   []string{"city"},
+			},
+		},
+	}}
+
+	result, err := ApplyWithOptions(tmpl, messages, true, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if !strings.Contains(result, "<tools>") || !strings.Contains(result, `"name":"get_weather"`) {
+		t.Errorf("expected the tools to be rendered, got %q", result)
+	}
+	if !strings.Contains(result, `"required":["city"]`) {
+		t.Errorf("expected the tool parameters to be rendered, got %q", result)
+	}
+
+	result, err = Apply(tmpl, messages, true)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if strings.Contains(result, "<tools>") {
+		t.Errorf("expected no tools without Options.Tools, got %q", result)
+	}
+}
+
+func TestApplyWithOptions_SpecialTokens(t *testing.T) {
+	tmpl, ok := BuiltinTemplate("chatml")
+	if !ok {
+		t.Fatal("chatml template not found")
+	}
+
+	opts := DefaultOptions()
+	opts.BOSToken = "<s>"
+	result, err := ApplyWithOptions(tmpl, []message.Message{message.Chat{Role: "user", Content: "Hi"}}, true, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(result), "<s>") {
+		t.Errorf("expected the output to start with the bos token, got %q", result)
+	}
+
+	result, err = ApplyWithOptions(`{{ bos_token }}|{{ eos_token }}`, nil, false, Options{BOSToken: "<s>", EOSToken: "</s>"})
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if result != "<s>|</s>" {
+		t.Errorf("expected %q, got %q", "<s>|</s>", result)
+	}
+}
+
+func TestApplyWithOptions_RaiseException(t *testing.T) {
+	tmpl, ok := BuiltinTemplate("chatml")
+	if !ok {
+		t.Fatal("chatml template not found")
+	}
+
+	messages := []message.Message{
+		message.Chat{Role: "user", Content: "Hi"},
+		message.Chat{Role: "user", Content: "Hi again"},
+	}
+
+	_, err := Apply(tmpl, messages, true)
+	if err == nil || !strings.Contains(err.Error(), "Conversation roles must alternate") {
+		t.Errorf("expected the template exception, got %v", err)
+	}
+}
+
+func TestApplyWithOptions_Vars(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Vars = map[string]any{"date_string": "26 Jul 2024", "enable_thinking": "overridden"}
+
+	result, err := ApplyWithOptions(`{{ date_string }} {{ enable_thinking }}`, nil, false, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if result != "26 Jul 2024 overridden" {
+		t.Errorf("expected the extra variables, got %q", result)
+	}
+}
+
+func TestApplyWithOptions_StrftimeNow(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Now = func() time.Time { return time.Date(2024, time.July, 6, 15, 4, 5, 0, time.UTC) }
+
+	result, err := ApplyWithOptions(`{{ strftime_now("%d %b %Y") }}|{{ strftime_now("%-d %B %Y, %H:%M:%S") }}|{{ strftime_now() }}`, nil, false, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if want := "06 Jul 2024|6 July 2024, 15:04:05|2024-07-06"; result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+}
+
+func TestApplyWithOptions_TojsonIndent(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Vars = map[string]any{"args": map[string]any{"city": "Paris"}}
+
+	result, err := ApplyWithOptions(`{{ args | tojson(indent=2) }}`, nil, false, opts)
+	if err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if want := "{\n  \"city\": \"Paris\"\n}"; result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+}
+
+func TestApply_Comments(t *testing.T) {
+	tmpl := `{#- we're removed, with the whitespace before -#}
+{{- messages[0].content }} {# it's a "comment" #}|
+{#- trimmed -#}
+  end`
+
+	result, err := Apply(tmpl, []message.Message{message.Chat{Role: "user", Content: "Hi"}}, false)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result != "Hi |end" {
+		t.Errorf("expected %q, got %q", "Hi |end", result)
+	}
+}
@@ -0,0 +1,165 @@
+package template
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"sync"
+
+	"github.com/ardanlabs/jinja"
+	"github.com/hybridgroup/yzma/pkg/llama"
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+// ErrNoChatTemplate is returned when a model has no chat template.
+var ErrNoChatTemplate = errors.New("model has no chat template")
+
+// Template is a compiled chat template. Compile it once and render it as
+// often as needed; it is safe for concurrent use.
+type Template struct {
+	source string
+	tmpl   *jinja.Template
+}
+
+// Compile compiles a jinja chat template.
+func Compile(source string) (*Template, error) {
+	t, err := compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{source: source, tmpl: t}, nil
+}
+
+// FromModel compiles the default chat template of model, as returned by
+// llama.ModelChatTemplate. It returns ErrNoChatTemplate if the model has none.
+func FromModel(model llama.Model) (*Template, error) {
+	source := llama.ModelChatTemplate(model, "")
+	if source == "" {
+		return nil, ErrNoChatTemplate
+	}
+	return Compile(source)
+}
+
+// Source returns the source of the template.
+func (t *Template) Source() string {
+	return t.source
+}
+
+// Render renders messages like Apply.
+func (t *Template) Render(messages []message.Message, addAssistantPrompt bool) (string, error) {
+	return t.RenderWithOptions(messages, addAssistantPrompt, DefaultOptions())
+}
+
+// RenderWithOptions renders messages like ApplyWithOptions.
+func (t *Template) RenderWithOptions(messages []message.Message, addAssistantPrompt bool, opts Options) (string, error) {
+	// The reasoning of the turn after the last user message is kept, as the
+	// model is still working on it, for example between tool calls.
+	lastUser := -1
+	if opts.OmitReasoning {
+		for i, m := range messages {
+			if m.GetRole() == "user" {
+				lastUser = i
+			}
+		}
+	}
+
+	msgs := make([]any, len(messages))
+	for i, m := range messages {
+		msg := map[string]any{
+			"role": m.GetRole(),
+		}
+		for k, v := range m.GetContent() {
+			msg[k] = v
+		}
+		if mm, ok := m.(message.MediaMessage); ok {
+			marker := opts.MediaMarker
+			if marker == "" {
+				marker = message.MediaMarker
+			}
+			msg["content"] = message.PartsText(mm.GetParts(), marker)
+		}
+		if opts.OmitReasoning && i < lastUser {
+			delete(msg, "reasoning_content")
+			delete(msg, "thinking")
+		}
+		msgs[i] = msg
+	}
+
+	data := map[string]jinja.Value{
+		"messages":              jinja.FromGoValue(msgs),
+		"add_generation_prompt": jinja.NewBool(addAssistantPrompt),
+		"enable_thinking":       jinja.NewBool(opts.EnableThinking),
+		"bos_token":             jinja.NewString(opts.BOSToken),
+		"eos_token":             jinja.NewString(opts.EOSToken),
+		"strftime_now":          strftimeNow(opts.Now),
+	}
+	if len(opts.Tools) > 0 {
+		tools := make([]any, len(opts.Tools))
+		for i, td := range opts.Tools {
+			tools[i] = td.GetContent()
+		}
+		data["tools"] = jinja.FromGoValue(tools)
+	}
+	for k, v := range opts.Vars {
+		if val, ok := v.(jinja.Value); ok {
+			data[k] = val
+			continue
+		}
+		data[k] = jinja.FromGoValue(v)
+	}
+
+	return t.tmpl.RenderValues(data)
+}
+
+// cacheSize is the number of compiled templates kept by cachedCompile.
+const cacheSize = 16
+
+// cache holds the most recently used compiled templates, keyed by the hash
+// of their source.
+var cache = struct {
+	sync.Mutex
+	order   *list.List // of *cacheEntry, most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+}{
+	order:   list.New(),
+	entries: make(map[[sha256.Size]byte]*list.Element),
+}
+
+type cacheEntry struct {
+	key [sha256.Size]byte
+	t   *Template
+}
+
+// cachedCompile returns the compiled template of source from the cache,
+// compiling it and evicting the least recently used template if needed.
+func cachedCompile(source string) (*Template, error) {
+	key := sha256.Sum256([]byte(source))
+
+	cache.Lock()
+	if e, ok := cache.entries[key]; ok {
+		cache.order.MoveToFront(e)
+		cache.Unlock()
+		return e.Value.(*cacheEntry).t, nil
+	}
+	cache.Unlock()
+
+	// Compile without holding the lock; two goroutines may compile the same
+	// template, which is harmless.
+	t, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+	if e, ok := cache.entries[key]; ok {
+		cache.order.MoveToFront(e)
+		return e.Value.(*cacheEntry).t, nil
+	}
+	cache.entries[key] = cache.order.PushFront(&cacheEntry{key: key, t: t})
+	if cache.order.Len() > cacheSize {
+		oldest := cache.order.Remove(cache.order.Back()).(*cacheEntry)
+		delete(cache.entries, oldest.key)
+	}
+	return t, nil
+}
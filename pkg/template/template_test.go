@@ -0,0 +1,110 @@
+package template
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/message"
+)
+
+func TestCompile_Render(t *testing.T) {
+	src, _ := BuiltinTemplate("chatml")
+	tmpl, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if tmpl.Source() != src {
+		t.Error("expected Source to return the template source")
+	}
+
+	messages := []message.Message{message.Chat{Role: "user", Content: "Hello"}}
+	got, err := tmpl.Render(messages, true)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want, err := Apply(src, messages, true)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected Render to match Apply:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestCompile_Error(t *testing.T) {
+	if _, err := Compile(`{% if messages %}`); err == nil {
+		t.Error("expected an error for an unclosed block")
+	}
+	if _, err := Apply(`{% if messages %}`, nil, false); err == nil {
+		t.Error("expected Apply to return the compile error")
+	}
+}
+
+func TestTemplate_ConcurrentRender(t *testing.T) {
+	src, _ := BuiltinTemplate("qwen2.5-instruct")
+	tmpl, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content := fmt.Sprintf("question %d", i)
+			got, err := tmpl.Render([]message.Message{message.Chat{Role: "user", Content: content}}, true)
+			if err != nil {
+				errs <- err
+				return
+			}
+			want := "<|im_start|>user\n" + content + "<|im_end|>\n<|im_start|>assistant\n"
+			if len(got) < len(want) || got[len(got)-len(want):] != want {
+				errs <- fmt.Errorf("unexpected prompt %q", got)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCachedCompile(t *testing.T) {
+	src := `{{ "cached" }}`
+	first, err := cachedCompile(src)
+	if err != nil {
+		t.Fatalf("cachedCompile failed: %v", err)
+	}
+	second, err := cachedCompile(src)
+	if err != nil {
+		t.Fatalf("cachedCompile failed: %v", err)
+	}
+	if first != second {
+		t.Error("expected the cached template to be reused")
+	}
+
+	// Fill the cache with other templates to evict the first one.
+	for i := range cacheSize {
+		if _, err := cachedCompile(fmt.Sprintf(`{{ %d }}`, i)); err != nil {
+			t.Fatalf("cachedCompile failed: %v", err)
+		}
+	}
+	cache.Lock()
+	n := cache.order.Len()
+	cache.Unlock()
+	if n != cacheSize {
+		t.Errorf("expected %d cached templates, got %d", cacheSize, n)
+	}
+
+	third, err := cachedCompile(src)
+	if err != nil {
+		t.Fatalf("cachedCompile failed: %v", err)
+	}
+	if third == first {
+		t.Error("expected the least recently used template to be evicted")
+	}
+}
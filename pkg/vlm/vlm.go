@@ -5,7 +5,9 @@ import (
 	"fmt"
 
 	"github.com/hybridgroup/yzma/pkg/llama"
+	"github.com/hybridgroup/yzma/pkg/message"
 	"github.com/hybridgroup/yzma/pkg/mtmd"
+	"github.com/hybridgroup/yzma/pkg/template"
 )
 
 // VLM is a Vision Language Model (VLM).
@@ -108,6 +110,27 @@ func (m *VLM) ChatTemplate(messages []llama.ChatMessage, add bool) string {
 	return result
 }
 
+// ApplyMessages applies the model's chat template to messages that may hold
+// image and audio parts, such as [message.Multimodal]. It returns the prompt,
+// with the projector's media marker for each part, and the bitmaps for those
+// markers in order, ready for Tokenize. The caller must free the bitmaps with
+// message.FreeBitmaps.
+func (m *VLM) ApplyMessages(messages []message.Message, add bool) (string, []mtmd.Bitmap, error) {
+	opts := template.DefaultOptions()
+	opts.MediaMarker = mtmd.GetMarker(m.ProjectorContext)
+
+	prompt, err := template.ApplyWithOptions(m.template, messages, add, opts)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to apply chat template: %w", err)
+	}
+
+	bitmaps, err := message.Bitmaps(m.ProjectorContext, messages)
+	if err != nil {
+		return "", nil, err
+	}
+	return prompt, bitmaps, nil
+}
+
 // Tokenize tokenizes the input text and image bitmap into output chunks.
 func (m *VLM) Tokenize(input *mtmd.InputText, bitmaps []mtmd.Bitmap, output mtmd.InputChunks) (err error) {
 	if res := mtmd.Tokenize(m.ProjectorContext, output, input, bitmaps); res != 0 {